@@ -0,0 +1,468 @@
+package anthropic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/counter"
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/models"
+	"github.com/gptscript-ai/gptscript/pkg/mvl"
+	"github.com/gptscript-ai/gptscript/pkg/ratelimit"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	DefaultBaseURL   = "https://api.anthropic.com"
+	DefaultMaxTokens = 4096
+	BuiltinCredName  = "sys.anthropic"
+	ModelPrefix      = "claude-"
+	APIVersion       = "2023-06-01"
+	WaitingMessage   = "Waiting for model response..."
+
+	// StructuredOutputsBeta is the beta of the Messages API that enforces the output format of a request.
+	StructuredOutputsBeta = "structured-outputs-2025-11-13"
+)
+
+var (
+	key = os.Getenv("ANTHROPIC_API_KEY")
+	url = os.Getenv("ANTHROPIC_BASE_URL")
+	log = mvl.Package()
+	// tokenizers estimate the tokens of the requests for the rate limits, since Claude's tokenizer is not public.
+	tokenizers = models.NewRegistry(0)
+)
+
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Type       string `json:"type"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("anthropic API error (status %d, type %s): %s", e.StatusCode, e.Type, e.Message)
+}
+
+type Client struct {
+	baseURL      string
+	apiKey       string
+	cache        *cache.Client
+	cacheKeyBase string
+	httpClient   *http.Client
+}
+
+type Options struct {
+	BaseURL  string `usage:"Anthropic base URL" name:"anthropic-base-url" env:"ANTHROPIC_BASE_URL"`
+	APIKey   string `usage:"Anthropic API KEY" name:"anthropic-api-key" env:"ANTHROPIC_API_KEY"`
+	CacheKey string `usage:"-"`
+	Cache    *cache.Client
+}
+
+func Complete(opts ...Options) (result Options) {
+	for _, opt := range opts {
+		result.BaseURL = types.FirstSet(opt.BaseURL, result.BaseURL)
+		result.APIKey = types.FirstSet(opt.APIKey, result.APIKey)
+		result.Cache = types.FirstSet(opt.Cache, result.Cache)
+		result.CacheKey = types.FirstSet(opt.CacheKey, result.CacheKey)
+	}
+
+	return result
+}
+
+func complete(opts ...Options) (Options, error) {
+	var err error
+	result := Complete(opts...)
+	if result.Cache == nil {
+		result.Cache, err = cache.New(cache.Options{
+			DisableCache: true,
+		})
+	}
+
+	if result.BaseURL == "" {
+		result.BaseURL = types.FirstSet(url, DefaultBaseURL)
+	}
+
+	if result.APIKey == "" && key != "" {
+		result.APIKey = key
+	}
+
+	return result, err
+}
+
+// NewClient returns a client for the Anthropic Messages API. The client only serves models when an API key is
+// configured, either through the options, the environment, or a previously saved credential.
+func NewClient(ctx context.Context, credStore credentials.CredentialStore, opts ...Options) (*Client, error) {
+	opt, err := complete(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if opt.APIKey == "" && credStore != nil {
+		cred, exists, err := credStore.Get(ctx, BuiltinCredName)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			opt.APIKey = cred.Env["ANTHROPIC_API_KEY"]
+		}
+	}
+
+	cacheKeyBase := opt.CacheKey
+	if cacheKeyBase == "" {
+		cacheKeyBase = hash.ID(opt.APIKey, opt.BaseURL)
+	}
+
+	return &Client{
+		baseURL:      strings.TrimSuffix(opt.BaseURL, "/"),
+		apiKey:       opt.APIKey,
+		cache:        opt.Cache,
+		cacheKeyBase: cacheKeyBase,
+		httpClient:   http.DefaultClient,
+	}, nil
+}
+
+func (c *Client) ProxyInfo([]string) (string, string, error) {
+	return "", "", errors.New("the anthropic client can not be used as a model provider proxy")
+}
+
+// Enabled returns true if the client has an API key and can serve requests.
+func (c *Client) Enabled() bool {
+	return c.apiKey != ""
+}
+
+// SupportsModel reports whether the model is served by this client, without calling the API. Models from another
+// provider are not.
+func (c *Client) SupportsModel(modelName string) bool {
+	if _, provider := types.SplitToolRef(modelName); provider != "" {
+		return false
+	}
+	return c.Enabled() && strings.HasPrefix(modelName, ModelPrefix)
+}
+
+// ProviderName returns the name of the provider of the models of the client, which is anthropic.
+func (c *Client) ProviderName(string) string {
+	return "anthropic"
+}
+
+func (c *Client) Supports(_ context.Context, modelName string) (bool, error) {
+	return c.SupportsModel(modelName), nil
+}
+
+func (c *Client) ListModels(ctx context.Context, providers ...string) ([]openai.Model, error) {
+	// Only serve if providers is empty or "" is in the list
+	if len(providers) != 0 && !slices.Contains(providers, "") {
+		return nil, nil
+	}
+
+	if !c.Enabled() {
+		return nil, nil
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, "/v1/models?limit=1000", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, toAPIError(resp)
+	}
+
+	var models struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+		return nil, fmt.Errorf("failed to decode anthropic models: %w", err)
+	}
+
+	var result []openai.Model
+	for _, model := range models.Data {
+		result = append(result, openai.Model{
+			ID:      model.ID,
+			Object:  "model",
+			OwnedBy: "anthropic",
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+func (c *Client) cacheKey(request MessagesRequest) any {
+	return map[string]any{
+		"base":    c.cacheKeyBase,
+		"request": request,
+	}
+}
+
+func (c *Client) fromCache(ctx context.Context, messageRequest types.CompletionRequest, request MessagesRequest) (result types.CompletionMessage, _ bool, _ error) {
+	if !messageRequest.GetCache() {
+		return types.CompletionMessage{}, false, nil
+	}
+	found, err := c.cache.Get(ctx, c.cacheKey(request), &result)
+	if err != nil {
+		return types.CompletionMessage{}, false, err
+	} else if !found {
+		return types.CompletionMessage{}, false, nil
+	}
+	return result, true, nil
+}
+
+func (c *Client) Call(ctx context.Context, messageRequest types.CompletionRequest, env []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	if !c.Enabled() {
+		return nil, errors.New("ANTHROPIC_API_KEY is not set. Please set the ANTHROPIC_API_KEY environment variable")
+	}
+
+	request := toRequest(messageRequest)
+	request.Stream = true
+	if len(request.Messages) == 0 {
+		log.Errorf("invalid request, no messages to send to LLM")
+		return &types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeAssistant,
+			Content: types.Text(""),
+		}, nil
+	}
+
+	toolMapping := map[string]string{}
+	for _, tool := range messageRequest.Tools {
+		if tool.Function.ToolID != "" {
+			toolMapping[tool.Function.Name] = tool.Function.ToolID
+		}
+	}
+
+	id := counter.Next()
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Request: map[string]any{
+			"messages":    request,
+			"toolMapping": toolMapping,
+		},
+	}
+
+	var cacheResponse bool
+	result, ok, err := c.fromCache(ctx, messageRequest, request)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		result, err = c.call(ctx, request, id, env, status)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		cacheResponse = true
+	}
+
+	if result.Role == "" {
+		result.Role = types.CompletionMessageRoleTypeAssistant
+	}
+
+	if cacheResponse {
+		result.Usage = types.Usage{}
+	}
+
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Response:     result,
+		Usage:        result.Usage,
+		Cached:       cacheResponse,
+	}
+
+	return &result, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("anthropic-version", APIVersion)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func (c *Client) call(ctx context.Context, request MessagesRequest, transactionID string, env []string, partial chan<- types.CompletionStatus) (result types.CompletionMessage, err error) {
+	partial <- types.CompletionStatus{
+		CompletionID: transactionID,
+		PartialResponse: &types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeAssistant,
+			Content: types.Text(WaitingMessage),
+		},
+	}
+
+	retries := 5
+	for _, e := range env {
+		if strings.HasPrefix(e, "GPTSCRIPT_DISABLE_RETRIES") {
+			retries = 0
+		}
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return types.CompletionMessage{}, err
+	}
+
+	release, err := ratelimit.Acquire(ctx, countRequest(request.Model, body), func(queue types.Queue) {
+		partial <- types.CompletionStatus{
+			CompletionID: transactionID,
+			Queue:        &queue,
+		}
+	})
+	if err != nil {
+		return types.CompletionMessage{}, err
+	}
+	defer func() {
+		release(result.Usage)
+	}()
+
+	slog.Debug("calling anthropic", "message", request.Messages)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	engineCtx, ok := engine.FromContext(ctx)
+	if ok {
+		engineCtx.OnUserCancel(ctx, cancel)
+	}
+
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		req, err := c.newRequest(ctx, http.MethodPost, "/v1/messages", body)
+		if err != nil {
+			return types.CompletionMessage{}, err
+		}
+		if request.OutputFormat != nil {
+			req.Header.Set("anthropic-beta", StructuredOutputsBeta)
+		}
+
+		resp, err = c.httpClient.Do(req)
+		if errors.Is(err, context.Canceled) {
+			return types.CompletionMessage{
+				Content: types.Text("User aborted the chat before model could respond"),
+				Role:    types.CompletionMessageRoleTypeAssistant,
+			}, nil
+		} else if err != nil {
+			return types.CompletionMessage{}, err
+		}
+
+		if resp.StatusCode == http.StatusOK {
+			break
+		}
+
+		apiErr := toAPIError(resp)
+		_ = resp.Body.Close()
+
+		// Retry on 5xx errors, which includes 529 Overloaded, and 429 Too Many Requests (ratelimit)
+		if attempt >= retries || (resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests) {
+			return types.CompletionMessage{}, apiErr
+		}
+
+		select {
+		case <-ctx.Done():
+			return types.CompletionMessage{}, ctx.Err()
+		case <-time.After(time.Duration(1<<attempt) * time.Second):
+		}
+	}
+	defer resp.Body.Close()
+
+	var (
+		stream         = newStream()
+		partialMessage types.CompletionMessage
+		start          = time.Now()
+		scanner        = bufio.NewScanner(resp.Body)
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		done, err := stream.add([]byte(strings.TrimSpace(data)))
+		if err != nil {
+			return types.CompletionMessage{}, err
+		}
+
+		partialMessage = stream.message()
+		if done {
+			break
+		}
+
+		if partial != nil && time.Since(start) > 100*time.Millisecond {
+			partial <- types.CompletionStatus{
+				CompletionID:    transactionID,
+				PartialResponse: &partialMessage,
+			}
+			start = time.Now()
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, context.Canceled) {
+		return types.CompletionMessage{}, err
+	}
+
+	if len(partialMessage.Content) == 0 && ctx.Err() != nil {
+		// Place a text holder if the user cancels the stream before the LLM produces any response.
+		partialMessage.Content = types.Text("User aborted the chat or chat finished before LLM can respond")
+	}
+
+	// The cache won't save the response if the context was canceled.
+	return partialMessage, c.cache.Store(ctx, cache.KindLLM, c.cacheKey(request), partialMessage)
+}
+
+// countRequest estimates the prompt tokens of a request from its body, which are counted against the tokens per minute
+// of the rate limits of Anthropic until the usage of the response is known.
+func countRequest(model string, body []byte) int {
+	tokenizer, err := tokenizers.Tokenizer(model)
+	if err != nil {
+		return 0
+	}
+	return tokenizer.Count(string(body))
+}
+
+func toAPIError(resp *http.Response) error {
+	data, _ := io.ReadAll(resp.Body)
+
+	var errResp struct {
+		Error APIError `json:"error"`
+	}
+	if err := json.Unmarshal(data, &errResp); err != nil || errResp.Error.Message == "" {
+		errResp.Error = APIError{
+			Type:    http.StatusText(resp.StatusCode),
+			Message: strings.TrimSpace(string(data)),
+		}
+	}
+	errResp.Error.StatusCode = resp.StatusCode
+	return &errResp.Error
+}
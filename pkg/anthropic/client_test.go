@@ -0,0 +1,377 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextToContent(t *testing.T) {
+	autogold.Expect([]ContentBlock{{
+		Type: "text",
+		Text: "hi\ndata:image/png;base64,xxxxx\n",
+	}}).Equal(t, textToContent("hi\ndata:image/png;base64,xxxxx\n"))
+
+	autogold.Expect([]ContentBlock{
+		{
+			Type: "text",
+			Text: "hi",
+		},
+		{
+			Type: "image",
+			Source: &ImageSource{
+				Type:      "base64",
+				MediaType: "image/jpeg",
+				Data:      "xxxxx",
+			},
+		},
+	}).Equal(t, textToContent("hi\ndata:image/jpeg;base64,xxxxx"))
+}
+
+func TestToRequest(t *testing.T) {
+	index := 0
+	request := toRequest(types.CompletionRequest{
+		Model:                "claude-test",
+		InternalSystemPrompt: new(bool),
+		Messages: []types.CompletionMessage{
+			{
+				Role:    types.CompletionMessageRoleTypeSystem,
+				Content: types.Text("be nice"),
+			},
+			{
+				Role:    types.CompletionMessageRoleTypeUser,
+				Content: types.Text("hi"),
+			},
+			{
+				Role: types.CompletionMessageRoleTypeAssistant,
+				Content: []types.ContentPart{
+					{
+						ToolCall: &types.CompletionToolCall{
+							Index: &index,
+							ID:    "toolu_1",
+							Function: types.CompletionFunctionCall{
+								Name:      "one",
+								Arguments: `{"a":"b"}`,
+							},
+						},
+					},
+					{
+						ToolCall: &types.CompletionToolCall{
+							ID: "toolu_2",
+							Function: types.CompletionFunctionCall{
+								Name: "two",
+							},
+						},
+					},
+				},
+			},
+			{
+				Role:    types.CompletionMessageRoleTypeTool,
+				Content: types.Text("result one"),
+				ToolCall: &types.CompletionToolCall{
+					ID: "toolu_1",
+				},
+			},
+			{
+				Role:    types.CompletionMessageRoleTypeTool,
+				Content: types.Text("result two"),
+				ToolCall: &types.CompletionToolCall{
+					ID: "toolu_2",
+				},
+			},
+		},
+	})
+
+	data, err := json.MarshalIndent(request, "", "  ")
+	require.NoError(t, err)
+	autogold.Expect(`{
+  "model": "claude-test",
+  "max_tokens": 4096,
+  "system": "be nice",
+  "messages": [
+    {
+      "role": "user",
+      "content": [
+        {
+          "type": "text",
+          "text": "hi"
+        }
+      ]
+    },
+    {
+      "role": "assistant",
+      "content": [
+        {
+          "type": "tool_use",
+          "id": "toolu_1",
+          "name": "one",
+          "input": {
+            "a": "b"
+          }
+        },
+        {
+          "type": "tool_use",
+          "id": "toolu_2",
+          "name": "two",
+          "input": {}
+        }
+      ]
+    },
+    {
+      "role": "user",
+      "content": [
+        {
+          "type": "tool_result",
+          "tool_use_id": "toolu_1",
+          "content": [
+            {
+              "type": "text",
+              "text": "result one"
+            }
+          ]
+        },
+        {
+          "type": "tool_result",
+          "tool_use_id": "toolu_2",
+          "content": [
+            {
+              "type": "text",
+              "text": "result two"
+            }
+          ]
+        }
+      ]
+    }
+  ],
+  "temperature": 0
+}`).Equal(t, string(data))
+}
+
+const streamResponse = `event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":10,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me "}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"check."}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: ping
+data: {"type":"ping"}
+
+event: content_block_start
+data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"lookup","input":{}}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"x\"}"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":1}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":25}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	s := httptest.NewServer(handler)
+	t.Cleanup(s.Close)
+
+	c, err := NewClient(context.Background(), nil, Options{
+		BaseURL: s.URL,
+		APIKey:  "test-key",
+	})
+	require.NoError(t, err)
+	return c
+}
+
+func drain(status chan types.CompletionStatus) {
+	for range status {
+	}
+}
+
+func TestToRequestEmptySystemMessage(t *testing.T) {
+	request := toRequest(types.CompletionRequest{
+		Model:                "claude-test",
+		InternalSystemPrompt: new(bool),
+		Messages: []types.CompletionMessage{
+			{Role: types.CompletionMessageRoleTypeSystem},
+			{Role: types.CompletionMessageRoleTypeSystem, Content: types.Text("be nice")},
+			{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("hi")},
+		},
+	})
+	require.Equal(t, "be nice", request.System)
+	require.Len(t, request.Messages, 1)
+}
+
+func TestCall(t *testing.T) {
+	var request MessagesRequest
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/messages", r.URL.Path)
+		require.Equal(t, "test-key", r.Header.Get("x-api-key"))
+		require.Equal(t, APIVersion, r.Header.Get("anthropic-version"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, streamResponse)
+	})
+
+	status := make(chan types.CompletionStatus)
+	go drain(status)
+	defer close(status)
+
+	resp, err := c.Call(context.Background(), types.CompletionRequest{
+		Model: "claude-test",
+		Messages: []types.CompletionMessage{
+			{
+				Role:    types.CompletionMessageRoleTypeUser,
+				Content: types.Text("look up x\ndata:image/png;base64,xxxxx"),
+			},
+		},
+		Tools: []types.ChatCompletionTool{
+			{
+				Function: types.CompletionFunctionDefinition{
+					Name:        "lookup",
+					Description: "Look things up",
+				},
+			},
+		},
+	}, nil, status)
+	require.NoError(t, err)
+
+	require.True(t, request.Stream)
+	require.Len(t, request.Tools, 1)
+	require.Equal(t, "lookup", request.Tools[0].Name)
+	require.Len(t, request.Messages, 1)
+	require.Len(t, request.Messages[0].Content, 2)
+	require.Equal(t, "image", request.Messages[0].Content[1].Type)
+
+	index := 0
+	autogold.Expect(&types.CompletionMessage{
+		Role: types.CompletionMessageRoleType("assistant"),
+		Content: []types.ContentPart{
+			{Text: "Let me check."},
+			{ToolCall: &types.CompletionToolCall{
+				Index: &index,
+				ID:    "toolu_1",
+				Function: types.CompletionFunctionCall{
+					Name:      "lookup",
+					Arguments: `{"q":"x"}`,
+				},
+			}},
+		},
+		Usage: types.Usage{
+			PromptTokens:     10,
+			CompletionTokens: 25,
+			TotalTokens:      35,
+		},
+	}).Equal(t, resp)
+}
+
+func TestCallOutputSchema(t *testing.T) {
+	var body map[string]any
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, StructuredOutputsBeta, r.Header.Get("anthropic-beta"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, streamResponse)
+	})
+
+	status := make(chan types.CompletionStatus)
+	go drain(status)
+	defer close(status)
+
+	schema := types.ObjectSchema("city", "The city")
+	_, err := c.Call(context.Background(), types.CompletionRequest{
+		Model:        "claude-test",
+		JSONResponse: true,
+		OutputSchema: schema,
+		Messages:     []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("hi")}},
+	}, nil, status)
+	require.NoError(t, err)
+
+	autogold.Expect(map[string]any{
+		"schema": map[string]any{
+			"additionalProperties": false,
+			"properties": map[string]any{"city": map[string]any{
+				"description": "The city",
+				"type":        []any{"string", "null"},
+			}},
+			"required": []any{"city"},
+			"type":     "object",
+		},
+		"type": "json_schema",
+	}).Equal(t, body["output_format"])
+	require.NotContains(t, body["system"], jsonResponsePrompt)
+}
+
+func TestCallError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, `{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long"}}`)
+	})
+
+	status := make(chan types.CompletionStatus)
+	go drain(status)
+	defer close(status)
+
+	_, err := c.Call(context.Background(), types.CompletionRequest{
+		Model:    "claude-test",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("hi")}},
+	}, nil, status)
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	require.Equal(t, "invalid_request_error", apiErr.Type)
+	require.Equal(t, "prompt is too long", apiErr.Message)
+}
+
+func TestSupports(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/models", r.URL.Path)
+		_, _ = fmt.Fprint(w, `{"data":[{"id":"claude-b"},{"id":"claude-a"}]}`)
+	})
+
+	ok, err := c.Supports(context.Background(), "claude-a")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = c.Supports(context.Background(), "gpt-4o")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	models, err := c.ListModels(context.Background())
+	require.NoError(t, err)
+	require.Len(t, models, 2)
+	require.Equal(t, "claude-a", models[0].ID)
+
+	disabled, err := NewClient(context.Background(), nil, Options{BaseURL: "http://localhost"})
+	require.NoError(t, err)
+	if key == "" {
+		require.False(t, disabled.SupportsModel("claude-a"))
+	}
+}
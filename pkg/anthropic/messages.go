@@ -0,0 +1,254 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/gptscript-ai/gptscript/pkg/system"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	roleUser      = "user"
+	roleAssistant = "assistant"
+
+	blockTypeText       = "text"
+	blockTypeImage      = "image"
+	blockTypeToolUse    = "tool_use"
+	blockTypeToolResult = "tool_result"
+
+	jsonResponsePrompt = "Respond only with a valid JSON object and no other text."
+
+	outputFormatTypeJSONSchema = "json_schema"
+)
+
+type MessagesRequest struct {
+	Model        string        `json:"model"`
+	MaxTokens    int           `json:"max_tokens"`
+	System       string        `json:"system,omitempty"`
+	Messages     []Message     `json:"messages"`
+	Tools        []Tool        `json:"tools,omitempty"`
+	Temperature  *float32      `json:"temperature,omitempty"`
+	Stream       bool          `json:"stream,omitempty"`
+	OutputFormat *OutputFormat `json:"output_format,omitempty"`
+}
+
+// OutputFormat constrains the text of the response to JSON that matches a schema.
+type OutputFormat struct {
+	Type   string             `json:"type"`
+	Schema *jsonschema.Schema `json:"schema"`
+}
+
+type Message struct {
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
+}
+
+type ContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Source    *ImageSource    `json:"source,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   []ContentBlock  `json:"content,omitempty"`
+}
+
+type ImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+type Usage struct {
+	InputTokens              int `json:"input_tokens,omitempty"`
+	OutputTokens             int `json:"output_tokens,omitempty"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+func toRequest(request types.CompletionRequest) MessagesRequest {
+	var (
+		systemPrompts []string
+		result        = MessagesRequest{
+			Model:       request.Model,
+			MaxTokens:   request.MaxTokens,
+			Temperature: request.Temperature,
+		}
+	)
+
+	if request.InternalSystemPrompt == nil || *request.InternalSystemPrompt {
+		systemPrompts = append(systemPrompts, system.InternalSystemPrompt)
+	}
+
+	for _, message := range request.Messages {
+		if message.Role == types.CompletionMessageRoleTypeSystem {
+			if text := message.String(); text != "" {
+				systemPrompts = append(systemPrompts, text)
+			}
+			continue
+		}
+
+		msg := toMessage(message, request.Chat)
+		if len(msg.Content) == 0 {
+			continue
+		}
+
+		// The Messages API expects the roles to alternate, so consecutive messages of the same role, such as the
+		// results of parallel tool calls, are sent as one message.
+		if last := len(result.Messages) - 1; last >= 0 && result.Messages[last].Role == msg.Role {
+			result.Messages[last].Content = append(result.Messages[last].Content, msg.Content...)
+		} else {
+			result.Messages = append(result.Messages, msg)
+		}
+	}
+
+	if request.OutputSchema != nil {
+		result.OutputFormat = &OutputFormat{
+			Type:   outputFormatTypeJSONSchema,
+			Schema: types.StrictSchema(request.OutputSchema),
+		}
+	} else if request.JSONResponse {
+		systemPrompts = append(systemPrompts, jsonResponsePrompt)
+	}
+	result.System = strings.Join(systemPrompts, "\n")
+
+	if result.MaxTokens == 0 {
+		result.MaxTokens = DefaultMaxTokens
+	}
+	if result.Temperature == nil {
+		result.Temperature = new(float32)
+	}
+
+	for _, tool := range request.Tools {
+		var params any = tool.Function.Parameters
+		if tool.Function.Parameters == nil || len(tool.Function.Parameters.Properties) == 0 {
+			params = map[string]any{
+				"type":       "object",
+				"properties": map[string]any{},
+			}
+		}
+
+		result.Tools = append(result.Tools, Tool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: params,
+		})
+	}
+
+	return result
+}
+
+func toMessage(message types.CompletionMessage, chat bool) Message {
+	if message.Role == types.CompletionMessageRoleTypeTool && message.ToolCall != nil {
+		var content []ContentBlock
+		for _, part := range message.Content {
+			content = append(content, textToContent(part.Text)...)
+		}
+		return Message{
+			Role: roleUser,
+			Content: []ContentBlock{
+				{
+					Type:      blockTypeToolResult,
+					ToolUseID: message.ToolCall.ID,
+					Content:   content,
+				},
+			},
+		}
+	}
+
+	result := Message{
+		Role: roleUser,
+	}
+	if message.Role == types.CompletionMessageRoleTypeAssistant {
+		result.Role = roleAssistant
+	}
+
+	for _, part := range message.Content {
+		if part.ToolCall != nil {
+			result.Content = append(result.Content, ContentBlock{
+				Type:  blockTypeToolUse,
+				ID:    part.ToolCall.ID,
+				Name:  part.ToolCall.Function.Name,
+				Input: toInput(part.ToolCall.Function.Arguments),
+			})
+		}
+		if part.Text == "" {
+			continue
+		}
+		if !chat && strings.TrimSpace(part.Text) == "{}" {
+			continue
+		}
+
+		text := part.Text
+		if prompt, ok := system.IsDefaultPrompt(text); ok {
+			text = prompt
+		}
+		result.Content = append(result.Content, textToContent(text)...)
+	}
+
+	return result
+}
+
+// toInput converts the arguments of a tool call to the JSON object the Messages API expects.
+func toInput(arguments string) json.RawMessage {
+	if strings.TrimSpace(arguments) == "" {
+		return json.RawMessage("{}")
+	}
+	if json.Valid([]byte(arguments)) && strings.HasPrefix(strings.TrimSpace(arguments), "{") {
+		return json.RawMessage(arguments)
+	}
+	data, _ := json.Marshal(map[string]string{
+		"input": arguments,
+	})
+	return data
+}
+
+// textToContent splits trailing data URL lines of images from the text, the same as the OpenAI client does.
+func textToContent(text string) []ContentBlock {
+	var blocks []ContentBlock
+	parts := strings.Split(text, "\n")
+	for i := len(parts) - 1; i >= 0; i-- {
+		source, ok := toImageSource(parts[i])
+		if !ok {
+			break
+		}
+		blocks = append(blocks, ContentBlock{
+			Type:   blockTypeImage,
+			Source: source,
+		})
+		parts = parts[:i]
+	}
+	if len(parts) > 0 {
+		if text := strings.Join(parts, "\n"); text != "" {
+			blocks = append(blocks, ContentBlock{
+				Type: blockTypeText,
+				Text: text,
+			})
+		}
+	}
+
+	slices.Reverse(blocks)
+	return blocks
+}
+
+func toImageSource(line string) (*ImageSource, bool) {
+	mediaType, data, ok := strings.Cut(strings.TrimPrefix(line, "data:"), ";base64,")
+	if !ok || !strings.HasPrefix(line, "data:image/") {
+		return nil, false
+	}
+	return &ImageSource{
+		Type:      "base64",
+		MediaType: mediaType,
+		Data:      data,
+	}, true
+}
@@ -0,0 +1,140 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+type streamEvent struct {
+	Type         string        `json:"type"`
+	Index        int           `json:"index"`
+	Message      *streamStart  `json:"message,omitempty"`
+	ContentBlock *ContentBlock `json:"content_block,omitempty"`
+	Delta        *streamDelta  `json:"delta,omitempty"`
+	Usage        *Usage        `json:"usage,omitempty"`
+	Error        *APIError     `json:"error,omitempty"`
+}
+
+type streamStart struct {
+	ID    string `json:"id"`
+	Usage Usage  `json:"usage"`
+}
+
+type streamDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	PartialJSON string `json:"partial_json"`
+	StopReason  string `json:"stop_reason"`
+}
+
+// stream accumulates the server-sent events of a streaming Messages API response into a CompletionMessage.
+type stream struct {
+	usage  Usage
+	blocks map[int]*types.ContentPart
+	order  []int
+	tools  int
+}
+
+func newStream() *stream {
+	return &stream{
+		blocks: map[int]*types.ContentPart{},
+	}
+}
+
+// add applies one event to the stream and returns true once the message is complete.
+func (s *stream) add(data []byte) (bool, error) {
+	var event streamEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return false, fmt.Errorf("failed to decode anthropic stream event: %w", err)
+	}
+
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			s.usage = event.Message.Usage
+		}
+	case "content_block_start":
+		if event.ContentBlock == nil {
+			return false, nil
+		}
+		part := &types.ContentPart{}
+		switch event.ContentBlock.Type {
+		case blockTypeToolUse:
+			part.ToolCall = &types.CompletionToolCall{
+				Index: ptr(s.tools),
+				ID:    event.ContentBlock.ID,
+				Function: types.CompletionFunctionCall{
+					Name: event.ContentBlock.Name,
+				},
+			}
+			s.tools++
+		case blockTypeText:
+			part.Text = event.ContentBlock.Text
+		default:
+			// Thinking and other block types are not part of the response.
+			return false, nil
+		}
+		s.blocks[event.Index] = part
+		s.order = append(s.order, event.Index)
+	case "content_block_delta":
+		part, ok := s.blocks[event.Index]
+		if !ok || event.Delta == nil {
+			return false, nil
+		}
+		switch event.Delta.Type {
+		case "text_delta":
+			part.Text += event.Delta.Text
+		case "input_json_delta":
+			if part.ToolCall != nil {
+				part.ToolCall.Function.Arguments += event.Delta.PartialJSON
+			}
+		}
+	case "message_delta":
+		if event.Usage != nil {
+			s.usage.OutputTokens = event.Usage.OutputTokens
+		}
+	case "message_stop":
+		return true, nil
+	case "error":
+		if event.Error != nil {
+			return false, event.Error
+		}
+		return false, fmt.Errorf("anthropic stream error: %s", strings.TrimSpace(string(data)))
+	}
+
+	return false, nil
+}
+
+func (s *stream) message() types.CompletionMessage {
+	msg := types.CompletionMessage{
+		Role: types.CompletionMessageRoleTypeAssistant,
+		Usage: types.Usage{
+			PromptTokens:     s.usage.InputTokens + s.usage.CacheCreationInputTokens + s.usage.CacheReadInputTokens,
+			CompletionTokens: s.usage.OutputTokens,
+		},
+	}
+	msg.Usage.TotalTokens = msg.Usage.PromptTokens + msg.Usage.CompletionTokens
+
+	for _, i := range s.order {
+		part := *s.blocks[i]
+		if part.ToolCall != nil {
+			toolCall := *part.ToolCall
+			if toolCall.Function.Arguments == "" {
+				toolCall.Function.Arguments = "{}"
+			}
+			part.ToolCall = &toolCall
+		} else if part.Text == "" {
+			continue
+		}
+		msg.Content = append(msg.Content, part)
+	}
+
+	return msg
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
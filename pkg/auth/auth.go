@@ -2,6 +2,7 @@ package auth
 
 import (
 	"fmt"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -13,6 +14,23 @@ import (
 )
 
 func Authorize(ctx engine.Context, input string) (runner.AuthorizerResponse, error) {
+	return authorize(ctx, input, false)
+}
+
+// AuthorizeRemember is Authorize with the additional choices to always or never allow the tool, for use with a
+// PolicyAuthorizer that remembers the decision.
+func AuthorizeRemember(ctx engine.Context, input string) (runner.AuthorizerResponse, error) {
+	return authorize(ctx, input, true)
+}
+
+const (
+	choiceYes    = "Yes"
+	choiceNo     = "No"
+	choiceAlways = "Always allow this tool"
+	choiceNever  = "Never allow this tool"
+)
+
+func authorize(ctx engine.Context, input string, remember bool) (runner.AuthorizerResponse, error) {
 	defer context.GetPauseFuncFromCtx(ctx.Ctx)()()
 
 	if IsSafe(ctx) {
@@ -21,20 +39,39 @@ func Authorize(ctx engine.Context, input string) (runner.AuthorizerResponse, err
 		}, nil
 	}
 
-	var result bool
+	var (
+		help   = fmt.Sprintf("The full source of the tools is as follows:\n\n%s", ctx.Tool.Print())
+		result = runner.AuthorizerResponse{
+			Message: "Request denied, blocking execution.",
+		}
+	)
+
+	if remember {
+		var choice string
+		err := survey.AskOne(&survey.Select{
+			Help:    help,
+			Default: choiceYes,
+			Message: ConfirmMessage(ctx, input),
+			Options: []string{choiceYes, choiceNo, choiceAlways, choiceNever},
+		}, &choice)
+		if err != nil {
+			return runner.AuthorizerResponse{}, err
+		}
+		result.Accept = choice == choiceYes || choice == choiceAlways
+		result.Remember = choice == choiceAlways || choice == choiceNever
+		return result, nil
+	}
+
 	err := survey.AskOne(&survey.Confirm{
-		Help:    fmt.Sprintf("The full source of the tools is as follows:\n\n%s", ctx.Tool.Print()),
+		Help:    help,
 		Default: true,
 		Message: ConfirmMessage(ctx, input),
-	}, &result)
+	}, &result.Accept)
 	if err != nil {
 		return runner.AuthorizerResponse{}, err
 	}
 
-	return runner.AuthorizerResponse{
-		Accept:  result,
-		Message: "Request denied, blocking execution.",
-	}, nil
+	return result, nil
 }
 
 func IsSafe(ctx engine.Context) bool {
@@ -47,10 +84,34 @@ func IsSafe(ctx engine.Context) bool {
 }
 
 func ConfirmMessage(ctx engine.Context, input string) string {
-	var (
-		loc         = ctx.Tool.Source.Location
-		interpreter = strings.Split(ctx.Tool.Instructions, "\n")[0][2:]
-	)
+	return fmt.Sprintf(`Description: %s
+  Interpreter: %s
+  Source: %s
+  Input: %s
+Allow the above tool to execute?`, ctx.Tool.Description, interpreter(ctx), toolSource(ctx), strings.TrimSpace(input))
+}
+
+func interpreter(ctx engine.Context) string {
+	return strings.Split(ctx.Tool.Instructions, "\n")[0][2:]
+}
+
+// interpreterName returns the program of the interpreter without its path or arguments, skipping /usr/bin/env.
+func interpreterName(ctx engine.Context) string {
+	if !ctx.Tool.IsCommand() {
+		return ""
+	}
+	fields := strings.Fields(interpreter(ctx))
+	if len(fields) > 1 && path.Base(fields[0]) == "env" {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return path.Base(fields[0])
+}
+
+func toolSource(ctx engine.Context) string {
+	loc := ctx.Tool.Source.Location
 
 	if ctx.Tool.Source.Repo != nil {
 		loc = ctx.Tool.Source.Repo.Root
@@ -63,9 +124,5 @@ func ConfirmMessage(ctx engine.Context, input string) string {
 		loc = "Builtin"
 	}
 
-	return fmt.Sprintf(`Description: %s
-  Interpreter: %s
-  Source: %s
-  Input: %s
-Allow the above tool to execute?`, ctx.Tool.Description, interpreter, loc, strings.TrimSpace(input))
+	return loc
 }
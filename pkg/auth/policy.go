@@ -0,0 +1,392 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/mvl"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"sigs.k8s.io/yaml"
+)
+
+var log = mvl.Package()
+
+type Action string
+
+const (
+	ActionAllow Action = "allow"
+	ActionDeny  Action = "deny"
+	ActionAsk   Action = "ask"
+)
+
+// Policy decides which tool calls are allowed. The first rule that matches a call decides it. Calls that no rule
+// matches are decided by the default action, except for the tools that are always safe to run.
+type Policy struct {
+	Default Action `json:"default,omitempty"`
+	Rules   []Rule `json:"rules,omitempty"`
+}
+
+// Rule matches a tool call if all the fields that are set match. The fields are glob patterns where "*" matches
+// anything but "/" and "**" matches anything.
+type Rule struct {
+	Action Action `json:"action"`
+	// Tool matches the name of the tool, or the name of the builtin such as sys.write or sys.http.*
+	Tool string `json:"tool,omitempty"`
+	// Source matches the location the tool was loaded from, such as github.com/gptscript-ai/** or /home/me/tools/*.gpt
+	Source string `json:"source,omitempty"`
+	// Interpreter matches the program of a command tool, such as python3 or node, without its path or arguments.
+	Interpreter string `json:"interpreter,omitempty"`
+	// Args matches the arguments of the call by name. Relative paths in arguments are made absolute before matching
+	// patterns that start with "/" or "~".
+	Args map[string]string `json:"args,omitempty"`
+	// Message is returned to the LLM when the rule denies a call.
+	Message string `json:"message,omitempty"`
+}
+
+// LoadPolicy reads a policy from a YAML or JSON file.
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy %s: %w", file, err)
+	}
+
+	var policy Policy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", file, err)
+	}
+
+	if policy.Default == "" {
+		policy.Default = ActionAsk
+	}
+	if err := validAction(policy.Default); err != nil {
+		return nil, fmt.Errorf("invalid default in policy %s: %w", file, err)
+	}
+	for i, rule := range policy.Rules {
+		if err := validAction(rule.Action); err != nil {
+			return nil, fmt.Errorf("invalid rule %d in policy %s: %w", i+1, file, err)
+		}
+	}
+
+	return &policy, nil
+}
+
+func validAction(action Action) error {
+	switch action {
+	case ActionAllow, ActionDeny, ActionAsk:
+		return nil
+	}
+	return fmt.Errorf("unknown action %q, must be one of allow, deny, or ask", action)
+}
+
+// Evaluate returns the action for the call and the index of the rule that matched, or -1 if no rule matched.
+func (p *Policy) Evaluate(ctx engine.Context, input string) (Action, int) {
+	call := newPolicyCall(ctx, input)
+	for i, rule := range p.Rules {
+		if rule.matches(call) {
+			return rule.Action, i
+		}
+	}
+	return p.Default, -1
+}
+
+type policyCall struct {
+	tool        string
+	source      string
+	interpreter string
+	args        map[string]any
+}
+
+func newPolicyCall(ctx engine.Context, input string) policyCall {
+	call := policyCall{
+		tool:        ctx.Tool.Name,
+		source:      toolSource(ctx),
+		interpreter: interpreterName(ctx),
+	}
+	if ctx.Tool.BuiltinFunc != nil {
+		call.tool = ctx.Tool.ID
+	}
+	_ = json.Unmarshal([]byte(input), &call.args)
+	return call
+}
+
+func (r Rule) matches(call policyCall) bool {
+	if r.Tool != "" && !globMatch(r.Tool, call.tool) {
+		return false
+	}
+	if r.Source != "" && !globMatch(r.Source, call.source) {
+		return false
+	}
+	if r.Interpreter != "" && !globMatch(r.Interpreter, call.interpreter) {
+		return false
+	}
+	for name, pattern := range r.Args {
+		value, ok := call.args[name].(string)
+		if !ok {
+			return false
+		}
+		pattern = expandHome(pattern)
+		if strings.HasPrefix(pattern, "/") && !strings.Contains(value, "://") {
+			if abs, err := filepath.Abs(value); err == nil {
+				value = abs
+			}
+		}
+		if !globMatch(pattern, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func expandHome(pattern string) string {
+	if rest, ok := strings.CutPrefix(pattern, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return pattern
+}
+
+var globCache sync.Map
+
+func globMatch(pattern, value string) bool {
+	re, ok := globCache.Load(pattern)
+	if !ok {
+		var buf strings.Builder
+		buf.WriteString("^")
+		for i := 0; i < len(pattern); i++ {
+			switch {
+			case strings.HasPrefix(pattern[i:], "**"):
+				buf.WriteString(".*")
+				i++
+			case pattern[i] == '*':
+				buf.WriteString("[^/]*")
+			case pattern[i] == '?':
+				buf.WriteString("[^/]")
+			default:
+				buf.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		}
+		buf.WriteString("$")
+		re, _ = globCache.LoadOrStore(pattern, regexp.MustCompile(buf.String()))
+	}
+	return re.(*regexp.Regexp).MatchString(value)
+}
+
+// PolicyOptions configures a PolicyAuthorizer.
+type PolicyOptions struct {
+	// File is the path to the policy file.
+	File string
+	// DecisionsFile is where the remembered decisions are stored, by default policy-decisions.json in the
+	// gptscript config directory.
+	DecisionsFile string
+	// AuditLog is a file every decision is appended to as a JSON line. If empty, decisions are only logged at debug level.
+	AuditLog string
+}
+
+// PolicyAuthorizer authorizes tool calls using a Policy. Calls the policy wants to ask about are passed to another
+// authorizer, such as the interactive prompt, and its decision is stored if it asks to remember it.
+type PolicyAuthorizer struct {
+	policy        *Policy
+	decisionsFile string
+	auditLog      string
+	lock          sync.Mutex
+}
+
+// AuditEntry is the record of one decision in the audit log.
+type AuditEntry struct {
+	Time        time.Time `json:"time"`
+	CallID      string    `json:"callID,omitempty"`
+	Tool        string    `json:"tool"`
+	ToolID      string    `json:"toolID,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	Interpreter string    `json:"interpreter,omitempty"`
+	Input       string    `json:"input,omitempty"`
+	Accept      bool      `json:"accept"`
+	// DecidedBy is "rule N", "default", "safe", "remembered", or "user".
+	DecidedBy string `json:"decidedBy"`
+}
+
+func NewPolicyAuthorizer(opts PolicyOptions) (*PolicyAuthorizer, error) {
+	policy, err := LoadPolicy(opts.File)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DecisionsFile == "" {
+		opts.DecisionsFile, err = xdg.ConfigFile("gptscript/policy-decisions.json")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &PolicyAuthorizer{
+		policy:        policy,
+		decisionsFile: opts.DecisionsFile,
+		auditLog:      opts.AuditLog,
+	}, nil
+}
+
+// Authorizer returns an AuthorizerFunc that evaluates the policy and passes the calls it should ask about to ask. If ask
+// is nil, those calls are denied.
+func (p *PolicyAuthorizer) Authorizer(ask runner.AuthorizerFunc) runner.AuthorizerFunc {
+	return func(ctx engine.Context, input string) (runner.AuthorizerResponse, error) {
+		resp, decidedBy, err := p.authorize(ctx, input, ask)
+		if err != nil {
+			return resp, err
+		}
+		p.audit(ctx, input, resp.Accept, decidedBy)
+		return resp, nil
+	}
+}
+
+func (p *PolicyAuthorizer) authorize(ctx engine.Context, input string, ask runner.AuthorizerFunc) (runner.AuthorizerResponse, string, error) {
+	action, rule := p.policy.Evaluate(ctx, input)
+	decidedBy := "default"
+	if rule >= 0 {
+		decidedBy = fmt.Sprintf("rule %d", rule+1)
+	}
+
+	if rule < 0 {
+		if IsSafe(ctx) {
+			return runner.AuthorizerResponse{Accept: true}, "safe", nil
+		}
+		if accept, ok, err := p.remembered(ctx); err != nil {
+			return runner.AuthorizerResponse{}, "", err
+		} else if ok {
+			return decision(accept, ""), "remembered", nil
+		}
+	}
+
+	switch action {
+	case ActionAllow:
+		return runner.AuthorizerResponse{Accept: true}, decidedBy, nil
+	case ActionDeny:
+		var message string
+		if rule >= 0 {
+			message = p.policy.Rules[rule].Message
+		}
+		return decision(false, message), decidedBy, nil
+	}
+
+	if ask == nil {
+		return decision(false, "Tool call requires confirmation, but no confirmation is possible."), decidedBy, nil
+	}
+
+	resp, err := ask(ctx, input)
+	if err != nil {
+		return resp, "", err
+	}
+	if resp.Remember {
+		if err := p.remember(ctx, resp.Accept); err != nil {
+			return resp, "", err
+		}
+	}
+	return resp, "user", nil
+}
+
+func decision(accept bool, message string) runner.AuthorizerResponse {
+	if accept {
+		return runner.AuthorizerResponse{Accept: true}
+	}
+	if message == "" {
+		message = "Tool call request has been denied by policy."
+	}
+	return runner.AuthorizerResponse{
+		Message: message,
+	}
+}
+
+func (p *PolicyAuthorizer) readDecisions() (map[string]bool, error) {
+	decisions := map[string]bool{}
+	data, err := os.ReadFile(p.decisionsFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return decisions, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read policy decisions %s: %w", p.decisionsFile, err)
+	}
+	if err := json.Unmarshal(data, &decisions); err != nil {
+		return nil, fmt.Errorf("failed to parse policy decisions %s: %w", p.decisionsFile, err)
+	}
+	return decisions, nil
+}
+
+func (p *PolicyAuthorizer) remembered(ctx engine.Context) (accept bool, ok bool, _ error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	decisions, err := p.readDecisions()
+	if err != nil {
+		return false, false, err
+	}
+	accept, ok = decisions[ctx.Tool.ID]
+	return accept, ok, nil
+}
+
+func (p *PolicyAuthorizer) remember(ctx engine.Context, accept bool) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	decisions, err := p.readDecisions()
+	if err != nil {
+		return err
+	}
+	decisions[ctx.Tool.ID] = accept
+
+	data, err := json.MarshalIndent(decisions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.decisionsFile), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(p.decisionsFile, data, 0600)
+}
+
+func (p *PolicyAuthorizer) audit(ctx engine.Context, input string, accept bool, decidedBy string) {
+	call := newPolicyCall(ctx, input)
+	entry := AuditEntry{
+		Time:        time.Now(),
+		CallID:      ctx.ID,
+		Tool:        call.tool,
+		ToolID:      ctx.Tool.ID,
+		Source:      call.source,
+		Interpreter: call.interpreter,
+		Input:       input,
+		Accept:      accept,
+		DecidedBy:   decidedBy,
+	}
+
+	log.Debugf("Policy decision for tool [%s]: accept=%v by %s", entry.Tool, accept, decidedBy)
+	if p.auditLog == "" {
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("Failed to marshal audit entry: %v", err)
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	f, err := os.OpenFile(p.auditLog, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		log.Errorf("Failed to open audit log %s: %v", p.auditLog, err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Errorf("Failed to write audit log %s: %v", p.auditLog, err)
+	}
+}
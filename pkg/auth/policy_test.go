@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+default: ask
+rules:
+- action: allow
+  tool: sys.write
+  args:
+    filename: /workspace/**
+- action: deny
+  tool: sys.write
+  message: Only files in the workspace can be written.
+- action: allow
+  tool: sys.http.*
+  args:
+    url: https://api.github.com/**
+- action: allow
+  source: github.com/gptscript-ai/**
+  interpreter: python3
+`
+
+func builtinContext(id string) engine.Context {
+	ctx := engine.Context{Ctx: context.Background()}
+	ctx.ID = "call"
+	ctx.Tool = types.Tool{
+		ID: id,
+		ToolDef: types.ToolDef{
+			Instructions: types.CommandPrefix + id,
+			BuiltinFunc: func(context.Context, []string, string, chan<- string) (string, error) {
+				return "", nil
+			},
+		},
+	}
+	return ctx
+}
+
+func commandContext(name, interpreter string, repo *types.Repo) engine.Context {
+	ctx := engine.Context{Ctx: context.Background()}
+	ctx.ID = "call"
+	ctx.Tool = types.Tool{
+		ID: "tool.gpt:" + name,
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Name: name,
+			},
+			Instructions: types.CommandPrefix + interpreter + "\nprint('hi')",
+		},
+		Source: types.ToolSource{
+			Location: "/home/me/tool.gpt",
+			Repo:     repo,
+		},
+	}
+	return ctx
+}
+
+func newTestPolicy(t *testing.T) (*PolicyAuthorizer, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policy.yaml"), []byte(testPolicy), 0600))
+
+	p, err := NewPolicyAuthorizer(PolicyOptions{
+		File:          filepath.Join(dir, "policy.yaml"),
+		DecisionsFile: filepath.Join(dir, "decisions.json"),
+		AuditLog:      filepath.Join(dir, "audit.log"),
+	})
+	require.NoError(t, err)
+	return p, dir
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	p, _ := newTestPolicy(t)
+
+	for _, test := range []struct {
+		name   string
+		ctx    engine.Context
+		input  string
+		action Action
+		rule   int
+	}{
+		{"write in workspace", builtinContext("sys.write"), `{"filename": "/workspace/a/b.txt"}`, ActionAllow, 0},
+		{"write outside workspace", builtinContext("sys.write"), `{"filename": "/etc/passwd"}`, ActionDeny, 1},
+		{"get allowed url", builtinContext("sys.http.get"), `{"url": "https://api.github.com/repos"}`, ActionAllow, 2},
+		{"post other url", builtinContext("sys.http.post"), `{"url": "https://example.com"}`, ActionAsk, -1},
+		{"python from repo", commandContext("py", "/usr/bin/env python3 ${GPTSCRIPT_TOOL_DIR}/main.py", &types.Repo{
+			Root: "https://github.com/gptscript-ai/search.git",
+		}), "", ActionAllow, 3},
+		{"python from local file", commandContext("py", "/usr/bin/env python3", nil), "", ActionAsk, -1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			action, rule := p.policy.Evaluate(test.ctx, test.input)
+			require.Equal(t, test.action, action)
+			require.Equal(t, test.rule, rule)
+		})
+	}
+}
+
+func TestPolicyAuthorizer(t *testing.T) {
+	p, dir := newTestPolicy(t)
+
+	resp, err := p.Authorizer(nil)(builtinContext("sys.write"), `{"filename": "/etc/passwd"}`)
+	require.NoError(t, err)
+	require.False(t, resp.Accept)
+	require.Equal(t, "Only files in the workspace can be written.", resp.Message)
+
+	// Without a way to ask, the calls the policy asks about are denied.
+	ctx := commandContext("py", "python3", nil)
+	resp, err = p.Authorizer(nil)(ctx, "")
+	require.NoError(t, err)
+	require.False(t, resp.Accept)
+
+	var asked int
+	ask := func(engine.Context, string) (runner.AuthorizerResponse, error) {
+		asked++
+		return runner.AuthorizerResponse{Accept: true, Remember: true}, nil
+	}
+
+	resp, err = p.Authorizer(ask)(ctx, "")
+	require.NoError(t, err)
+	require.True(t, resp.Accept)
+	require.Equal(t, 1, asked)
+
+	// The remembered decision is used without asking again, also by a new authorizer.
+	p, err = NewPolicyAuthorizer(PolicyOptions{
+		File:          filepath.Join(dir, "policy.yaml"),
+		DecisionsFile: filepath.Join(dir, "decisions.json"),
+		AuditLog:      filepath.Join(dir, "audit.log"),
+	})
+	require.NoError(t, err)
+
+	resp, err = p.Authorizer(ask)(ctx, "")
+	require.NoError(t, err)
+	require.True(t, resp.Accept)
+	require.Equal(t, 1, asked)
+
+	f, err := os.Open(filepath.Join(dir, "audit.log"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	var decidedBy []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		decidedBy = append(decidedBy, entry.DecidedBy)
+	}
+	require.Equal(t, []string{"rule 2", "default", "user", "remembered"}, decidedBy)
+}
+
+func TestLoadPolicyInvalidAction(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("rules:\n- action: maybe\n"), 0600))
+
+	_, err := LoadPolicy(file)
+	require.ErrorContains(t, err, `invalid rule 1`)
+}
@@ -1,13 +1,13 @@
 package cache
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
-	"io/fs"
+	"fmt"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -16,18 +16,44 @@ import (
 	"github.com/adrg/xdg"
 	"github.com/getkin/kin-openapi/openapi3"
 	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/mvl"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"github.com/gptscript-ai/gptscript/pkg/version"
 )
 
+var log = mvl.Package()
+
 type Client struct {
 	dir  string
 	noop bool
+	disk *Disk
+	// remote is the shared cache that is read when an entry is not on disk.
+	remote   Backend
+	readOnly bool
+}
+
+// Backend stores the encoded entries of the cache by their keys.
+type Backend interface {
+	// Get returns nil if there is no entry with the key.
+	Get(ctx context.Context, key string) (*Object, error)
+	Put(ctx context.Context, key string, obj Object) error
+}
+
+// Object is an encoded entry of the cache.
+type Object struct {
+	Kind Kind
+	Data []byte
 }
 
 type Options struct {
-	DisableCache bool   `usage:"Disable caching of LLM API responses"`
-	CacheDir     string `usage:"Directory to store cache (default: $XDG_CACHE_HOME/gptscript)"`
+	DisableCache  bool    `usage:"Disable caching of LLM API responses"`
+	CacheDir      string  `usage:"Directory to store cache (default: $XDG_CACHE_HOME/gptscript)"`
+	CacheMaxSize  string  `usage:"Maximum size of the cache, for example 500MB, after which the least recently used entries are evicted (default: unlimited)"`
+	CacheTTL      string  `usage:"How long cache entries are kept, as a duration or a list of kind=duration, for example llm=168h,source=24h (default: forever)"`
+	CacheURL      string  `usage:"URL of a shared cache that is used when an entry is not in the local cache, either an HTTP server that supports GET and PUT, or an S3 bucket as s3://bucket/prefix"`
+	CacheToken    string  `usage:"Bearer token for the HTTP server of --cache-url"`
+	CacheReadOnly bool    `usage:"Only read from the shared cache of --cache-url, never write to it"`
+	CacheBackend  Backend `usage:"-" json:"-"`
 }
 
 func init() {
@@ -39,6 +65,14 @@ func Complete(opts ...Options) (result Options) {
 	for _, opt := range opts {
 		result.CacheDir = types.FirstSet(opt.CacheDir, result.CacheDir)
 		result.DisableCache = types.FirstSet(opt.DisableCache, result.DisableCache)
+		result.CacheMaxSize = types.FirstSet(opt.CacheMaxSize, result.CacheMaxSize)
+		result.CacheTTL = types.FirstSet(opt.CacheTTL, result.CacheTTL)
+		result.CacheURL = types.FirstSet(opt.CacheURL, result.CacheURL)
+		result.CacheToken = types.FirstSet(opt.CacheToken, result.CacheToken)
+		result.CacheReadOnly = types.FirstSet(opt.CacheReadOnly, result.CacheReadOnly)
+		if opt.CacheBackend != nil {
+			result.CacheBackend = opt.CacheBackend
+		}
 	}
 	if result.CacheDir == "" {
 		result.CacheDir = filepath.Join(xdg.CacheHome, version.ProgramName)
@@ -77,12 +111,32 @@ func WithNoCache(ctx context.Context) context.Context {
 
 func New(opts ...Options) (*Client, error) {
 	opt := Complete(opts...)
+	maxSize, err := ParseSize(opt.CacheMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	ttls, err := ParseTTLs(opt.CacheTTL)
+	if err != nil {
+		return nil, err
+	}
 	if err := os.MkdirAll(opt.CacheDir, 0755); err != nil {
 		return nil, err
 	}
+
+	remote := opt.CacheBackend
+	if remote == nil && opt.CacheURL != "" {
+		remote, err = NewRemote(opt.CacheURL, opt.CacheToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &Client{
-		dir:  opt.CacheDir,
-		noop: opt.DisableCache,
+		dir:      opt.CacheDir,
+		noop:     opt.DisableCache,
+		disk:     NewDisk(opt.CacheDir, maxSize, ttls),
+		remote:   remote,
+		readOnly: opt.CacheReadOnly,
 	}, nil
 }
 
@@ -100,7 +154,7 @@ func (c *Client) cacheKey(key any) (string, error) {
 	return hex.EncodeToString(digest), nil
 }
 
-func (c *Client) Store(ctx context.Context, key, value any) error {
+func (c *Client) Store(ctx context.Context, kind Kind, key, value any) error {
 	if c == nil {
 		return nil
 	}
@@ -115,10 +169,7 @@ func (c *Client) Store(ctx context.Context, key, value any) error {
 	if c.noop || IsNoCache(ctx) {
 		keyValue, err := c.cacheKey(key)
 		if err == nil {
-			p := filepath.Join(c.dir, keyValue)
-			if _, err := os.Stat(p); err == nil {
-				_ = os.Remove(p)
-			}
+			c.disk.Delete(keyValue)
 		}
 		return nil
 	}
@@ -128,13 +179,25 @@ func (c *Client) Store(ctx context.Context, key, value any) error {
 		return err
 	}
 
-	f, err := os.Create(filepath.Join(c.dir, keyValue))
-	if err != nil {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
 		return err
 	}
-	defer f.Close()
+	obj := Object{
+		Kind: kind,
+		Data: buf.Bytes(),
+	}
 
-	return gob.NewEncoder(f).Encode(value)
+	if err := c.disk.Put(ctx, keyValue, obj); err != nil {
+		return err
+	}
+	if c.remote != nil && !c.readOnly {
+		// The shared cache is an optimization, so failing to write to it doesn't fail the caller.
+		if err := c.remote.Put(ctx, keyValue, obj); err != nil {
+			log.Errorf("failed to store %s in the shared cache: %v", keyValue, err)
+		}
+	}
+	return nil
 }
 
 func (c *Client) Get(ctx context.Context, key, out any) (bool, error) {
@@ -147,13 +210,55 @@ func (c *Client) Get(ctx context.Context, key, out any) (bool, error) {
 		return false, err
 	}
 
-	f, err := os.Open(filepath.Join(c.dir, keyValue))
-	if errors.Is(err, fs.ErrNotExist) {
-		return false, nil
-	} else if err != nil {
+	obj, err := c.disk.Get(ctx, keyValue)
+	if err != nil {
 		return false, err
 	}
-	defer f.Close()
 
-	return gob.NewDecoder(f).Decode(out) == nil, nil
+	if obj == nil && c.remote != nil {
+		obj, err = c.remote.Get(ctx, keyValue)
+		if err != nil {
+			log.Errorf("failed to get %s from the shared cache: %v", keyValue, err)
+			return false, nil
+		}
+		if obj != nil {
+			log.Debugf("hit %s in the shared cache", keyValue)
+			if err := c.disk.Put(ctx, keyValue, *obj); err != nil {
+				return false, err
+			}
+		}
+	}
+	if obj == nil {
+		return false, nil
+	}
+
+	return gob.NewDecoder(bytes.NewReader(obj.Data)).Decode(out) == nil, nil
+}
+
+// List lists the entries of the local cache, see Disk.List.
+func (c *Client) List(kinds ...Kind) ([]Entry, error) {
+	return c.disk.List(kinds...)
+}
+
+// Stats summarizes the entries of the local cache, see Disk.Stats.
+func (c *Client) Stats() (Stats, error) {
+	stats, err := c.disk.Stats()
+	if err != nil {
+		return Stats{}, err
+	}
+	if remote, ok := c.remote.(fmt.Stringer); ok {
+		stats.Remote = remote.String()
+		stats.RemoteReadOnly = c.readOnly
+	}
+	return stats, nil
+}
+
+// Prune prunes the local cache, see Disk.Prune.
+func (c *Client) Prune() (PruneResult, error) {
+	return c.disk.Prune()
+}
+
+// Clear clears the local cache, see Disk.Clear.
+func (c *Client) Clear(kinds ...Kind) (PruneResult, error) {
+	return c.disk.Clear(kinds...)
 }
@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, opts ...Options) *Client {
+	c, err := New(append([]Options{{CacheDir: t.TempDir()}}, opts...)...)
+	require.NoError(t, err)
+	return c
+}
+
+// age makes the entry look like it was created and last used d ago.
+func age(t *testing.T, c *Client, key any, d time.Duration) {
+	keyValue, err := c.cacheKey(key)
+	require.NoError(t, err)
+
+	p := filepath.Join(c.dir, keyValue)
+	info, err := os.Stat(p)
+	require.NoError(t, err)
+
+	then := time.Now().Add(-d)
+	data, err := json.Marshal(metadata{
+		Kind:    c.disk.entry(keyValue, info).Kind,
+		Created: then,
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(p+metadataSuffix, data, 0644))
+	require.NoError(t, os.Chtimes(p, then, then))
+}
+
+func TestStoreGet(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	require.NoError(t, c.Store(ctx, KindLLM, "key", "value"))
+
+	var value string
+	found, err := c.Get(ctx, "key", &value)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "value", value)
+
+	found, err = c.Get(ctx, "other", &value)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	entries, err := c.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, KindLLM, entries[0].Kind)
+	assert.False(t, entries[0].Created.IsZero())
+	assert.False(t, entries[0].LastHit.Before(entries[0].Created))
+	assert.Positive(t, entries[0].Size)
+}
+
+func TestLegacyEntry(t *testing.T) {
+	c := newTestClient(t)
+	require.NoError(t, c.Store(context.Background(), KindLLM, "key", "value"))
+
+	keyValue, err := c.cacheKey("key")
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(c.dir, keyValue+metadataSuffix)))
+
+	entries, err := c.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, KindUnknown, entries[0].Kind)
+	assert.True(t, entries[0].LastHit.IsZero())
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, Options{CacheTTL: "llm=1h"})
+
+	require.NoError(t, c.Store(ctx, KindLLM, "old", "value"))
+	require.NoError(t, c.Store(ctx, KindLLM, "new", "value"))
+	require.NoError(t, c.Store(ctx, KindSource, "source", "value"))
+	age(t, c, "old", 2*time.Hour)
+	age(t, c, "source", 2*time.Hour)
+
+	var value string
+	found, err := c.Get(ctx, "old", &value)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	found, err = c.Get(ctx, "new", &value)
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	// Sources have no TTL.
+	found, err = c.Get(ctx, "source", &value)
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	entries, err := c.List()
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	value := strings.Repeat("x", 1000)
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Store(ctx, KindLLM, key, value))
+	}
+	age(t, c, "a", 3*time.Hour)
+	age(t, c, "b", 2*time.Hour)
+	age(t, c, "c", time.Hour)
+
+	// Prune with the TTL and the size limit of another client of the same directory.
+	pruner := newTestClient(t, Options{
+		CacheDir:     c.dir,
+		CacheTTL:     "150m",
+		CacheMaxSize: "1500",
+	})
+
+	var found string
+	ok, err := c.Get(ctx, "b", &found)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	result, err := pruner.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Expired)
+	assert.Equal(t, 1, result.Evicted)
+
+	// "b" was hit, so "c" is the least recently used entry.
+	entries, err := c.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	keyValue, err := c.cacheKey("b")
+	require.NoError(t, err)
+	assert.Equal(t, keyValue, entries[0].Key)
+}
+
+func TestEvictOnStore(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, Options{CacheMaxSize: "2.5KB"})
+
+	value := strings.Repeat("x", 1000)
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Store(ctx, KindLLM, key, value))
+		age(t, c, key, time.Hour)
+	}
+
+	stats, err := c.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Entries)
+	assert.LessOrEqual(t, stats.Size, int64(2500))
+
+	var found string
+	ok, err := c.Get(ctx, "a", &found)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestDiskSize(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, Options{CacheMaxSize: "2.5KB"})
+
+	value := strings.Repeat("x", 1000)
+	for _, key := range []string{"a", "b", "a"} {
+		require.NoError(t, c.Store(ctx, KindLLM, key, value))
+	}
+
+	stats, err := c.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, stats.Size, c.disk.size)
+
+	keyValue, err := c.cacheKey("a")
+	require.NoError(t, err)
+	c.disk.Delete(keyValue)
+
+	stats, err = c.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, stats.Size, c.disk.size)
+}
+
+func TestClear(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	require.NoError(t, c.Store(ctx, KindLLM, "llm", "value"))
+	require.NoError(t, c.Store(ctx, KindOpenAPI, "openapi", "value"))
+	require.NoError(t, c.Store(ctx, KindSource, "source", "value"))
+	require.NoError(t, os.MkdirAll(filepath.Join(c.dir, "repos"), 0755))
+
+	result, err := c.Clear(KindLLM, KindOpenAPI)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Cleared)
+
+	stats, err := c.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, map[Kind]KindStats{KindSource: {Entries: 1, Size: stats.Size}}, stats.Kinds)
+
+	_, err = c.Clear()
+	require.NoError(t, err)
+
+	files, err := os.ReadDir(c.dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "repos", files[0].Name())
+}
+
+func TestParseSize(t *testing.T) {
+	for size, expected := range map[string]int64{
+		"":       0,
+		"1024":   1024,
+		"500MB":  500_000_000,
+		"1.5 GB": 1_500_000_000,
+		"2KiB":   2048,
+		"1gib":   1 << 30,
+	} {
+		actual, err := ParseSize(size)
+		require.NoError(t, err, size)
+		assert.Equal(t, expected, actual, size)
+	}
+
+	_, err := ParseSize("big")
+	assert.Error(t, err)
+	_, err = ParseSize("10 parsecs")
+	assert.Error(t, err)
+}
+
+func TestParseTTLs(t *testing.T) {
+	ttls, err := ParseTTLs("llm=168h, source=24h,1h")
+	require.NoError(t, err)
+	assert.Equal(t, map[Kind]time.Duration{
+		KindLLM:    168 * time.Hour,
+		KindSource: 24 * time.Hour,
+		"":         time.Hour,
+	}, ttls)
+
+	_, err = ParseTTLs("responses=1h")
+	assert.ErrorContains(t, err, `invalid kind of cache entries "responses"`)
+	_, err = ParseTTLs("llm=forever")
+	assert.ErrorContains(t, err, `invalid cache TTL "llm=forever"`)
+}
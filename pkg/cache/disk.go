@@ -0,0 +1,567 @@
+package cache
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Kind is what a cache entry holds.
+type Kind string
+
+const (
+	// KindLLM is a response of an LLM to a chat completion request.
+	KindLLM Kind = "llm"
+	// KindOpenAPI is a remote OpenAPI schema that was loaded as a tool.
+	KindOpenAPI Kind = "openapi"
+	// KindSource is the source of a remote tool.
+	KindSource Kind = "source"
+	// KindUnknown is an entry that was stored without metadata by an older version.
+	KindUnknown Kind = "unknown"
+)
+
+// Kinds are the kinds of the entries that are stored in the cache.
+var Kinds = []Kind{KindLLM, KindOpenAPI, KindSource}
+
+const (
+	metadataSuffix = ".json"
+	tempPrefix     = ".tmp-"
+
+	// evictRatio is the share of the maximum size that a Put evicts the entries down to once they are larger than the
+	// maximum size, so that the entries are not listed again by every following Put.
+	evictRatio = 0.9
+)
+
+// metadata is stored next to each entry, in a file with the name of the entry and the metadata suffix.
+type metadata struct {
+	Kind    Kind      `json:"kind"`
+	Created time.Time `json:"created"`
+}
+
+// Entry describes an entry of the cache.
+type Entry struct {
+	Key     string    `json:"key"`
+	Kind    Kind      `json:"kind"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+	// LastHit is zero if the entry was never read.
+	LastHit time.Time `json:"lastHit,omitzero"`
+
+	// lastUsed is when the entry was created or last hit, whichever is later.
+	lastUsed time.Time
+}
+
+type KindStats struct {
+	Entries int   `json:"entries"`
+	Size    int64 `json:"size"`
+}
+
+type Stats struct {
+	Dir     string `json:"dir"`
+	Entries int    `json:"entries"`
+	Size    int64  `json:"size"`
+	// MaxSize is zero if the size of the cache is not limited.
+	MaxSize int64 `json:"maxSize,omitempty"`
+	// TTLs are the TTLs of the kinds of entries, where "*" is the TTL of the kinds that are not listed.
+	TTLs   map[Kind]string    `json:"ttls,omitempty"`
+	Kinds  map[Kind]KindStats `json:"kinds"`
+	Oldest time.Time          `json:"oldest,omitzero"`
+	Newest time.Time          `json:"newest,omitzero"`
+	// Remote is the URL of the shared remote cache, which is not included in the other stats.
+	Remote         string `json:"remote,omitempty"`
+	RemoteReadOnly bool   `json:"remoteReadOnly,omitempty"`
+}
+
+// PruneResult is what Prune and Clear removed from the cache.
+type PruneResult struct {
+	// Expired are the entries that outlived their TTL, Evicted are the least recently used entries that did not fit in
+	// the maximum size, and Cleared are the entries that were cleared.
+	Expired int   `json:"expired"`
+	Evicted int   `json:"evicted"`
+	Cleared int   `json:"cleared"`
+	Size    int64 `json:"size"`
+}
+
+// Disk is the backend that stores the entries of the cache as files in a directory, with the metadata of each entry
+// in a file next to it. It evicts the least recently used entries once the entries are larger than its maximum size,
+// and expires the entries that outlive the TTL of their kind.
+type Disk struct {
+	dir     string
+	maxSize int64
+	ttls    map[Kind]time.Duration
+
+	// lock serializes the evictions of this backend.
+	lock sync.Mutex
+
+	// sizeLock guards size, which is the running total of the sizes of the entries. It is loaded from the directory by
+	// the first Put of a backend with a maximum size, and is only approximate if other processes share the directory.
+	sizeLock sync.Mutex
+	size     int64
+	sized    bool
+}
+
+// NewDisk returns a disk backend that stores the entries in dir. A maxSize of 0 does not limit the size of the entries,
+// and a kind without a TTL is kept forever.
+func NewDisk(dir string, maxSize int64, ttls map[Kind]time.Duration) *Disk {
+	return &Disk{
+		dir:     dir,
+		maxSize: maxSize,
+		ttls:    ttls,
+	}
+}
+
+func (d *Disk) Get(_ context.Context, key string) (*Object, error) {
+	p := filepath.Join(d.dir, key)
+	info, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entry := d.entry(key, info)
+	if d.expired(entry, time.Now()) {
+		d.remove(key, entry.Size)
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+	return &Object{
+		Kind: entry.Kind,
+		Data: data,
+	}, nil
+}
+
+func (d *Disk) Put(_ context.Context, key string, obj Object) error {
+	now := time.Now()
+	replaced := d.entrySize(key)
+	if err := d.write(key, obj.Data); err != nil {
+		return err
+	}
+
+	meta, err := json.Marshal(metadata{
+		Kind:    obj.Kind,
+		Created: now,
+	})
+	if err != nil {
+		return err
+	}
+	if err := d.write(key+metadataSuffix, meta); err != nil {
+		return err
+	}
+	// The modification time of an entry is when it was last used, which is when it was created until it is hit.
+	_ = os.Chtimes(filepath.Join(d.dir, key), now, now)
+
+	if d.maxSize > 0 {
+		size, err := d.grow(int64(len(obj.Data)+len(meta)) - replaced)
+		if err != nil {
+			return fmt.Errorf("failed to size cache entries: %w", err)
+		}
+		if size > d.maxSize {
+			if _, err := d.evict(int64(float64(d.maxSize) * evictRatio)); err != nil {
+				return fmt.Errorf("failed to evict cache entries: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete removes an entry and its metadata.
+func (d *Disk) Delete(key string) {
+	d.remove(key, d.entrySize(key))
+}
+
+// grow adds delta to the size of the entries and returns the new size, loading the size from the entries in the
+// directory the first time.
+func (d *Disk) grow(delta int64) (int64, error) {
+	d.sizeLock.Lock()
+	defer d.sizeLock.Unlock()
+
+	if d.sized {
+		d.size += delta
+		return d.size, nil
+	}
+
+	entries, err := d.List()
+	if err != nil {
+		return 0, err
+	}
+	d.size = 0
+	for _, entry := range entries {
+		d.size += entry.Size
+	}
+	d.sized = true
+	return d.size, nil
+}
+
+// entrySize returns the size of an entry and its metadata, which is 0 if the entry doesn't exist.
+func (d *Disk) entrySize(key string) int64 {
+	var size int64
+	for _, name := range []string{key, key + metadataSuffix} {
+		if info, err := os.Stat(filepath.Join(d.dir, name)); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// write replaces a file in the cache directory atomically, so that a concurrent Get never reads a partial entry.
+func (d *Disk) write(name string, data []byte) error {
+	f, err := os.CreateTemp(d.dir, tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(d.dir, name))
+}
+
+func isKey(name string) bool {
+	if len(name) != hex.EncodedLen(32) {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+func (d *Disk) entry(key string, info fs.FileInfo) Entry {
+	entry := Entry{
+		Key:      key,
+		Kind:     KindUnknown,
+		Size:     info.Size(),
+		Created:  info.ModTime(),
+		lastUsed: info.ModTime(),
+	}
+
+	data, err := os.ReadFile(filepath.Join(d.dir, key+metadataSuffix))
+	if err != nil {
+		return entry
+	}
+
+	var meta metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return entry
+	}
+
+	entry.Kind = meta.Kind
+	entry.Created = meta.Created
+	entry.Size += int64(len(data))
+	if info.ModTime().After(meta.Created) {
+		entry.LastHit = info.ModTime()
+	}
+	return entry
+}
+
+// List returns the entries of the kinds, or all the entries if no kind is given, from the least to the most
+// recently used.
+func (d *Disk) List(kinds ...Kind) ([]Entry, error) {
+	files, err := os.ReadDir(d.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var result []Entry
+	for _, file := range files {
+		if !file.Type().IsRegular() || !isKey(file.Name()) {
+			continue
+		}
+		info, err := file.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		entry := d.entry(file.Name(), info)
+		if len(kinds) == 0 || slices.Contains(kinds, entry.Kind) {
+			result = append(result, entry)
+		}
+	}
+
+	slices.SortFunc(result, func(a, b Entry) int {
+		return a.lastUsed.Compare(b.lastUsed)
+	})
+	return result, nil
+}
+
+// Stats summarizes the entries.
+func (d *Disk) Stats() (Stats, error) {
+	entries, err := d.List()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	result := Stats{
+		Dir:     d.dir,
+		MaxSize: d.maxSize,
+		Kinds:   map[Kind]KindStats{},
+	}
+	for kind, ttl := range d.ttls {
+		if result.TTLs == nil {
+			result.TTLs = map[Kind]string{}
+		}
+		if kind == "" {
+			kind = "*"
+		}
+		result.TTLs[kind] = ttl.String()
+	}
+
+	for _, entry := range entries {
+		result.Entries++
+		result.Size += entry.Size
+
+		kind := result.Kinds[entry.Kind]
+		kind.Entries++
+		kind.Size += entry.Size
+		result.Kinds[entry.Kind] = kind
+
+		if result.Oldest.IsZero() || entry.Created.Before(result.Oldest) {
+			result.Oldest = entry.Created
+		}
+		if entry.Created.After(result.Newest) {
+			result.Newest = entry.Created
+		}
+	}
+	return result, nil
+}
+
+// Prune removes the entries that have outlived the TTL of their kind, and then evicts the least recently used entries
+// until the cache fits in its maximum size.
+func (d *Disk) Prune() (PruneResult, error) {
+	entries, err := d.List()
+	if err != nil {
+		return PruneResult{}, err
+	}
+
+	var (
+		result PruneResult
+		now    = time.Now()
+	)
+	for _, entry := range entries {
+		if d.expired(entry, now) {
+			d.remove(entry.Key, entry.Size)
+			result.Expired++
+			result.Size += entry.Size
+		}
+	}
+	d.removeOrphans()
+
+	if d.maxSize > 0 {
+		evicted, err := d.evict(d.maxSize)
+		if err != nil {
+			return result, err
+		}
+		result.Evicted += evicted.Evicted
+		result.Size += evicted.Size
+	}
+	return result, nil
+}
+
+// Clear removes the entries of the kinds, or all the entries if no kind is given. The other data in the cache
+// directory, like the repositories of tools and the runtimes they are built with, is kept.
+func (d *Disk) Clear(kinds ...Kind) (PruneResult, error) {
+	entries, err := d.List(kinds...)
+	if err != nil {
+		return PruneResult{}, err
+	}
+
+	var result PruneResult
+	for _, entry := range entries {
+		d.remove(entry.Key, entry.Size)
+		result.Cleared++
+		result.Size += entry.Size
+	}
+	if len(kinds) == 0 {
+		d.removeOrphans()
+	}
+	return result, nil
+}
+
+// evict removes the least recently used entries until the cache is no larger than maxSize.
+func (d *Disk) evict(maxSize int64) (PruneResult, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	entries, err := d.List()
+	if err != nil {
+		return PruneResult{}, err
+	}
+
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size
+	}
+
+	var result PruneResult
+	for _, entry := range entries {
+		if size <= maxSize {
+			break
+		}
+		d.remove(entry.Key, entry.Size)
+		size -= entry.Size
+		result.Evicted++
+		result.Size += entry.Size
+	}
+
+	// The entries were listed anyway, so the running size is corrected for the changes of other processes.
+	d.sizeLock.Lock()
+	defer d.sizeLock.Unlock()
+	d.size, d.sized = size, true
+	return result, nil
+}
+
+func (d *Disk) expired(entry Entry, now time.Time) bool {
+	ttl, ok := d.ttls[entry.Kind]
+	if !ok {
+		ttl, ok = d.ttls[""]
+	}
+	return ok && now.Sub(entry.Created) > ttl
+}
+
+// remove removes an entry and its metadata, and subtracts the size of the entry from the size of the entries.
+func (d *Disk) remove(key string, size int64) {
+	_ = os.Remove(filepath.Join(d.dir, key))
+	_ = os.Remove(filepath.Join(d.dir, key+metadataSuffix))
+
+	d.sizeLock.Lock()
+	defer d.sizeLock.Unlock()
+	if d.sized {
+		d.size = max(d.size-size, 0)
+	}
+}
+
+// removeOrphans removes the metadata of entries that no longer exist, and the temporary files of writes that were
+// interrupted more than an hour ago.
+func (d *Disk) removeOrphans() {
+	files, err := os.ReadDir(d.dir)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if !file.Type().IsRegular() {
+			continue
+		}
+		if key, ok := strings.CutSuffix(file.Name(), metadataSuffix); ok && isKey(key) {
+			if _, err := os.Stat(filepath.Join(d.dir, key)); errors.Is(err, fs.ErrNotExist) {
+				_ = os.Remove(filepath.Join(d.dir, file.Name()))
+			}
+		} else if strings.HasPrefix(file.Name(), tempPrefix) {
+			if info, err := file.Info(); err == nil && time.Since(info.ModTime()) > time.Hour {
+				_ = os.Remove(filepath.Join(d.dir, file.Name()))
+			}
+		}
+	}
+}
+
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1e3,
+	"kb":  1e3,
+	"m":   1e6,
+	"mb":  1e6,
+	"g":   1e9,
+	"gb":  1e9,
+	"t":   1e12,
+	"tb":  1e12,
+	"ki":  1 << 10,
+	"kib": 1 << 10,
+	"mi":  1 << 20,
+	"mib": 1 << 20,
+	"gi":  1 << 30,
+	"gib": 1 << 30,
+	"ti":  1 << 40,
+	"tib": 1 << 40,
+}
+
+// ParseSize parses a size in bytes with an optional decimal (KB, MB, GB, TB) or binary (KiB, MiB, GiB, TiB) unit. An
+// empty size is 0.
+func ParseSize(size string) (int64, error) {
+	size = strings.TrimSpace(size)
+	if size == "" {
+		return 0, nil
+	}
+
+	i := strings.IndexFunc(size, func(r rune) bool {
+		return r != '.' && !unicode.IsDigit(r)
+	})
+	if i < 0 {
+		i = len(size)
+	}
+
+	number, err := strconv.ParseFloat(size[:i], 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid cache size %q", size)
+	}
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(size[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid unit of cache size %q", size)
+	}
+	return int64(math.Round(number * unit)), nil
+}
+
+// ParseTTLs parses the TTLs of the kinds of entries from a comma separated list of kind=duration. A duration without a
+// kind is the TTL of the kinds that are not listed, which is stored with an empty kind.
+func ParseTTLs(ttls string) (map[Kind]time.Duration, error) {
+	result := map[Kind]time.Duration{}
+	for _, ttl := range strings.Split(ttls, ",") {
+		ttl = strings.TrimSpace(ttl)
+		if ttl == "" {
+			continue
+		}
+
+		kind, value, ok := strings.Cut(ttl, "=")
+		if !ok {
+			kind, value = "", kind
+		} else if _, err := ParseKind(strings.TrimSpace(kind)); err != nil {
+			return nil, err
+		}
+
+		duration, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid cache TTL %q", ttl)
+		}
+		result[Kind(strings.TrimSpace(kind))] = duration
+	}
+	return result, nil
+}
+
+// ParseKind parses the name of a kind of cache entries.
+func ParseKind(kind string) (Kind, error) {
+	if !slices.Contains(Kinds, Kind(kind)) && Kind(kind) != KindUnknown {
+		names := make([]string, 0, len(Kinds))
+		for _, kind := range Kinds {
+			names = append(names, string(kind))
+		}
+		return "", fmt.Errorf("invalid kind of cache entries %q, must be one of %s or %s", kind, strings.Join(names, ", "), KindUnknown)
+	}
+	return Kind(kind), nil
+}
@@ -0,0 +1,245 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	kindHeader   = "X-Gptscript-Cache-Kind"
+	s3KindHeader = "X-Amz-Meta-Kind"
+)
+
+// Remote is the backend of a cache that is shared through an HTTP server, which returns the body of the last PUT
+// request to a URL for a GET request of the same URL. S3 and the servers that are compatible with it are supported by
+// signing the requests with the AWS credentials of the environment.
+type Remote struct {
+	url    string
+	base   *url.URL
+	token  string
+	s3     *s3Credentials
+	client *http.Client
+}
+
+type s3Credentials struct {
+	region, accessKeyID, secretAccessKey, sessionToken string
+}
+
+// NewRemote returns the backend of the cache at the URL, which is either an http(s) URL that the keys of the entries
+// are appended to, or s3://bucket/prefix. The token, if set, is sent as a bearer token to an HTTP server.
+//
+// The region, credentials and endpoint of an S3 bucket are read from the AWS_REGION, AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL environment variables. Setting
+// the endpoint selects the path style addressing of the buckets that S3 compatible servers use.
+func NewRemote(rawURL, token string) (*Remote, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache URL %q: %w", rawURL, err)
+	}
+
+	result := &Remote{
+		url:   rawURL,
+		base:  base,
+		token: token,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+
+	switch base.Scheme {
+	case "http", "https":
+	case "s3":
+		if base.Host == "" {
+			return nil, fmt.Errorf("invalid cache URL %q: missing bucket", rawURL)
+		}
+		result.s3 = &s3Credentials{
+			region:          types.FirstSet(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+			accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		result.base, err = s3URL(base, result.s3.region, types.FirstSet(os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL")))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid cache URL %q: the scheme must be http, https or s3", rawURL)
+	}
+
+	return result, nil
+}
+
+// s3URL returns the HTTP URL of the objects of the bucket and prefix of an s3:// URL.
+func s3URL(u *url.URL, region, endpoint string) (*url.URL, error) {
+	bucket, prefix := u.Host, strings.Trim(u.Path, "/")
+	if endpoint == "" {
+		return url.Parse(fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, prefix))
+	}
+
+	result, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: %w", endpoint, err)
+	}
+	return result.JoinPath(bucket, prefix), nil
+}
+
+func (r *Remote) String() string {
+	return r.url
+}
+
+func (r *Remote) Get(ctx context.Context, key string) (*Object, error) {
+	resp, err := r.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unexpected status getting %s: %s", key, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := Kind(types.FirstSet(resp.Header.Get(kindHeader), resp.Header.Get(s3KindHeader)))
+	if !slices.Contains(Kinds, kind) {
+		kind = KindUnknown
+	}
+	return &Object{
+		Kind: kind,
+		Data: data,
+	}, nil
+}
+
+func (r *Remote) Put(ctx context.Context, key string, obj Object) error {
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	if r.s3 != nil {
+		header.Set(s3KindHeader, string(obj.Kind))
+	} else {
+		header.Set(kindHeader, string(obj.Kind))
+	}
+
+	resp, err := r.do(ctx, http.MethodPut, key, header, obj.Data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status putting %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+func (r *Remote) do(ctx context.Context, method, key string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, r.base.JoinPath(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	if r.s3 != nil {
+		r.s3.sign(req, body, time.Now())
+	} else if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	return r.client.Do(req)
+}
+
+// sign signs the request with AWS Signature Version 4. Requests are not signed without credentials, which is how the
+// public buckets are read.
+func (s *s3Credentials) sign(req *http.Request, body []byte, now time.Time) {
+	if s.accessKeyID == "" || s.secretAccessKey == "" {
+		return
+	}
+
+	var (
+		payloadHash = sha256Hex(body)
+		amzDate     = now.UTC().Format("20060102T150405Z")
+		date        = amzDate[:8]
+		scope       = date + "/" + s.region + "/s3/aws4_request"
+	)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	headers := map[string]string{
+		"host": req.URL.Host,
+	}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
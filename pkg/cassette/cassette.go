@@ -0,0 +1,281 @@
+// Package cassette records the LLM completions and command tool outputs of a run to a directory, and replays them
+// so that the run can be repeated offline and deterministically.
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/counter"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+type Mode string
+
+const (
+	ModeRecord Mode = "record"
+	ModeReplay Mode = "replay"
+
+	kindCompletion = "completion"
+	kindCommand    = "command"
+)
+
+// passthrough are the builtins that only control the run, so they are always run instead of recorded.
+var passthrough = map[string]struct{}{
+	"sys.abort":        {},
+	"sys.chat.finish":  {},
+	"sys.chat.history": {},
+	"sys.chat.current": {},
+	"sys.context":      {},
+	"sys.echo":         {},
+}
+
+// Interaction is one recorded request and the responses it got, in order. Identical requests are recorded as one
+// interaction with more than one response.
+type Interaction struct {
+	Kind      string     `json:"kind"`
+	Request   any        `json:"request"`
+	Responses []Response `json:"responses"`
+}
+
+type Response struct {
+	Completion *types.CompletionMessage `json:"completion,omitempty"`
+	Output     string                   `json:"output,omitempty"`
+	Err        string                   `json:"err,omitempty"`
+}
+
+type commandRequest struct {
+	Tool         string `json:"tool"`
+	Instructions string `json:"instructions"`
+	Input        string `json:"input"`
+}
+
+// ErrDrift is returned in replay mode for a request that is not in the cassette.
+type ErrDrift struct {
+	Dir  string
+	Kind string
+	Key  string
+}
+
+// File is where the request that drifted was saved, to compare it to the recorded requests.
+func (e *ErrDrift) File() string {
+	return filepath.Join(e.Dir, "drift", e.Key+".json")
+}
+
+func (e *ErrDrift) Error() string {
+	return fmt.Sprintf("run has drifted from the recording in %s: no recorded %s for request %s, the request was saved to %s, record the run again if the change is expected",
+		e.Dir, e.Kind, e.Key, e.File())
+}
+
+// Cassette is a directory of recorded interactions, one JSON file per request.
+type Cassette struct {
+	dir    string
+	mode   Mode
+	lock   sync.Mutex
+	played map[string]int
+}
+
+// Open opens the cassette in dir. In replay mode the directory must exist.
+func Open(dir string, mode Mode) (*Cassette, error) {
+	switch mode {
+	case ModeRecord:
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cassette %s: %w", dir, err)
+		}
+	case ModeReplay:
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("failed to open cassette %s: %w", dir, err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid cassette mode %q", mode)
+	}
+
+	return &Cassette{
+		dir:    dir,
+		mode:   mode,
+		played: map[string]int{},
+	}, nil
+}
+
+func (c *Cassette) file(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+func (c *Cassette) read(key string) (*Interaction, error) {
+	data, err := os.ReadFile(c.file(key))
+	if err != nil {
+		return nil, err
+	}
+	var interaction Interaction
+	if err := json.Unmarshal(data, &interaction); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", c.file(key), err)
+	}
+	return &interaction, nil
+}
+
+func (c *Cassette) write(file string, interaction any) error {
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+func (c *Cassette) record(kind, key string, request any, resp Response) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	interaction, err := c.read(key)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && c.played[key] == 0) {
+		// Start over for requests recorded by an earlier recording to the same directory.
+		interaction, err = &Interaction{
+			Kind:    kind,
+			Request: request,
+		}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c.played[key]++
+	interaction.Responses = append(interaction.Responses, resp)
+	return c.write(c.file(key), interaction)
+}
+
+// replay returns the next recorded response to the request. When all the responses to a request were used, the last
+// one is repeated.
+func (c *Cassette) replay(kind, key string, request any) (Response, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	interaction, err := c.read(key)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && (interaction.Kind != kind || len(interaction.Responses) == 0)) {
+		drift := &ErrDrift{
+			Dir:  c.dir,
+			Kind: kind,
+			Key:  key,
+		}
+		if err := c.write(drift.File(), Interaction{Kind: kind, Request: request}); err != nil {
+			return Response{}, err
+		}
+		return Response{}, drift
+	} else if err != nil {
+		return Response{}, err
+	}
+
+	i := min(c.played[key], len(interaction.Responses)-1)
+	c.played[key]++
+	return interaction.Responses[i], nil
+}
+
+// Model wraps the model to record its completions, or replaces it to replay them.
+func (c *Cassette) Model(model engine.Model) engine.Model {
+	return &cassetteModel{
+		Model:    model,
+		cassette: c,
+	}
+}
+
+type cassetteModel struct {
+	engine.Model
+	cassette *Cassette
+}
+
+// completionKey returns the request without the IDs of its tools, which have the locations of the scripts the tools are
+// from, so that a recording replays in any checkout of the scripts. The model is not sent the IDs.
+func completionKey(messageRequest types.CompletionRequest) types.CompletionRequest {
+	messageRequest.Tools = slices.Clone(messageRequest.Tools)
+	for i := range messageRequest.Tools {
+		messageRequest.Tools[i].Function.ToolID = ""
+	}
+	return messageRequest
+}
+
+func (m *cassetteModel) Call(ctx context.Context, messageRequest types.CompletionRequest, env []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	keyRequest := completionKey(messageRequest)
+	key := kindCompletion + "-" + hash.Digest(keyRequest)
+
+	if m.cassette.mode == ModeRecord {
+		resp, err := m.Model.Call(ctx, messageRequest, env, status)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.cassette.record(kindCompletion, key, keyRequest, Response{Completion: resp}); err != nil {
+			return nil, fmt.Errorf("failed to record completion: %w", err)
+		}
+		return resp, nil
+	}
+
+	id := counter.Next()
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Request:      messageRequest,
+	}
+
+	resp, err := m.cassette.replay(kindCompletion, key, keyRequest)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Err != "" || resp.Completion == nil {
+		return nil, fmt.Errorf("invalid recorded completion %s", key)
+	}
+
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Response:     resp.Completion,
+		Usage:        resp.Completion.Usage,
+		Cached:       true,
+	}
+	return resp.Completion, nil
+}
+
+// InterceptCommand records the output of command tools, or replays it without running the command.
+func (c *Cassette) InterceptCommand(_ engine.Context, tool types.Tool, input string, run func() (string, error)) (string, error) {
+	if _, ok := passthrough[tool.ID]; ok && tool.BuiltinFunc != nil {
+		return run()
+	}
+
+	request := commandRequest{
+		Tool:         tool.Name,
+		Instructions: tool.Instructions,
+		Input:        input,
+	}
+	key := kindCommand + "-" + hash.Digest(request)
+
+	if c.mode == ModeRecord {
+		out, err := run()
+		resp := Response{
+			Output: out,
+		}
+		if err != nil {
+			resp.Err = err.Error()
+		}
+		if recordErr := c.record(kindCommand, key, request, resp); recordErr != nil {
+			return "", fmt.Errorf("failed to record command output: %w", recordErr)
+		}
+		return out, err
+	}
+
+	resp, err := c.replay(kindCommand, key, request)
+	if err != nil {
+		return "", err
+	}
+	if resp.Err != "" {
+		if err := engine.IsChatFinishMessage(resp.Err); err != nil {
+			return resp.Output, err
+		}
+		return resp.Output, errors.New(resp.Err)
+	}
+	return resp.Output, engine.IsChatFinishMessage(resp.Output)
+}
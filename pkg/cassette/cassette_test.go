@@ -0,0 +1,135 @@
+package cassette
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+type testModel struct {
+	calls int
+}
+
+func (m *testModel) ProxyInfo([]string) (string, string, error) {
+	return "", "", nil
+}
+
+func (m *testModel) Call(_ context.Context, req types.CompletionRequest, _ []string, _ chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	m.calls++
+	return &types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeAssistant,
+		Content: types.Text(req.Messages[0].Content[0].Text + " back"),
+	}, nil
+}
+
+func request(text string) types.CompletionRequest {
+	return types.CompletionRequest{
+		Model: "test",
+		Messages: []types.CompletionMessage{
+			{
+				Role:    types.CompletionMessageRoleTypeUser,
+				Content: types.Text(text),
+			},
+		},
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		dir    = t.TempDir()
+		model  = &testModel{}
+		status = make(chan types.CompletionStatus, 10)
+		tool   = types.Tool{
+			ToolDef: types.ToolDef{
+				Parameters: types.Parameters{
+					Name: "date",
+				},
+				Instructions: "#!/bin/date",
+			},
+		}
+		runs int
+		run  = func() (string, error) {
+			runs++
+			if runs > 1 {
+				return "", errors.New("failed")
+			}
+			return "today", nil
+		}
+	)
+
+	recorder, err := Open(dir, ModeRecord)
+	require.NoError(t, err)
+
+	resp, err := recorder.Model(model).Call(ctx, request("hi"), nil, status)
+	require.NoError(t, err)
+	require.Equal(t, "hi back", resp.Content[0].Text)
+
+	out, err := recorder.InterceptCommand(engine.Context{}, tool, "{}", run)
+	require.NoError(t, err)
+	require.Equal(t, "today", out)
+
+	_, err = recorder.InterceptCommand(engine.Context{}, tool, "{}", run)
+	require.EqualError(t, err, "failed")
+
+	replayer, err := Open(dir, ModeReplay)
+	require.NoError(t, err)
+
+	resp, err = replayer.Model(model).Call(ctx, request("hi"), nil, status)
+	require.NoError(t, err)
+	require.Equal(t, "hi back", resp.Content[0].Text)
+	require.Equal(t, 1, model.calls)
+
+	out, err = replayer.InterceptCommand(engine.Context{}, tool, "{}", run)
+	require.NoError(t, err)
+	require.Equal(t, "today", out)
+
+	_, err = replayer.InterceptCommand(engine.Context{}, tool, "{}", run)
+	require.EqualError(t, err, "failed")
+	require.Equal(t, 2, runs)
+
+	_, err = replayer.Model(model).Call(ctx, request("bye"), nil, status)
+	var drift *ErrDrift
+	require.ErrorAs(t, err, &drift)
+	require.FileExists(t, drift.File())
+	require.Equal(t, 1, model.calls)
+}
+
+func TestReplayFromOtherDirectory(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		model  = &testModel{}
+		script = "Tools: helper\n\nhi\n\n---\nName: helper\nDescription: Helps\n\n#!/bin/echo help\n"
+	)
+
+	// run runs the script from a copy in a new directory with the model of the cassette.
+	run := func(model engine.Model) (*engine.Return, error) {
+		file := filepath.Join(t.TempDir(), "script.gpt")
+		require.NoError(t, os.WriteFile(file, []byte(script), 0644))
+		prg, err := loader.Program(context.Background(), file, "", loader.Options{})
+		require.NoError(t, err)
+
+		ctx, err := engine.NewContext(context.Background(), &prg, "", nil)
+		require.NoError(t, err)
+		return (&engine.Engine{Model: model}).Start(ctx, "")
+	}
+
+	recorder, err := Open(dir, ModeRecord)
+	require.NoError(t, err)
+	_, err = run(recorder.Model(model))
+	require.NoError(t, err)
+
+	replayer, err := Open(dir, ModeReplay)
+	require.NoError(t, err)
+	ret, err := run(replayer.Model(model))
+	require.NoError(t, err)
+	require.Equal(t, "hi back", *ret.Result)
+	require.Equal(t, 1, model.calls)
+}
@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	cmd2 "github.com/gptscript-ai/cmd"
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/spf13/cobra"
+)
+
+type Cache struct {
+	root *GPTScript
+}
+
+func (c *Cache) Customize(cmd *cobra.Command) {
+	cmd.Use = "cache"
+	cmd.Short = "Inspect and clean up the cache of LLM responses, OpenAPI schemas and tool sources"
+	cmd.Args = cobra.NoArgs
+	cmd.AddCommand(cmd2.Command(&CacheList{root: c.root}))
+	cmd.AddCommand(cmd2.Command(&CacheStats{root: c.root}))
+	cmd.AddCommand(cmd2.Command(&CachePrune{root: c.root}))
+	cmd.AddCommand(cmd2.Command(&CacheClear{root: c.root}))
+}
+
+func (c *Cache) Run(cmd *cobra.Command, _ []string) error {
+	return cmd.Help()
+}
+
+func newCacheClient(root *GPTScript) (*cache.Client, error) {
+	return cache.New(cache.Options(root.CacheOptions))
+}
+
+func parseKinds(args []string) ([]cache.Kind, error) {
+	kinds := make([]cache.Kind, 0, len(args))
+	for _, arg := range args {
+		kind, err := cache.ParseKind(arg)
+		if err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+type CacheList struct {
+	root *GPTScript
+}
+
+func (c *CacheList) Customize(cmd *cobra.Command) {
+	cmd.Use = "ls [KIND...]"
+	cmd.Aliases = []string{"list"}
+	cmd.SilenceUsage = true
+	cmd.Short = "List the cache entries, optionally only of the kinds llm, openapi, source or unknown, from the least to the most recently used"
+}
+
+func (c *CacheList) Run(_ *cobra.Command, args []string) error {
+	kinds, err := parseKinds(args)
+	if err != nil {
+		return err
+	}
+
+	client, err := newCacheClient(c.root)
+	if err != nil {
+		return err
+	}
+
+	entries, err := client.List(kinds...)
+	if err != nil {
+		return fmt.Errorf("failed to list cache entries: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 10, 1, 3, ' ', 0)
+	defer w.Flush()
+
+	_, _ = w.Write([]byte("KEY\tKIND\tSIZE\tCREATED\tLAST HIT\n"))
+	for _, entry := range entries {
+		lastHit := "never"
+		if !entry.LastHit.IsZero() {
+			lastHit = ago(entry.LastHit)
+		}
+		printFields(w, []any{entry.Key[:12], entry.Kind, formatSize(entry.Size), ago(entry.Created), lastHit})
+	}
+	return nil
+}
+
+type CacheStats struct {
+	root *GPTScript
+}
+
+func (c *CacheStats) Customize(cmd *cobra.Command) {
+	cmd.Use = "stats"
+	cmd.SilenceUsage = true
+	cmd.Short = "Show the number and size of the cache entries by kind"
+	cmd.Args = cobra.NoArgs
+}
+
+func (c *CacheStats) Run(_ *cobra.Command, _ []string) error {
+	client, err := newCacheClient(c.root)
+	if err != nil {
+		return err
+	}
+
+	stats, err := client.Stats()
+	if err != nil {
+		return fmt.Errorf("failed to read cache stats: %w", err)
+	}
+
+	maxSize := "unlimited"
+	if stats.MaxSize > 0 {
+		maxSize = formatSize(stats.MaxSize)
+	}
+
+	fmt.Printf("Directory: %s\n", stats.Dir)
+	fmt.Printf("Entries:   %d\n", stats.Entries)
+	fmt.Printf("Size:      %s of %s\n", formatSize(stats.Size), maxSize)
+	if stats.Remote != "" {
+		mode := "read-write"
+		if stats.RemoteReadOnly {
+			mode = "read-only"
+		}
+		fmt.Printf("Remote:    %s (%s)\n", stats.Remote, mode)
+	}
+	if stats.Entries > 0 {
+		fmt.Printf("Oldest:    %s\n", ago(stats.Oldest))
+		fmt.Printf("Newest:    %s\n", ago(stats.Newest))
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 10, 1, 3, ' ', 0)
+	defer w.Flush()
+
+	_, _ = w.Write([]byte("KIND\tENTRIES\tSIZE\tTTL\n"))
+	for _, kind := range append(slices.Clone(cache.Kinds), cache.KindUnknown) {
+		ttl, ok := stats.TTLs[kind]
+		if !ok {
+			ttl, ok = stats.TTLs["*"]
+		}
+		if !ok {
+			ttl = "forever"
+		}
+		printFields(w, []any{kind, fmt.Sprint(stats.Kinds[kind].Entries), formatSize(stats.Kinds[kind].Size), ttl})
+	}
+	return nil
+}
+
+type CachePrune struct {
+	root *GPTScript
+}
+
+func (c *CachePrune) Customize(cmd *cobra.Command) {
+	cmd.Use = "prune"
+	cmd.SilenceUsage = true
+	cmd.Short = "Remove the cache entries that outlived the --cache-ttl, then the least recently used entries over the --cache-max-size"
+	cmd.Args = cobra.NoArgs
+}
+
+func (c *CachePrune) Run(_ *cobra.Command, _ []string) error {
+	client, err := newCacheClient(c.root)
+	if err != nil {
+		return err
+	}
+
+	result, err := client.Prune()
+	if err != nil {
+		return fmt.Errorf("failed to prune cache: %w", err)
+	}
+
+	fmt.Printf("Removed %d expired and %d evicted entries, freeing %s\n", result.Expired, result.Evicted, formatSize(result.Size))
+	return nil
+}
+
+type CacheClear struct {
+	root *GPTScript
+}
+
+func (c *CacheClear) Customize(cmd *cobra.Command) {
+	cmd.Use = "clear [KIND...]"
+	cmd.SilenceUsage = true
+	cmd.Short = "Remove all the cache entries, or only those of the kinds llm, openapi, source or unknown"
+}
+
+func (c *CacheClear) Run(_ *cobra.Command, args []string) error {
+	kinds, err := parseKinds(args)
+	if err != nil {
+		return err
+	}
+
+	client, err := newCacheClient(c.root)
+	if err != nil {
+		return err
+	}
+
+	result, err := client.Clear(kinds...)
+	if err != nil {
+		return fmt.Errorf("failed to clear cache: %w", err)
+	}
+
+	fmt.Printf("Removed %d entries, freeing %s\n", result.Cleared, formatSize(result.Size))
+	return nil
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, exp := float64(size)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[exp])
+}
+
+func ago(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
@@ -64,6 +64,7 @@ func (e *Eval) Run(cmd *cobra.Command, args []string) error {
 
 	prg, err := loader.ProgramFromSource(cmd.Context(), tool.String(), "", loader.Options{
 		Cache: g.Cache,
+		Trust: e.gptscript.trust,
 	})
 	if err != nil {
 		return err
@@ -78,6 +79,7 @@ func (e *Eval) Run(cmd *cobra.Command, args []string) error {
 		return chat.Start(cmd.Context(), nil, g, func() (types.Program, error) {
 			return loader.ProgramFromSource(cmd.Context(), tool.String(), "", loader.Options{
 				Cache: g.Cache,
+				Trust: e.gptscript.trust,
 			})
 		}, os.Environ(), toolInput, "")
 	}
@@ -3,17 +3,23 @@ package cli
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 
+	"github.com/adrg/xdg"
 	"github.com/fatih/color"
+	"github.com/google/uuid"
 	"github.com/gptscript-ai/cmd"
 	gptscript2 "github.com/gptscript-ai/go-gptscript"
+	"github.com/gptscript-ai/gptscript/pkg/anthropic"
 	"github.com/gptscript-ai/gptscript/pkg/auth"
 	"github.com/gptscript-ai/gptscript/pkg/builtin"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
@@ -21,11 +27,15 @@ import (
 	"github.com/gptscript-ai/gptscript/pkg/env"
 	"github.com/gptscript-ai/gptscript/pkg/gptscript"
 	"github.com/gptscript-ai/gptscript/pkg/input"
+	"github.com/gptscript-ai/gptscript/pkg/llm"
 	"github.com/gptscript-ai/gptscript/pkg/loader"
 	"github.com/gptscript-ai/gptscript/pkg/loader/github"
+	"github.com/gptscript-ai/gptscript/pkg/loader/vcs"
 	"github.com/gptscript-ai/gptscript/pkg/monitor"
 	"github.com/gptscript-ai/gptscript/pkg/mvl"
 	"github.com/gptscript-ai/gptscript/pkg/openai"
+	"github.com/gptscript-ai/gptscript/pkg/ratelimit"
+	"github.com/gptscript-ai/gptscript/pkg/repos/runtimes"
 	"github.com/gptscript-ai/gptscript/pkg/runner"
 	"github.com/gptscript-ai/gptscript/pkg/system"
 	"github.com/gptscript-ai/gptscript/pkg/types"
@@ -37,18 +47,21 @@ import (
 )
 
 type (
-	DisplayOptions monitor.Options
-	CacheOptions   cache.Options
-	OpenAIOptions  openai.Options
+	DisplayOptions   monitor.Options
+	CacheOptions     cache.Options
+	OpenAIOptions    openai.Options
+	AnthropicOptions anthropic.Options
 )
 
 type GPTScript struct {
 	CacheOptions
 	OpenAIOptions
+	AnthropicOptions
 	DisplayOptions
 	SystemToolsDir string `usage:"Directory that contains system managed tool for which GPTScript will not manage the runtime"`
 	Color          *bool  `usage:"Use color in output (default true)" default:"true"`
 	Confirm        bool   `usage:"Prompt before running potentially dangerous commands"`
+	Sandbox        bool   `usage:"Run command tools in a sandbox with a read-only filesystem, a writable workspace, and no network unless the tool allows it"`
 	Debug          bool   `usage:"Enable debug logging"`
 	NoTrunc        bool   `usage:"Do not truncate long log messages"`
 	Quiet          *bool  `usage:"No output logging (set --quiet=false to force on even when there is no TTY)" short:"q"`
@@ -72,10 +85,30 @@ type GPTScript struct {
 	UI                       bool     `usage:"Launch the UI" local:"true" name:"ui"`
 	DisableTUI               bool     `usage:"Don't use chat TUI but instead verbose output" local:"true" name:"disable-tui"`
 	SaveChatStateFile        string   `usage:"A file to save the chat state to so that a conversation can be resumed with --chat-state" local:"true"`
+	Checkpoint               bool     `usage:"Checkpoint the run so that it can be resumed with --resume if it fails or is interrupted" local:"true"`
+	Resume                   string   `usage:"Resume a failed or interrupted run from its last checkpoint using the run ID" local:"true"`
+	BudgetTokens             int      `usage:"Maximum number of tokens the run may use across all calls and chat turns (0 for no limit)" local:"true"`
+	PriceTable               string   `usage:"Path to a JSON or YAML file of model prices in USD per million tokens, used to enforce Max Cost"`
+	ModelRoutes              string   `usage:"Path to a JSON or YAML file of model fallbacks and rules that route calls to other models"`
+	RateLimit                []string `usage:"Requests or tokens per minute sent to a model provider, as provider:rpm=N or provider:tpm=N, for example openai:tpm=30000"`
+	MaxInflightCompletions   int      `usage:"Maximum number of completions requested from the model providers at once (default: unlimited)"`
+	Policy                   string   `usage:"Path to a YAML or JSON policy file of rules that allow, deny, or ask before running tools"`
+	PolicyDecisions          string   `usage:"File to store the decisions to always or never allow a tool in (default is in the config directory)"`
+	PolicyAuditLog           string   `usage:"File to append a JSON line to for every decision made by the policy"`
+	Record                   string   `usage:"Record the LLM completions and command tool outputs of the run to this directory" local:"true"`
+	Replay                   string   `usage:"Replay the LLM completions and command tool outputs recorded with --record from this directory, failing if the run differs" local:"true"`
+	Lockfile                 string   `usage:"Lock file that pins the remote tools of the script to a revision, written by gptscript lock (default: gptscript.lock next to the script if it exists)"`
+	FrozenLockfile           bool     `usage:"Fail if a remote tool is not in the lock file"`
+	VendorDir                string   `usage:"Load remote tools only from a directory written by gptscript vendor"`
 	DefaultModelProvider     string   `usage:"Default LLM model provider to use, this will override OpenAI settings"`
+	MockFile                 string   `usage:"YAML file of the replies of the mock model provider, used with --default-model-provider mock or Model: name from mock (default: gptscript.mock.yaml)"`
 	GithubEnterpriseHostname string   `usage:"The host name for a Github Enterprise instance to enable for remote loading" local:"true"`
+	VCSHosts                 string   `usage:"YAML or JSON file of the GitHub Enterprise, GitLab, Gitea and git hosts to load remote tools from (default: vcs-hosts.yaml in the config directory)" name:"vcs-hosts"`
+	TrustedKeys              string   `usage:"File of the SSH and minisign public keys to verify the signatures of remote tools with (default: trusted-keys in the config directory)"`
+	RequireSignatures        bool     `usage:"Fail to load remote tools that are not signed by a trusted key"`
 
 	readData []byte
+	trust    *loader.Trust
 }
 
 func New() *cobra.Command {
@@ -84,8 +117,13 @@ func New() *cobra.Command {
 		root,
 		&Eval{gptscript: root},
 		&Credential{root: root},
+		&Cache{root: root},
 		&Parse{gptscript: root},
 		&Fmt{},
+		&Lock{gptscript: root},
+		&Vendor{gptscript: root},
+		&Lint{gptscript: root},
+		&Test{gptscript: root},
 		&Getenv{},
 		&SDKServer{
 			GPTScript: root,
@@ -130,14 +168,24 @@ func New() *cobra.Command {
 	return command
 }
 
+func (r *GPTScript) newPolicyAuthorizer() (*auth.PolicyAuthorizer, error) {
+	return auth.NewPolicyAuthorizer(auth.PolicyOptions{
+		File:          r.Policy,
+		DecisionsFile: r.PolicyDecisions,
+		AuditLog:      r.PolicyAuditLog,
+	})
+}
+
 func (r *GPTScript) NewGPTScriptOpts() (gptscript.Options, error) {
 	opts := gptscript.Options{
-		Cache:   cache.Options(r.CacheOptions),
-		OpenAI:  openai.Options(r.OpenAIOptions),
-		Monitor: monitor.Options(r.DisplayOptions),
+		Cache:     cache.Options(r.CacheOptions),
+		OpenAI:    openai.Options(r.OpenAIOptions),
+		Anthropic: anthropic.Options(r.AnthropicOptions),
+		Monitor:   monitor.Options(r.DisplayOptions),
 		Runner: runner.Options{
 			CredentialOverrides: r.CredentialOverride,
 			Sequential:          r.ForceSequential,
+			Sandbox:             r.Sandbox,
 		},
 		Quiet:                r.Quiet,
 		Env:                  os.Environ(),
@@ -146,12 +194,50 @@ func (r *GPTScript) NewGPTScriptOpts() (gptscript.Options, error) {
 		DisablePromptServer:  r.UI,
 		DefaultModelProvider: r.DefaultModelProvider,
 		SystemToolsDir:       r.SystemToolsDir,
+		Record:               r.Record,
+		Replay:               r.Replay,
+		MockFile:             r.MockFile,
+		Trust:                r.trust,
 	}
 
-	if r.Confirm {
+	if r.VendorDir != "" {
+		opts.Runner.RuntimeManager = runtimes.Vendored(cache.Complete(opts.Cache).CacheDir, r.SystemToolsDir)
+	}
+
+	if r.Policy != "" {
+		policy, err := r.newPolicyAuthorizer()
+		if err != nil {
+			return gptscript.Options{}, err
+		}
+		opts.Runner.Authorizer = policy.Authorizer(auth.AuthorizeRemember)
+	} else if r.Confirm {
 		opts.Runner.Authorizer = auth.Authorize
 	}
 
+	if r.PriceTable != "" {
+		prices, err := runner.LoadPrices(r.PriceTable)
+		if err != nil {
+			return gptscript.Options{}, err
+		}
+		opts.Runner.Prices = prices
+	}
+
+	if r.ModelRoutes != "" {
+		routes, err := llm.LoadRoutes(r.ModelRoutes)
+		if err != nil {
+			return gptscript.Options{}, err
+		}
+		opts.ModelRoutes = routes
+	}
+
+	if len(r.RateLimit) > 0 || r.MaxInflightCompletions > 0 {
+		limits, err := ratelimit.Parse(r.RateLimit...)
+		if err != nil {
+			return gptscript.Options{}, err
+		}
+		opts.RateLimiter = ratelimit.New(r.MaxInflightCompletions, limits)
+	}
+
 	if r.Ports != "" {
 		start, end, _ := strings.Cut(r.Ports, "-")
 		startNum, err := strconv.ParseInt(strings.TrimSpace(start), 10, 64)
@@ -231,6 +317,20 @@ func (r *GPTScript) PersistentPre(*cobra.Command, []string) error {
 
 	system.SetBinToSelf()
 
+	hostsFile := r.VCSHosts
+	if hostsFile == "" {
+		hostsFile = filepath.Join(xdg.ConfigHome, "gptscript", "vcs-hosts.yaml")
+	}
+	hosts, err := vcs.LoadHosts(hostsFile, r.VCSHosts == "")
+	if err != nil {
+		return err
+	}
+	vcs.AddHosts(hosts)
+
+	if r.trust, err = r.loadTrust(); err != nil {
+		return err
+	}
+
 	if r.DefaultModel != "" {
 		builtin.SetDefaultModel(r.DefaultModel)
 	}
@@ -275,17 +375,75 @@ func (r *GPTScript) listModels(ctx context.Context, gptScript *gptscript.GPTScri
 		return err
 	}
 
+	w := tabwriter.NewWriter(os.Stdout, 10, 1, 3, ' ', 0)
+	defer w.Flush()
+
+	_, _ = w.Write([]byte("MODEL\tCONTEXT WINDOW\tMAX OUTPUT TOKENS\tTOKENIZER\n"))
 	for _, model := range models {
-		fmt.Println(model.ID)
+		info, _ := gptScript.Models.Info(model.ID)
+		printFields(w, []any{model.ID, tokenCount(info.ContextWindow), tokenCount(info.MaxOutputTokens), gptScript.Models.TokenizerName(model.ID)})
 	}
 	return nil
 }
 
+func tokenCount(count int) string {
+	if count == 0 {
+		return "-"
+	}
+	return strconv.Itoa(count)
+}
+
+// loadLock reads the lock file of the program, which is optional unless it is set or the lock is frozen.
+func (r *GPTScript) loadLock(program string) (*loader.Lock, error) {
+	file := r.Lockfile
+	if file == "" {
+		file = loader.DefaultLockPath(program)
+		if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) && !r.FrozenLockfile {
+			if _, err := os.Stat(loader.DefaultLockFile); err == nil && filepath.Clean(file) != loader.DefaultLockFile {
+				log.Infof("WARNING: ignoring %s in the current directory, the lock file of %s is %s", loader.DefaultLockFile, program, file)
+			} else {
+				log.Debugf("no lock file at %s, the remote tools of %s are not pinned", file, program)
+			}
+			return nil, nil
+		}
+	}
+	return loader.LoadLock(file, r.FrozenLockfile)
+}
+
+// loadTrust reads the trusted keys, which are optional unless they are set or signatures are required.
+func (r *GPTScript) loadTrust() (*loader.Trust, error) {
+	file := r.TrustedKeys
+	if file == "" {
+		file = filepath.Join(xdg.ConfigHome, "gptscript", "trusted-keys")
+		if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) && !r.RequireSignatures {
+			return nil, nil
+		}
+	}
+	return loader.LoadTrust(file, r.RequireSignatures)
+}
+
+// loadVendor reads the vendor directory if one is set.
+func (r *GPTScript) loadVendor() (*loader.Vendor, error) {
+	if r.VendorDir == "" {
+		return nil, nil
+	}
+	return loader.LoadVendor(r.VendorDir)
+}
+
 func (r *GPTScript) readProgram(ctx context.Context, runner *gptscript.GPTScript, args []string) (prg types.Program, err error) {
 	if len(args) == 0 {
 		return
 	}
 
+	lock, err := r.loadLock(args[0])
+	if err != nil {
+		return prg, err
+	}
+	vendor, err := r.loadVendor()
+	if err != nil {
+		return prg, err
+	}
+
 	if args[0] == "-" {
 		var (
 			data []byte
@@ -301,12 +459,18 @@ func (r *GPTScript) readProgram(ctx context.Context, runner *gptscript.GPTScript
 			r.readData = data
 		}
 		return loader.ProgramFromSource(ctx, string(data), r.SubTool, loader.Options{
-			Cache: runner.Cache,
+			Cache:  runner.Cache,
+			Lock:   lock,
+			Vendor: vendor,
+			Trust:  r.trust,
 		})
 	}
 
 	return loader.Program(ctx, args[0], r.SubTool, loader.Options{
-		Cache: runner.Cache,
+		Cache:  runner.Cache,
+		Lock:   lock,
+		Vendor: vendor,
+		Trust:  r.trust,
 	})
 }
 
@@ -415,6 +579,36 @@ func (r *GPTScript) Run(cmd *cobra.Command, args []string) (retErr error) {
 		return r.listModels(ctx, gptScript, args)
 	}
 
+	var checkpoint *runner.Checkpoint
+	if r.Resume != "" {
+		if len(args) > 0 {
+			return fmt.Errorf("a program can not be specified when resuming run %s", r.Resume)
+		}
+
+		var ok bool
+		checkpoint, ok, err = gptScript.Checkpoints.Load(ctx, r.Resume)
+		if err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("no checkpoint found for run %s", r.Resume)
+		}
+
+		program := checkpoint.Program
+		if checkpoint.Dir != "" {
+			// The program was run from a relative path, which it is loaded from again so that its tools have the same IDs.
+			if err := os.Chdir(checkpoint.Dir); err != nil {
+				return fmt.Errorf("failed to resume run %s in %s: %w", r.Resume, checkpoint.Dir, err)
+			}
+			program, err = filepath.Rel(checkpoint.Dir, program)
+			if err != nil {
+				return err
+			}
+		}
+
+		args = []string{program}
+		r.SubTool = checkpoint.SubTool
+	}
+
 	prg, err := r.readProgram(ctx, gptScript, args)
 	if err != nil {
 		return err
@@ -441,6 +635,9 @@ func (r *GPTScript) Run(cmd *cobra.Command, args []string) (retErr error) {
 	if err != nil {
 		return err
 	}
+	if checkpoint != nil {
+		toolInput = checkpoint.Input
+	}
 
 	var chatState string
 	if r.ChatState != "" && r.ChatState != "null" && !strings.HasPrefix(r.ChatState, "{") {
@@ -453,7 +650,9 @@ func (r *GPTScript) Run(cmd *cobra.Command, args []string) (retErr error) {
 
 	// This chat in a stateless mode
 	if r.SaveChatStateFile == "-" || r.SaveChatStateFile == "stdout" {
-		resp, err := gptScript.Chat(cmd.Context(), chatState, prg, gptOpt.Env, toolInput, runner.RunOptions{})
+		resp, err := gptScript.Chat(cmd.Context(), chatState, prg, gptOpt.Env, toolInput, runner.RunOptions{
+			BudgetTokens: r.BudgetTokens,
+		})
 		if err != nil {
 			return err
 		}
@@ -495,10 +694,46 @@ func (r *GPTScript) Run(cmd *cobra.Command, args []string) (retErr error) {
 		gptScript.ExtraEnv = nil
 	}
 
-	s, err := gptScript.Run(cmd.Context(), prg, gptOpt.Env, toolInput, runner.RunOptions{})
+	runOpts := runner.RunOptions{
+		BudgetTokens: r.BudgetTokens,
+	}
+	if checkpoint != nil {
+		runOpts.CheckpointID = checkpoint.ID
+	} else if r.Checkpoint && args[0] != "-" && !r.Daemon {
+		runOpts.CheckpointID, err = r.newCheckpoint(ctx, gptScript, args[0], toolInput)
+		if err != nil {
+			return err
+		}
+	}
+
+	s, err := gptScript.Run(cmd.Context(), prg, gptOpt.Env, toolInput, runOpts)
 	if err != nil {
+		if runOpts.CheckpointID != "" {
+			_, _ = fmt.Fprintf(os.Stderr, "The run can be resumed with: gptscript --resume %s\n", runOpts.CheckpointID)
+		}
 		return err
 	}
 
 	return r.PrintOutput(toolInput, s)
 }
+
+// newCheckpoint records what is needed to load the program again so that the run can later be resumed by ID alone.
+func (r *GPTScript) newCheckpoint(ctx context.Context, gptScript *gptscript.GPTScript, program, toolInput string) (string, error) {
+	var dir string
+	if _, err := os.Stat(program); err == nil && !filepath.IsAbs(program) {
+		dir, err = os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		program = filepath.Join(dir, program)
+	}
+
+	id := uuid.NewString()
+	return id, gptScript.Checkpoints.Save(ctx, runner.Checkpoint{
+		ID:      id,
+		Program: program,
+		Dir:     dir,
+		SubTool: r.SubTool,
+		Input:   toolInput,
+	})
+}
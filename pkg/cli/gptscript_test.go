@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumeRelativePath(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	marker := filepath.Join(dir, "marker")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fail.gpt"), []byte(`#!/bin/sh
+test -f `+marker+` || exit 1
+echo resumed
+`), 0644))
+	t.Chdir(dir)
+
+	run := func(args ...string) error {
+		cmd := New()
+		cmd.SetArgs(append([]string{"--cache-dir", cacheDir, "--disable-tui", "--quiet"}, args...))
+		return cmd.ExecuteContext(context.Background())
+	}
+
+	// Runs are only checkpointed with --checkpoint.
+	require.Error(t, run("./fail.gpt"))
+	require.NoDirExists(t, filepath.Join(cacheDir, "checkpoints"))
+
+	// The first run fails, which leaves its checkpoint behind.
+	require.Error(t, run("--checkpoint", "./fail.gpt"))
+
+	entries, err := os.ReadDir(filepath.Join(cacheDir, "checkpoints"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	id := entries[0].Name()[:len(entries[0].Name())-len(".json")]
+
+	checkpoint, ok, err := runner.NewFileCheckpointStore(filepath.Join(cacheDir, "checkpoints")).Load(context.Background(), id)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, filepath.Join(dir, "fail.gpt"), checkpoint.Program)
+	assert.Equal(t, dir, checkpoint.Dir)
+
+	// The checkpoint of a run that got further records the ID of its entry tool, which is checked on resume.
+	prg, err := loader.Program(context.Background(), "./fail.gpt", "", loader.Options{})
+	require.NoError(t, err)
+	checkpoint.EntryToolID = prg.EntryToolID
+	require.NoError(t, runner.NewFileCheckpointStore(filepath.Join(cacheDir, "checkpoints")).Save(context.Background(), *checkpoint))
+
+	// The run is resumed from the directory it was started in, wherever it is resumed from.
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile(marker, nil, 0644))
+	assert.NoError(t, run("--resume", id))
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gptscript-ai/gptscript/pkg/lint"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/spf13/cobra"
+)
+
+type Lint struct {
+	Format    string `usage:"Output format: text, json or sarif" default:"text"`
+	gptscript *GPTScript
+}
+
+func (l *Lint) Customize(cmd *cobra.Command) {
+	cmd.Use = "lint [flags] PROGRAM_FILE..."
+	cmd.Short = "Check scripts for problems that would only show when they run"
+	cmd.Args = cobra.MinimumNArgs(1)
+}
+
+func (l *Lint) Run(cmd *cobra.Command, args []string) error {
+	if l.Format != "text" && l.Format != "json" && l.Format != "sarif" {
+		return fmt.Errorf("invalid format %q, must be text, json or sarif", l.Format)
+	}
+
+	c, err := newCacheClient(l.gptscript)
+	if err != nil {
+		return err
+	}
+	lock, err := l.gptscript.loadLock(args[0])
+	if err != nil {
+		return err
+	}
+	vendor, err := l.gptscript.loadVendor()
+	if err != nil {
+		return err
+	}
+
+	var diagnostics []lint.Diagnostic
+	for _, arg := range args {
+		var content string
+		if arg == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			content = string(data)
+		}
+
+		result, err := lint.Lint(cmd.Context(), locationName(arg), content, lint.Options{
+			Loader: loader.Options{
+				Cache:     c,
+				Lock:      lock,
+				Vendor:    vendor,
+				Trust:     l.gptscript.trust,
+				MCPLoader: unloadedMCP{},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		diagnostics = append(diagnostics, result...)
+	}
+
+	switch l.Format {
+	case "json":
+		if diagnostics == nil {
+			diagnostics = []lint.Diagnostic{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(diagnostics)
+	case "sarif":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(lint.ToSARIF(diagnostics, lint.DefaultRules()...))
+	default:
+		for _, d := range diagnostics {
+			fmt.Println(d)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var errs int
+	for _, d := range diagnostics {
+		if d.Severity == lint.SeverityError {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return fmt.Errorf("found %d errors", errs)
+	}
+	return nil
+}
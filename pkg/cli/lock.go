@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+type Lock struct {
+	gptscript *GPTScript
+}
+
+func (l *Lock) Customize(cmd *cobra.Command) {
+	cmd.Use = "lock [flags] PROGRAM_FILE..."
+	cmd.Short = "Pin the remote tools that scripts reference to their latest revision in a lock file"
+	cmd.Args = cobra.MinimumNArgs(1)
+}
+
+func (l *Lock) Run(cmd *cobra.Command, args []string) error {
+	c, err := newCacheClient(l.gptscript)
+	if err != nil {
+		return err
+	}
+
+	lock := loader.NewLock()
+	for _, arg := range args {
+		if _, err := loader.Program(cmd.Context(), arg, "", loader.Options{
+			Cache:     c,
+			Lock:      lock,
+			Trust:     l.gptscript.trust,
+			MCPLoader: unloadedMCP{},
+		}); err != nil {
+			return err
+		}
+	}
+
+	file := types.FirstSet(l.gptscript.Lockfile, loader.DefaultLockPath(args[0]))
+	if err := lock.Save(file); err != nil {
+		return err
+	}
+
+	fmt.Printf("Locked %d remote tools in %s\n", len(lock.Tools), file)
+	return nil
+}
+
+// unloadedMCP keeps the MCP servers of the scripts as they are instead of starting them, since only the remote tools
+// are locked or vendored.
+type unloadedMCP struct{}
+
+func (unloadedMCP) Load(_ context.Context, tool types.Tool) ([]types.Tool, error) {
+	return []types.Tool{tool}, nil
+}
+
+func (unloadedMCP) Close() error {
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/gptscript-ai/cmd"
 	"github.com/gptscript-ai/gptscript/pkg/daemon"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
 	"github.com/gptscript-ai/gptscript/pkg/mvl"
 	"github.com/nanobot-ai/nanobot/pkg/supervise"
 )
@@ -23,6 +24,13 @@ func Main() {
 			}
 			os.Exit(0)
 		}
+		if os.Args[1] == "sys.sandbox" {
+			if err := engine.SysSandbox(os.Args[2:]); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "failed to set up the sandbox: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
 		if os.Args[1] == "_exec" {
 			if err := supervise.Daemon(); err != nil {
 				_, _ = fmt.Fprintf(os.Stderr, "failed running _exec: %v\n", err)
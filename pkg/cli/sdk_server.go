@@ -2,8 +2,11 @@ package cli
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"time"
 
+	"github.com/gptscript-ai/gptscript/pkg/auth"
 	"github.com/gptscript-ai/gptscript/pkg/sdkserver"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
@@ -13,6 +16,12 @@ type SDKServer struct {
 	*GPTScript
 	DatasetTool   string `usage:"Tool to use for datasets"`
 	WorkspaceTool string `usage:"Tool to use for workspace"`
+	APIKeysFile   string `usage:"Path to a YAML or JSON file of the API keys clients must authenticate with" name:"api-keys-file"`
+	APIKeys       string `usage:"YAML or JSON API keys clients must authenticate with, in the format of --api-keys-file" name:"api-keys"`
+	AuditLog      string `usage:"File to append a JSON line to for every request to a sensitive route"`
+	RunStore      string `usage:"Directory to persist runs in, so they can be listed and replayed after a restart (default: memory only)"`
+	RunRetention  string `usage:"How long finished runs are kept, as a duration such as 168h (default: forever)"`
+	MaxRuns       int    `usage:"How many finished runs are kept" default:"100"`
 }
 
 func (c *SDKServer) Customize(cmd *cobra.Command) {
@@ -35,11 +44,48 @@ func (c *SDKServer) Run(cmd *cobra.Command, _ []string) error {
 		ctx = cmd.Context()
 	}
 
+	var policy *auth.PolicyAuthorizer
+	if c.Policy != "" {
+		policy, err = c.newPolicyAuthorizer()
+		if err != nil {
+			return err
+		}
+	}
+
+	var apiKeys []sdkserver.APIKey
+	if c.APIKeysFile != "" {
+		apiKeys, err = sdkserver.LoadAPIKeys(c.APIKeysFile)
+		if err != nil {
+			return err
+		}
+	}
+	if c.APIKeys != "" {
+		keys, err := sdkserver.ParseAPIKeys([]byte(c.APIKeys))
+		if err != nil {
+			return fmt.Errorf("invalid API keys: %w", err)
+		}
+		apiKeys = append(apiKeys, keys...)
+	}
+
+	var runRetention time.Duration
+	if c.RunRetention != "" {
+		runRetention, err = time.ParseDuration(c.RunRetention)
+		if err != nil {
+			return fmt.Errorf("invalid run retention %q: %w", c.RunRetention, err)
+		}
+	}
+
 	return sdkserver.Run(ctx, sdkserver.Options{
 		Options:       opts,
+		Policy:        policy,
 		ListenAddress: c.ListenAddress,
 		Debug:         c.Debug,
 		DatasetTool:   c.DatasetTool,
 		WorkspaceTool: c.WorkspaceTool,
+		APIKeys:       apiKeys,
+		AuditLog:      c.AuditLog,
+		RunStore:      c.RunStore,
+		RunRetention:  runRetention,
+		MaxRuns:       c.MaxRuns,
 	})
 }
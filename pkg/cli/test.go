@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/gptscript"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/repos/runtimes"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/scripttest"
+	"github.com/gptscript-ai/gptscript/pkg/tests/judge"
+	"github.com/spf13/cobra"
+)
+
+type Test struct {
+	JUnit string `usage:"Write the results as JUnit XML to this file, or - for stdout" name:"junit"`
+
+	gptscript *GPTScript
+}
+
+func (t *Test) Customize(cmd *cobra.Command) {
+	cmd.Use = "test [flags] [PATH...]"
+	cmd.Short = "Run the test cases in the *.test.gpt and *.test.yaml files in the paths, by default the current directory"
+}
+
+func (t *Test) Run(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	files, err := scripttest.Discover(args...)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no test specs found in %s", strings.Join(args, ", "))
+	}
+
+	opts, err := t.gptscript.NewGPTScriptOpts()
+	if err != nil {
+		return err
+	}
+	lock, err := t.gptscript.loadLock(args[0])
+	if err != nil {
+		return err
+	}
+	vendor, err := t.gptscript.loadVendor()
+	if err != nil {
+		return err
+	}
+	if t.gptscript.Quiet == nil {
+		quiet := true
+		opts.Quiet = &quiet
+	}
+	if opts.Workspace == "" {
+		// The runners of the test cases that mock the model share the workspace, so it's created here.
+		opts.Workspace, err = os.MkdirTemp("", "gptscript-workspace-*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(opts.Workspace)
+	}
+
+	g, err := gptscript.New(cmd.Context(), opts)
+	if err != nil {
+		return err
+	}
+	defer g.Close(true)
+
+	testOpts := scripttest.Options{
+		Runner: g,
+		NewMockRunner: func(model engine.Model) (scripttest.Runner, error) {
+			r, err := runner.New(model, credentials.NoopStore{}, runner.Options{
+				RuntimeManager: runtimes.Default(g.Cache.CacheDir(), opts.SystemToolsDir),
+				Sequential:     opts.Runner.Sequential,
+				Sandbox:        opts.Runner.Sandbox,
+			})
+			if err != nil {
+				return nil, err
+			}
+			mock := *g
+			mock.Runner = r
+			return &mock, nil
+		},
+		Loader: loader.Options{
+			Cache:  g.Cache,
+			Lock:   lock,
+			Vendor: vendor,
+			Trust:  t.gptscript.trust,
+		},
+		Env: opts.Env,
+	}
+
+	if apiKey := t.gptscript.OpenAIOptions.APIKey; apiKey != "" {
+		cfg := openai.DefaultConfig(apiKey)
+		if t.gptscript.OpenAIOptions.BaseURL != "" {
+			cfg.BaseURL = t.gptscript.OpenAIOptions.BaseURL
+		}
+		testOpts.Judge, err = judge.New[string](openai.NewClientWithConfig(cfg))
+		if err != nil {
+			return err
+		}
+	}
+
+	results := scripttest.Run(cmd.Context(), testOpts, files...)
+
+	// The results are reported on stderr when the JUnit XML is written to stdout, so that stdout is only the XML.
+	report := os.Stdout
+	if t.JUnit == "-" {
+		report = os.Stderr
+	}
+
+	var total, failed int
+	for _, spec := range results {
+		if spec.Err != nil {
+			total++
+			failed++
+			fmt.Fprintf(report, "ERROR %s: %v\n", spec.File, spec.Err)
+			continue
+		}
+		for _, result := range spec.Results {
+			total++
+			switch {
+			case result.Err != nil:
+				failed++
+				fmt.Fprintf(report, "ERROR %s: %s (%.2fs): %v\n", spec.File, result.Name, result.Duration.Seconds(), result.Err)
+			case !result.Passed():
+				failed++
+				fmt.Fprintf(report, "FAIL  %s: %s (%.2fs)\n", spec.File, result.Name, result.Duration.Seconds())
+				for _, failure := range result.Failures {
+					fmt.Fprintf(report, "      %s\n", failure)
+				}
+			default:
+				fmt.Fprintf(report, "PASS  %s: %s (%.2fs)\n", spec.File, result.Name, result.Duration.Seconds())
+			}
+		}
+	}
+
+	if t.JUnit != "" {
+		out := os.Stdout
+		if t.JUnit != "-" {
+			out, err = os.Create(t.JUnit)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		if err := scripttest.WriteJUnit(out, results); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, total)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/repos/runtimes"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+type Vendor struct {
+	gptscript *GPTScript
+}
+
+func (v *Vendor) Customize(cmd *cobra.Command) {
+	cmd.Use = "vendor [flags] PROGRAM_FILE..."
+	cmd.Short = "Copy the remote tools of scripts and the git repos of their commands to a directory to run them offline"
+	cmd.Args = cobra.MinimumNArgs(1)
+}
+
+func (v *Vendor) Run(cmd *cobra.Command, args []string) error {
+	c, err := newCacheClient(v.gptscript)
+	if err != nil {
+		return err
+	}
+
+	lock, err := v.gptscript.loadLock(args[0])
+	if err != nil {
+		return err
+	}
+
+	dir := types.FirstSet(v.gptscript.VendorDir, loader.DefaultVendorPath(args[0]))
+	vendor := loader.NewVendor(dir)
+	programs := make([]types.Program, 0, len(args))
+	for _, arg := range args {
+		prg, err := loader.Program(cmd.Context(), arg, "", loader.Options{
+			Cache:     c,
+			Lock:      lock,
+			Vendor:    vendor,
+			Trust:     v.gptscript.trust,
+			MCPLoader: unloadedMCP{},
+		})
+		if err != nil {
+			return err
+		}
+		programs = append(programs, prg)
+	}
+
+	if err := vendor.Save(cmd.Context(), programs...); err != nil {
+		return err
+	}
+
+	for _, prg := range programs {
+		for _, tool := range prg.ToolSet {
+			if runtime := runtimes.Supporting(tool, toolCommand(tool)); runtime != "" {
+				log.Infof("WARNING: the %s runtime of %s is not vendored, it is downloaded the first time the tool runs", runtime, tool.Name)
+			}
+		}
+	}
+
+	fmt.Printf("Vendored %d remote sources and %d git repos in %s\n", vendor.Sources(), vendor.Repos(), dir)
+	return nil
+}
+
+// toolCommand returns the command that runs a command or daemon tool, split into fields.
+func toolCommand(tool types.Tool) []string {
+	instructions := tool.Instructions
+	if tool.IsDaemon() {
+		instructions = types.CommandPrefix + strings.TrimSpace(strings.TrimPrefix(instructions, types.DaemonPrefix))
+	} else if !tool.IsCommand() {
+		return nil
+	}
+	interpreter, _, _ := strings.Cut(strings.TrimPrefix(instructions, types.CommandPrefix), "\n")
+	return strings.Fields(interpreter)
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// hasTypedArguments returns whether the arguments declare anything but optional strings, in which case the input of a
+// call is validated against them.
+func hasTypedArguments(schema *jsonschema.Schema) bool {
+	if schema == nil {
+		return false
+	}
+	if len(schema.Required) > 0 {
+		return true
+	}
+	for _, prop := range schema.Properties {
+		if types.ArgSpec(prop, false) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateArguments validates the input of a call against the arguments of the tool. Strings are converted to the
+// declared types first, because arguments given on the command line are always strings, and the converted input is
+// returned.
+func validateArguments(schema *jsonschema.Schema, input string) (string, error) {
+	args := map[string]any{}
+	if strings.TrimSpace(input) != "" {
+		if err := json.Unmarshal([]byte(input), &args); err != nil {
+			return "", errors.New("input must be a JSON object of arguments")
+		}
+	}
+
+	var converted bool
+	for name, value := range args {
+		prop, ok := schema.Properties[name]
+		if !ok {
+			continue
+		}
+		if s, ok := value.(string); ok {
+			if v, ok := convertArgument(prop.Type, s); ok {
+				args[name] = v
+				converted = true
+			}
+		}
+	}
+
+	resolved, err := schema.Resolve(nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid arguments schema: %w", err)
+	}
+	if err := resolved.Validate(args); err != nil {
+		return "", err
+	}
+
+	if !converted {
+		return input, nil
+	}
+	data, err := json.Marshal(args)
+	return string(data), err
+}
+
+func convertArgument(typ, value string) (any, bool) {
+	switch typ {
+	case "integer", "number":
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return f, err == nil
+	case "boolean":
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		return b, err == nil
+	case "array", "object":
+		var v any
+		err := json.Unmarshal([]byte(value), &v)
+		return v, err == nil
+	}
+	return nil, false
+}
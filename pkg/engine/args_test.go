@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateArguments(t *testing.T) {
+	count, _, ok := types.ParseArgSpec("integer, 1..10")
+	require.True(t, ok)
+	verbose, _, ok := types.ParseArgSpec("boolean")
+	require.True(t, ok)
+
+	schema := types.ObjectSchema("name", "The name")
+	schema.Properties["count"] = count
+	schema.Properties["verbose"] = verbose
+	schema.Required = []string{"count"}
+	require.True(t, hasTypedArguments(schema))
+	require.False(t, hasTypedArguments(types.ObjectSchema("name", "The name")))
+
+	// Strings are converted, as they are for arguments from the command line.
+	input, err := validateArguments(schema, `{"count": "5", "verbose": "true", "name": "bob"}`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"count": 5, "verbose": true, "name": "bob"}`, input)
+
+	input, err = validateArguments(schema, `{"count": 5}`)
+	require.NoError(t, err)
+	require.Equal(t, `{"count": 5}`, input)
+
+	_, err = validateArguments(schema, `{"count": 11}`)
+	require.Error(t, err)
+
+	_, err = validateArguments(schema, `{"count": "many"}`)
+	require.Error(t, err)
+
+	_, err = validateArguments(schema, `{"name": "bob"}`)
+	require.ErrorContains(t, err, "count")
+
+	_, err = validateArguments(schema, "five")
+	require.ErrorContains(t, err, "must be a JSON object")
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -126,8 +127,13 @@ func (e *Engine) runCommand(ctx Context, tool types.Tool, input string) (cmdOut
 	commandCtx, cancel := context.WithCancel(ctx.Ctx)
 	defer cancel()
 
-	cmd, stop, err := e.newCommand(commandCtx, extraEnv, tool, input, true)
-	if err != nil {
+	cmd, stop, err := e.newCommand(commandCtx, extraEnv, tool, input, true, e.sandboxed(tool))
+	if sandboxErr := (*SandboxError)(nil); errors.As(err, &sandboxErr) {
+		if ctx.ToolCategory == NoCategory && ctx.Parent != nil {
+			return fmt.Sprintf("ERROR: %v", err), nil
+		}
+		return "", err
+	} else if err != nil {
 		if ctx.ToolCategory == NoCategory && ctx.Parent != nil {
 			return fmt.Sprintf("ERROR: got (%v) while parsing command", err), nil
 		}
@@ -258,7 +264,7 @@ func appendInputAsEnv(env []string, input string) []string {
 	return newEnv
 }
 
-func (e *Engine) newCommand(ctx context.Context, extraEnv []string, tool types.Tool, input string, useShell bool) (*exec.Cmd, func(), error) {
+func (e *Engine) newCommand(ctx context.Context, extraEnv []string, tool types.Tool, input string, useShell, sandboxed bool) (*exec.Cmd, func(), error) {
 	if runtime.GOOS == "windows" {
 		useShell = false
 	}
@@ -302,6 +308,9 @@ func (e *Engine) newCommand(ctx context.Context, extraEnv []string, tool types.T
 
 	ctx, cancel := context.WithCancel(ctx)
 	stop := cancel
+	policy := sandboxPolicy{
+		network: tool.Network,
+	}
 
 	if strings.TrimSpace(rest) != "" {
 		f, err := os.CreateTemp(env.Getenv("GPTSCRIPT_TMPDIR", envvars), version.ProgramName+requiredFileExtensions[args[0]])
@@ -320,6 +329,7 @@ func (e *Engine) newCommand(ctx context.Context, extraEnv []string, tool types.T
 			return nil, nil, err
 		}
 		args = append(args, f.Name())
+		policy.readable = append(policy.readable, f.Name())
 	}
 
 	// Expand and/or normalize env references
@@ -347,5 +357,24 @@ func (e *Engine) newCommand(ctx context.Context, extraEnv []string, tool types.T
 
 	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
 	cmd.Env = compressEnv(envvars)
+
+	if sandboxed {
+		if workspace := envMap["GPTSCRIPT_WORKSPACE_DIR"]; workspace != "" {
+			if _, err := os.Stat(workspace); err == nil {
+				policy.writable = append(policy.writable, workspace)
+			}
+		}
+		sandboxStop, err := sandbox(cmd, tool, policy)
+		if err != nil {
+			stop()
+			return nil, nil, err
+		}
+		commandStop := stop
+		stop = func() {
+			sandboxStop()
+			commandStop()
+		}
+	}
+
 	return cmd, stop, nil
 }
@@ -177,14 +177,18 @@ func (e *Engine) startDaemon(tool types.Tool) (string, string, error) {
 	port = nextPort()
 	url = fmt.Sprintf("http://127.0.0.1:%d%s", port, path)
 
+	// The daemon serves on the loopback interface of the host, so a sandboxed daemon shares the network of the host.
+	daemonTool := tool
+	daemonTool.Network = true
 	cmd, stop, err := e.newCommand(ctx, []string{
 		fmt.Sprintf("PORT=%d", port),
 		fmt.Sprintf("GPTSCRIPT_PORT=%d", port),
 		fmt.Sprintf("GPTSCRIPT_DAEMON_TOKEN=%s", token),
 	},
-		tool,
+		daemonTool,
 		"{}",
 		false,
+		e.sandboxed(tool),
 	)
 	if err != nil {
 		return url, "", err
@@ -42,17 +42,27 @@ type Engine struct {
 	Env            []string
 	Progress       chan<- types.CompletionStatus
 	MCPRunner      MCPRunner
+	// Sandbox runs every command tool in the sandbox, not only the tools with "Sandbox: true".
+	Sandbox            bool
+	CommandInterceptor CommandInterceptor
 }
 
 type MCPRunner interface {
 	Run(ctx Context, progress chan<- types.CompletionStatus, tool types.Tool, input string) (string, error)
 }
 
+// CommandInterceptor is called in place of running a command tool, which it can do by calling run.
+type CommandInterceptor interface {
+	InterceptCommand(ctx Context, tool types.Tool, input string, run func() (string, error)) (string, error)
+}
+
 type State struct {
 	Input      string                              `json:"input,omitempty"`
 	Completion types.CompletionRequest             `json:"completion,omitempty"`
 	Pending    map[string]types.CompletionToolCall `json:"pending,omitempty"`
 	Results    map[string]CallResult               `json:"results,omitempty"`
+	// OutputSchemaRetries is the number of times the LLM was asked to fix an output that didn't match the output schema.
+	OutputSchemaRetries int `json:"outputSchemaRetries,omitempty"`
 }
 
 type Return struct {
@@ -292,8 +302,11 @@ func (c *Context) WrappedContext(e *Engine) context.Context {
 func populateMessageParams(ctx Context, completion *types.CompletionRequest, tool types.Tool) error {
 	completion.Model = tool.ModelName
 	completion.MaxTokens = tool.MaxTokens
-	completion.JSONResponse = tool.JSONResponse
+	completion.JSONResponse = tool.JSONResponse || tool.OutputSchema != nil
+	completion.OutputSchema = tool.OutputSchema
+	completion.ContextCompaction = tool.ContextCompaction
 	completion.Cache = tool.Cache
+	completion.CacheKey = tool.CacheKey
 	completion.Chat = tool.Chat
 	completion.Temperature = tool.Temperature
 	completion.InternalSystemPrompt = tool.InternalPrompt
@@ -335,7 +348,17 @@ func (e *Engine) runCommandTools(ctx Context, tool types.Tool, input string) (*R
 	} else if tool.IsCall() {
 		return e.runCall(ctx, tool, input)
 	}
-	s, err := e.runCommand(ctx, tool, input)
+	run := func() (string, error) {
+		return e.runCommand(ctx, tool, input)
+	}
+	if e.CommandInterceptor != nil {
+		s, err := e.CommandInterceptor.InterceptCommand(ctx, tool, input, run)
+		return &Return{
+			Result: &s,
+		}, err
+	}
+
+	s, err := run()
 	return &Return{
 		Result: &s,
 	}, err
@@ -361,6 +384,19 @@ func (e *Engine) Start(ctx Context, input string) (ret *Return, err error) {
 		}
 	}()
 
+	if ctx.ToolCategory == NoCategory && !tool.Chat && hasTypedArguments(tool.Arguments) {
+		input, err = validateArguments(tool.Arguments, input)
+		if err != nil {
+			if ctx.Parent != nil {
+				msg := fmt.Sprintf("ERROR: invalid arguments for tool %s: %v", tool.Name, err)
+				return &Return{
+					Result: &msg,
+				}, nil
+			}
+			return nil, fmt.Errorf("invalid arguments for tool %s: %w", tool.Name, err)
+		}
+	}
+
 	if tool.IsMCPInvoke() {
 		return e.runMCPInvoke(ctx, tool, input)
 	}
@@ -406,6 +442,10 @@ func addUpdateSystem(ctx Context, tool types.Tool, msgs []types.CompletionMessag
 		instructions = append(instructions, tool.Instructions)
 	}
 
+	if tool.OutputSchema != nil {
+		instructions = append(instructions, outputSchemaPrompt(tool.OutputSchema))
+	}
+
 	if len(instructions) == 0 {
 		return msgs
 	}
@@ -517,6 +557,19 @@ func (e *Engine) complete(ctx Context, state *State) (*Return, error) {
 		ret.Result = &empty
 	}
 
+	if err := checkOutputSchema(state.Completion.OutputSchema, &ret); err != nil {
+		if state.OutputSchemaRetries >= maxOutputSchemaRetries {
+			return nil, err
+		}
+		state.OutputSchemaRetries++
+		state.Completion.Messages = append(state.Completion.Messages, types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeUser,
+			Content: types.Text(err.retryPrompt()),
+		})
+		return e.complete(ctx, state)
+	}
+	state.OutputSchemaRetries = 0
+
 	return &ret, nil
 }
 
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// maxOutputSchemaRetries is how many times the LLM is asked to fix an output that doesn't match the output schema.
+const maxOutputSchemaRetries = 2
+
+// ErrOutputSchema is returned when the output of a tool still doesn't match its output schema after the retries.
+type ErrOutputSchema struct {
+	Output string
+	Err    error
+}
+
+func (e *ErrOutputSchema) Error() string {
+	return fmt.Sprintf("output does not match the output schema after %d retries: %v", maxOutputSchemaRetries, e.Err)
+}
+
+func (e *ErrOutputSchema) Unwrap() error {
+	return e.Err
+}
+
+func (e *ErrOutputSchema) retryPrompt() string {
+	return fmt.Sprintf("Your response does not match the required JSON schema: %v\nRespond again with only JSON that matches the schema.", e.Err)
+}
+
+func outputSchemaPrompt(schema *jsonschema.Schema) string {
+	data, _ := json.Marshal(schema)
+	return fmt.Sprintf("Respond with only JSON that matches the following JSON schema:\n%s", data)
+}
+
+// checkOutputSchema validates the final result of a completion against the schema. Completions that call tools are not
+// checked. The providers that enforce the schema are given its strict version, whose optional properties are required
+// and nullable, so an output that matches the strict schema matches too.
+func checkOutputSchema(schema *jsonschema.Schema, ret *Return) *ErrOutputSchema {
+	if schema == nil || ret.Result == nil || len(ret.Calls) > 0 {
+		return nil
+	}
+
+	var output any
+	if err := json.Unmarshal([]byte(*ret.Result), &output); err != nil {
+		return &ErrOutputSchema{
+			Output: *ret.Result,
+			Err:    fmt.Errorf("response is not valid JSON: %w", err),
+		}
+	}
+
+	resolved, err := schema.Resolve(nil)
+	if err != nil {
+		return &ErrOutputSchema{
+			Output: *ret.Result,
+			Err:    fmt.Errorf("invalid output schema: %w", err),
+		}
+	}
+	if err := resolved.Validate(output); err != nil {
+		if strict, strictErr := types.StrictSchema(schema).Resolve(nil); strictErr == nil && strict.Validate(output) == nil {
+			return nil
+		}
+		return &ErrOutputSchema{
+			Output: *ret.Result,
+			Err:    err,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+type outputSchemaModel struct {
+	responses []string
+	requests  []types.CompletionRequest
+}
+
+func (m *outputSchemaModel) ProxyInfo([]string) (string, string, error) {
+	return "", "", nil
+}
+
+func (m *outputSchemaModel) Call(_ context.Context, messageRequest types.CompletionRequest, _ []string, _ chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	m.requests = append(m.requests, messageRequest)
+	resp := m.responses[0]
+	m.responses = m.responses[1:]
+	return &types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeAssistant,
+		Content: types.Text(resp),
+	}, nil
+}
+
+func outputSchemaContext() Context {
+	tool := types.Tool{
+		ID: "tool",
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				OutputSchema: &jsonschema.Schema{
+					Type:     "object",
+					Required: []string{"name"},
+					Properties: map[string]*jsonschema.Schema{
+						"name": {Type: "string"},
+					},
+				},
+			},
+			Instructions: "Return a name",
+		},
+	}
+
+	ctx := Context{
+		Ctx: context.Background(),
+		Program: &types.Program{
+			EntryToolID: tool.ID,
+			ToolSet: types.ToolSet{
+				tool.ID: tool,
+			},
+		},
+	}
+	ctx.Tool = tool
+	return ctx
+}
+
+func TestOutputSchemaRetry(t *testing.T) {
+	model := &outputSchemaModel{
+		responses: []string{"Bob", `{"name": 1}`, `{"name": "Bob"}`},
+	}
+	e := &Engine{
+		Model: model,
+	}
+
+	ret, err := e.Start(outputSchemaContext(), "")
+	require.NoError(t, err)
+	require.Equal(t, `{"name": "Bob"}`, *ret.Result)
+	require.Len(t, model.requests, 3)
+	require.True(t, model.requests[0].JSONResponse)
+	require.Contains(t, model.requests[0].Messages[0].Content[0].Text, `"required":["name"]`)
+	require.Equal(t, 0, ret.State.OutputSchemaRetries)
+
+	// The retries ask the LLM to fix the previous response.
+	last := model.requests[2].Messages
+	require.Len(t, last, 5)
+	require.Equal(t, types.CompletionMessageRoleTypeUser, last[4].Role)
+	require.Contains(t, last[4].Content[0].Text, "does not match the required JSON schema")
+}
+
+func TestOutputSchemaRetriesExhausted(t *testing.T) {
+	e := &Engine{
+		Model: &outputSchemaModel{
+			responses: []string{"Bob", "Bob", "Bob"},
+		},
+	}
+
+	_, err := e.Start(outputSchemaContext(), "")
+	var schemaErr *ErrOutputSchema
+	require.ErrorAs(t, err, &schemaErr)
+	require.Equal(t, "Bob", schemaErr.Output)
+}
+
+func TestOutputSchemaNullOptional(t *testing.T) {
+	schema := types.ObjectSchema("city", "The city", "population", "The population")
+	schema.Required = []string{"city"}
+
+	// Strict providers return the optional properties as null.
+	for _, output := range []string{`{"city": "Paris", "population": null}`, `{"city": "Paris"}`} {
+		require.Nil(t, checkOutputSchema(schema, &Return{Result: &output}), output)
+	}
+
+	output := `{"city": null}`
+	require.NotNil(t, checkOutputSchema(schema, &Return{Result: &output}))
+}
@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// SandboxError is returned when a command tool can't be run in the sandbox it requires.
+type SandboxError struct {
+	ToolName string
+	Err      error
+}
+
+func (e *SandboxError) Error() string {
+	return fmt.Sprintf("failed to sandbox tool [%s]: %v", e.ToolName, e.Err)
+}
+
+func (e *SandboxError) Unwrap() error {
+	return e.Err
+}
+
+// sandboxPolicy describes what a sandboxed command is allowed to do. Everything else on the host filesystem is
+// read-only, and there is no network access unless the tool declares it with "Network: true".
+type sandboxPolicy struct {
+	network  bool
+	writable []string
+	readable []string
+}
+
+func (e *Engine) sandboxed(tool types.Tool) bool {
+	return e.Sandbox || tool.Sandbox
+}
+
+// sandbox changes the command to run inside the sandbox of the policy. The returned function releases the resources
+// held for the sandbox and must be called after the command exits.
+func sandbox(cmd *exec.Cmd, tool types.Tool, policy sandboxPolicy) (func(), error) {
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+
+	stop, err := sandboxCommand(cmd, policy)
+	if err != nil {
+		return nil, &SandboxError{
+			ToolName: tool.Name,
+			Err:      err,
+		}
+	}
+	return stop, nil
+}
@@ -0,0 +1,447 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/gptscript-ai/gptscript/pkg/system"
+	"golang.org/x/sys/unix"
+)
+
+// deniedSyscalls are the system calls a sandboxed command gets EPERM for. They allow escaping the sandbox or changing
+// the host, and no tool needs them.
+var deniedSyscalls = []uint32{
+	unix.SYS_ACCT,
+	unix.SYS_ADD_KEY,
+	unix.SYS_BPF,
+	unix.SYS_CLOCK_SETTIME,
+	unix.SYS_DELETE_MODULE,
+	unix.SYS_FINIT_MODULE,
+	unix.SYS_INIT_MODULE,
+	unix.SYS_KEXEC_FILE_LOAD,
+	unix.SYS_KEXEC_LOAD,
+	unix.SYS_KEYCTL,
+	unix.SYS_MOUNT,
+	unix.SYS_OPEN_BY_HANDLE_AT,
+	unix.SYS_PERF_EVENT_OPEN,
+	unix.SYS_PIVOT_ROOT,
+	unix.SYS_PTRACE,
+	unix.SYS_REBOOT,
+	unix.SYS_REQUEST_KEY,
+	unix.SYS_SETNS,
+	unix.SYS_SETTIMEOFDAY,
+	unix.SYS_SWAPOFF,
+	unix.SYS_SWAPON,
+	unix.SYS_UMOUNT2,
+	unix.SYS_UNSHARE,
+	unix.SYS_USERFAULTFD,
+}
+
+// sandboxCommand runs the command with bubblewrap if it is installed. Otherwise, it falls back to unshare and sets up
+// the same read-only mounts and seccomp filter with sys.sandbox.
+func sandboxCommand(cmd *exec.Cmd, policy sandboxPolicy) (func(), error) {
+	if bwrap, err := exec.LookPath("bwrap"); err == nil {
+		return bwrapCommand(cmd, bwrap, policy)
+	}
+	if unshare, err := exec.LookPath("unshare"); err == nil {
+		if err := checkUnshare(); err != nil {
+			return nil, fmt.Errorf("bwrap is not installed and the sandbox can't be set up with unshare: %w", err)
+		}
+		log.Debugf("bwrap is not installed, sandboxing with unshare")
+		cmd.Args = append(unshareArgs(policy), append([]string{cmd.Path}, cmd.Args[1:]...)...)
+		cmd.Path = unshare
+		return func() {}, nil
+	}
+	return nil, errors.New("neither bwrap nor unshare is installed")
+}
+
+// checkUnshare sets up the sandbox with unshare once, so that a sandbox that can't be set up fully fails before any
+// command runs in it instead of each command failing.
+var checkUnshare = sync.OnceValue(func() error {
+	args := append(unshareArgs(sandboxPolicy{}), "true")
+	if out, err := exec.Command("unshare", args[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+})
+
+func bwrapCommand(cmd *exec.Cmd, bwrap string, policy sandboxPolicy) (func(), error) {
+	var (
+		stop   = func() {}
+		filter = seccompFilter()
+	)
+	if filter != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		_, err = w.Write(filter)
+		_ = w.Close()
+		if err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+		cmd.ExtraFiles = append(cmd.ExtraFiles, r)
+		stop = func() {
+			_ = r.Close()
+		}
+	}
+
+	// The first extra file is fd 3 in the child.
+	cmd.Args = append(bwrapArgs(policy, filter != nil, 2+len(cmd.ExtraFiles)), append([]string{cmd.Path}, cmd.Args[1:]...)...)
+	cmd.Path = bwrap
+	return stop, nil
+}
+
+func bwrapArgs(policy sandboxPolicy, seccomp bool, seccompFD int) []string {
+	args := []string{
+		"bwrap",
+		"--die-with-parent",
+		"--new-session",
+		"--unshare-all",
+	}
+	if policy.network {
+		args = append(args, "--share-net")
+	}
+	args = append(args,
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+	)
+	for _, p := range policy.readable {
+		args = append(args, "--ro-bind", p, p)
+	}
+	for _, p := range policy.writable {
+		args = append(args, "--bind", p, p)
+	}
+	if seccomp {
+		args = append(args, "--seccomp", strconv.Itoa(seccompFD))
+	}
+	return append(args, "--")
+}
+
+func unshareArgs(policy sandboxPolicy) []string {
+	args := []string{
+		"unshare",
+		"--user",
+		"--map-root-user",
+		"--mount",
+		"--pid",
+		"--fork",
+		"--mount-proc",
+		"--ipc",
+		"--uts",
+		"--kill-child",
+	}
+	if !policy.network {
+		args = append(args, "--net")
+	}
+	args = append(args, "--", system.Bin(), "sys.sandbox")
+	for _, p := range policy.readable {
+		args = append(args, "--ro", p)
+	}
+	for _, p := range policy.writable {
+		args = append(args, "--rw", p)
+	}
+	return append(args, "--")
+}
+
+// SysSandbox sets up the sandbox in the namespaces that unshare created and then runs the command in it. The arguments
+// are the paths that are mounted read-only with --ro and writable with --rw, "--" and the command. It only returns if
+// the sandbox can't be set up.
+func SysSandbox(args []string) error {
+	usage := errors.New("usage: sys.sandbox [--ro PATH | --rw PATH]... -- COMMAND [ARG...]")
+
+	var readable, writable []string
+	for len(args) > 0 && args[0] != "--" {
+		if len(args) < 2 {
+			return usage
+		}
+		switch args[0] {
+		case "--ro":
+			readable = append(readable, args[1])
+		case "--rw":
+			writable = append(writable, args[1])
+		default:
+			return usage
+		}
+		args = args[2:]
+	}
+	if len(args) < 2 {
+		return usage
+	}
+	command := args[1:]
+
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		return err
+	}
+
+	// Seccomp filters apply to the thread that installs them, which has to be the one that runs the command.
+	runtime.LockOSThread()
+
+	if err := mountSandbox(readable, writable); err != nil {
+		return err
+	}
+	if err := installSeccompFilter(); err != nil {
+		return err
+	}
+	return unix.Exec(path, command, os.Environ())
+}
+
+// mountSandbox sets up the mounts the way bwrap does: it mounts a tmpfs on /tmp, bind mounts the readable and writable
+// paths onto themselves, and then remounts every other mount read-only.
+func mountSandbox(readable, writable []string) error {
+	// Nothing mounted in the sandbox may propagate back to the host.
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_SLAVE, ""); err != nil {
+		return fmt.Errorf("failed to make the mounts of the sandbox private: %w", err)
+	}
+
+	// The paths are opened before the tmpfs hides the ones in /tmp, and are mounted from their descriptors.
+	paths := slices.Concat(readable, writable)
+	fds := make([]int, 0, len(paths))
+	defer func() {
+		for _, fd := range fds {
+			_ = unix.Close(fd)
+		}
+	}()
+	for _, p := range paths {
+		fd, err := unix.Open(p, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", p, err)
+		}
+		fds = append(fds, fd)
+	}
+
+	tmp := false
+	if info, err := os.Stat("/tmp"); err == nil && info.IsDir() {
+		if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+			return fmt.Errorf("failed to mount a tmpfs on /tmp: %w", err)
+		}
+		tmp = true
+	}
+
+	for i, p := range paths {
+		if err := mountPoint(p, fds[i]); err != nil {
+			return err
+		}
+		if err := unix.Mount(fmt.Sprintf("/proc/self/fd/%d", fds[i]), p, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("failed to bind mount %s: %w", p, err)
+		}
+	}
+
+	mounts, err := readMounts()
+	if err != nil {
+		return err
+	}
+	for _, m := range mounts {
+		if tmp && m.point == "/tmp" {
+			continue
+		}
+		if m.flags&unix.MS_RDONLY != 0 || slices.ContainsFunc(writable, func(p string) bool {
+			return m.point == p || strings.HasPrefix(m.point, strings.TrimSuffix(p, "/")+"/")
+		}) {
+			continue
+		}
+		// The flags of the mount are kept, since the ones set outside the user namespace can't be cleared in it.
+		err := unix.Mount("", m.point, "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY|m.flags, "")
+		if errors.Is(err, unix.ENOENT) || errors.Is(err, unix.EACCES) {
+			// The command can't reach mounts that the sandbox can't reach either.
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to remount %s read-only: %w", m.point, err)
+		}
+	}
+	return nil
+}
+
+// mountPoint creates the file or directory to mount the path of the descriptor on, if the tmpfs on /tmp hid it.
+func mountPoint(p string, fd int) error {
+	if _, err := os.Lstat(p); err == nil {
+		return nil
+	}
+
+	var stat unix.Stat_t
+	if err := unix.Fstat(fd, &stat); err != nil {
+		return fmt.Errorf("failed to stat %s: %w", p, err)
+	}
+	if stat.Mode&unix.S_IFMT == unix.S_IFDIR {
+		return os.MkdirAll(p, 0700)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+type mount struct {
+	point string
+	flags uintptr
+}
+
+var mountFlags = map[string]uintptr{
+	"ro":          unix.MS_RDONLY,
+	"nosuid":      unix.MS_NOSUID,
+	"nodev":       unix.MS_NODEV,
+	"noexec":      unix.MS_NOEXEC,
+	"noatime":     unix.MS_NOATIME,
+	"nodiratime":  unix.MS_NODIRATIME,
+	"relatime":    unix.MS_RELATIME,
+	"nosymfollow": unix.MS_NOSYMFOLLOW,
+}
+
+// readMounts returns the visible mounts of the mount namespace with their flags. A mount point that is mounted over
+// is only listed once, with the flags of the mount on top.
+func readMounts() ([]mount, error) {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		result  []mount
+		indexes = map[string]int{}
+	)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		// The fields are the mount ID, the parent ID, major:minor, the root, the mount point and its options.
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+
+		m := mount{
+			point: unescapeMountPoint(fields[4]),
+		}
+		for _, option := range strings.Split(fields[5], ",") {
+			m.flags |= mountFlags[option]
+		}
+		if m.flags&(unix.MS_NOATIME|unix.MS_RELATIME) == 0 {
+			m.flags |= unix.MS_STRICTATIME
+		}
+
+		if i, ok := indexes[m.point]; ok {
+			result[i] = m
+		} else {
+			indexes[m.point] = len(result)
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+// unescapeMountPoint replaces the octal escapes of spaces, tabs, newlines and backslashes in mountinfo.
+func unescapeMountPoint(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// installSeccompFilter installs the filter that bwrap installs for its sandbox on the current thread.
+func installSeccompFilter() error {
+	program := seccompProgram()
+	if program == nil {
+		return nil
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+	filter := unix.SockFprog{
+		Len:    uint16(len(program)),
+		Filter: &program[0],
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_SECCOMP, unix.SECCOMP_SET_MODE_FILTER, 0, uintptr(unsafe.Pointer(&filter))); errno != 0 {
+		return fmt.Errorf("failed to install the seccomp filter: %w", errno)
+	}
+	return nil
+}
+
+func auditArch() (uint32, bool) {
+	switch runtime.GOARCH {
+	case "amd64":
+		return unix.AUDIT_ARCH_X86_64, true
+	case "arm64":
+		return unix.AUDIT_ARCH_AARCH64, true
+	}
+	return 0, false
+}
+
+// seccompFilter returns the seccomp program in the format bwrap reads, or nil on architectures the filter isn't written
+// for.
+func seccompFilter() []byte {
+	program := seccompProgram()
+	if program == nil {
+		return nil
+	}
+	buf := &bytes.Buffer{}
+	_ = binary.Write(buf, binary.NativeEndian, program)
+	return buf.Bytes()
+}
+
+// seccompProgram returns the classic BPF program that denies deniedSyscalls. It returns nil on architectures the
+// filter isn't written for.
+func seccompProgram() []unix.SockFilter {
+	arch, ok := auditArch()
+	if !ok {
+		return nil
+	}
+
+	const (
+		offsetNR   = 0
+		offsetArch = 4
+		// Syscalls of the x32 ABI have this bit set and would otherwise bypass the filter.
+		x32SyscallBit = 0x40000000
+	)
+
+	program := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: offsetArch},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 1, K: arch},
+		{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_KILL_PROCESS},
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: offsetNR},
+	}
+
+	var checks []unix.SockFilter
+	if runtime.GOARCH == "amd64" {
+		checks = append(checks, unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, K: x32SyscallBit})
+	}
+	for _, nr := range deniedSyscalls {
+		checks = append(checks, unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: nr})
+	}
+	// Each check jumps over the remaining checks and the allow to the deny at the end.
+	for i := range checks {
+		checks[i].Jt = uint8(len(checks) - i)
+	}
+
+	program = append(program, checks...)
+	return append(program,
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_ALLOW},
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)},
+	)
+}
@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestMain(m *testing.M) {
+	// Without bwrap, the sandbox runs commands with sys.sandbox of the binary, which is the test binary in tests.
+	if len(os.Args) > 1 && os.Args[1] == "sys.sandbox" {
+		if err := SysSandbox(os.Args[2:]); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	os.Exit(m.Run())
+}
+
+func TestSeccompFilter(t *testing.T) {
+	data := seccompFilter()
+	if data == nil {
+		t.Skip("no seccomp filter for this architecture")
+	}
+
+	program := make([]unix.SockFilter, len(data)/8)
+	require.NoError(t, binary.Read(bytes.NewReader(data), binary.NativeEndian, program))
+
+	deny := len(program) - 1
+	require.Equal(t, unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)}, program[deny])
+	require.Equal(t, unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_ALLOW}, program[deny-1])
+
+	var denied []uint32
+	for i, inst := range program[4 : deny-1] {
+		require.Equal(t, deny, 4+i+1+int(inst.Jt), "instruction %d does not jump to the deny", 4+i)
+		if inst.Code == unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K {
+			denied = append(denied, inst.K)
+		}
+	}
+	require.Equal(t, deniedSyscalls, denied)
+}
+
+func TestSandbox(t *testing.T) {
+	if _, err := exec.LookPath("bwrap"); err != nil {
+		if err := exec.Command("unshare", "--user", "--map-root-user", "--mount", "true").Run(); err != nil {
+			t.Skip("no sandbox available:", err)
+		}
+	}
+
+	workspace, outside := t.TempDir(), t.TempDir()
+	e := &Engine{
+		Env: []string{
+			"PATH=" + os.Getenv("PATH"),
+			"GPTSCRIPT_WORKSPACE_DIR=" + workspace,
+			"OUTSIDE=" + outside,
+		},
+	}
+
+	tool := types.Tool{
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Name:    "write",
+				Sandbox: true,
+			},
+			Instructions: "#!/bin/sh\n" +
+				"echo ok > $GPTSCRIPT_WORKSPACE_DIR/inside\n" +
+				"echo no > $OUTSIDE/outside || true\n" +
+				"echo no > /dev/shm/gptscript-sandbox-test || true\n" +
+				"grep Seccomp: /proc/self/status > $GPTSCRIPT_WORKSPACE_DIR/seccomp\n" +
+				"echo ok > /tmp/gptscript-sandbox-test && cp /tmp/gptscript-sandbox-test $GPTSCRIPT_WORKSPACE_DIR/tmp\n",
+		},
+	}
+
+	cmd, stop, err := e.newCommand(context.Background(), nil, tool, "{}", true, e.sandboxed(tool))
+	require.NoError(t, err)
+	defer stop()
+
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	require.FileExists(t, filepath.Join(workspace, "inside"))
+	require.NoFileExists(t, filepath.Join(outside, "outside"))
+	require.NoFileExists(t, "/dev/shm/gptscript-sandbox-test")
+	// /tmp is a tmpfs in the sandbox, which is writable and not shared with the host.
+	require.FileExists(t, filepath.Join(workspace, "tmp"))
+	require.NoFileExists(t, "/tmp/gptscript-sandbox-test")
+
+	seccomp, err := os.ReadFile(filepath.Join(workspace, "seccomp"))
+	require.NoError(t, err)
+	if seccompFilter() != nil {
+		require.Equal(t, "Seccomp:\t2\n", string(seccomp))
+	}
+}
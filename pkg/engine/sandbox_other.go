@@ -0,0 +1,17 @@
+//go:build !linux
+
+package engine
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+func sandboxCommand(*exec.Cmd, sandboxPolicy) (func(), error) {
+	return nil, fmt.Errorf("sandboxed command tools are not supported on %s", runtime.GOOS)
+}
+
+func SysSandbox([]string) error {
+	return fmt.Errorf("sandboxed command tools are not supported on %s", runtime.GOOS)
+}
@@ -11,8 +11,10 @@ import (
 	"strings"
 
 	openai2 "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/anthropic"
 	"github.com/gptscript-ai/gptscript/pkg/builtin"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/cassette"
 	"github.com/gptscript-ai/gptscript/pkg/config"
 	context2 "github.com/gptscript-ai/gptscript/pkg/context"
 	"github.com/gptscript-ai/gptscript/pkg/credentials"
@@ -20,10 +22,13 @@ import (
 	"github.com/gptscript-ai/gptscript/pkg/llm"
 	"github.com/gptscript-ai/gptscript/pkg/loader"
 	"github.com/gptscript-ai/gptscript/pkg/mcp"
+	"github.com/gptscript-ai/gptscript/pkg/mock"
+	"github.com/gptscript-ai/gptscript/pkg/models"
 	"github.com/gptscript-ai/gptscript/pkg/monitor"
 	"github.com/gptscript-ai/gptscript/pkg/mvl"
 	"github.com/gptscript-ai/gptscript/pkg/openai"
 	"github.com/gptscript-ai/gptscript/pkg/prompt"
+	"github.com/gptscript-ai/gptscript/pkg/ratelimit"
 	"github.com/gptscript-ai/gptscript/pkg/remote"
 	"github.com/gptscript-ai/gptscript/pkg/repos/runtimes"
 	"github.com/gptscript-ai/gptscript/pkg/runner"
@@ -37,8 +42,10 @@ var log = mvl.Package()
 
 type GPTScript struct {
 	Registry                  *llm.Registry
+	Models                    *models.Registry
 	Runner                    *runner.Runner
 	Cache                     *cache.Client
+	Checkpoints               runner.CheckpointStore
 	CredentialStoreFactory    credentials.StoreFactory
 	DefaultCredentialContexts []string
 	WorkspacePath             string
@@ -50,6 +57,7 @@ type GPTScript struct {
 type Options struct {
 	Cache                cache.Options
 	OpenAI               openai.Options
+	Anthropic            anthropic.Options
 	Monitor              monitor.Options
 	Runner               runner.Options
 	DefaultModelProvider string
@@ -61,6 +69,19 @@ type Options struct {
 	Env                  []string
 	CredentialStore      string
 	CredentialToolsEnv   []string
+	// Record is a directory to record the completions and command outputs of runs to.
+	Record string
+	// Replay is a directory to replay recorded completions and command outputs from, instead of calling the model.
+	Replay string
+	// MockFile is the YAML file of the replies of the mock model provider.
+	MockFile string
+	// ModelRoutes are the fallbacks and routing rules of the calls to models.
+	ModelRoutes *llm.Routes
+	// RateLimiter limits the requests to the model providers. It is shared by all the instances it is set in, such as
+	// the concurrent runs of the SDK server.
+	RateLimiter *ratelimit.Limiter
+	// Trust verifies the signatures of the remote tools that are loaded to run model providers and credential tools.
+	Trust *loader.Trust
 }
 
 func Complete(opts ...Options) Options {
@@ -70,6 +91,7 @@ func Complete(opts ...Options) Options {
 		result.Monitor = monitor.Complete(result.Monitor, opt.Monitor)
 		result.Runner = runner.Complete(result.Runner, opt.Runner)
 		result.OpenAI = openai.Complete(result.OpenAI, opt.OpenAI)
+		result.Anthropic = anthropic.Complete(result.Anthropic, opt.Anthropic)
 
 		result.SystemToolsDir = types.FirstSet(opt.SystemToolsDir, result.SystemToolsDir)
 		result.CredentialContexts = opt.CredentialContexts
@@ -80,6 +102,12 @@ func Complete(opts ...Options) Options {
 		result.DisablePromptServer = types.FirstSet(opt.DisablePromptServer, result.DisablePromptServer)
 		result.DefaultModelProvider = types.FirstSet(opt.DefaultModelProvider, result.DefaultModelProvider)
 		result.CredentialStore = types.FirstSet(opt.CredentialStore, result.CredentialStore)
+		result.Record = types.FirstSet(opt.Record, result.Record)
+		result.Replay = types.FirstSet(opt.Replay, result.Replay)
+		result.MockFile = types.FirstSet(opt.MockFile, result.MockFile)
+		result.ModelRoutes = types.FirstSet(opt.ModelRoutes, result.ModelRoutes)
+		result.RateLimiter = types.FirstSet(opt.RateLimiter, result.RateLimiter)
+		result.Trust = types.FirstSet(opt.Trust, result.Trust)
 	}
 
 	if result.Quiet == nil {
@@ -116,11 +144,20 @@ func New(ctx context.Context, o ...Options) (*GPTScript, error) {
 		cliCfg.CredentialsStore = opts.CredentialStore
 	}
 
+	if opts.OpenAI.Models == nil {
+		opts.OpenAI.Models, err = models.Load(opts.OpenAI.ModelTable, opts.OpenAI.CharsPerToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+	registry.SetRoutes(opts.ModelRoutes, opts.OpenAI.Models)
+	registry.SetLimiter(opts.RateLimiter)
+
 	if opts.Runner.RuntimeManager == nil {
 		opts.Runner.RuntimeManager = runtimes.Default(cacheClient.CacheDir(), opts.SystemToolsDir)
 	}
 
-	simplerRunner, err := newSimpleRunner(cacheClient, opts.Runner.RuntimeManager, opts.CredentialToolsEnv)
+	simplerRunner, err := newSimpleRunner(cacheClient, opts.Trust, opts.Runner.RuntimeManager, opts.CredentialToolsEnv)
 	if err != nil {
 		return nil, err
 	}
@@ -135,7 +172,23 @@ func New(ctx context.Context, o ...Options) (*GPTScript, error) {
 		return nil, err
 	}
 
+	// The mock provider is checked first, so that its models are never looked up by the other clients.
+	if err := registry.AddClient(mock.New(opts.MockFile, opts.DefaultModelProvider == mock.ProviderName)); err != nil {
+		return nil, err
+	}
+
 	if opts.DefaultModelProvider == "" {
+		anthropicClient, err := anthropic.NewClient(ctx, credStore, opts.Anthropic, anthropic.Options{
+			Cache: cacheClient,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if err := registry.AddClient(anthropicClient); err != nil {
+			return nil, err
+		}
+
 		oaiClient, err := openai.NewClient(ctx, credStore, opts.OpenAI, openai.Options{
 			Cache:   cacheClient,
 			SetSeed: true,
@@ -149,11 +202,35 @@ func New(ctx context.Context, o ...Options) (*GPTScript, error) {
 		}
 	}
 
+	if opts.Runner.CheckpointStore == nil {
+		opts.Runner.CheckpointStore = runner.NewFileCheckpointStore(filepath.Join(cacheClient.CacheDir(), "checkpoints"))
+	}
+
 	if opts.Runner.MonitorFactory == nil {
 		opts.Runner.MonitorFactory = monitor.NewConsole(opts.Monitor, monitor.Options{DebugMessages: *opts.Quiet})
 	}
 
-	runner, err := runner.New(registry, credStore, opts.Runner)
+	if traceOpts, ok := monitor.TraceOptionsFromEnv(opts.Env); ok {
+		opts.Runner.MonitorFactory = monitor.NewMultiFactory(opts.Runner.MonitorFactory, monitor.NewTraceFactory(traceOpts))
+	}
+
+	var model engine.Model = registry
+	if opts.Record != "" && opts.Replay != "" {
+		return nil, errors.New("record and replay cannot be used together")
+	} else if opts.Record != "" || opts.Replay != "" {
+		dir, mode := opts.Record, cassette.ModeRecord
+		if opts.Replay != "" {
+			dir, mode = opts.Replay, cassette.ModeReplay
+		}
+		c, err := cassette.Open(dir, mode)
+		if err != nil {
+			return nil, err
+		}
+		model = c.Model(registry)
+		opts.Runner.CommandInterceptor = c
+	}
+
+	runner, err := runner.New(model, credStore, opts.Runner)
 	if err != nil {
 		return nil, err
 	}
@@ -174,7 +251,7 @@ func New(ctx context.Context, o ...Options) (*GPTScript, error) {
 
 	fullEnv := append(opts.Env, extraEnv...)
 
-	remoteClient := remote.New(runner, fullEnv, cacheClient, credStore, opts.DefaultModelProvider)
+	remoteClient := remote.New(runner, fullEnv, cacheClient, opts.Trust, opts.OpenAI.Models, credStore, opts.DefaultModelProvider)
 	if err := registry.AddClient(remoteClient); err != nil {
 		closeServer()
 		return nil, err
@@ -182,8 +259,10 @@ func New(ctx context.Context, o ...Options) (*GPTScript, error) {
 
 	return &GPTScript{
 		Registry:                  registry,
+		Models:                    opts.OpenAI.Models,
 		Runner:                    runner,
 		Cache:                     cacheClient,
+		Checkpoints:               opts.Runner.CheckpointStore,
 		CredentialStoreFactory:    storeFactory,
 		DefaultCredentialContexts: opts.CredentialContexts,
 		WorkspacePath:             opts.Workspace,
@@ -297,11 +376,12 @@ func (g *GPTScript) ListModels(ctx context.Context, providers ...string) ([]open
 
 type simpleRunner struct {
 	cache  *cache.Client
+	trust  *loader.Trust
 	runner *runner.Runner
 	env    []string
 }
 
-func newSimpleRunner(cache *cache.Client, rm engine.RuntimeManager, env []string) (*simpleRunner, error) {
+func newSimpleRunner(cache *cache.Client, trust *loader.Trust, rm engine.RuntimeManager, env []string) (*simpleRunner, error) {
 	runner, err := runner.New(noopModel{}, credentials.NoopStore{}, runner.Options{
 		RuntimeManager: rm,
 		MonitorFactory: simpleMonitorFactory{},
@@ -311,6 +391,7 @@ func newSimpleRunner(cache *cache.Client, rm engine.RuntimeManager, env []string
 	}
 	return &simpleRunner{
 		cache:  cache,
+		trust:  trust,
 		runner: runner,
 		env:    env,
 	}, nil
@@ -319,6 +400,7 @@ func newSimpleRunner(cache *cache.Client, rm engine.RuntimeManager, env []string
 func (s *simpleRunner) Load(ctx context.Context, toolName string) (prg types.Program, err error) {
 	return loader.Program(ctx, toolName, "", loader.Options{
 		Cache: s.cache,
+		Trust: s.trust,
 	})
 }
 
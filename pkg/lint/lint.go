@@ -0,0 +1,218 @@
+package lint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/parser"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+type Severity string
+
+const (
+	SeverityError   = Severity("error")
+	SeverityWarning = Severity("warning")
+)
+
+// Diagnostic is a problem a rule found in a program, at the line of the tool it is in.
+type Diagnostic struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	Location string   `json:"location,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Tool     string   `json:"tool,omitempty"`
+}
+
+func (d Diagnostic) String() string {
+	if d.Location == "" {
+		return fmt.Sprintf("%s: %s (%s)", d.Severity, d.Message, d.Rule)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s (%s)", d.Location, d.Line, d.Severity, d.Message, d.Rule)
+}
+
+// Rule checks a program for one kind of problem.
+type Rule interface {
+	// Name identifies the rule in diagnostics.
+	Name() string
+	// Description says what the rule checks.
+	Description() string
+	// Check returns the problems the rule finds in the program.
+	Check(prg *Program) []Diagnostic
+}
+
+// Program is a program to check. Unlike a program that is loaded to run it, a program is loaded to check it even if
+// some of its tool references can't be loaded.
+type Program struct {
+	types.Program
+	// Entry are the tools of the file of the entry tool, including the ones the program doesn't use. It is empty if the
+	// file can't be read again, like a remote file.
+	Entry []types.Tool
+	// Unresolved are the tool references that can't be loaded.
+	Unresolved []Unresolved
+}
+
+type Unresolved struct {
+	Tool      types.Tool
+	Reference string
+	Err       error
+}
+
+// Local returns whether a tool is in a local file, as opposed to a remote tool or a built-in tool. Only local tools are
+// checked, since they are the ones that can be fixed.
+func (p *Program) Local(tool types.Tool) bool {
+	return tool.Source.Location != "" && tool.Source.Repo == nil && !strings.Contains(tool.Source.Location, "://")
+}
+
+// LocalTools returns the local tools of the program in the order of their file and line.
+func (p *Program) LocalTools() []types.Tool {
+	var result []types.Tool
+	for _, tool := range p.ToolSet {
+		if p.Local(tool) {
+			result = append(result, tool)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Source.Location != result[j].Source.Location {
+			return result[i].Source.Location < result[j].Source.Location
+		}
+		return result[i].Source.LineNo < result[j].Source.LineNo
+	})
+	return result
+}
+
+// Diagnostic returns a diagnostic of a rule at a tool.
+func (p *Program) Diagnostic(rule Rule, severity Severity, tool types.Tool, format string, args ...any) Diagnostic {
+	return Diagnostic{
+		Rule:     rule.Name(),
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+		Location: tool.Source.Location,
+		Line:     tool.Source.LineNo,
+		Tool:     tool.Name,
+	}
+}
+
+type Options struct {
+	Loader loader.Options
+	// Rules are the rules to check the program with, DefaultRules if none are set.
+	Rules []Rule
+}
+
+func complete(opts ...Options) (result Options) {
+	for _, opt := range opts {
+		result.Loader = opt.Loader
+		if opt.Rules != nil {
+			result.Rules = opt.Rules
+		}
+	}
+	if result.Rules == nil {
+		result.Rules = DefaultRules()
+	}
+	return
+}
+
+// Load loads a program to check it from a file, or from content if it is set, in which case file is only used as its
+// location.
+func Load(ctx context.Context, file, content string, opts ...Options) (*Program, error) {
+	var (
+		opt    = complete(opts...)
+		result = &Program{}
+		err    error
+	)
+
+	opt.Loader.Unresolved = func(tool types.Tool, ref string, err error) {
+		result.Unresolved = append(result.Unresolved, Unresolved{
+			Tool:      tool,
+			Reference: ref,
+			Err:       err,
+		})
+	}
+
+	if content != "" {
+		opt.Loader.Location = file
+		result.Program, err = loader.ProgramFromSource(ctx, content, "", opt.Loader)
+	} else {
+		result.Program, err = loader.Program(ctx, file, "", opt.Loader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entry := result.ToolSet[result.EntryToolID]
+	if !result.Local(entry) {
+		return result, nil
+	}
+	if content == "" {
+		data, err := os.ReadFile(entry.Source.Location)
+		if err != nil {
+			// The entry file is a directory or it is not a file at all, so the unused tools are not checked.
+			return result, nil
+		}
+		content = string(data)
+	}
+
+	result.Entry, err = parser.ParseTools(strings.NewReader(content), parser.Options{
+		AssignGlobals: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range result.Entry {
+		result.Entry[i].Source.Location = entry.Source.Location
+		result.Entry[i].ID = entry.Source.Location + ":" + result.Entry[i].Name
+	}
+	return result, nil
+}
+
+// Lint loads a program and checks it with the rules. A program that can't be loaded, like a script with a syntax error,
+// is a diagnostic too if the error has a line.
+func Lint(ctx context.Context, file, content string, opts ...Options) ([]Diagnostic, error) {
+	opt := complete(opts...)
+
+	prg, err := Load(ctx, file, content, opt)
+	if errLine := (*parser.ErrLine)(nil); errors.As(err, &errLine) {
+		return []Diagnostic{{
+			Rule:     loadRule{}.Name(),
+			Severity: SeverityError,
+			Message:  errLine.Err.Error(),
+			Location: types.FirstSet(errLine.Path, file),
+			Line:     errLine.Line,
+		}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return Check(prg, opt.Rules...), nil
+}
+
+// Check checks a loaded program with rules, and returns the diagnostics in the order of their file and line.
+func Check(prg *Program, rules ...Rule) []Diagnostic {
+	var result []Diagnostic
+	for _, rule := range rules {
+		result = append(result, rule.Check(prg)...)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Location != result[j].Location {
+			return result[i].Location < result[j].Location
+		}
+		return result[i].Line < result[j].Line
+	})
+	return result
+}
+
+// HasErrors returns whether any of the diagnostics is an error.
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
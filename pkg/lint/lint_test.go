@@ -0,0 +1,88 @@
+package lint
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.gpt")
+	require.NoError(t, os.WriteFile(file, []byte(`Tools: ./missing.gpt, search with ${Subject} as query and ${topic} as max-results
+Agents: helper
+Credentials: cred with ${Subject} as env and OTHER as extra
+Param: subject: what to find
+
+Find ${other} about ${subject}
+
+---
+Name: search
+Param: query: what to search for
+Param: max-results: how many results to return
+
+#!/bin/bash
+limit=${MAX_RESULTS}
+echo ${query} ${limit} ${GPTSCRIPT_INPUT}
+
+---
+Name: helper
+
+Help.
+
+---
+Name: unused
+
+Nothing uses me.
+
+---
+Name: cred
+Param: env: the variable to set
+
+#!sys.echo
+`), 0644))
+
+	diagnostics, err := Lint(context.Background(), file, "")
+	require.NoError(t, err)
+
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.String())
+	}
+	assert.Equal(t, []string{
+		file + ":1: error: ./missing.gpt can not be loaded: can not load tools path=" + dir + " name=./missing.gpt (unresolved-tool)",
+		file + ":1: warning: credential cred is passed extra, which it does not declare (credential-args)",
+		file + ":1: warning: ${topic} does not match any parameter (argument-placeholder)",
+		file + ":1: warning: ${Subject} does not match any parameter, credential arguments are case sensitive (argument-placeholder)",
+		file + ":9: warning: ${query} is not set, parameter query is exported as ${QUERY} (argument-placeholder)",
+		file + ":18: warning: agent helper has no description (agent-description)",
+		file + ":23: warning: tool unused is not referenced by any tool (unused-tool)",
+	}, got)
+	assert.True(t, HasErrors(diagnostics))
+
+	sarif := ToSARIF(diagnostics, DefaultRules()...)
+	require.Len(t, sarif.Runs, 1)
+	assert.Len(t, sarif.Runs[0].Tool.Driver.Rules, len(DefaultRules())+1)
+	require.Len(t, sarif.Runs[0].Results, len(diagnostics))
+	result := sarif.Runs[0].Results[0]
+	assert.Equal(t, "unresolved-tool", result.RuleID)
+	assert.Equal(t, "error", result.Level)
+	assert.Equal(t, filepath.ToSlash(file), result.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, 1, result.Locations[0].PhysicalLocation.Region.StartLine)
+}
+
+func TestLintLoadError(t *testing.T) {
+	diagnostics, err := Lint(context.Background(), "main.gpt", "Name: main\nParam: \n\n#!sys.echo\n")
+	require.NoError(t, err)
+	assert.Equal(t, []Diagnostic{{
+		Rule:     "load",
+		Severity: SeverityError,
+		Message:  "invalid arg format: ",
+		Location: "main.gpt",
+		Line:     2,
+	}}, diagnostics)
+}
@@ -0,0 +1,283 @@
+package lint
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/shlex"
+	"github.com/gptscript-ai/gptscript/pkg/env"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// DefaultRules returns the rules programs are checked with if none are set.
+func DefaultRules() []Rule {
+	return []Rule{
+		unresolvedRule{},
+		unusedRule{},
+		agentDescriptionRule{},
+		credentialArgsRule{},
+		placeholderRule{},
+	}
+}
+
+// loadRule is the rule of the diagnostic of a program that can't be loaded, which Lint reports instead of checking the
+// program.
+type loadRule struct{}
+
+func (loadRule) Name() string {
+	return "load"
+}
+
+func (loadRule) Description() string {
+	return "The script can be parsed and loaded."
+}
+
+func (loadRule) Check(*Program) []Diagnostic {
+	return nil
+}
+
+type unresolvedRule struct{}
+
+func (unresolvedRule) Name() string {
+	return "unresolved-tool"
+}
+
+func (unresolvedRule) Description() string {
+	return "Every tool that a tool references can be loaded."
+}
+
+func (r unresolvedRule) Check(prg *Program) (result []Diagnostic) {
+	for _, unresolved := range prg.Unresolved {
+		result = append(result, prg.Diagnostic(r, SeverityError, unresolved.Tool, "%s can not be loaded: %v", unresolved.Reference, unresolved.Err))
+	}
+	return
+}
+
+type unusedRule struct{}
+
+func (unusedRule) Name() string {
+	return "unused-tool"
+}
+
+func (unusedRule) Description() string {
+	return "Every tool in the script is referenced by a tool of the program."
+}
+
+func (r unusedRule) Check(prg *Program) (result []Diagnostic) {
+	for i, tool := range prg.Entry {
+		if _, ok := prg.ToolSet[tool.ID]; i != 0 && !ok {
+			result = append(result, prg.Diagnostic(r, SeverityWarning, tool, "tool %s is not referenced by any tool", tool.Name))
+		}
+	}
+	return
+}
+
+type agentDescriptionRule struct{}
+
+func (agentDescriptionRule) Name() string {
+	return "agent-description"
+}
+
+func (agentDescriptionRule) Description() string {
+	return "Every agent has a description, which is what the model chooses agents by."
+}
+
+func (r agentDescriptionRule) Check(prg *Program) (result []Diagnostic) {
+	reported := map[string]struct{}{}
+	for _, tool := range prg.LocalTools() {
+		for _, agent := range tool.Agents {
+			for _, ref := range tool.ToolMapping[agent] {
+				target := prg.ToolSet[ref.ToolID]
+				if strings.TrimSpace(target.Description) != "" {
+					continue
+				}
+				if _, ok := reported[target.ID]; ok {
+					continue
+				}
+				reported[target.ID] = struct{}{}
+
+				// Agents that are not local can't be given a description, so it is reported at the reference.
+				at := target
+				if !prg.Local(target) {
+					at = tool
+				}
+				result = append(result, prg.Diagnostic(r, SeverityWarning, at, "agent %s has no description", agent))
+			}
+		}
+	}
+	return
+}
+
+type credentialArgsRule struct{}
+
+func (credentialArgsRule) Name() string {
+	return "credential-args"
+}
+
+func (credentialArgsRule) Description() string {
+	return "Credential references pass the parameters their credential tool declares, like the names of the environment " +
+		"variables to set, and no others."
+}
+
+func (r credentialArgsRule) Check(prg *Program) (result []Diagnostic) {
+	for _, tool := range prg.LocalTools() {
+		for _, credential := range slices.Concat(tool.Credentials, tool.ExportCredentials) {
+			name, _, _, args, err := types.ParseCredentialArgs(credential, "")
+			if err != nil {
+				result = append(result, prg.Diagnostic(r, SeverityError, tool, "invalid credential %s: %v", credential, err))
+				continue
+			}
+
+			for _, ref := range tool.ToolMapping[credential] {
+				var (
+					target   = prg.ToolSet[ref.ToolID]
+					declared = map[string]struct{}{}
+				)
+				if target.Arguments != nil {
+					for _, param := range sortedKeys(target.Arguments.Properties) {
+						declared[param] = struct{}{}
+						if _, ok := args[param]; !ok {
+							result = append(result, prg.Diagnostic(r, SeverityWarning, tool,
+								"credential %s is not passed %s, which it declares", name, param))
+						}
+					}
+				}
+				for _, arg := range sortedKeys(args) {
+					if _, ok := declared[arg]; !ok {
+						result = append(result, prg.Diagnostic(r, SeverityWarning, tool,
+							"credential %s is passed %s, which it does not declare", name, arg))
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+type placeholderRule struct{}
+
+func (placeholderRule) Name() string {
+	return "argument-placeholder"
+}
+
+func (placeholderRule) Description() string {
+	return "The ${name} placeholders in the arguments of tool references match the parameters of the tool, and the ones " +
+		"in commands use the upper case names that parameters are exported to the environment as."
+}
+
+var placeholderRegexp = regexp.MustCompile(`\$\{!?([A-Za-z_][A-Za-z0-9_]*)`)
+
+func (r placeholderRule) Check(prg *Program) (result []Diagnostic) {
+	for _, tool := range prg.LocalTools() {
+		var params []string
+		if tool.Arguments != nil {
+			params = sortedKeys(tool.Arguments.Properties)
+		}
+
+		reported := map[string]struct{}{}
+		report := func(name, format string, args ...any) {
+			if _, ok := reported[name]; !ok {
+				reported[name] = struct{}{}
+				result = append(result, prg.Diagnostic(r, SeverityWarning, tool, format, args...))
+			}
+		}
+
+		for _, name := range refPlaceholders(tool) {
+			if !slices.ContainsFunc(params, func(param string) bool { return strings.EqualFold(param, name) }) {
+				report(name, "${%s} does not match any parameter", name)
+			}
+		}
+		for _, name := range credentialPlaceholders(tool) {
+			if !slices.Contains(params, name) {
+				report(name, "${%s} does not match any parameter, credential arguments are case sensitive", name)
+			}
+		}
+
+		if !tool.IsCommand() {
+			// The instructions of prompts are not expanded, so placeholders in them are just text to the model.
+			continue
+		}
+
+		// Parameters are exported to commands as upper case environment variables, so a placeholder that names a
+		// parameter in any other case is empty when the command runs.
+		texts := []string{tool.Instructions}
+		if interpreter, _, _ := strings.Cut(tool.Instructions, "\n"); !isShell(interpreter) {
+			// The bodies of other interpreters are code in which ${} means something else.
+			texts = []string{interpreter}
+		}
+		for _, text := range texts {
+			for _, match := range placeholderRegexp.FindAllStringSubmatch(text, -1) {
+				name := match[1]
+				for _, param := range params {
+					if exported := strings.ToUpper(env.ToEnvLike(param)); name != exported && strings.ToUpper(env.ToEnvLike(name)) == exported {
+						report(name, "${%s} is not set, parameter %s is exported as ${%s}", name, param, exported)
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// refPlaceholders returns the names of the $name and ${name} placeholders in the arguments of the tool references of
+// a tool other than credentials, which are looked up in the input of the tool regardless of case.
+func refPlaceholders(tool types.Tool) (result []string) {
+	refs := slices.Concat(tool.Tools, tool.Agents, tool.Export, tool.ExportContext, tool.Context, tool.InputFilters,
+		tool.ExportInputFilters, tool.OutputFilters, tool.ExportOutputFilters)
+	for _, ref := range refs {
+		_, arg := types.SplitArg(ref)
+		fields, err := shlex.Split(arg)
+		if err != nil {
+			continue
+		}
+		for i := 0; i < len(fields); i++ {
+			if fields[i] == "as" {
+				i++
+				continue
+			}
+			if key, ok := strings.CutPrefix(fields[i], "$"); ok {
+				result = append(result, strings.TrimSuffix(strings.TrimPrefix(key, "{"), "}"))
+			}
+		}
+	}
+	return
+}
+
+// credentialPlaceholders returns the names of the ${name} placeholders in the arguments of the credentials of a tool,
+// which are looked up in the input of the tool by their exact name.
+func credentialPlaceholders(tool types.Tool) (result []string) {
+	for _, credential := range slices.Concat(tool.Credentials, tool.ExportCredentials) {
+		_, _, _, args, err := types.ParseCredentialArgs(credential, "")
+		if err != nil {
+			continue
+		}
+		for _, arg := range sortedKeys(args) {
+			value, _ := args[arg].(string)
+			if strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}") {
+				result = append(result, strings.TrimSuffix(strings.TrimPrefix(value, "${"), "}"))
+			}
+		}
+	}
+	return
+}
+
+// isShell returns whether the interpreter of a command tool is a shell, like #!/bin/bash or #!/usr/bin/env sh.
+func isShell(interpreter string) bool {
+	fields := strings.Fields(strings.TrimPrefix(interpreter, types.CommandPrefix))
+	if len(fields) > 1 && path.Base(fields[0]) == "env" {
+		fields = fields[1:]
+	}
+	return len(fields) > 0 && slices.Contains([]string{"sh", "bash", "zsh", "dash", "ksh"}, path.Base(fields[0]))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,116 @@
+package lint
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/version"
+)
+
+// SARIF is a log in the Static Analysis Results Interchange Format 2.1.0, which code scanning tools like the one of
+// GitHub read.
+type SARIF struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SARIFRun `json:"runs"`
+}
+
+type SARIFRun struct {
+	Tool    SARIFTool     `json:"tool"`
+	Results []SARIFResult `json:"results"`
+}
+
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+type SARIFDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []SARIFRule `json:"rules"`
+}
+
+type SARIFRule struct {
+	ID               string       `json:"id"`
+	ShortDescription SARIFMessage `json:"shortDescription"`
+}
+
+type SARIFResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   SARIFMessage    `json:"message"`
+	Locations []SARIFLocation `json:"locations,omitempty"`
+}
+
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+type SARIFLocation struct {
+	PhysicalLocation SARIFPhysicalLocation `json:"physicalLocation"`
+}
+
+type SARIFPhysicalLocation struct {
+	ArtifactLocation SARIFArtifactLocation `json:"artifactLocation"`
+	Region           *SARIFRegion          `json:"region,omitempty"`
+}
+
+type SARIFArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type SARIFRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// ToSARIF returns the diagnostics of rules as a SARIF log.
+func ToSARIF(diagnostics []Diagnostic, rules ...Rule) SARIF {
+	run := SARIFRun{
+		Tool: SARIFTool{
+			Driver: SARIFDriver{
+				Name:           version.ProgramName,
+				Version:        version.Get().Tag,
+				InformationURI: "https://github.com/gptscript-ai/gptscript",
+			},
+		},
+		Results: []SARIFResult{},
+	}
+
+	for _, rule := range append([]Rule{loadRule{}}, rules...) {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, SARIFRule{
+			ID:               rule.Name(),
+			ShortDescription: SARIFMessage{Text: rule.Description()},
+		})
+	}
+
+	for _, d := range diagnostics {
+		result := SARIFResult{
+			RuleID:  d.Rule,
+			Level:   string(d.Severity),
+			Message: SARIFMessage{Text: d.Message},
+		}
+		if d.Location != "" {
+			uri := d.Location
+			if !strings.Contains(uri, "://") {
+				uri = filepath.ToSlash(filepath.Clean(uri))
+			}
+			location := SARIFLocation{
+				PhysicalLocation: SARIFPhysicalLocation{
+					ArtifactLocation: SARIFArtifactLocation{URI: uri},
+				},
+			}
+			if d.Line > 0 {
+				location.PhysicalLocation.Region = &SARIFRegion{StartLine: d.Line}
+			}
+			result.Locations = append(result.Locations, location)
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	return SARIF{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []SARIFRun{run},
+	}
+}
@@ -9,8 +9,12 @@ import (
 
 	"github.com/google/uuid"
 	openai2 "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
 	"github.com/gptscript-ai/gptscript/pkg/env"
+	"github.com/gptscript-ai/gptscript/pkg/models"
+	"github.com/gptscript-ai/gptscript/pkg/mvl"
 	"github.com/gptscript-ai/gptscript/pkg/openai"
+	"github.com/gptscript-ai/gptscript/pkg/ratelimit"
 	"github.com/gptscript-ai/gptscript/pkg/remote"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 )
@@ -21,11 +25,28 @@ type Client interface {
 	Supports(ctx context.Context, modelName string) (bool, error)
 }
 
+// modelSupporter is implemented by the clients that know whether they serve a model without listing the models of a
+// provider.
+type modelSupporter interface {
+	SupportsModel(modelName string) bool
+}
+
+// providerNamer is implemented by the clients that know the provider of a model, whose rate limits apply to the calls
+// to the model.
+type providerNamer interface {
+	ProviderName(modelName string) string
+}
+
+var log = mvl.Package()
+
 type Registry struct {
 	proxyToken string
 	proxyURL   string
 	proxyLock  sync.Mutex
 	clients    []Client
+	routes     *Routes
+	models     *models.Registry
+	limiter    *ratelimit.Limiter
 }
 
 func NewRegistry() *Registry {
@@ -39,6 +60,21 @@ func (r *Registry) AddClient(client Client) error {
 	return nil
 }
 
+// SetLimiter sets the rate limits of the model providers, which are shared by every registry with the same limiter.
+func (r *Registry) SetLimiter(limiter *ratelimit.Limiter) {
+	r.limiter = limiter
+}
+
+// SetRoutes sets the fallbacks and routing rules of the calls, and the models whose tokenizers estimate the tokens of
+// their prompts.
+func (r *Registry) SetRoutes(routes *Routes, modelInfo *models.Registry) {
+	if modelInfo == nil {
+		modelInfo = models.NewRegistry(0)
+	}
+	r.routes = routes
+	r.models = modelInfo
+}
+
 func (r *Registry) ListModels(ctx context.Context, providers ...string) (result []openai2.Model, _ error) {
 	for _, v := range r.clients {
 		models, err := v.ListModels(ctx, providers...)
@@ -54,13 +90,22 @@ func (r *Registry) ListModels(ctx context.Context, providers ...string) (result
 }
 
 func (r *Registry) fastPath(modelName string) Client {
-	// This is optimization hack to avoid doing List Models
-	if len(r.clients) == 1 {
-		return r.clients[0]
+	// The clients that know their models answer them without the other clients, and are otherwise left out of the fast
+	// path.
+	clients := make([]Client, 0, len(r.clients))
+	for _, client := range r.clients {
+		if c, ok := client.(modelSupporter); ok {
+			if c.SupportsModel(modelName) {
+				return client
+			}
+			continue
+		}
+		clients = append(clients, client)
 	}
 
-	if len(r.clients) != 2 {
-		return nil
+	// This is optimization hack to avoid doing List Models
+	if len(clients) == 1 {
+		return clients[0]
 	}
 
 	_, modelFromProvider := types.SplitToolRef(modelName)
@@ -68,17 +113,29 @@ func (r *Registry) fastPath(modelName string) Client {
 		return nil
 	}
 
-	_, ok := r.clients[0].(*openai.Client)
-	if !ok {
-		return nil
+	// The fast path only applies to the default setup of the built-in clients followed by the remote client.
+	var (
+		oaiClient Client
+		hasRemote bool
+	)
+	for _, client := range clients {
+		switch c := client.(type) {
+		case *openai.Client:
+			if oaiClient != nil {
+				return nil
+			}
+			oaiClient = c
+		case *remote.Client:
+			hasRemote = true
+		default:
+			return nil
+		}
 	}
 
-	_, ok = r.clients[1].(*remote.Client)
-	if !ok {
+	if !hasRemote {
 		return nil
 	}
-
-	return r.clients[0]
+	return oaiClient
 }
 
 func (r *Registry) getClient(ctx context.Context, modelName string, env []string) (Client, error) {
@@ -122,13 +179,97 @@ func (r *Registry) getClient(ctx context.Context, modelName string, env []string
 	return nil, errors.Join(errs...)
 }
 
+// Call sends the request to the model of its route, and then to the fallbacks of that model in order while the calls
+// fail with a rate limit, server or context length error.
 func (r *Registry) Call(ctx context.Context, messageRequest types.CompletionRequest, env []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
 	if messageRequest.Model == "" {
 		return nil, fmt.Errorf("model is required")
 	}
 
+	var toolName string
+	if engineCtx, ok := engine.FromContext(ctx); ok {
+		toolName = engineCtx.Tool.Name
+	}
+	modelNames := r.routes.models(toolName, messageRequest, func() int {
+		return countPromptTokens(r.models, messageRequest)
+	})
+	if len(modelNames) == 0 {
+		return nil, fmt.Errorf("model is required")
+	}
+
+	var err error
+	for i, modelName := range modelNames {
+		if i > 0 {
+			reason := fallbackReason(err)
+			log.Infof("falling back from %s to %s (%s): %v", modelNames[i-1], modelName, reason, err)
+			status <- types.CompletionStatus{
+				Model: modelNames[i-1],
+				Fallback: &types.Fallback{
+					From:   modelNames[i-1],
+					To:     modelName,
+					Reason: reason,
+					Error:  err.Error(),
+				},
+			}
+		}
+
+		request := messageRequest
+		request.Model = modelName
+
+		var resp *types.CompletionMessage
+		resp, err = r.callWithModel(ctx, request, env, status)
+		if err == nil {
+			if resp.Model == "" {
+				resp.Model = modelName
+			}
+			return resp, nil
+		}
+		if fallbackReason(err) == "" || ctx.Err() != nil {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// callWithModel calls the model of the request, setting it as the model of the statuses of the call.
+func (r *Registry) callWithModel(ctx context.Context, messageRequest types.CompletionRequest, env []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	var (
+		modelStatus = make(chan types.CompletionStatus)
+		done        = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for s := range modelStatus {
+			s.Model = types.FirstSet(s.Model, messageRequest.Model)
+			status <- s
+		}
+	}()
+	defer func() {
+		close(modelStatus)
+		<-done
+	}()
+
+	return r.call(ctx, messageRequest, env, modelStatus)
+}
+
+// callClient calls the client with the rate limits of the provider of the model.
+func (r *Registry) callClient(ctx context.Context, client Client, messageRequest types.CompletionRequest, env []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	ctx = ratelimit.WithProvider(ctx, r.limiter, providerName(client, messageRequest.Model))
+	return client.Call(ctx, messageRequest, env, status)
+}
+
+// providerName returns the name of the provider of the model, which is either the provider the model is from, or the
+// built-in provider of the client.
+func providerName(client Client, modelName string) string {
+	if c, ok := client.(providerNamer); ok {
+		return c.ProviderName(modelName)
+	}
+	return ""
+}
+
+func (r *Registry) call(ctx context.Context, messageRequest types.CompletionRequest, env []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
 	if c := r.fastPath(messageRequest.Model); c != nil {
-		return c.Call(ctx, messageRequest, env, status)
+		return r.callClient(ctx, c, messageRequest, env, status)
 	}
 
 	var errs []error
@@ -143,7 +284,7 @@ func (r *Registry) Call(ctx context.Context, messageRequest types.CompletionRequ
 
 			errs = append(errs, err)
 		} else if ok {
-			return client.Call(ctx, messageRequest, env, status)
+			return r.callClient(ctx, client, messageRequest, env, status)
 		}
 	}
 
@@ -156,7 +297,7 @@ func (r *Registry) Call(ctx context.Context, messageRequest types.CompletionRequ
 		if err != nil {
 			return nil, err
 		} else if ok {
-			return oaiClient.Call(ctx, messageRequest, env, status)
+			return r.callClient(ctx, oaiClient, messageRequest, env, status)
 		}
 	}
 
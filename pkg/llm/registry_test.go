@@ -0,0 +1,24 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFastPathModelSupporter(t *testing.T) {
+	mockClient := mock.New("", false)
+	registry := NewRegistry()
+	for _, client := range []Client{mockClient, &testClient{}, &testClient{}} {
+		assert.NoError(t, registry.AddClient(client))
+	}
+
+	assert.Same(t, mockClient, registry.fastPath("model from mock"))
+	assert.Nil(t, registry.fastPath("model"))
+}
+
+func TestProviderName(t *testing.T) {
+	assert.Equal(t, mock.ProviderName, providerName(mock.New("", false), "model from mock"))
+	assert.Equal(t, "", providerName(&testClient{}, "model"))
+}
@@ -0,0 +1,201 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	openai2 "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/anthropic"
+	"github.com/gptscript-ai/gptscript/pkg/models"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// The reasons a call falls back to the next model.
+const (
+	FallbackRateLimit     = "rate limit"
+	FallbackServerError   = "server error"
+	FallbackContextLength = "context length"
+)
+
+// Routes are the fallbacks and routing rules of the calls to models.
+type Routes struct {
+	// Fallbacks are the models that are tried in order, keyed by the model they replace when a call to it fails with a
+	// rate limit, server or context length error.
+	Fallbacks map[string][]string `json:"fallbacks,omitempty"`
+	// Rules send calls to other models than the tools request. The first rule that matches a call applies.
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// Rule sends the calls that match all of its conditions to another model.
+type Rule struct {
+	// Tool is a regular expression the name of the tool that makes the call must match.
+	Tool string `json:"tool,omitempty"`
+	// Model is a regular expression the requested model must match.
+	Model string `json:"model,omitempty"`
+	// MinPromptTokens and MaxPromptTokens bound the estimated tokens of the messages of the call.
+	MinPromptTokens int `json:"minPromptTokens,omitempty"`
+	MaxPromptTokens int `json:"maxPromptTokens,omitempty"`
+	// JSONResponse, if set, must match whether the call requires a JSON response.
+	JSONResponse *bool `json:"jsonResponse,omitempty"`
+	// Use is the model the calls are sent to, in the syntax of the Model directive, so it can be followed by its
+	// fallbacks separated by commas.
+	Use string `json:"use"`
+
+	tool, model *regexp.Regexp
+}
+
+// LoadRoutes reads JSON or YAML routes from a file.
+func LoadRoutes(file string) (*Routes, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model routes %s: %w", file, err)
+	}
+
+	var routes Routes
+	if err := yaml.Unmarshal(data, &routes); err != nil {
+		return nil, fmt.Errorf("failed to parse model routes %s: %w", file, err)
+	}
+	if err := routes.compile(); err != nil {
+		return nil, fmt.Errorf("invalid model routes %s: %w", file, err)
+	}
+	return &routes, nil
+}
+
+func (r *Routes) compile() (err error) {
+	for i := range r.Rules {
+		rule := &r.Rules[i]
+		if rule.Use == "" {
+			return fmt.Errorf("rule %d has no model to use", i+1)
+		}
+		if rule.Tool != "" {
+			if rule.tool, err = regexp.Compile(rule.Tool); err != nil {
+				return fmt.Errorf("invalid tool of rule %d: %w", i+1, err)
+			}
+		}
+		if rule.Model != "" {
+			if rule.model, err = regexp.Compile(rule.Model); err != nil {
+				return fmt.Errorf("invalid model of rule %d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SplitModels splits the value of a Model directive into the model and its fallbacks, which are separated by commas.
+func SplitModels(model string) (result []string) {
+	for _, name := range strings.Split(model, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// models returns the models that a call is sent to in order, until one of them doesn't fail with an error that falls
+// back. The tokens of the prompt are only counted if a rule depends on them.
+func (r *Routes) models(toolName string, request types.CompletionRequest, promptTokens func() int) []string {
+	if r == nil {
+		return SplitModels(request.Model)
+	}
+
+	model := request.Model
+	for _, rule := range r.Rules {
+		if rule.matches(toolName, request, promptTokens) {
+			log.Debugf("routing the call of %s from %s to %s", toolName, request.Model, rule.Use)
+			model = rule.Use
+			break
+		}
+	}
+
+	var result []string
+	for _, name := range SplitModels(model) {
+		for _, name := range append([]string{name}, r.Fallbacks[name]...) {
+			if !slices.Contains(result, name) {
+				result = append(result, name)
+			}
+		}
+	}
+	return result
+}
+
+func (r Rule) matches(toolName string, request types.CompletionRequest, promptTokens func() int) bool {
+	if r.tool != nil && !r.tool.MatchString(toolName) {
+		return false
+	}
+	if r.model != nil && !r.model.MatchString(request.Model) {
+		return false
+	}
+	if r.JSONResponse != nil && *r.JSONResponse != request.JSONResponse {
+		return false
+	}
+	if r.MinPromptTokens > 0 || r.MaxPromptTokens > 0 {
+		tokens := promptTokens()
+		if r.MinPromptTokens > 0 && tokens < r.MinPromptTokens {
+			return false
+		}
+		if r.MaxPromptTokens > 0 && tokens > r.MaxPromptTokens {
+			return false
+		}
+	}
+	return true
+}
+
+// countPromptTokens estimates the tokens of the messages of a request with the tokenizer of the model.
+func countPromptTokens(registry *models.Registry, request types.CompletionRequest) int {
+	tokenizer, err := registry.Tokenizer(request.Model)
+	if err != nil {
+		log.Errorf("failed to count the prompt tokens of %s: %v", request.Model, err)
+		return 0
+	}
+
+	var result int
+	for _, msg := range request.Messages {
+		for _, content := range msg.Content {
+			result += tokenizer.Count(content.Text)
+			if content.ToolCall != nil {
+				result += tokenizer.Count(content.ToolCall.Function.Arguments)
+			}
+		}
+	}
+	return result
+}
+
+// fallbackReason returns why a call failed if the failure falls back to the next model, or "" if it doesn't.
+func fallbackReason(err error) string {
+	var (
+		apiError          *openai2.APIError
+		requestError      *openai2.RequestError
+		anthropicAPIError *anthropic.APIError
+	)
+	switch {
+	case errors.As(err, &apiError):
+		if apiError.Code == "context_length_exceeded" {
+			return FallbackContextLength
+		}
+		return statusFallbackReason(apiError.HTTPStatusCode)
+	case errors.As(err, &requestError):
+		return statusFallbackReason(requestError.HTTPStatusCode)
+	case errors.As(err, &anthropicAPIError):
+		if strings.Contains(anthropicAPIError.Message, "prompt is too long") {
+			return FallbackContextLength
+		}
+		return statusFallbackReason(anthropicAPIError.StatusCode)
+	}
+	return ""
+}
+
+func statusFallbackReason(code int) string {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return FallbackRateLimit
+	case code >= http.StatusInternalServerError:
+		return FallbackServerError
+	}
+	return ""
+}
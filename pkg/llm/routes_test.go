@@ -0,0 +1,192 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	openai2 "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/anthropic"
+	"github.com/gptscript-ai/gptscript/pkg/models"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClient serves the models of its errors, failing the calls to the models with a non-nil error.
+type testClient struct {
+	errors map[string]error
+	calls  []string
+}
+
+func (t *testClient) Call(_ context.Context, messageRequest types.CompletionRequest, _ []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	t.calls = append(t.calls, messageRequest.Model)
+	status <- types.CompletionStatus{
+		CompletionID: "1",
+		Request:      messageRequest,
+	}
+	if err := t.errors[messageRequest.Model]; err != nil {
+		return nil, err
+	}
+	return &types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeAssistant,
+		Content: types.Text("from " + messageRequest.Model),
+	}, nil
+}
+
+func (t *testClient) ListModels(context.Context, ...string) ([]openai2.Model, error) {
+	return nil, nil
+}
+
+func (t *testClient) Supports(_ context.Context, modelName string) (bool, error) {
+	_, ok := t.errors[modelName]
+	return ok, nil
+}
+
+func writeRoutes(t *testing.T, content string) *Routes {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "routes.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	routes, err := LoadRoutes(file)
+	require.NoError(t, err)
+	return routes
+}
+
+func TestSplitModels(t *testing.T) {
+	assert.Equal(t, []string{"gpt-4o"}, SplitModels("gpt-4o"))
+	assert.Equal(t, []string{"gpt-4o", "claude-3-5-sonnet from anthropic"}, SplitModels(" gpt-4o , claude-3-5-sonnet from anthropic,"))
+	assert.Empty(t, SplitModels(" , "))
+}
+
+func TestRoutes(t *testing.T) {
+	routes := writeRoutes(t, `
+fallbacks:
+  gpt-4o: [gpt-4o-mini, claude]
+rules:
+- tool: ^summarize$
+  use: cheap, gpt-4o
+- minPromptTokens: 10
+  use: big
+- model: ^gpt-4o$
+  jsonResponse: true
+  use: json
+`)
+
+	tokenizer := models.NewRegistry(1)
+	models := func(toolName string, request types.CompletionRequest) []string {
+		return routes.models(toolName, request, func() int {
+			return countPromptTokens(tokenizer, request)
+		})
+	}
+
+	request := types.CompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("hi")}},
+	}
+	assert.Equal(t, []string{"gpt-4o", "gpt-4o-mini", "claude"}, models("main", request))
+	assert.Equal(t, []string{"cheap", "gpt-4o", "gpt-4o-mini", "claude"}, models("summarize", request))
+
+	jsonRequest := request
+	jsonRequest.JSONResponse = true
+	assert.Equal(t, []string{"json"}, models("main", jsonRequest))
+
+	bigRequest := request
+	bigRequest.Messages = []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text(strings.Repeat("word ", 20))}}
+	assert.Equal(t, []string{"big"}, models("main", bigRequest))
+
+	assert.Equal(t, []string{"a", "b"}, (*Routes)(nil).models("main", types.CompletionRequest{Model: "a, b"}, nil))
+}
+
+func TestLoadRoutesErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "routes.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("rules:\n- tool: foo\n"), 0644))
+	_, err := LoadRoutes(file)
+	assert.ErrorContains(t, err, "rule 1 has no model to use")
+
+	require.NoError(t, os.WriteFile(file, []byte("rules:\n- tool: '('\n  use: gpt-4o\n"), 0644))
+	_, err = LoadRoutes(file)
+	assert.ErrorContains(t, err, "invalid tool of rule 1")
+}
+
+func TestFallbackReason(t *testing.T) {
+	assert.Equal(t, FallbackRateLimit, fallbackReason(&openai2.APIError{HTTPStatusCode: http.StatusTooManyRequests}))
+	assert.Equal(t, FallbackServerError, fallbackReason(&openai2.RequestError{HTTPStatusCode: http.StatusBadGateway}))
+	assert.Equal(t, FallbackContextLength, fallbackReason(&openai2.APIError{HTTPStatusCode: http.StatusBadRequest, Code: "context_length_exceeded"}))
+	assert.Equal(t, FallbackServerError, fallbackReason(&anthropic.APIError{StatusCode: 529}))
+	assert.Equal(t, FallbackContextLength, fallbackReason(&anthropic.APIError{StatusCode: http.StatusBadRequest, Message: "prompt is too long: 250000 tokens > 200000 maximum"}))
+	assert.Empty(t, fallbackReason(&openai2.APIError{HTTPStatusCode: http.StatusUnauthorized}))
+	assert.Empty(t, fallbackReason(context.Canceled))
+}
+
+func collect(status chan types.CompletionStatus) func() []types.CompletionStatus {
+	var (
+		result []types.CompletionStatus
+		done   = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for s := range status {
+			result = append(result, s)
+		}
+	}()
+	return func() []types.CompletionStatus {
+		close(status)
+		<-done
+		return result
+	}
+}
+
+func TestCallFallback(t *testing.T) {
+	primaryErr := &openai2.APIError{HTTPStatusCode: http.StatusServiceUnavailable, Message: "overloaded"}
+	client := &testClient{
+		errors: map[string]error{
+			"primary":   primaryErr,
+			"secondary": nil,
+			"tertiary":  nil,
+		},
+	}
+	registry := NewRegistry()
+	require.NoError(t, registry.AddClient(client))
+
+	status := make(chan types.CompletionStatus)
+	statuses := collect(status)
+
+	resp, err := registry.Call(context.Background(), types.CompletionRequest{Model: "primary, secondary, tertiary"}, nil, status)
+	require.NoError(t, err)
+	assert.Equal(t, "from secondary", resp.String())
+	assert.Equal(t, "secondary", resp.Model)
+	assert.Equal(t, []string{"primary", "secondary"}, client.calls)
+
+	result := statuses()
+	require.Len(t, result, 3)
+	assert.Equal(t, "primary", result[0].Model)
+	assert.Equal(t, &types.Fallback{
+		From:   "primary",
+		To:     "secondary",
+		Reason: FallbackServerError,
+		Error:  primaryErr.Error(),
+	}, result[1].Fallback)
+	assert.Equal(t, "secondary", result[2].Model)
+}
+
+func TestCallNoFallback(t *testing.T) {
+	client := &testClient{
+		errors: map[string]error{
+			"primary":   &openai2.APIError{HTTPStatusCode: http.StatusUnauthorized, Message: "invalid key"},
+			"secondary": nil,
+		},
+	}
+	registry := NewRegistry()
+	require.NoError(t, registry.AddClient(client))
+
+	status := make(chan types.CompletionStatus)
+	statuses := collect(status)
+
+	_, err := registry.Call(context.Background(), types.CompletionRequest{Model: "primary, secondary"}, nil, status)
+	assert.ErrorContains(t, err, "invalid key")
+	assert.Equal(t, []string{"primary"}, client.calls)
+	assert.Len(t, statuses(), 1)
+}
@@ -0,0 +1,146 @@
+// Package gitclone loads tools from any git repo by checking it out, for hosts that don't serve the files of repos
+// over HTTP.
+package gitclone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	gpath "path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/locker"
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/repos/git"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+type Config struct {
+	// Prefix is what the references to the tools start with, like git+https:// or git.example.com/.
+	Prefix string
+	// URL replaces the prefix in the URL the repo is cloned from, like https:// or ssh://git@git.example.com/.
+	URL string
+}
+
+var defaultConfigs = []*Config{
+	{
+		Prefix: "git+https://",
+		URL:    "https://",
+	},
+	{
+		Prefix: "git+ssh://",
+		URL:    "ssh://",
+	},
+}
+
+func init() {
+	for _, config := range defaultConfigs {
+		loader.AddVSC(LoaderForPrefix(config.Prefix, config.URL))
+	}
+}
+
+// regexp to match a git commit id
+var commitRegexp = regexp.MustCompile("^[a-f0-9]{40}$")
+
+func LoaderForPrefix(prefix, cloneURL string) func(context.Context, *cache.Client, string) (string, string, *types.Repo, bool, error) {
+	config := &Config{
+		Prefix: prefix,
+		URL:    cloneURL,
+	}
+	return func(ctx context.Context, c *cache.Client, urlName string) (string, string, *types.Repo, bool, error) {
+		return LoadWithConfig(ctx, c, urlName, config)
+	}
+}
+
+// splitRepo splits a reference into the repo, which ends in .git, and the path of the tool in the repo.
+func splitRepo(urlPath string) (string, string, bool) {
+	i := strings.Index(urlPath, ".git/")
+	if i < 0 {
+		return urlPath, "", strings.HasSuffix(urlPath, ".git")
+	}
+	return urlPath[:i+len(".git")], urlPath[i+len(".git/"):], true
+}
+
+// LoadWithConfig checks out the repo of a reference like git+https://example.com/org/repo.git/path/tool.gpt@main at
+// the commit of the revision, and returns the file:// URL of the tool in the checkout.
+func LoadWithConfig(ctx context.Context, c *cache.Client, urlName string, config *Config) (string, string, *types.Repo, bool, error) {
+	if !strings.HasPrefix(urlName, config.Prefix) {
+		return "", "", nil, false, nil
+	}
+
+	urlPath, ref := loader.SplitRevision(strings.TrimPrefix(urlName, config.Prefix))
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	repo, path, ok := splitRepo(urlPath)
+	if !ok {
+		return "", "", nil, false, fmt.Errorf("invalid git reference %s, the path of the repo must end in .git", urlName)
+	}
+	repo = config.URL + repo
+	path = strings.Trim(path, "/")
+
+	commit := ref
+	if !commitRegexp.MatchString(ref) {
+		var err error
+		commit, err = git.LsRemote(ctx, repo, ref)
+		if err != nil {
+			return "", "", nil, false, fmt.Errorf("failed to get git commit of %s at %s: %w", repo, ref, err)
+		}
+	}
+
+	dir, err := checkout(ctx, c, repo, commit)
+	if err != nil {
+		return "", "", nil, false, err
+	}
+
+	// A directory is loaded as its default tool file.
+	return "file:///" + strings.TrimPrefix(filepath.ToSlash(filepath.Join(dir, filepath.FromSlash(path))), "/"), "", &types.Repo{
+		VCS:      "git",
+		Root:     repo,
+		Path:     gpath.Dir(path),
+		Name:     gpath.Base(path),
+		Revision: commit,
+	}, true, nil
+}
+
+// checkout checks out the commit of the repo in the cache directory, unless it was checked out before.
+func checkout(ctx context.Context, c *cache.Client, repo, commit string) (string, error) {
+	if c == nil {
+		var err error
+		c, err = cache.New()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var (
+		// The clones are shared with the checkouts of the tools that are run.
+		gitDir = filepath.Join(c.CacheDir(), "repos", "git")
+		dir    = filepath.Join(c.CacheDir(), "repos", "checkouts", hash.Digest(repo), commit)
+		done   = dir + ".done"
+	)
+
+	locker.Lock(dir)
+	defer locker.Unlock(dir)
+
+	if _, err := os.Stat(done); err == nil {
+		return dir, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	// Cleanup previous failed checkouts
+	_ = os.RemoveAll(dir)
+
+	if err := git.Checkout(ctx, gitDir, repo, commit, dir); err != nil {
+		return "", fmt.Errorf("failed to check out %s at %s: %w", repo, commit, err)
+	}
+	return dir, os.WriteFile(done, nil, 0644)
+}
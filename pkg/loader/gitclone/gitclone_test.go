@@ -0,0 +1,73 @@
+package gitclone
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gitCommand(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+func TestLoad(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	root := t.TempDir()
+	repo := filepath.Join(root, "tools.git")
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, "weather"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "weather", "tool.gpt"), []byte("Tools: ../sub.gpt\n\n#!sys.echo weather\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "sub.gpt"), []byte("#!sys.echo sub\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "secret.gpt"), []byte("#!sys.echo secret\n"), 0644))
+	gitCommand(t, repo, "init", "-b", "main")
+	gitCommand(t, repo, "add", ".")
+	gitCommand(t, repo, "commit", "-m", "tools")
+	commit := gitCommand(t, repo, "rev-parse", "HEAD")
+
+	c, err := cache.New(cache.Options{CacheDir: t.TempDir()})
+	require.NoError(t, err)
+	loader.AddVSC(LoaderForPrefix("git+test://", "file://"))
+
+	url, token, r, ok, err := LoadWithConfig(context.Background(), c, "git+test://"+repo+"/weather@main", &Config{Prefix: "git+test://", URL: "file://"})
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, token)
+	assert.Equal(t, "file://"+repo, r.Root)
+	assert.Equal(t, commit, r.Revision)
+	assert.Equal(t, "weather", r.Name)
+	assert.True(t, strings.HasPrefix(url, "file:///"))
+
+	prg, err := loader.Program(context.Background(), "git+test://"+repo+"/weather@main", "", loader.Options{Cache: c})
+	require.NoError(t, err)
+	var instructions []string
+	for _, tool := range prg.ToolSet {
+		instructions = append(instructions, tool.Instructions)
+		assert.Equal(t, commit, tool.Source.Repo.Revision)
+	}
+	assert.ElementsMatch(t, []string{"#!sys.echo weather", "#!sys.echo sub"}, instructions)
+
+	// Relative references can't leave the repo.
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "escape.gpt"), []byte("Tools: ../secret.gpt\n\n#!sys.echo escape\n"), 0644))
+	gitCommand(t, repo, "add", ".")
+	gitCommand(t, repo, "commit", "-m", "escape")
+	_, err = loader.Program(context.Background(), "git+test://"+repo+"/escape.gpt@main", "", loader.Options{Cache: c})
+	assert.ErrorContains(t, err, "can not load tools")
+
+	_, _, _, _, err = LoadWithConfig(context.Background(), c, "git+test://"+root+"/tools", &Config{Prefix: "git+test://", URL: "file://"})
+	assert.ErrorContains(t, err, "the path of the repo must end in .git")
+}
@@ -0,0 +1,154 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	gpath "path"
+	"regexp"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/mvl"
+	"github.com/gptscript-ai/gptscript/pkg/repos/git"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+type Config struct {
+	// Prefix is what the references to the tools on the instance start with, like gitea.example.com/.
+	Prefix string
+	// URL is the URL of the instance, like https://gitea.example.com.
+	URL       string
+	AuthToken string
+}
+
+var log = mvl.Package()
+
+// regexp to match a git commit id
+var commitRegexp = regexp.MustCompile("^[a-f0-9]{40}$")
+
+func getCommit(ctx context.Context, owner, repo, ref string, config *Config) (string, error) {
+	if commitRegexp.MatchString(ref) {
+		return ref, nil
+	}
+
+	query := url.Values{"limit": {"1"}, "stat": {"false"}, "verification": {"false"}, "files": {"false"}}
+	if ref != "HEAD" {
+		query.Set("sha", ref)
+	}
+	commitsURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/commits?%s", config.URL, owner, repo, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, commitsURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request of %s/%s at %s: %w", owner, repo, commitsURL, err)
+	}
+
+	if config.AuthToken != "" {
+		req.Header.Add("Authorization", "Bearer "+config.AuthToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		c, _ := io.ReadAll(resp.Body)
+		commit, fallBackErr := git.LsRemote(ctx, repoURL(owner, repo, config), ref)
+		if fallBackErr == nil {
+			return commit, nil
+		}
+		return "", fmt.Errorf("failed to get Gitea commit of %s/%s at %s (fallback error %v): %s %s",
+			owner, repo, ref, fallBackErr, resp.Status, c)
+	}
+
+	var commits []struct {
+		SHA string `json:"sha,omitempty"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&commits); err != nil {
+		return "", fmt.Errorf("failed to decode Gitea commit of %s/%s at %s: %w", owner, repo, commitsURL, err)
+	}
+
+	if len(commits) == 0 || commits[0].SHA == "" {
+		return "", fmt.Errorf("failed to find commit in response of %s, got empty string", commitsURL)
+	}
+
+	log.Debugf("loaded gitea commit of %s/%s at %s as %q", owner, repo, commitsURL, commits[0].SHA)
+	return commits[0].SHA, nil
+}
+
+func repoURL(owner, repo string, config *Config) string {
+	return fmt.Sprintf("%s/%s/%s.git", config.URL, owner, repo)
+}
+
+// apiURL returns the URL of the Gitea API that a file is downloaded from, for the URL of the file that LoadWithConfig
+// returned, and the token to download it with. The raw files of private repos are only served by the API to tokens.
+func (c *Config) apiURL(fileURL string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(fileURL, c.URL+"/")
+	if !ok {
+		return "", "", false
+	}
+	repo, rest, ok := strings.Cut(rest, "/raw/commit/")
+	if !ok || strings.Count(repo, "/") != 1 {
+		return "", "", false
+	}
+	ref, path, _ := strings.Cut(rest, "/")
+	return fmt.Sprintf("%s/api/v1/repos/%s/raw/%s?ref=%s", c.URL, repo, path, url.QueryEscape(ref)), c.AuthToken, true
+}
+
+// LoaderForPrefix returns the VCS lookup of the tools of a Gitea instance, and adds the download URLs of its files.
+func LoaderForPrefix(prefix, instanceURL, token string) func(context.Context, *cache.Client, string) (string, string, *types.Repo, bool, error) {
+	config := &Config{
+		Prefix:    prefix,
+		URL:       strings.TrimSuffix(instanceURL, "/"),
+		AuthToken: token,
+	}
+	loader.AddDownloadURL(config.apiURL)
+	return func(ctx context.Context, c *cache.Client, urlName string) (string, string, *types.Repo, bool, error) {
+		return LoadWithConfig(ctx, c, urlName, config)
+	}
+}
+
+func LoadWithConfig(ctx context.Context, _ *cache.Client, urlName string, config *Config) (string, string, *types.Repo, bool, error) {
+	if !strings.HasPrefix(urlName, config.Prefix) {
+		return "", "", nil, false, nil
+	}
+
+	urlPath, ref := loader.SplitRevision(strings.TrimPrefix(urlName, config.Prefix))
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	parts := strings.Split(urlPath, "/")
+	// Must be at least 2 parts OWNER/REPO[/FILE]
+	if len(parts) < 2 {
+		return "", "", nil, false, nil
+	}
+
+	owner, repo := parts[0], parts[1]
+	path := strings.Trim(strings.Join(parts[2:], "/"), "/")
+
+	ref, err := getCommit(ctx, owner, repo, ref, config)
+	if err != nil {
+		return "", "", nil, false, err
+	}
+
+	// A directory is loaded as its default tool file when the file is not found. The file is downloaded from the URL of
+	// apiURL.
+	downloadURL := fmt.Sprintf("%s/%s/%s/raw/commit/%s", config.URL, owner, repo, ref)
+	if path != "" {
+		downloadURL += "/" + path
+	}
+
+	return downloadURL, config.AuthToken, &types.Repo{
+		VCS:      "git",
+		Root:     repoURL(owner, repo, config),
+		Path:     gpath.Dir(path),
+		Name:     gpath.Base(path),
+		Revision: ref,
+	}, true, nil
+}
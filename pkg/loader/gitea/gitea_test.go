@@ -0,0 +1,88 @@
+package gitea
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadWithConfig(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer mytoken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/api/v1/repos/team/tools/commits" && r.URL.Query().Get("sha") == "main" {
+			_, _ = w.Write([]byte(`[{"sha": "172dfb00b48c6adbbaa7e99270933f95887d1b91"}]`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+
+	load := LoaderForPrefix("gitea.test/", s.URL, "mytoken")
+
+	url, token, repo, ok, err := load(context.Background(), nil, "gitea.test/team/tools/weather/tool.gpt@main")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, s.URL+"/team/tools/raw/commit/172dfb00b48c6adbbaa7e99270933f95887d1b91/weather/tool.gpt", url)
+	assert.Equal(t, "mytoken", token)
+	assert.Equal(t, &types.Repo{
+		VCS:      "git",
+		Root:     s.URL + "/team/tools.git",
+		Path:     "weather",
+		Name:     "tool.gpt",
+		Revision: "172dfb00b48c6adbbaa7e99270933f95887d1b91",
+	}, repo)
+
+	_, _, _, ok, err = load(context.Background(), nil, "gitea.test/team")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, _, _, err = load(context.Background(), nil, "gitea.test/team/missing@main")
+	assert.ErrorContains(t, err, "failed to get Gitea commit of team/missing at main")
+}
+
+func TestLoadPrivateRepo(t *testing.T) {
+	const commit = "172dfb00b48c6adbbaa7e99270933f95887d1b91"
+	files := map[string]string{
+		"weather/tool.gpt":     "Tools: ./forecast.gpt\n\n#!sys.echo weather\n",
+		"weather/forecast.gpt": "#!sys.echo forecast\n",
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Like Gitea, only the API serves the files of private repos, and only to tokens.
+		if r.Header.Get("Authorization") != "Bearer mytoken" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Path == "/api/v1/repos/team/tools/commits" && r.URL.Query().Get("sha") == "main" {
+			_, _ = w.Write([]byte(`[{"sha": "` + commit + `"}]`))
+			return
+		}
+		file, ok := strings.CutPrefix(r.URL.Path, "/api/v1/repos/team/tools/raw/")
+		if content, found := files[file]; ok && found && r.URL.Query().Get("ref") == commit {
+			_, _ = w.Write([]byte(content))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+
+	loader.AddVSC(LoaderForPrefix("private.gitea.test/", s.URL, "mytoken"))
+
+	c, err := cache.New(cache.Options{CacheDir: t.TempDir()})
+	require.NoError(t, err)
+
+	prg, err := loader.Program(context.Background(), "private.gitea.test/team/tools/weather@main", "", loader.Options{Cache: c})
+	require.NoError(t, err)
+	require.Len(t, prg.ToolSet, 2)
+	assert.Equal(t, s.URL+"/team/tools/raw/commit/"+commit+"/weather", prg.ToolSet[prg.EntryToolID].Source.Location)
+}
@@ -0,0 +1,182 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	gpath "path"
+	"regexp"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/mvl"
+	"github.com/gptscript-ai/gptscript/pkg/repos/git"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+type Config struct {
+	// Prefix is what the references to the tools on the instance start with, like gitlab.com/.
+	Prefix string
+	// URL is the URL of the instance, like https://gitlab.com.
+	URL       string
+	AuthToken string
+}
+
+var (
+	log                 = mvl.Package()
+	defaultGitLabConfig = &Config{
+		Prefix:    "gitlab.com/",
+		URL:       "https://gitlab.com",
+		AuthToken: os.Getenv("GITLAB_TOKEN"),
+	}
+)
+
+func init() {
+	loader.AddVSC(Load)
+	loader.AddDownloadURL(defaultGitLabConfig.apiURL)
+}
+
+// regexp to match a git commit id
+var commitRegexp = regexp.MustCompile("^[a-f0-9]{40}$")
+
+func getCommit(ctx context.Context, project, ref string, config *Config) (string, error) {
+	if commitRegexp.MatchString(ref) {
+		return ref, nil
+	}
+
+	commitURL := fmt.Sprintf("%s/api/v4/projects/%s/repository/commits/%s", config.URL, url.PathEscape(project), url.PathEscape(ref))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, commitURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request of %s at %s: %w", project, commitURL, err)
+	}
+
+	if config.AuthToken != "" {
+		req.Header.Add("Authorization", "Bearer "+config.AuthToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		c, _ := io.ReadAll(resp.Body)
+		commit, fallBackErr := git.LsRemote(ctx, repoURL(project, config), ref)
+		if fallBackErr == nil {
+			return commit, nil
+		}
+		return "", fmt.Errorf("failed to get GitLab commit of %s at %s (fallback error %v): %s %s",
+			project, ref, fallBackErr, resp.Status, c)
+	}
+
+	var commit struct {
+		ID string `json:"id,omitempty"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&commit); err != nil {
+		return "", fmt.Errorf("failed to decode GitLab commit of %s at %s: %w", project, commitURL, err)
+	}
+
+	log.Debugf("loaded gitlab commit of %s at %s as %q", project, commitURL, commit.ID)
+
+	if commit.ID == "" {
+		return "", fmt.Errorf("failed to find commit in response of %s, got empty string", commitURL)
+	}
+
+	return commit.ID, nil
+}
+
+func repoURL(project string, config *Config) string {
+	return fmt.Sprintf("%s/%s.git", config.URL, project)
+}
+
+// splitProject splits the path of a reference into the project and the path of the tool in the project. Projects in
+// subgroups are separated from the path of the tool by /-/, as in the URLs of GitLab, and otherwise the project is the
+// group and the name of the project.
+func splitProject(urlPath string) (string, string, bool) {
+	if project, path, ok := strings.Cut(urlPath, "/-/"); ok {
+		return project, path, strings.Contains(project, "/")
+	}
+
+	parts := strings.Split(urlPath, "/")
+	// Must be at least 2 parts GROUP/PROJECT[/FILE]
+	if len(parts) < 2 {
+		return "", "", false
+	}
+	return strings.Join(parts[:2], "/"), strings.Join(parts[2:], "/"), true
+}
+
+// apiURL returns the URL of the GitLab API that a file is downloaded from, for the URL of the file that LoadWithConfig
+// returned, and the token to download it with. The raw files of private projects are only served by the API to tokens.
+func (c *Config) apiURL(fileURL string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(fileURL, c.URL+"/")
+	if !ok {
+		return "", "", false
+	}
+	project, rest, ok := strings.Cut(rest, "/-/raw/")
+	if !ok {
+		return "", "", false
+	}
+	ref, path, _ := strings.Cut(rest, "/")
+	return fmt.Sprintf("%s/api/v4/projects/%s/repository/files/%s/raw?ref=%s",
+		c.URL, url.PathEscape(project), url.PathEscape(path), url.QueryEscape(ref)), c.AuthToken, true
+}
+
+// LoaderForPrefix returns the VCS lookup of the tools of a GitLab instance, and adds the download URLs of its files.
+func LoaderForPrefix(prefix, instanceURL, token string) func(context.Context, *cache.Client, string) (string, string, *types.Repo, bool, error) {
+	config := &Config{
+		Prefix:    prefix,
+		URL:       strings.TrimSuffix(instanceURL, "/"),
+		AuthToken: token,
+	}
+	loader.AddDownloadURL(config.apiURL)
+	return func(ctx context.Context, c *cache.Client, urlName string) (string, string, *types.Repo, bool, error) {
+		return LoadWithConfig(ctx, c, urlName, config)
+	}
+}
+
+func Load(ctx context.Context, c *cache.Client, urlName string) (string, string, *types.Repo, bool, error) {
+	return LoadWithConfig(ctx, c, urlName, defaultGitLabConfig)
+}
+
+func LoadWithConfig(ctx context.Context, _ *cache.Client, urlName string, config *Config) (string, string, *types.Repo, bool, error) {
+	if !strings.HasPrefix(urlName, config.Prefix) {
+		return "", "", nil, false, nil
+	}
+
+	urlPath, ref := loader.SplitRevision(strings.TrimPrefix(urlName, config.Prefix))
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	project, path, ok := splitProject(urlPath)
+	if !ok {
+		return "", "", nil, false, nil
+	}
+	path = strings.Trim(path, "/")
+
+	ref, err := getCommit(ctx, project, ref, config)
+	if err != nil {
+		return "", "", nil, false, err
+	}
+
+	// A directory is loaded as its default tool file when the file is not found. The file is downloaded from the URL of
+	// apiURL.
+	downloadURL := fmt.Sprintf("%s/%s/-/raw/%s", config.URL, project, ref)
+	if path != "" {
+		downloadURL += "/" + path
+	}
+
+	return downloadURL, config.AuthToken, &types.Repo{
+		VCS:      "git",
+		Root:     repoURL(project, config),
+		Path:     gpath.Dir(path),
+		Name:     gpath.Base(path),
+		Revision: ref,
+	}, true, nil
+}
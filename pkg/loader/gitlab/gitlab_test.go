@@ -0,0 +1,102 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadWithConfig(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer mytoken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.RawPath {
+		case "/api/v4/projects/team%2Ftools/repository/commits/main",
+			"/api/v4/projects/team%2Fsub%2Ftools/repository/commits/v1%2F0":
+			_, _ = w.Write([]byte(`{"id": "172dfb00b48c6adbbaa7e99270933f95887d1b91"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	load := LoaderForPrefix("gitlab.test/", s.URL+"/", "mytoken")
+
+	url, token, repo, ok, err := load(context.Background(), nil, "gitlab.test/team/tools/weather/tool.gpt@main")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, s.URL+"/team/tools/-/raw/172dfb00b48c6adbbaa7e99270933f95887d1b91/weather/tool.gpt", url)
+	assert.Equal(t, "mytoken", token)
+	assert.Equal(t, &types.Repo{
+		VCS:      "git",
+		Root:     s.URL + "/team/tools.git",
+		Path:     "weather",
+		Name:     "tool.gpt",
+		Revision: "172dfb00b48c6adbbaa7e99270933f95887d1b91",
+	}, repo)
+
+	url, _, repo, ok, err = load(context.Background(), nil, "gitlab.test/team/sub/tools/-/weather@v1/0")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, s.URL+"/team/sub/tools/-/raw/172dfb00b48c6adbbaa7e99270933f95887d1b91/weather", url)
+	assert.Equal(t, s.URL+"/team/sub/tools.git", repo.Root)
+
+	url, _, repo, ok, err = load(context.Background(), nil, "gitlab.test/team/tools@172dfb00b48c6adbbaa7e99270933f95887d1b91")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, s.URL+"/team/tools/-/raw/172dfb00b48c6adbbaa7e99270933f95887d1b91", url)
+	assert.Equal(t, ".", repo.Path)
+
+	_, _, _, ok, err = load(context.Background(), nil, "github.com/team/tools")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, _, _, err = load(context.Background(), nil, "gitlab.test/team/missing@main")
+	assert.ErrorContains(t, err, "failed to get GitLab commit of team/missing at main")
+}
+
+func TestLoadPrivateProject(t *testing.T) {
+	const commit = "172dfb00b48c6adbbaa7e99270933f95887d1b91"
+	files := map[string]string{
+		"weather%2Ftool.gpt":     "Tools: ./forecast.gpt\n\n#!sys.echo weather\n",
+		"weather%2Fforecast.gpt": "#!sys.echo forecast\n",
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Like GitLab, only the API serves the files of private projects, and only to tokens.
+		if r.Header.Get("Authorization") != "Bearer mytoken" || !strings.HasPrefix(r.URL.EscapedPath(), "/api/v4/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.EscapedPath() == "/api/v4/projects/team%2Ftools/repository/commits/main" {
+			_, _ = w.Write([]byte(`{"id": "` + commit + `"}`))
+			return
+		}
+		file, ok := strings.CutPrefix(r.URL.EscapedPath(), "/api/v4/projects/team%2Ftools/repository/files/")
+		if content, found := files[strings.TrimSuffix(file, "/raw")]; ok && found && r.URL.Query().Get("ref") == commit {
+			_, _ = w.Write([]byte(content))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+
+	loader.AddVSC(LoaderForPrefix("private.gitlab.test/", s.URL, "mytoken"))
+
+	c, err := cache.New(cache.Options{CacheDir: t.TempDir()})
+	require.NoError(t, err)
+
+	prg, err := loader.Program(context.Background(), "private.gitlab.test/team/tools/weather@main", "", loader.Options{Cache: c})
+	require.NoError(t, err)
+	require.Len(t, prg.ToolSet, 2)
+	assert.Equal(t, s.URL+"/team/tools/-/raw/"+commit+"/weather", prg.ToolSet[prg.EntryToolID].Source.Location)
+}
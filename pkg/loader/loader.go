@@ -55,6 +55,12 @@ type source struct {
 	Location string
 	// Repo The VCS repo where this tool was found, used to clone and provide the local tool code content
 	Repo *types.Repo
+	// Signature is the detached signature of a remote source, if it has one and it was looked up
+	Signature []byte
+	// RepoManifest is the manifest of the repo of a remote source and RepoManifestSignature is its signature, if the
+	// repo has one and it was looked up
+	RepoManifest          []byte
+	RepoManifestSignature []byte
 }
 
 func (s source) WithRemote(remote bool) *source {
@@ -172,7 +178,7 @@ func processMCP(ctx context.Context, tool []types.Tool, mcpLoader MCPLoader) (re
 	return result, nil
 }
 
-func readTool(ctx context.Context, cache *cache.Client, mcp MCPLoader, prg *types.Program, base *source, targetToolName, defaultModel string) ([]types.Tool, error) {
+func readTool(ctx context.Context, state *loadState, prg *types.Program, base *source, targetToolName string) ([]types.Tool, error) {
 	data := base.Content
 
 	var (
@@ -229,7 +235,7 @@ func readTool(ctx context.Context, cache *cache.Client, mcp MCPLoader, prg *type
 		return nil, fmt.Errorf("no tools found in %s", base)
 	}
 
-	tools, err := processMCP(ctx, tools, mcp)
+	tools, err := processMCP(ctx, tools, state.mcp)
 	if err != nil {
 		return nil, err
 	}
@@ -301,17 +307,17 @@ func readTool(ctx context.Context, cache *cache.Client, mcp MCPLoader, prg *type
 		localTools[strings.ToLower(tool.Name)] = tool
 	}
 
-	return linkAll(ctx, cache, mcp, prg, base, targetTools, localTools, defaultModel)
+	return linkAll(ctx, state, prg, base, targetTools, localTools)
 }
 
-func linkAll(ctx context.Context, cache *cache.Client, mcp MCPLoader, prg *types.Program, base *source, tools []types.Tool, localTools types.ToolSet, defaultModel string) (result []types.Tool, _ error) {
+func linkAll(ctx context.Context, state *loadState, prg *types.Program, base *source, tools []types.Tool, localTools types.ToolSet) (result []types.Tool, _ error) {
 	localToolsMapping := make(map[string]string, len(tools))
 	for _, localTool := range localTools {
 		localToolsMapping[strings.ToLower(localTool.Name)] = localTool.ID
 	}
 
 	for _, tool := range tools {
-		tool, err := link(ctx, cache, mcp, prg, base, tool, localTools, localToolsMapping, defaultModel)
+		tool, err := link(ctx, state, prg, base, tool, localTools, localToolsMapping)
 		if err != nil {
 			return nil, err
 		}
@@ -320,7 +326,7 @@ func linkAll(ctx context.Context, cache *cache.Client, mcp MCPLoader, prg *types
 	return
 }
 
-func link(ctx context.Context, cache *cache.Client, mcp MCPLoader, prg *types.Program, base *source, tool types.Tool, localTools types.ToolSet, localToolsMapping map[string]string, defaultModel string) (types.Tool, error) {
+func link(ctx context.Context, state *loadState, prg *types.Program, base *source, tool types.Tool, localTools types.ToolSet, localToolsMapping map[string]string) (types.Tool, error) {
 	if existing, ok := prg.ToolSet[tool.ID]; ok {
 		return existing, nil
 	}
@@ -345,7 +351,7 @@ func link(ctx context.Context, cache *cache.Client, mcp MCPLoader, prg *types.Pr
 				linkedTool = existing
 			} else {
 				var err error
-				linkedTool, err = link(ctx, cache, mcp, prg, base, localTool, localTools, localToolsMapping, defaultModel)
+				linkedTool, err = link(ctx, state, prg, base, localTool, localTools, localToolsMapping)
 				if err != nil {
 					return types.Tool{}, fmt.Errorf("failed linking %s at %s: %w", targetToolName, base, err)
 				}
@@ -355,8 +361,11 @@ func link(ctx context.Context, cache *cache.Client, mcp MCPLoader, prg *types.Pr
 			toolNames[targetToolName] = struct{}{}
 		} else {
 			toolName, subTool := types.SplitToolRef(targetToolName)
-			resolvedTools, err := resolve(ctx, cache, mcp, prg, base, toolName, subTool, defaultModel)
-			if err != nil {
+			resolvedTools, err := resolve(ctx, state, prg, base, toolName, subTool)
+			if err != nil && state.unresolved != nil {
+				state.unresolved(tool, targetToolName, err)
+				continue
+			} else if err != nil {
 				return types.Tool{}, fmt.Errorf("failed resolving %s from %s: %w", targetToolName, base, err)
 			}
 			for _, resolvedTool := range resolvedTools {
@@ -368,7 +377,7 @@ func link(ctx context.Context, cache *cache.Client, mcp MCPLoader, prg *types.Pr
 	tool.LocalTools = localToolsMapping
 
 	if tool.ModelName == "" {
-		tool.ModelName = defaultModel
+		tool.ModelName = state.defaultModel
 	}
 
 	tool = builtin.SetDefaults(tool)
@@ -395,12 +404,12 @@ func ProgramFromSource(ctx context.Context, content, subToolName string, opts ..
 	prg := types.Program{
 		ToolSet: types.ToolSet{},
 	}
-	tools, err := readTool(ctx, opt.Cache, opt.MCPLoader, &prg, &source{
+	tools, err := readTool(ctx, newLoadState(opt), &prg, &source{
 		Content:  []byte(content),
 		Path:     locationPath,
 		Name:     locationName,
 		Location: opt.Location,
-	}, subToolName, opt.DefaultModel)
+	}, subToolName)
 	if err != nil {
 		return types.Program{}, err
 	}
@@ -413,8 +422,39 @@ type Options struct {
 	Location     string
 	DefaultModel string
 	MCPLoader    MCPLoader
+	Lock         *Lock
+	Vendor       *Vendor
+	Trust        *Trust
+	// Unresolved is called with the tool references that can't be loaded, instead of failing to load the program.
+	Unresolved UnresolvedFunc
+}
+
+// loadState is what everything a program loads shares, from its options.
+type loadState struct {
+	cache        *cache.Client
+	mcp          MCPLoader
+	lock         *Lock
+	vendor       *Vendor
+	trust        *Trust
+	unresolved   UnresolvedFunc
+	defaultModel string
+}
+
+func newLoadState(opt Options) *loadState {
+	return &loadState{
+		cache:        opt.Cache,
+		mcp:          opt.MCPLoader,
+		lock:         opt.Lock,
+		vendor:       opt.Vendor,
+		trust:        opt.Trust,
+		unresolved:   opt.Unresolved,
+		defaultModel: opt.DefaultModel,
+	}
 }
 
+// UnresolvedFunc is called with a tool, one of its tool references that can't be loaded and the error loading it.
+type UnresolvedFunc func(tool types.Tool, ref string, err error)
+
 type MCPLoader interface {
 	Load(ctx context.Context, tool types.Tool) ([]types.Tool, error)
 	Close() error
@@ -426,6 +466,12 @@ func complete(opts ...Options) (result Options) {
 		result.Location = types.FirstSet(opt.Location, result.Location)
 		result.DefaultModel = types.FirstSet(opt.DefaultModel, result.DefaultModel)
 		result.MCPLoader = types.FirstSet(opt.MCPLoader, result.MCPLoader)
+		result.Lock = types.FirstSet(opt.Lock, result.Lock)
+		result.Vendor = types.FirstSet(opt.Vendor, result.Vendor)
+		result.Trust = types.FirstSet(opt.Trust, result.Trust)
+		if opt.Unresolved != nil {
+			result.Unresolved = opt.Unresolved
+		}
 	}
 
 	if result.Location == "" {
@@ -463,7 +509,7 @@ func Program(ctx context.Context, name, subToolName string, opts ...Options) (ty
 		Name:    name,
 		ToolSet: types.ToolSet{},
 	}
-	tools, err := resolve(ctx, opt.Cache, opt.MCPLoader, &prg, &source{}, name, subToolName, opt.DefaultModel)
+	tools, err := resolve(ctx, newLoadState(opt), &prg, &source{}, name, subToolName)
 	if err != nil {
 		return types.Program{}, err
 	}
@@ -471,21 +517,21 @@ func Program(ctx context.Context, name, subToolName string, opts ...Options) (ty
 	return prg, nil
 }
 
-func resolve(ctx context.Context, cache *cache.Client, mcp MCPLoader, prg *types.Program, base *source, name, subTool, defaultModel string) ([]types.Tool, error) {
+func resolve(ctx context.Context, state *loadState, prg *types.Program, base *source, name, subTool string) ([]types.Tool, error) {
 	if subTool == "" {
-		t, ok := builtin.DefaultModel(name, defaultModel)
+		t, ok := builtin.DefaultModel(name, state.defaultModel)
 		if ok {
 			prg.ToolSet[t.ID] = t
 			return []types.Tool{t}, nil
 		}
 	}
 
-	s, err := input(ctx, cache, base, name)
+	s, err := input(ctx, state, base, name)
 	if err != nil {
 		return nil, err
 	}
 
-	result, err := readTool(ctx, cache, mcp, prg, s, subTool, defaultModel)
+	result, err := readTool(ctx, state, prg, s, subTool)
 	if err != nil {
 		return nil, err
 	}
@@ -497,7 +543,7 @@ func resolve(ctx context.Context, cache *cache.Client, mcp MCPLoader, prg *types
 	return result, nil
 }
 
-func input(ctx context.Context, cache *cache.Client, base *source, name string) (*source, error) {
+func input(ctx context.Context, state *loadState, base *source, name string) (*source, error) {
 	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
 		// copy and modify
 		base = base.WithRemote(true)
@@ -510,7 +556,7 @@ func input(ctx context.Context, cache *cache.Client, base *source, name string)
 		}
 	}
 
-	s, ok, err := loadURL(ctx, cache, base, name)
+	s, ok, err := loadURL(ctx, state, base, name)
 	if err != nil || ok {
 		return s, err
 	}
@@ -227,3 +227,16 @@ func TestDefault(t *testing.T) {
   }
 }`).Equal(t, toString(prg))
 }
+
+func TestSplitRevision(t *testing.T) {
+	for _, tt := range []struct{ name, url, rev string }{
+		{name: "github.com/org/repo/tool.gpt@main", url: "github.com/org/repo/tool.gpt", rev: "main"},
+		{name: "github.com/org/repo", url: "github.com/org/repo"},
+		{name: "git+ssh://git@example.com/org/repo.git@v1", url: "git+ssh://git@example.com/org/repo.git", rev: "v1"},
+		{name: "git+ssh://git@example.com/org/repo.git/tool", url: "git+ssh://git@example.com/org/repo.git/tool"},
+	} {
+		url, rev := SplitRevision(tt.name)
+		require.Equal(t, tt.url, url)
+		require.Equal(t, tt.rev, rev)
+	}
+}
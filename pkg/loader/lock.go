@@ -0,0 +1,180 @@
+package loader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	url2 "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+)
+
+// DefaultLockFile is the lock file that is used if none is set.
+const DefaultLockFile = "gptscript.lock"
+
+// DefaultLockPath returns where the default lock file of a program is, which is next to the script, or in the script
+// directory if the program is a directory. Programs that aren't local files, like URLs and stdin, use the current
+// directory.
+func DefaultLockPath(program string) string {
+	s, err := os.Stat(program)
+	switch {
+	case err != nil:
+		return DefaultLockFile
+	case s.IsDir():
+		return filepath.Join(program, DefaultLockFile)
+	default:
+		return filepath.Join(filepath.Dir(program), DefaultLockFile)
+	}
+}
+
+// Lock pins the remote tools that scripts reference to the revision and content they had when they were locked, so
+// that a script doesn't pick up new tool code between runs.
+type Lock struct {
+	// Tools are the locked tools by the reference they are loaded with, which is the reference as written in the script,
+	// or the URL of references that are relative to a remote tool.
+	Tools map[string]LockedTool `json:"tools"`
+
+	frozen bool
+	update bool
+	lock   sync.Mutex
+}
+
+type LockedTool struct {
+	// Revision is the commit the tool is pinned to, empty for tools that are not in a VCS repo.
+	Revision string `json:"revision,omitempty"`
+	// Digest is the sha256 digest of the content of the tool.
+	Digest string `json:"digest"`
+}
+
+// NewLock returns an empty lock that records every remote tool that is loaded with it, at its latest revision, to be
+// saved with Save.
+func NewLock() *Lock {
+	return &Lock{
+		Tools:  map[string]LockedTool{},
+		update: true,
+	}
+}
+
+// LoadLock reads a lock file. The loader then loads the locked tools at their revision and fails if their content
+// differs from the lock. If frozen is set, it also fails to load remote tools that are not in the lock.
+func LoadLock(file string, frozen bool) (*Lock, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("lock file %s does not exist, run gptscript lock to create it", file)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read lock file %s: %w", file, err)
+	}
+
+	var lock Lock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("invalid lock file %s: %w", file, err)
+	}
+	if lock.Tools == nil {
+		lock.Tools = map[string]LockedTool{}
+	}
+	lock.frozen = frozen
+	return &lock, nil
+}
+
+// Save writes the lock to a file.
+func (l *Lock) Save(file string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// References returns the references of the locked tools in order.
+func (l *Lock) References() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	refs := make([]string, 0, len(l.Tools))
+	for ref := range l.Tools {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// lockReference returns the reference a tool is locked by, which is the URL of references that are relative to a remote
+// tool.
+func lockReference(base *source, name string, relative bool) string {
+	if base.Path == "" || !relative {
+		return name
+	}
+	ref := base.Path + "/" + name
+	if parsed, err := url2.Parse(ref); err == nil && parsed.Scheme != "" {
+		parsed.Path = path.Clean(parsed.Path)
+		return parsed.String()
+	}
+	return ref
+}
+
+// updating returns whether the lock records the tools instead of pinning them, which is false without a lock.
+func (l *Lock) updating() bool {
+	return l != nil && l.update
+}
+
+// pin returns the name to load a reference with, which has the locked revision of the reference if it has one.
+// References that are relative to a remote tool are pinned by the revision of that tool.
+func (l *Lock) pin(ref, name string, relative bool) string {
+	if l == nil || l.update || relative {
+		return name
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	locked, ok := l.Tools[ref]
+	if !ok || locked.Revision == "" {
+		return name
+	}
+	name, _ = SplitRevision(name)
+	return name + "@" + locked.Revision
+}
+
+// check records the loaded tool if the lock is being updated, and otherwise fails if the tool differs from the lock.
+func (l *Lock) check(ref string, s *source) error {
+	if l == nil {
+		return nil
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	digest := hash.Digest(s.Content)
+	if l.update {
+		var revision string
+		if s.Repo != nil {
+			revision = s.Repo.Revision
+		}
+		l.Tools[ref] = LockedTool{
+			Revision: revision,
+			Digest:   digest,
+		}
+		return nil
+	}
+
+	locked, ok := l.Tools[ref]
+	if !ok {
+		if l.frozen {
+			return fmt.Errorf("%s is not in the lock file, run gptscript lock to add it", ref)
+		}
+		log.Debugf("%s is not in the lock file, loading its latest revision", ref)
+		return nil
+	}
+	if locked.Digest != digest {
+		return fmt.Errorf("the content of %s does not match the lock file, run gptscript lock to update it", ref)
+	}
+	return nil
+}
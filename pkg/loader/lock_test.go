@@ -0,0 +1,122 @@
+package loader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	lockTestRevision1 = "1111111111111111111111111111111111111111"
+	lockTestRevision2 = "2222222222222222222222222222222222222222"
+)
+
+func TestLock(t *testing.T) {
+	var (
+		head  = lockTestRevision1
+		files = map[string]string{
+			"/main.gpt":                           "Tools: lock.test/tool@main\n\n#!sys.echo main\n",
+			"/" + lockTestRevision1 + "/tool.gpt": "Tools: ./sub.gpt\n\n#!sys.echo one\n",
+			"/" + lockTestRevision1 + "/sub.gpt":  "#!sys.echo sub\n",
+			"/" + lockTestRevision2 + "/tool.gpt": "#!sys.echo two\n",
+		}
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer s.Close()
+
+	AddVSC(func(_ context.Context, _ *cache.Client, name string) (string, string, *types.Repo, bool, error) {
+		url, ref, _ := strings.Cut(name, "@")
+		if !strings.HasPrefix(url, "lock.test/") {
+			return "", "", nil, false, nil
+		}
+		if ref == "main" {
+			ref = head
+		}
+		return s.URL + "/" + ref + "/tool.gpt", "", &types.Repo{
+			VCS:      "git",
+			Root:     s.URL,
+			Path:     ".",
+			Name:     "tool.gpt",
+			Revision: ref,
+		}, true, nil
+	})
+
+	instructions := func(prg types.Program, location string) string {
+		for _, tool := range prg.ToolSet {
+			if tool.Source.Location == location {
+				return tool.Instructions
+			}
+		}
+		return ""
+	}
+
+	lock := NewLock()
+	_, err := Program(context.Background(), s.URL+"/main.gpt", "", Options{Lock: lock})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		s.URL + "/" + lockTestRevision1 + "/sub.gpt",
+		s.URL + "/main.gpt",
+		"lock.test/tool@main",
+	}, lock.References())
+	assert.Equal(t, lockTestRevision1, lock.Tools["lock.test/tool@main"].Revision)
+	assert.Empty(t, lock.Tools[s.URL+"/main.gpt"].Revision)
+
+	file := filepath.Join(t.TempDir(), DefaultLockFile)
+	require.NoError(t, lock.Save(file))
+	lock, err = LoadLock(file, false)
+	require.NoError(t, err)
+
+	// The locked revision is loaded after the branch moves.
+	head = lockTestRevision2
+	prg, err := Program(context.Background(), s.URL+"/main.gpt", "", Options{Lock: lock})
+	require.NoError(t, err)
+	assert.Equal(t, "#!sys.echo one", instructions(prg, s.URL+"/"+lockTestRevision1+"/tool.gpt"))
+
+	prg, err = Program(context.Background(), s.URL+"/main.gpt", "")
+	require.NoError(t, err)
+	assert.Equal(t, "#!sys.echo two", instructions(prg, s.URL+"/"+lockTestRevision2+"/tool.gpt"))
+
+	// Tools that are not locked are only loaded if the lock is not frozen.
+	files["/other.gpt"] = "#!sys.echo other\n"
+	_, err = Program(context.Background(), s.URL+"/other.gpt", "", Options{Lock: lock})
+	require.NoError(t, err)
+
+	frozen, err := LoadLock(file, true)
+	require.NoError(t, err)
+	_, err = Program(context.Background(), s.URL+"/other.gpt", "", Options{Lock: frozen})
+	assert.ErrorContains(t, err, s.URL+"/other.gpt is not in the lock file")
+
+	files["/main.gpt"] = "#!sys.echo changed\n"
+	_, err = Program(context.Background(), s.URL+"/main.gpt", "", Options{Lock: lock})
+	assert.ErrorContains(t, err, "the content of "+s.URL+"/main.gpt does not match the lock file")
+
+	_, err = LoadLock(filepath.Join(t.TempDir(), DefaultLockFile), false)
+	assert.ErrorContains(t, err, "does not exist, run gptscript lock to create it")
+}
+
+func TestDefaultLockPath(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.gpt")
+	require.NoError(t, os.WriteFile(script, []byte("echo hi"), 0644))
+
+	assert.Equal(t, filepath.Join(dir, DefaultLockFile), DefaultLockPath(script))
+	assert.Equal(t, filepath.Join(dir, DefaultLockFile), DefaultLockPath(dir))
+	assert.Equal(t, DefaultLockFile, DefaultLockPath("-"))
+	assert.Equal(t, DefaultLockFile, DefaultLockPath("github.com/gptscript-ai/dalle-image-generation"))
+}
@@ -0,0 +1,365 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	url2 "net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/repos"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// SignatureSuffix is appended to the URL of a remote tool to find its detached signature.
+	SignatureSuffix = ".sig"
+	// SignatureNamespace is the namespace of SSH signatures of tools, as in ssh-keygen -Y sign -n gptscript.
+	SignatureNamespace = "gptscript"
+)
+
+// Trust verifies the detached signatures of remote tools and OpenAPI documents with a set of trusted keys. A signature
+// is a file next to the tool with .sig appended to its name, written by ssh-keygen -Y sign or by minisign.
+type Trust struct {
+	sshKeys      []ssh.PublicKey
+	minisignKeys map[string]ed25519.PublicKey
+	require      bool
+}
+
+// LoadTrust reads a file of trusted public keys, with a key per line in the authorized_keys format of OpenSSH or in the
+// format of minisign public keys. If require is set, remote sources that are not signed by one of the keys fail to load.
+// Otherwise only the signatures that are there are verified.
+func LoadTrust(file string, require bool) (*Trust, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("trusted keys file %s does not exist", file)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read trusted keys file %s: %w", file, err)
+	}
+
+	t, err := parseTrust(data, require)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted keys file %s: %w", file, err)
+	}
+	return t, nil
+}
+
+func parseTrust(data []byte, require bool) (*Trust, error) {
+	t := &Trust{
+		minisignKeys: map[string]ed25519.PublicKey{},
+		require:      require,
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+
+		if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err == nil {
+			t.sshKeys = append(t.sshKeys, key)
+			continue
+		}
+
+		// A minisign public key is the algorithm, the key ID and the ed25519 key.
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(key) != 2+8+ed25519.PublicKeySize || string(key[:2]) != "Ed" {
+			return nil, fmt.Errorf("line %d is not an SSH or minisign public key", i)
+		}
+		t.minisignKeys[string(key[2:10])] = key[10:]
+	}
+
+	if len(t.sshKeys) == 0 && len(t.minisignKeys) == 0 {
+		return nil, fmt.Errorf("there are no keys")
+	}
+	return t, scanner.Err()
+}
+
+// verify fails if the signature of a remote source is invalid, or if the source is not signed by a trusted key and
+// signatures are required. A source in a repo with a signed manifest is verified with the manifest instead, which
+// must list the source, and the digest of the manifest is set on the repo so that the checkout is verified with it too.
+// With signatures required, sources in repos must have a signed manifest, since their checkout is what commands run.
+func (t *Trust) verify(ref string, s *source) error {
+	if t == nil {
+		return nil
+	}
+
+	if s.Repo != nil && s.RepoManifest != nil {
+		return t.verifyManifest(ref, s)
+	} else if s.Repo != nil && t.require {
+		return fmt.Errorf("the repo of %s has no %s, remote tools in repos must be signed with a manifest of the repo",
+			ref, repos.ManifestFile)
+	}
+
+	_, err := t.verifySignature(ref, s.Content, s.Signature)
+	return err
+}
+
+// verifyManifest verifies the manifest of the repo of a source and checks that the manifest lists the source.
+func (t *Trust) verifyManifest(ref string, s *source) error {
+	manifestRef := fmt.Sprintf("the %s of %s", repos.ManifestFile, ref)
+	trusted, err := t.verifySignature(manifestRef, s.RepoManifest, s.RepoManifestSignature)
+	if err != nil {
+		return err
+	} else if !trusted {
+		// The manifest is not signed by a trusted key, which is only allowed without required signatures, so the source
+		// is verified on its own.
+		_, err := t.verifySignature(ref, s.Content, s.Signature)
+		return err
+	}
+
+	manifest, err := repos.ParseManifest(s.RepoManifest)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", manifestRef, err)
+	}
+	if digest, ok := manifest.Digest(path.Join(s.Repo.Path, s.Repo.Name)); !ok {
+		return fmt.Errorf("%s is not in %s", ref, manifestRef)
+	} else if digest != hash.Digest(s.Content) {
+		return fmt.Errorf("%s does not match its digest in %s", ref, manifestRef)
+	}
+
+	repo := *s.Repo
+	repo.Manifest = hash.Digest(s.RepoManifest)
+	s.Repo = &repo
+	return nil
+}
+
+// verifySignature verifies the signature of content and returns whether it is signed by a trusted key. It fails if the
+// signature is invalid, or if the content is not signed by a trusted key and signatures are required.
+func (t *Trust) verifySignature(ref string, content, signature []byte) (bool, error) {
+	if len(signature) == 0 {
+		if t.require {
+			return false, fmt.Errorf("%s is not signed, remote tools must be signed by a trusted key", ref)
+		}
+		return false, nil
+	}
+
+	var (
+		trusted bool
+		err     error
+	)
+	if bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN SSH SIGNATURE-----")) {
+		trusted, err = t.verifySSH(content, signature)
+	} else {
+		trusted, err = t.verifyMinisign(content, signature)
+	}
+	if err != nil {
+		return false, fmt.Errorf("invalid signature of %s: %w", ref, err)
+	} else if !trusted && t.require {
+		return false, fmt.Errorf("%s is signed by a key that is not trusted", ref)
+	} else if !trusted {
+		log.Debugf("%s is signed by a key that is not trusted, loading it anyway", ref)
+	}
+	return trusted, nil
+}
+
+// sshSignature is an SSH signature, as defined in PROTOCOL.sshsig of OpenSSH, without its magic preamble.
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// verifySSH verifies an SSH signature and returns whether its key is trusted. The signatures of keys that are not
+// trusted are not verified.
+func (t *Trust) verifySSH(content, signature []byte) (bool, error) {
+	block, _ := pem.Decode(signature)
+	if block == nil || block.Type != "SSH SIGNATURE" || !bytes.HasPrefix(block.Bytes, []byte("SSHSIG")) {
+		return false, fmt.Errorf("not an SSH signature")
+	}
+
+	var sig sshSignature
+	if err := ssh.Unmarshal(block.Bytes[len("SSHSIG"):], &sig); err != nil {
+		return false, err
+	}
+	if sig.Version != 1 {
+		return false, fmt.Errorf("unsupported SSH signature version %d", sig.Version)
+	}
+	if sig.Namespace != SignatureNamespace {
+		return false, fmt.Errorf("the signature is for namespace %q instead of %q", sig.Namespace, SignatureNamespace)
+	}
+
+	key, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return false, err
+	}
+	trusted := false
+	for _, trustedKey := range t.sshKeys {
+		if bytes.Equal(trustedKey.Marshal(), key.Marshal()) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return false, nil
+	}
+
+	var digest []byte
+	switch sig.HashAlgorithm {
+	case "sha256":
+		sum := sha256.Sum256(content)
+		digest = sum[:]
+	case "sha512":
+		sum := sha512.Sum512(content)
+		digest = sum[:]
+	default:
+		return false, fmt.Errorf("unsupported hash algorithm %q", sig.HashAlgorithm)
+	}
+
+	var keySig ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &keySig); err != nil {
+		return false, err
+	}
+
+	signed := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{sig.Namespace, sig.Reserved, sig.HashAlgorithm, digest})...)
+	if err := key.Verify(signed, &keySig); err != nil {
+		return false, fmt.Errorf("the signature does not match the content: %w", err)
+	}
+	return true, nil
+}
+
+// verifyMinisign verifies a minisign signature and returns whether its key is trusted. The signatures of keys that are
+// not trusted are not verified.
+func (t *Trust) verifyMinisign(content, signature []byte) (bool, error) {
+	lines := strings.Split(strings.TrimSpace(string(signature)), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return false, fmt.Errorf("not an SSH or minisign signature")
+	}
+
+	// The signature is the algorithm, the key ID and the ed25519 signature. The global signature signs the signature
+	// and the trusted comment.
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return false, fmt.Errorf("invalid minisign signature")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return false, fmt.Errorf("invalid minisign global signature")
+	}
+
+	key, ok := t.minisignKeys[string(sig[2:10])]
+	if !ok {
+		return false, nil
+	}
+
+	message := content
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		prehashed := blake2b.Sum512(content)
+		message = prehashed[:]
+	default:
+		return false, fmt.Errorf("unsupported minisign signature algorithm %q", sig[:2])
+	}
+
+	if !ed25519.Verify(key, message, sig[10:]) {
+		return false, fmt.Errorf("the signature does not match the content")
+	}
+	trustedComment := strings.TrimPrefix(strings.TrimRight(lines[2], "\r"), "trusted comment: ")
+	if !ed25519.Verify(key, append(sig[10:], trustedComment...), globalSig) {
+		return false, fmt.Errorf("the trusted comment does not match the signature")
+	}
+	return true, nil
+}
+
+// getSignature downloads the signature of a remote file, and returns nil if it has none.
+func getSignature(ctx context.Context, url, bearerToken string) ([]byte, error) {
+	return getOptional(ctx, url+SignatureSuffix, bearerToken)
+}
+
+// getOptional downloads a remote file, and returns nil if there is none.
+func getOptional(ctx context.Context, url, bearerToken string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
+
+	resp, err := doDownload(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error loading %s: %s", req.URL.String(), resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// readSignature reads the signature of a file of a checkout, and returns nil if it has none.
+func readSignature(filePath string) ([]byte, error) {
+	return readOptional(filePath + SignatureSuffix)
+}
+
+// readOptional reads a file of a checkout, and returns nil if there is none.
+func readOptional(filePath string) ([]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// getManifest returns the manifest of the repo of a source that was loaded from url, and its signature. It returns nil
+// if the repo has no manifest.
+func getManifest(ctx context.Context, url, bearerToken string, repo *types.Repo) ([]byte, []byte, error) {
+	// The URL of a file of a repo ends with its path in the repo, after which the root of the repo is left.
+	root, ok := strings.CutSuffix(url, "/"+strings.TrimPrefix(path.Join(repo.Path, repo.Name), "/"))
+	if !ok {
+		return nil, nil, nil
+	}
+	manifestURL := root + "/" + repos.ManifestFile
+
+	var (
+		manifest, signature []byte
+		err                 error
+	)
+	if strings.HasPrefix(manifestURL, "file://") {
+		parsed, err := url2.Parse(manifestURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		filePath := localPath(parsed.Path)
+		if manifest, err = readOptional(filePath); err == nil && manifest != nil {
+			signature, err = readSignature(filePath)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return manifest, signature, nil
+	}
+
+	if manifest, err = getOptional(ctx, manifestURL, bearerToken); err == nil && manifest != nil {
+		signature, err = getSignature(ctx, manifestURL, bearerToken)
+	}
+	return manifest, signature, err
+}
@@ -0,0 +1,244 @@
+package loader
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/repos"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshSign signs content like ssh-keygen -Y sign -n gptscript does.
+func sshSign(t *testing.T, key ed25519.PrivateKey, content []byte) []byte {
+	t.Helper()
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	digest := sha512.Sum512(content)
+	sig, err := signer.Sign(rand.Reader, append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{SignatureNamespace, "", "sha512", digest[:]})...))
+	require.NoError(t, err)
+
+	blob := append([]byte("SSHSIG"), ssh.Marshal(sshSignature{
+		Version:       1,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     SignatureNamespace,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(sig),
+	})...)
+	return pem.EncodeToMemory(&pem.Block{Type: "SSH SIGNATURE", Bytes: blob})
+}
+
+// minisignKey returns a minisign public key and a function that signs content with it like minisign -S does, which
+// signs the BLAKE2b hash of the content.
+func minisignKey(t *testing.T) (string, func([]byte) []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyID := []byte("12345678")
+
+	publicKey := "untrusted comment: minisign public key\n" +
+		base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...)) + "\n"
+	return publicKey, func(content []byte) []byte {
+		digest := blake2b.Sum512(content)
+		sig := ed25519.Sign(priv, digest[:])
+		trustedComment := "timestamp:1700000000"
+		globalSig := ed25519.Sign(priv, append(append([]byte{}, sig...), trustedComment...))
+		return []byte("untrusted comment: signature from minisign secret key\n" +
+			base64.StdEncoding.EncodeToString(append(append([]byte("ED"), keyID...), sig...)) + "\n" +
+			"trusted comment: " + trustedComment + "\n" +
+			base64.StdEncoding.EncodeToString(globalSig) + "\n")
+	}
+}
+
+func TestTrust(t *testing.T) {
+	_, sshKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPublicKey, err := ssh.NewPublicKey(sshKey.Public())
+	require.NoError(t, err)
+	minisignPublicKey, minisign := minisignKey(t)
+
+	files := map[string][]byte{
+		"/main.gpt":     []byte("Tools: ./ssh.gpt, ./minisign.gpt\n\n#!sys.echo main\n"),
+		"/ssh.gpt":      []byte("#!sys.echo ssh\n"),
+		"/minisign.gpt": []byte("#!sys.echo minisign\n"),
+		"/other.gpt":    []byte("#!sys.echo other\n"),
+	}
+	files["/main.gpt.sig"] = sshSign(t, sshKey, files["/main.gpt"])
+	files["/ssh.gpt.sig"] = sshSign(t, sshKey, files["/ssh.gpt"])
+	files["/minisign.gpt.sig"] = minisign(files["/minisign.gpt"])
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer s.Close()
+
+	keys := []byte("# release keys\n" + string(ssh.MarshalAuthorizedKey(sshPublicKey)) + minisignPublicKey)
+	required, err := parseTrust(keys, true)
+	require.NoError(t, err)
+	optional, err := parseTrust(keys, false)
+	require.NoError(t, err)
+
+	prg, err := Program(context.Background(), s.URL+"/main.gpt", "", Options{Trust: required})
+	require.NoError(t, err)
+	assert.Len(t, prg.ToolSet, 3)
+
+	_, err = Program(context.Background(), s.URL+"/other.gpt", "", Options{Trust: required})
+	assert.ErrorContains(t, err, s.URL+"/other.gpt is not signed")
+	_, err = Program(context.Background(), s.URL+"/other.gpt", "", Options{Trust: optional})
+	assert.NoError(t, err)
+
+	// A signature by a key that is not trusted is the same as no signature.
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	files["/other.gpt.sig"] = sshSign(t, otherKey, files["/other.gpt"])
+	_, err = Program(context.Background(), s.URL+"/other.gpt", "", Options{Trust: required})
+	assert.ErrorContains(t, err, s.URL+"/other.gpt is signed by a key that is not trusted")
+	_, err = Program(context.Background(), s.URL+"/other.gpt", "", Options{Trust: optional})
+	assert.NoError(t, err)
+
+	// Signatures that don't match are rejected even if signatures are optional.
+	files["/ssh.gpt"] = []byte("#!sys.echo changed\n")
+	files["/minisign.gpt"] = []byte("#!sys.echo changed\n")
+	for _, name := range []string{"/ssh.gpt", "/minisign.gpt"} {
+		_, err = Program(context.Background(), s.URL+name, "", Options{Trust: optional})
+		assert.ErrorContains(t, err, "invalid signature of "+s.URL+name+": the signature does not match the content")
+	}
+
+	_, err = parseTrust([]byte("not a key\n"), false)
+	assert.ErrorContains(t, err, "line 1 is not an SSH or minisign public key")
+}
+
+func TestTrustSSHKeygen(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+
+	dir := t.TempDir()
+	key := filepath.Join(dir, "key")
+	file := filepath.Join(dir, "tool.gpt")
+	require.NoError(t, os.WriteFile(file, []byte("#!sys.echo tool\n"), 0644))
+	for _, args := range [][]string{
+		{"-q", "-t", "ed25519", "-N", "", "-f", key},
+		{"-q", "-Y", "sign", "-n", SignatureNamespace, "-f", key, file},
+	} {
+		out, err := exec.Command("ssh-keygen", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	trust, err := LoadTrust(key+".pub", true)
+	require.NoError(t, err)
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	signature, err := os.ReadFile(file + SignatureSuffix)
+	require.NoError(t, err)
+	assert.NoError(t, trust.verify(file, &source{Content: content, Signature: signature}))
+	assert.ErrorContains(t, trust.verify(file, &source{Content: []byte("#!sys.echo changed\n"), Signature: signature}),
+		"the signature does not match the content")
+}
+
+func TestTrustManifest(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	publicKey, err := ssh.NewPublicKey(key.Public())
+	require.NoError(t, err)
+
+	const commit = "172dfb00b48c6adbbaa7e99270933f95887d1b91"
+	files := map[string][]byte{
+		"/" + commit + "/tool.gpt":       []byte("Tools: ./sub/helper.gpt\n\n#!/bin/sh ${GPTSCRIPT_TOOL_DIR}/run.sh\n"),
+		"/" + commit + "/sub/helper.gpt": []byte("#!sys.echo helper\n"),
+		"/" + commit + "/run.sh":         []byte("echo hi\n"),
+	}
+	writeManifest := func() {
+		var manifest []byte
+		for _, name := range []string{"tool.gpt", "sub/helper.gpt", "run.sh"} {
+			manifest = append(manifest, hash.Digest(files["/"+commit+"/"+name])+"  "+name+"\n"...)
+		}
+		files["/"+commit+"/"+repos.ManifestFile] = manifest
+		files["/"+commit+"/"+repos.ManifestFile+SignatureSuffix] = sshSign(t, key, manifest)
+	}
+	writeManifest()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer s.Close()
+
+	AddVSC(func(_ context.Context, _ *cache.Client, name string) (string, string, *types.Repo, bool, error) {
+		if !strings.HasPrefix(name, "manifest.test/") {
+			return "", "", nil, false, nil
+		}
+		return s.URL + "/" + commit + "/tool.gpt", "", &types.Repo{
+			VCS:      "git",
+			Root:     "https://manifest.test/tools.git",
+			Path:     ".",
+			Name:     "tool.gpt",
+			Revision: commit,
+		}, true, nil
+	})
+
+	required, err := parseTrust(ssh.MarshalAuthorizedKey(publicKey), true)
+	require.NoError(t, err)
+	optional, err := parseTrust(ssh.MarshalAuthorizedKey(publicKey), false)
+	require.NoError(t, err)
+
+	// The tools of the repo are not signed themselves, the manifest of the repo covers them.
+	prg, err := Program(context.Background(), "manifest.test/tools", "", Options{Trust: required})
+	require.NoError(t, err)
+	require.Len(t, prg.ToolSet, 2)
+	for _, tool := range prg.ToolSet {
+		assert.Equal(t, hash.Digest(files["/"+commit+"/"+repos.ManifestFile]), tool.Source.Repo.Manifest, tool.Name)
+	}
+
+	files["/"+commit+"/sub/helper.gpt"] = []byte("#!sys.echo changed\n")
+	_, err = Program(context.Background(), "manifest.test/tools", "", Options{Trust: optional})
+	assert.ErrorContains(t, err, "sub/helper.gpt does not match its digest in the "+repos.ManifestFile+" of")
+
+	// Without a manifest, the tools of repos can only be loaded if signatures are not required, and their checkout is
+	// not verified.
+	delete(files, "/"+commit+"/"+repos.ManifestFile)
+	_, err = Program(context.Background(), "manifest.test/tools", "", Options{Trust: required})
+	assert.ErrorContains(t, err, "has no "+repos.ManifestFile)
+	prg, err = Program(context.Background(), "manifest.test/tools", "", Options{Trust: optional})
+	require.NoError(t, err)
+	assert.Empty(t, prg.ToolSet[prg.EntryToolID].Source.Repo.Manifest)
+
+	// A manifest that is signed by a key that is not trusted doesn't cover the tools.
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writeManifest()
+	files["/"+commit+"/"+repos.ManifestFile+SignatureSuffix] = sshSign(t, otherKey, files["/"+commit+"/"+repos.ManifestFile])
+	_, err = Program(context.Background(), "manifest.test/tools", "", Options{Trust: required})
+	assert.ErrorContains(t, err, "the "+repos.ManifestFile+" of manifest.test/tools is signed by a key that is not trusted")
+}
@@ -2,16 +2,23 @@ package loader
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	url2 "net/url"
+	"os"
 	"path"
+	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
 	"time"
 
 	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/openapi"
+	"github.com/gptscript-ai/gptscript/pkg/repos"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 )
 
@@ -23,6 +30,41 @@ func AddVSC(lookup VCSLookup) {
 	vcsLookups = append(vcsLookups, lookup)
 }
 
+// DownloadURL returns the URL that a remote file is downloaded from and the bearer token to download it with, for the
+// URL of the file that a VCS lookup returned. It returns false for the URLs of other hosts.
+type DownloadURL func(string) (string, string, bool)
+
+var downloadURLs []DownloadURL
+
+// AddDownloadURL adds the download URLs of a host whose files are downloaded from an API that does not take the path of
+// the file as the path of the URL. The sources keep the URLs of the VCS lookup, so that relative tools, default tool
+// files and signatures are found next to them as for other hosts, and are downloaded with the token of the host too.
+func AddDownloadURL(downloadURL DownloadURL) {
+	downloadURLs = append(downloadURLs, downloadURL)
+}
+
+// doDownload sends a request for a remote file to the URL that the file is downloaded from.
+func doDownload(req *http.Request) (*http.Response, error) {
+	for _, downloadURL := range downloadURLs {
+		target, bearerToken, ok := downloadURL(req.URL.String())
+		if !ok {
+			continue
+		}
+		parsed, err := url2.Parse(target)
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.URL = parsed
+		req.Host = parsed.Host
+		if bearerToken != "" {
+			req.Header.Set("Authorization", "Bearer "+bearerToken)
+		}
+		break
+	}
+	return http.DefaultClient.Do(req)
+}
+
 type cacheKey struct {
 	Name string
 	Path string
@@ -32,6 +74,8 @@ type cacheKey struct {
 type cacheValue struct {
 	Source *source
 	Time   time.Time
+	// SignatureChecked is set if the signature of the source was looked up, which is only done with trusted keys or when vendoring.
+	SignatureChecked bool
 }
 
 func (c *cacheKey) isStatic() bool {
@@ -42,13 +86,52 @@ func (c *cacheKey) isStatic() bool {
 
 var stableRef = regexp.MustCompile("^([a-f0-9]{7,40}$|v[0-9]|[0-9])")
 
-func loadURL(ctx context.Context, cache *cache.Client, base *source, name string) (*source, bool, error) {
+// SplitRevision splits the revision off a remote tool reference, like main in github.com/org/repo/tool@main. The user
+// of a URL, like git in git+ssh://git@example.com/repo.git, is not a revision.
+func SplitRevision(name string) (string, string) {
+	start := 0
+	if i := strings.Index(name, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	if i := strings.Index(name[start:], "/"); i >= 0 {
+		start += i
+	}
+	if i := strings.Index(name[start:], "@"); i >= 0 {
+		return name[:start+i], name[start+i+1:]
+	}
+	return name, ""
+}
+
+func loadURL(ctx context.Context, state *loadState, base *source, name string) (*source, bool, error) {
 	var (
 		repo        *types.Repo
-		url         = name
-		bearerToken = ""
 		relative    = strings.HasPrefix(name, ".") || !strings.Contains(name, "/")
-		cachedKey   = cacheKey{
+		lockRef     = lockReference(base, name, relative)
+		bearerToken = ""
+		// Signatures are looked up to verify them, and to vendor them along with the sources.
+		signatures = state.trust != nil || state.vendor.recording()
+	)
+
+	if state.vendor.offline() {
+		s, ok, err := state.vendor.source(lockRef)
+		if err != nil {
+			return nil, false, err
+		} else if !ok && (base.Remote || !relative) {
+			return nil, false, fmt.Errorf("%s is not vendored, run gptscript vendor to add it", lockRef)
+		} else if !ok {
+			return nil, false, nil
+		}
+		if err := state.lock.check(lockRef, s); err != nil {
+			return nil, false, err
+		}
+		return s, true, state.trust.verify(lockRef, s)
+	}
+
+	name = state.lock.pin(lockRef, name, relative)
+
+	var (
+		url       = name
+		cachedKey = cacheKey{
 			Name: name,
 			Path: base.Path,
 			Repo: base.Repo,
@@ -57,7 +140,7 @@ func loadURL(ctx context.Context, cache *cache.Client, base *source, name string
 	)
 
 	if cachedKey.Repo == nil {
-		if _, rev, ok := strings.Cut(name, "@"); ok && stableRef.MatchString(rev) {
+		if _, rev := SplitRevision(name); rev != "" && stableRef.MatchString(rev) {
 			cachedKey.Repo = &types.Repo{
 				Revision: rev,
 			}
@@ -67,9 +150,17 @@ func loadURL(ctx context.Context, cache *cache.Client, base *source, name string
 		cachedKey.Path = "."
 	}
 
-	if ok, err := cache.Get(ctx, cachedKey, &cachedValue); err != nil {
+	if ok, err := state.cache.Get(ctx, cachedKey, &cachedValue); err != nil {
 		return nil, false, err
-	} else if ok && (cachedKey.isStatic() || time.Since(cachedValue.Time) < CacheTimeout) {
+	} else if ok && (!signatures || cachedValue.SignatureChecked) &&
+		(cachedKey.isStatic() || (time.Since(cachedValue.Time) < CacheTimeout && !state.lock.updating())) {
+		if err := state.lock.check(lockRef, cachedValue.Source); err != nil {
+			return nil, false, err
+		}
+		if err := state.trust.verify(lockRef, cachedValue.Source); err != nil {
+			return nil, false, err
+		}
+		state.vendor.record(lockRef, cachedValue.Source)
 		return cachedValue.Source, true, nil
 	}
 
@@ -86,21 +177,29 @@ func loadURL(ctx context.Context, cache *cache.Client, base *source, name string
 		repo = &newRepo
 	}
 
+	// Files of checkouts are only read if a VCS lookup returned them, or if they are relative to a file of a checkout
+	// and don't leave its repo.
+	checkout := relative && repo != nil && strings.HasPrefix(base.Path, "file://") &&
+		repo.Path != ".." && !strings.HasPrefix(repo.Path, "../")
+
 	if repo == nil || !relative {
 		for _, vcs := range vcsLookups {
-			newURL, newBearer, newRepo, ok, err := vcs(ctx, cache, name)
+			newURL, newBearer, newRepo, ok, err := vcs(ctx, state.cache, name)
 			if err != nil {
 				return nil, false, err
 			} else if ok {
 				repo = newRepo
 				url = newURL
 				bearerToken = newBearer
+				checkout = repo != nil
 				break
 			}
 		}
 	}
 
-	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+	checkout = checkout && strings.HasPrefix(url, "file://")
+
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") && !checkout {
 		return nil, false, nil
 	}
 
@@ -122,16 +221,36 @@ func loadURL(ctx context.Context, cache *cache.Client, base *source, name string
 		url = pathString + "/" + name
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, false, err
-	}
+	var (
+		data      []byte
+		defaulted string
+		signature []byte
+	)
+	if checkout {
+		filePath := localPath(path.Join(path.Dir(parsed.Path), name))
+		data, defaulted, err = readWithDefaults(filePath)
+		if err == nil && signatures {
+			if defaulted != "" {
+				filePath = filepath.Join(filePath, defaulted)
+			}
+			signature, err = readSignature(filePath)
+		}
+	} else {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, false, err
+		}
 
-	if bearerToken != "" {
-		req.Header.Set("Authorization", "Bearer "+bearerToken)
-	}
+		if bearerToken != "" {
+			req.Header.Set("Authorization", "Bearer "+bearerToken)
+		}
 
-	data, defaulted, err := getWithDefaults(req)
+		data, defaulted, err = getWithDefaults(req)
+		if err == nil && signatures {
+			signature, err = getSignature(ctx, req.URL.String(), bearerToken)
+		}
+	}
 	if err != nil {
 		return nil, false, fmt.Errorf("error loading %s: %v", url, err)
 	}
@@ -148,17 +267,36 @@ func loadURL(ctx context.Context, cache *cache.Client, base *source, name string
 	log.Debugf("opened %s", url)
 
 	result := &source{
-		Content:  data,
-		Remote:   true,
-		Path:     pathString,
-		Name:     name,
-		Location: url,
-		Repo:     repo,
+		Content:   data,
+		Remote:    true,
+		Path:      pathString,
+		Name:      name,
+		Location:  url,
+		Repo:      repo,
+		Signature: signature,
+	}
+
+	if repo != nil && signatures {
+		if relative && base.Repo != nil && base.RepoManifest != nil {
+			// The manifest of the repo was already looked up for the source this one is relative to.
+			result.RepoManifest, result.RepoManifestSignature = base.RepoManifest, base.RepoManifestSignature
+		} else if result.RepoManifest, result.RepoManifestSignature, err = getManifest(ctx, url, bearerToken, repo); err != nil {
+			return nil, false, fmt.Errorf("error loading the %s of %s: %v", repos.ManifestFile, url, err)
+		}
+	}
+
+	if err := state.lock.check(lockRef, result); err != nil {
+		return nil, false, err
+	}
+	if err := state.trust.verify(lockRef, result); err != nil {
+		return nil, false, err
 	}
+	state.vendor.record(lockRef, result)
 
-	if err := cache.Store(ctx, cachedKey, cacheValue{
-		Source: result,
-		Time:   time.Now(),
+	if err := state.cache.Store(ctx, cacheKind(data), cachedKey, cacheValue{
+		Source:           result,
+		Time:             time.Now(),
+		SignatureChecked: signatures,
 	}); err != nil {
 		return nil, false, err
 	}
@@ -166,11 +304,19 @@ func loadURL(ctx context.Context, cache *cache.Client, base *source, name string
 	return result, true, nil
 }
 
+// cacheKind tells the OpenAPI schemas from the sources of tools in the cache.
+func cacheKind(data []byte) cache.Kind {
+	if openapi.IsOpenAPI(data) != 0 {
+		return cache.KindOpenAPI
+	}
+	return cache.KindSource
+}
+
 func getWithDefaults(req *http.Request) ([]byte, string, error) {
 	originalPath := req.URL.Path
 
 	// First, try to get the original path as is. It might be an OpenAPI definition.
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := doDownload(req)
 	if err != nil {
 		return nil, "", err
 	}
@@ -189,7 +335,7 @@ func getWithDefaults(req *http.Request) ([]byte, string, error) {
 	for i, def := range types.DefaultFiles {
 		req.URL.Path = path.Join(originalPath, def)
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := doDownload(req)
 		if err != nil {
 			return nil, "", err
 		}
@@ -210,6 +356,32 @@ func getWithDefaults(req *http.Request) ([]byte, string, error) {
 	panic("unreachable")
 }
 
+// localPath returns the path of the file of a file:// URL.
+func localPath(urlPath string) string {
+	if runtime.GOOS == "windows" {
+		urlPath = strings.TrimPrefix(urlPath, "/")
+	}
+	return filepath.FromSlash(urlPath)
+}
+
+// readWithDefaults reads a file of a checkout, or the default tool file if it is a directory.
+func readWithDefaults(filePath string) ([]byte, string, error) {
+	if s, err := os.Stat(filePath); err != nil || !s.IsDir() {
+		data, err := os.ReadFile(filePath)
+		return data, "", err
+	}
+
+	for i, def := range types.DefaultFiles {
+		data, err := os.ReadFile(filepath.Join(filePath, def))
+		if errors.Is(err, fs.ErrNotExist) && i != len(types.DefaultFiles)-1 {
+			continue
+		}
+		return data, def, err
+	}
+
+	panic("unreachable")
+}
+
 func ContentFromURL(url string, disableCache bool) (string, error) {
 	cache, err := cache.New(cache.Options{
 		DisableCache: disableCache,
@@ -218,7 +390,7 @@ func ContentFromURL(url string, disableCache bool) (string, error) {
 		return "", fmt.Errorf("failed to create cache: %w", err)
 	}
 
-	source, ok, err := loadURL(context.Background(), cache, &source{}, url)
+	source, ok, err := loadURL(context.Background(), &loadState{cache: cache}, &source{}, url)
 	if err != nil {
 		return "", fmt.Errorf("failed to load %s: %w", url, err)
 	}
@@ -0,0 +1,117 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/loader/gitclone"
+	"github.com/gptscript-ai/gptscript/pkg/loader/gitea"
+	"github.com/gptscript-ai/gptscript/pkg/loader/github"
+	"github.com/gptscript-ai/gptscript/pkg/loader/gitlab"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// The types of hosts.
+const (
+	TypeGitHub = "github"
+	TypeGitLab = "gitlab"
+	TypeGitea  = "gitea"
+	TypeGit    = "git"
+)
+
+// Host is a host that remote tools are loaded from.
+type Host struct {
+	// Prefix is what the references to the tools on the host start with, like gitlab.example.com/.
+	Prefix string `json:"prefix"`
+	// Type is github for GitHub Enterprise, gitlab, gitea, or git for any other host, whose repos are cloned.
+	Type string `json:"type"`
+	// URL is the URL of GitLab and Gitea hosts, https:// and the host of the prefix by default. For git hosts, it
+	// replaces the prefix in the URL the repos are cloned from, like ssh://git@git.example.com/. GitHub Enterprise hosts
+	// are always at https:// and the host of the prefix.
+	URL string `json:"url,omitempty"`
+	// TokenEnv is the environment variable of the token to authenticate to the host with. It is GH_ENTERPRISE_TOKEN,
+	// GITLAB_TOKEN or GITEA_TOKEN by default. Git hosts use the credentials that git is configured with instead.
+	TokenEnv string `json:"tokenEnv,omitempty"`
+}
+
+type hostsFile struct {
+	Hosts []Host `json:"hosts"`
+}
+
+// LoadHosts reads the JSON or YAML hosts file. A file that doesn't exist has no hosts if optional is set.
+func LoadHosts(file string, optional bool) ([]Host, error) {
+	data, err := os.ReadFile(file)
+	if optional && errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read hosts file %s: %w", file, err)
+	}
+
+	var hosts hostsFile
+	if err := yaml.UnmarshalStrict(data, &hosts); err != nil {
+		return nil, fmt.Errorf("invalid hosts file %s: %w", file, err)
+	}
+
+	for i, host := range hosts.Hosts {
+		if host.Prefix == "" {
+			return nil, fmt.Errorf("invalid hosts file %s: host %d has no prefix", file, i+1)
+		}
+		switch host.Type {
+		case TypeGitHub, TypeGitLab, TypeGitea, TypeGit:
+		default:
+			return nil, fmt.Errorf("invalid hosts file %s: host %s has type %q, must be one of %s, %s, %s or %s", file,
+				host.Prefix, host.Type, TypeGitHub, TypeGitLab, TypeGitea, TypeGit)
+		}
+	}
+	return hosts.Hosts, nil
+}
+
+// AddHosts loads the remote tools whose references start with the prefix of a host from the host.
+func AddHosts(hosts []Host) {
+	for _, host := range hosts {
+		loader.AddVSC(host.lookup())
+	}
+}
+
+func (h Host) url() string {
+	if h.URL != "" {
+		return strings.TrimSuffix(h.URL, "/")
+	}
+	hostname, _, _ := strings.Cut(h.Prefix, "/")
+	return "https://" + hostname
+}
+
+func (h Host) token(defaultEnv string) string {
+	if h.TokenEnv != "" {
+		return os.Getenv(h.TokenEnv)
+	}
+	return os.Getenv(defaultEnv)
+}
+
+func (h Host) lookup() loader.VCSLookup {
+	switch h.Type {
+	case TypeGitHub:
+		config := github.NewGithubEnterpriseConfig(strings.TrimSuffix(h.Prefix, "/"))
+		config.AuthToken = h.token("GH_ENTERPRISE_TOKEN")
+		return func(ctx context.Context, c *cache.Client, urlName string) (string, string, *types.Repo, bool, error) {
+			return github.LoadWithConfig(ctx, c, urlName, config)
+		}
+	case TypeGitLab:
+		return gitlab.LoaderForPrefix(h.Prefix, h.url(), h.token("GITLAB_TOKEN"))
+	case TypeGitea:
+		return gitea.LoaderForPrefix(h.Prefix, h.url(), h.token("GITEA_TOKEN"))
+	default:
+		cloneURL := h.URL
+		if cloneURL == "" {
+			cloneURL = "https://" + h.Prefix
+		}
+		return gitclone.LoaderForPrefix(h.Prefix, cloneURL)
+	}
+}
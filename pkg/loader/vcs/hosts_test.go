@@ -0,0 +1,44 @@
+package vcs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadHosts(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "vcs-hosts.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+hosts:
+- prefix: gitlab.example.com/
+  type: gitlab
+  tokenEnv: EXAMPLE_GITLAB_TOKEN
+- prefix: code.example.com/
+  type: git
+  url: ssh://git@code.example.com/
+`), 0644))
+
+	hosts, err := LoadHosts(file, false)
+	require.NoError(t, err)
+	require.Len(t, hosts, 2)
+	assert.Equal(t, "https://gitlab.example.com", hosts[0].url())
+	assert.Equal(t, "ssh://git@code.example.com", hosts[1].url())
+
+	t.Setenv("EXAMPLE_GITLAB_TOKEN", "mytoken")
+	assert.Equal(t, "mytoken", hosts[0].token("GITLAB_TOKEN"))
+
+	hosts, err = LoadHosts(filepath.Join(dir, "missing.yaml"), true)
+	require.NoError(t, err)
+	assert.Empty(t, hosts)
+
+	_, err = LoadHosts(filepath.Join(dir, "missing.yaml"), false)
+	assert.ErrorContains(t, err, "failed to read hosts file")
+
+	require.NoError(t, os.WriteFile(file, []byte("hosts:\n- prefix: svn.example.com/\n  type: svn\n"), 0644))
+	_, err = LoadHosts(file, false)
+	assert.ErrorContains(t, err, `host svn.example.com/ has type "svn"`)
+}
@@ -0,0 +1,295 @@
+package loader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/repos/git"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	// DefaultVendorDir is the directory the tools are vendored to if none is set.
+	DefaultVendorDir = "vendor"
+	// VendorManifest is the file in the vendor directory that lists what is vendored.
+	VendorManifest = "manifest.json"
+)
+
+// DefaultVendorPath returns where the default vendor directory of a program is, which is next to its default lock file.
+func DefaultVendorPath(program string) string {
+	return filepath.Join(filepath.Dir(DefaultLockPath(program)), DefaultVendorDir)
+}
+
+// Vendor is a directory with copies of the remote tools and OpenAPI documents that scripts load, and of the commits of
+// the git repos of their command tools, so that the scripts can be loaded and run without network access.
+type Vendor struct {
+	dir      string
+	manifest vendorManifest
+	contents map[string][]byte
+	update   bool
+	lock     sync.Mutex
+}
+
+type vendorManifest struct {
+	// Sources are the vendored sources by the reference they are loaded with, which is the same as in lock files.
+	Sources map[string]VendoredSource `json:"sources"`
+	// Repos are the directories of the vendored git repos, relative to the vendor directory, by their URL and commit.
+	Repos map[string]string `json:"repos,omitempty"`
+}
+
+type VendoredSource struct {
+	// File is the copy of the source, relative to the vendor directory.
+	File string `json:"file"`
+	// Digest is the sha256 digest of the content of the source.
+	Digest   string      `json:"digest"`
+	Location string      `json:"location"`
+	Path     string      `json:"path"`
+	Name     string      `json:"name"`
+	Repo     *types.Repo `json:"repo,omitempty"`
+	// Signature is the detached signature of the source, if it has one.
+	Signature []byte `json:"signature,omitempty"`
+	// RepoManifest is the manifest of the repo of the source and RepoManifestSignature is its signature, if it has one.
+	RepoManifest          []byte `json:"repoManifest,omitempty"`
+	RepoManifestSignature []byte `json:"repoManifestSignature,omitempty"`
+}
+
+// NewVendor returns a vendor that records every remote source that is loaded with it, to be written to the directory
+// with Save.
+func NewVendor(dir string) *Vendor {
+	return &Vendor{
+		dir: dir,
+		manifest: vendorManifest{
+			Sources: map[string]VendoredSource{},
+			Repos:   map[string]string{},
+		},
+		contents: map[string][]byte{},
+		update:   true,
+	}
+}
+
+// LoadVendor reads the manifest of a vendor directory. The loader then loads remote tools only from the directory.
+func LoadVendor(dir string) (*Vendor, error) {
+	file := filepath.Join(dir, VendorManifest)
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s does not exist, run gptscript vendor to create it", file)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read vendor manifest %s: %w", file, err)
+	}
+
+	v := &Vendor{
+		dir: dir,
+	}
+	if err := json.Unmarshal(data, &v.manifest); err != nil {
+		return nil, fmt.Errorf("invalid vendor manifest %s: %w", file, err)
+	}
+	return v, nil
+}
+
+func repoKey(repo *types.Repo) string {
+	return repo.Root + "@" + repo.Revision
+}
+
+// Save writes the recorded sources to the vendor directory, along with the git repos of the command tools of the
+// programs. What was vendored to the directory before is replaced. The directory must not exist, be empty, or have a
+// vendor manifest, and only what its manifest lists is removed.
+func (v *Vendor) Save(ctx context.Context, programs ...types.Program) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if err := v.removeVendored(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(v.dir, "sources"), 0755); err != nil {
+		return err
+	}
+
+	for _, s := range v.manifest.Sources {
+		if err := os.WriteFile(filepath.Join(v.dir, filepath.FromSlash(s.File)), v.contents[s.Digest], 0644); err != nil {
+			return err
+		}
+	}
+
+	for _, prg := range programs {
+		for _, tool := range prg.ToolSet {
+			repo := tool.Source.Repo
+			if repo == nil || repo.VCS != "git" || !runsFromRepo(tool) {
+				continue
+			}
+			if _, ok := v.manifest.Repos[repoKey(repo)]; ok {
+				continue
+			}
+
+			dir := "repos/" + hash.Digest(repo.Root)[:12] + "-" + repo.Revision + ".git"
+			if err := git.Mirror(ctx, repo.Root, repo.Revision, filepath.Join(v.dir, filepath.FromSlash(dir))); err != nil {
+				return fmt.Errorf("failed to vendor %s at %s: %w", repo.Root, repo.Revision, err)
+			}
+			v.manifest.Repos[repoKey(repo)] = dir
+		}
+	}
+
+	data, err := json.MarshalIndent(v.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(v.dir, VendorManifest), append(data, '\n'), 0644)
+}
+
+// removeVendored removes the sources and repos that the manifest of the vendor directory lists. A directory without a
+// manifest is not a vendor directory, so it is refused unless it is empty.
+func (v *Vendor) removeVendored() error {
+	file := filepath.Join(v.dir, VendorManifest)
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		entries, err := os.ReadDir(v.dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return fmt.Errorf("%s is not empty and has no %s, refusing to vendor to a directory that gptscript vendor did not write", v.dir, VendorManifest)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read vendor manifest %s: %w", file, err)
+	}
+
+	var previous vendorManifest
+	if err := json.Unmarshal(data, &previous); err != nil {
+		return fmt.Errorf("invalid vendor manifest %s: %w", file, err)
+	}
+
+	vendored := make([]string, 0, len(previous.Sources)+len(previous.Repos))
+	for _, s := range previous.Sources {
+		vendored = append(vendored, s.File)
+	}
+	for _, dir := range previous.Repos {
+		vendored = append(vendored, dir)
+	}
+	for _, p := range vendored {
+		if !isVendoredPath(p) {
+			return fmt.Errorf("vendor manifest %s lists %s, which is not in the sources or repos directory", file, p)
+		}
+		if err := os.RemoveAll(filepath.Join(v.dir, filepath.FromSlash(p))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isVendoredPath returns whether a path of a vendor manifest is an entry of the sources or repos directory.
+func isVendoredPath(p string) bool {
+	dir, name, ok := strings.Cut(path.Clean(p), "/")
+	return ok && (dir == "sources" || dir == "repos") && name != ".." && !strings.Contains(name, "/")
+}
+
+// Sources returns the number of vendored sources.
+func (v *Vendor) Sources() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return len(v.manifest.Sources)
+}
+
+// Repos returns the number of vendored git repos.
+func (v *Vendor) Repos() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return len(v.manifest.Repos)
+}
+
+// runsFromRepo returns whether running the tool needs a checkout of its repo, which is the case for the commands that
+// are not built in.
+func runsFromRepo(tool types.Tool) bool {
+	return tool.IsDaemon() || (tool.IsCommand() && !strings.HasPrefix(tool.Instructions, types.CommandPrefix+"sys."))
+}
+
+// recording returns whether loaded sources are recorded to be vendored, which is false without a vendor.
+func (v *Vendor) recording() bool {
+	return v != nil && v.update
+}
+
+// offline returns whether remote sources are only loaded from the vendor directory, which is false without a vendor.
+func (v *Vendor) offline() bool {
+	return v != nil && !v.update
+}
+
+// record records a remote source that was loaded if the vendor is being updated.
+func (v *Vendor) record(ref string, s *source) {
+	if !v.recording() {
+		return
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	digest := hash.Digest(s.Content)
+	v.contents[digest] = s.Content
+	v.manifest.Sources[ref] = VendoredSource{
+		File:      "sources/" + digest,
+		Digest:    digest,
+		Location:  s.Location,
+		Path:      s.Path,
+		Name:      s.Name,
+		Repo:      s.Repo,
+		Signature: s.Signature,
+
+		RepoManifest:          s.RepoManifest,
+		RepoManifestSignature: s.RepoManifestSignature,
+	}
+}
+
+// source returns the vendored source of a reference. The git repos of vendored sources are replaced with their vendored
+// copy, so that their tools are checked out from there.
+func (v *Vendor) source(ref string) (*source, bool, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	vendored, ok := v.manifest.Sources[ref]
+	if !ok {
+		return nil, false, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(v.dir, filepath.FromSlash(vendored.File)))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read vendored %s: %w", ref, err)
+	}
+	if hash.Digest(data) != vendored.Digest {
+		return nil, false, fmt.Errorf("the vendored copy of %s does not match the vendor manifest, run gptscript vendor to update it", ref)
+	}
+
+	repo := vendored.Repo
+	if repo != nil {
+		if dir, ok := v.manifest.Repos[repoKey(repo)]; ok {
+			root, err := filepath.Abs(filepath.Join(v.dir, filepath.FromSlash(dir)))
+			if err != nil {
+				return nil, false, err
+			}
+			vendoredRepo := *repo
+			vendoredRepo.Root = root
+			repo = &vendoredRepo
+		}
+	}
+
+	return &source{
+		Content:   data,
+		Remote:    true,
+		Path:      vendored.Path,
+		Name:      vendored.Name,
+		Location:  vendored.Location,
+		Repo:      repo,
+		Signature: vendored.Signature,
+
+		RepoManifest:          vendored.RepoManifest,
+		RepoManifestSignature: vendored.RepoManifestSignature,
+	}, true, nil
+}
@@ -0,0 +1,141 @@
+package loader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVendor(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	repo := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "run.sh"), []byte("echo hi\n"), 0755))
+	git(repo, "init", "-b", "main")
+	git(repo, "add", ".")
+	git(repo, "commit", "-m", "tool")
+	commit := git(repo, "rev-parse", "HEAD")
+
+	files := map[string]string{
+		"/main.gpt":                "Tools: vendor.test/tool@main\n\n#!sys.echo main\n",
+		"/" + commit + "/tool.gpt": "Tools: ./sub.gpt\n\n#!/bin/sh ${GPTSCRIPT_TOOL_DIR}/run.sh\n",
+		"/" + commit + "/sub.gpt":  "#!sys.echo sub\n",
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer s.Close()
+
+	AddVSC(func(_ context.Context, _ *cache.Client, name string) (string, string, *types.Repo, bool, error) {
+		if !strings.HasPrefix(name, "vendor.test/") {
+			return "", "", nil, false, nil
+		}
+		return s.URL + "/" + commit + "/tool.gpt", "", &types.Repo{
+			VCS:      "git",
+			Root:     repo,
+			Path:     ".",
+			Name:     "tool.gpt",
+			Revision: commit,
+		}, true, nil
+	})
+
+	c, err := cache.New(cache.Options{CacheDir: t.TempDir()})
+	require.NoError(t, err)
+
+	dir := filepath.Join(t.TempDir(), DefaultVendorDir)
+	vendor := NewVendor(dir)
+	prg, err := Program(context.Background(), s.URL+"/main.gpt", "", Options{Cache: c, Vendor: vendor})
+	require.NoError(t, err)
+	require.NoError(t, vendor.Save(context.Background(), prg))
+	assert.Equal(t, 3, vendor.Sources())
+	assert.Equal(t, 1, vendor.Repos())
+
+	// The vendored program is loaded without the server, and its command tool is checked out from the vendored repo.
+	s.Close()
+	vendor, err = LoadVendor(dir)
+	require.NoError(t, err)
+	c, err = cache.New(cache.Options{CacheDir: t.TempDir()})
+	require.NoError(t, err)
+	prg, err = Program(context.Background(), s.URL+"/main.gpt", "", Options{Cache: c, Vendor: vendor})
+	require.NoError(t, err)
+	require.Len(t, prg.ToolSet, 3)
+
+	var vendoredRepo string
+	for _, tool := range prg.ToolSet {
+		if runsFromRepo(tool) {
+			vendoredRepo = tool.Source.Repo.Root
+		}
+	}
+	assert.True(t, strings.HasPrefix(vendoredRepo, dir), vendoredRepo)
+	assert.Equal(t, commit, git(vendoredRepo, "rev-parse", "HEAD"))
+
+	_, err = Program(context.Background(), s.URL+"/other.gpt", "", Options{Cache: c, Vendor: vendor})
+	assert.ErrorContains(t, err, s.URL+"/other.gpt is not vendored, run gptscript vendor to add it")
+
+	_, err = LoadVendor(t.TempDir())
+	assert.ErrorContains(t, err, "does not exist, run gptscript vendor to create it")
+}
+
+func TestVendorSave(t *testing.T) {
+	// A directory that was not written by gptscript vendor is left alone.
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sources"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sources", "main.go"), []byte("package main\n"), 0644))
+	err := NewVendor(dir).Save(context.Background())
+	assert.ErrorContains(t, err, "is not empty and has no "+VendorManifest)
+	assert.FileExists(t, filepath.Join(dir, "sources", "main.go"))
+
+	// Only what the previous manifest lists is replaced.
+	dir = t.TempDir()
+	require.NoError(t, NewVendor(dir).Save(context.Background()))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "repos", "old.git"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sources", "old"), []byte("old"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sources", "notes.txt"), []byte("mine"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, VendorManifest),
+		[]byte(`{"sources":{"old.gpt":{"file":"sources/old"}},"repos":{"old@main":"repos/old.git"}}`), 0644))
+	require.NoError(t, NewVendor(dir).Save(context.Background()))
+	assert.NoFileExists(t, filepath.Join(dir, "sources", "old"))
+	assert.NoDirExists(t, filepath.Join(dir, "repos", "old.git"))
+	assert.FileExists(t, filepath.Join(dir, "sources", "notes.txt"))
+
+	// A manifest that lists files outside the vendored directories is refused.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, VendorManifest),
+		[]byte(`{"sources":{"old.gpt":{"file":"sources/../notes.txt"}}}`), 0644))
+	err = NewVendor(dir).Save(context.Background())
+	assert.ErrorContains(t, err, "which is not in the sources or repos directory")
+}
+
+func TestDefaultVendorPath(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.gpt")
+	require.NoError(t, os.WriteFile(script, []byte("echo hi"), 0644))
+
+	assert.Equal(t, filepath.Join(dir, DefaultVendorDir), DefaultVendorPath(script))
+	assert.Equal(t, filepath.Join(dir, DefaultVendorDir), DefaultVendorPath(dir))
+	assert.Equal(t, DefaultVendorDir, DefaultVendorPath("-"))
+}
@@ -0,0 +1,328 @@
+// Package mock is the built-in mock model provider, which answers chat completion requests with the replies scripted in
+// a YAML file instead of calling a model, so that scripts can run end to end without network access.
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ProviderName is the name of the mock provider, as in "Model: gpt-4o from mock".
+	ProviderName = "mock"
+	// DefaultFile is the file of the replies if none is set.
+	DefaultFile = "gptscript.mock.yaml"
+)
+
+// File is the YAML file of the replies of the mock provider.
+type File struct {
+	// Models are the names of the models that are listed, "mock" by default. Any model name can be used.
+	Models []string `json:"models,omitempty"`
+	// Replies are checked in order, and the first one that matches the request answers it.
+	Replies []Reply `json:"replies,omitempty"`
+	// Default is the text that answers the requests that no reply matches. If it is not set, those requests fail.
+	Default string `json:"default,omitempty"`
+}
+
+// Reply answers the requests that match all of its conditions. It is either a single step, or a plan of steps where
+// the first step answers the last message of the user, and every following step answers the results of the tool calls
+// of the step before it. A reply no longer matches once all the steps of its plan are taken.
+type Reply struct {
+	// Model is a regular expression the name of the model must match.
+	Model string `json:"model,omitempty"`
+	// System is a regular expression the system prompt, which holds the instructions of the tool, must match.
+	System string `json:"system,omitempty"`
+	// Match is a regular expression the last message of the user, or the system prompt if there is none, must match.
+	// Its groups are expanded in the text and the arguments of the steps as $1 or ${name}.
+	Match string `json:"match,omitempty"`
+
+	Step
+	Plan []Step `json:"plan,omitempty"`
+}
+
+// Step is either text or calls to tools.
+type Step struct {
+	Text      string     `json:"text,omitempty"`
+	ToolCall  *ToolCall  `json:"toolCall,omitempty"`
+	ToolCalls []ToolCall `json:"toolCalls,omitempty"`
+}
+
+type ToolCall struct {
+	Name string `json:"name"`
+	// Arguments are either a JSON string or an object.
+	Arguments any `json:"arguments,omitempty"`
+}
+
+func (r Reply) steps() []Step {
+	if len(r.Plan) > 0 {
+		return r.Plan
+	}
+	return []Step{r.Step}
+}
+
+// Load reads the replies of the mock provider from a file.
+func Load(file string) (*File, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("the replies of the mock model provider are read from %s, which does not exist", file)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var result File
+	if err := yaml.UnmarshalStrict(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse mock model replies %s: %w", file, err)
+	}
+	return &result, nil
+}
+
+// Client is the mock model provider. It reads its file on every call, so that the replies can be changed while a chat
+// is running.
+type Client struct {
+	file string
+	// isDefault is whether mock is the default model provider, which answers the models without a provider.
+	isDefault bool
+}
+
+func New(file string, isDefault bool) *Client {
+	if file == "" {
+		file = DefaultFile
+	}
+	return &Client{
+		file:      file,
+		isDefault: isDefault,
+	}
+}
+
+// SupportsModel returns whether the model is from the mock provider.
+func (c *Client) SupportsModel(modelName string) bool {
+	provider, model := types.SplitToolRef(modelName)
+	if model == "" {
+		return c.isDefault
+	}
+	return provider == ProviderName
+}
+
+// ProviderName returns the name of the provider of the models of the client, which is mock.
+func (c *Client) ProviderName(string) string {
+	return ProviderName
+}
+
+func (c *Client) Supports(_ context.Context, modelName string) (bool, error) {
+	return c.SupportsModel(modelName), nil
+}
+
+func (c *Client) ListModels(_ context.Context, providers ...string) ([]openai.Model, error) {
+	if !slices.Contains(providers, ProviderName) {
+		return nil, nil
+	}
+
+	file, err := Load(c.file)
+	if err != nil {
+		return nil, err
+	}
+
+	names := file.Models
+	if len(names) == 0 {
+		names = []string{ProviderName}
+	}
+
+	result := make([]openai.Model, 0, len(names))
+	for _, name := range names {
+		result = append(result, openai.Model{
+			ID:      fmt.Sprintf("%s from %s", name, ProviderName),
+			Object:  "model",
+			OwnedBy: ProviderName,
+		})
+	}
+	return result, nil
+}
+
+func (c *Client) Call(_ context.Context, messageRequest types.CompletionRequest, _ []string, _ chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	file, err := Load(c.file)
+	if err != nil {
+		return nil, err
+	}
+	return file.Reply(messageRequest)
+}
+
+// Reply answers the request with the first reply that matches it.
+func (f *File) Reply(messageRequest types.CompletionRequest) (*types.CompletionMessage, error) {
+	model := messageRequest.Model
+	if _, name := types.SplitToolRef(model); name != "" {
+		model = name
+	}
+	system, user, taken := conversation(messageRequest.Messages)
+
+	for i, reply := range f.Replies {
+		steps := reply.steps()
+		if taken >= len(steps) {
+			continue
+		}
+
+		if ok, err := matches(reply.Model, model); err != nil {
+			return nil, fmt.Errorf("invalid model of mock reply %d: %w", i+1, err)
+		} else if !ok {
+			continue
+		}
+		if ok, err := matches(reply.System, system); err != nil {
+			return nil, fmt.Errorf("invalid system of mock reply %d: %w", i+1, err)
+		} else if !ok {
+			continue
+		}
+
+		expand := func(s string) string { return s }
+		if reply.Match != "" {
+			re, err := regexp.Compile(reply.Match)
+			if err != nil {
+				return nil, fmt.Errorf("invalid match of mock reply %d: %w", i+1, err)
+			}
+			groups := re.FindStringSubmatchIndex(user)
+			if groups == nil {
+				continue
+			}
+			expand = func(s string) string {
+				return string(re.ExpandString(nil, s, user, groups))
+			}
+		}
+
+		result, err := respond(steps[taken], expand, messageRequest.Tools)
+		if err != nil {
+			return nil, fmt.Errorf("mock reply %d: %w", i+1, err)
+		}
+		return result, nil
+	}
+
+	if f.Default != "" {
+		return &types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeAssistant,
+			Content: types.Text(f.Default),
+		}, nil
+	}
+	return nil, fmt.Errorf("no mock reply matches the message %q", user)
+}
+
+// conversation returns the system prompt, the text of the last message of the user, and the number of steps that were
+// taken since then, which is the number of responses of the model after it. A tool that is called without input has no
+// message of the user, so its instructions in the system prompt are matched instead.
+func conversation(msgs []types.CompletionMessage) (system, user string, taken int) {
+	var prompts []string
+	for _, msg := range msgs {
+		if msg.Role == types.CompletionMessageRoleTypeSystem {
+			prompts = append(prompts, msg.String())
+		}
+	}
+	system = strings.Join(prompts, "\n")
+
+	for i := len(msgs) - 1; i >= 0; i-- {
+		switch msgs[i].Role {
+		case types.CompletionMessageRoleTypeUser:
+			if text := msgs[i].String(); text != "" {
+				return system, text, taken
+			}
+			return system, system, taken
+		case types.CompletionMessageRoleTypeAssistant:
+			taken++
+		}
+	}
+	return system, system, taken
+}
+
+func matches(pattern, s string) (bool, error) {
+	if pattern == "" {
+		return true, nil
+	}
+	return regexp.MatchString(pattern, s)
+}
+
+func respond(step Step, expand func(string) string, tools []types.ChatCompletionTool) (*types.CompletionMessage, error) {
+	calls := step.ToolCalls
+	if step.ToolCall != nil {
+		calls = append([]ToolCall{*step.ToolCall}, calls...)
+	}
+
+	result := &types.CompletionMessage{
+		Role: types.CompletionMessageRoleTypeAssistant,
+	}
+	if step.Text != "" || len(calls) == 0 {
+		result.Content = types.Text(expand(step.Text))
+	}
+
+	for _, call := range calls {
+		index := slices.IndexFunc(tools, func(tool types.ChatCompletionTool) bool {
+			return tool.Function.Name == call.Name
+		})
+		if index < 0 {
+			names := make([]string, 0, len(tools))
+			for _, tool := range tools {
+				names = append(names, tool.Function.Name)
+			}
+			return nil, fmt.Errorf("calls tool %q, but the available tools are [%s]", call.Name, strings.Join(names, ", "))
+		}
+
+		args, err := arguments(call.Arguments, expand)
+		if err != nil {
+			return nil, fmt.Errorf("invalid arguments of the call to %s: %w", call.Name, err)
+		}
+
+		result.Content = append(result.Content, types.ContentPart{
+			ToolCall: &types.CompletionToolCall{
+				Index: &index,
+				ID:    "call_" + hash.ID(call.Name, args)[:8],
+				Function: types.CompletionFunctionCall{
+					Name:      call.Name,
+					Arguments: args,
+				},
+			},
+		})
+	}
+	return result, nil
+}
+
+// arguments renders the arguments of a tool call as JSON, with the groups of the match expanded in its strings.
+func arguments(args any, expand func(string) string) (string, error) {
+	switch v := args.(type) {
+	case nil:
+		return "{}", nil
+	case string:
+		return expand(v), nil
+	}
+
+	data, err := json.Marshal(expandStrings(args, expand))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func expandStrings(value any, expand func(string) string) any {
+	switch v := value.(type) {
+	case string:
+		return expand(v)
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, child := range v {
+			result[key] = expandStrings(child, expand)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, child := range v {
+			result[i] = expandStrings(child, expand)
+		}
+		return result
+	}
+	return value
+}
@@ -0,0 +1,172 @@
+package mock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testFile = `
+models: [fast, smart]
+replies:
+- match: (?i)weather in (?P<city>\w+)
+  plan:
+  - toolCall:
+      name: get_weather
+      arguments:
+        city: ${city}
+  - text: It is sunny in ${city}.
+- model: ^smart$
+  match: hello
+  text: Hello from the smart model.
+- system: pirate
+  match: hello
+  text: Ahoy!
+- match: hello
+  text: Hello!
+- match: echo (.*)
+  toolCall:
+    name: echo
+    arguments: '{"text": "$1"}'
+default: I don't know.
+`
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), DefaultFile)
+	require.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	return file
+}
+
+func request(model, system string, msgs ...types.CompletionMessage) types.CompletionRequest {
+	result := types.CompletionRequest{
+		Model: model,
+		Tools: []types.ChatCompletionTool{
+			{Function: types.CompletionFunctionDefinition{Name: "echo"}},
+			{Function: types.CompletionFunctionDefinition{Name: "get_weather"}},
+		},
+	}
+	if system != "" {
+		result.Messages = append(result.Messages, types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeSystem,
+			Content: types.Text(system),
+		})
+	}
+	result.Messages = append(result.Messages, msgs...)
+	return result
+}
+
+func user(text string) types.CompletionMessage {
+	return types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeUser,
+		Content: types.Text(text),
+	}
+}
+
+func TestReply(t *testing.T) {
+	client := New(writeFile(t, testFile), true)
+
+	tests := []struct {
+		name, model, system, message, want string
+	}{
+		{name: "first match", model: "fast", message: "hello there", want: "Hello!"},
+		{name: "model", model: "smart from mock", message: "hello there", want: "Hello from the smart model."},
+		{name: "system", model: "fast", system: "Talk like a pirate.", message: "hello there", want: "Ahoy!"},
+		{name: "default", model: "fast", message: "what now?", want: "I don't know."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Call(context.Background(), request(tt.model, tt.system, user(tt.message)), nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, types.CompletionMessageRoleTypeAssistant, resp.Role)
+			assert.Equal(t, tt.want, resp.String())
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	client := New(writeFile(t, testFile), true)
+
+	req := request("fast", "", user("What's the weather in Paris?"))
+	resp, err := client.Call(context.Background(), req, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, resp.Content, 1)
+	require.NotNil(t, resp.Content[0].ToolCall)
+	assert.Equal(t, 1, *resp.Content[0].ToolCall.Index)
+	assert.Equal(t, "get_weather", resp.Content[0].ToolCall.Function.Name)
+	assert.JSONEq(t, `{"city": "Paris"}`, resp.Content[0].ToolCall.Function.Arguments)
+
+	// The result of the tool call is answered by the next step of the plan.
+	req.Messages = append(req.Messages, *resp, types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeTool,
+		Content: types.Text("sunny"),
+	})
+	resp, err = client.Call(context.Background(), req, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "It is sunny in Paris.", resp.String())
+
+	// Once the plan is done, the next matching reply answers, which is the default here.
+	req.Messages = append(req.Messages, *resp)
+	resp, err = client.Call(context.Background(), req, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "I don't know.", resp.String())
+}
+
+func TestToolCallArgumentsString(t *testing.T) {
+	client := New(writeFile(t, testFile), true)
+
+	resp, err := client.Call(context.Background(), request("fast", "", user("echo hi")), nil, nil)
+	require.NoError(t, err)
+	require.Len(t, resp.Content, 1)
+	require.NotNil(t, resp.Content[0].ToolCall)
+	assert.Equal(t, "echo", resp.Content[0].ToolCall.Function.Name)
+	assert.Equal(t, `{"text": "hi"}`, resp.Content[0].ToolCall.Function.Arguments)
+}
+
+func TestErrors(t *testing.T) {
+	_, err := New(filepath.Join(t.TempDir(), "missing.yaml"), true).Call(context.Background(), request("fast", "", user("hello")), nil, nil)
+	assert.ErrorContains(t, err, "does not exist")
+
+	_, err = New(writeFile(t, "replies:\n- match: hello\n  text: hi\n"), true).Call(context.Background(), request("fast", "", user("bye")), nil, nil)
+	assert.ErrorContains(t, err, `no mock reply matches the message "bye"`)
+
+	_, err = New(writeFile(t, "replies:\n- toolCall:\n    name: missing\n"), true).Call(context.Background(), request("fast", "", user("bye")), nil, nil)
+	assert.ErrorContains(t, err, `calls tool "missing", but the available tools are [echo, get_weather]`)
+
+	_, err = New(writeFile(t, "replies:\n- text: hi\n  unknown: true\n"), true).Call(context.Background(), request("fast", "", user("bye")), nil, nil)
+	assert.ErrorContains(t, err, "failed to parse mock model replies")
+}
+
+func TestSupportsModel(t *testing.T) {
+	assert.True(t, New("", false).SupportsModel("fast from mock"))
+	assert.False(t, New("", false).SupportsModel("fast from openai"))
+	assert.False(t, New("", false).SupportsModel("gpt-4o"))
+	assert.True(t, New("", true).SupportsModel("gpt-4o"))
+}
+
+func TestListModels(t *testing.T) {
+	client := New(writeFile(t, testFile), false)
+
+	models, err := client.ListModels(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, models)
+
+	models, err = client.ListModels(context.Background(), ProviderName)
+	require.NoError(t, err)
+	require.Len(t, models, 2)
+	assert.Equal(t, "fast from mock", models[0].ID)
+	assert.Equal(t, "smart from mock", models[1].ID)
+}
+
+func TestMatchInstructionsWithoutInput(t *testing.T) {
+	client := New(writeFile(t, testFile), true)
+
+	resp, err := client.Call(context.Background(), request("fast", "Say hello to the user."), nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello!", resp.String())
+}
@@ -0,0 +1,199 @@
+// Package models describes the context windows, output limits and tokenizers of LLM models, so that the tokens of a
+// request can be counted the way the model it is sent to counts them.
+package models
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+	"sigs.k8s.io/yaml"
+)
+
+func init() {
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// DefaultCharsPerToken estimates the tokens of the models without a known tokenizer.
+const DefaultCharsPerToken = 4.0
+
+// Info is the metadata of a model.
+type Info struct {
+	ContextWindow   int `json:"contextWindow,omitempty"`
+	MaxOutputTokens int `json:"maxOutputTokens,omitempty"`
+	// Encoding is the tiktoken encoding of the tokenizer of the model, for example o200k_base.
+	Encoding string `json:"encoding,omitempty"`
+	// CharsPerToken estimates the tokens of a model without an encoding.
+	CharsPerToken float64 `json:"charsPerToken,omitempty"`
+}
+
+// Table is model metadata keyed by model name. A name that ends with "*" is a prefix that matches all the models that
+// start with it.
+type Table map[string]Info
+
+// Default is the metadata of the well-known models. The models that share a prefix with models of different limits, like
+// the gpt-4 ones, are listed by their exact names, so that the other models with the prefix are not given wrong limits.
+var Default = Table{
+	"gpt-5*":               {ContextWindow: 400_000, MaxOutputTokens: 128_000, Encoding: "o200k_base"},
+	"gpt-4.1*":             {ContextWindow: 1_047_576, MaxOutputTokens: 32_768, Encoding: "o200k_base"},
+	"gpt-4o*":              {ContextWindow: 128_000, MaxOutputTokens: 16_384, Encoding: "o200k_base"},
+	"gpt-4-turbo*":         {ContextWindow: 128_000, MaxOutputTokens: 4_096, Encoding: "cl100k_base"},
+	"gpt-4-1106-preview":   {ContextWindow: 128_000, MaxOutputTokens: 4_096, Encoding: "cl100k_base"},
+	"gpt-4-0125-preview":   {ContextWindow: 128_000, MaxOutputTokens: 4_096, Encoding: "cl100k_base"},
+	"gpt-4-vision-preview": {ContextWindow: 128_000, MaxOutputTokens: 4_096, Encoding: "cl100k_base"},
+	"gpt-4-32k*":           {ContextWindow: 32_768, MaxOutputTokens: 8_192, Encoding: "cl100k_base"},
+	"gpt-4":                {ContextWindow: 8_192, MaxOutputTokens: 8_192, Encoding: "cl100k_base"},
+	"gpt-4-0314":           {ContextWindow: 8_192, MaxOutputTokens: 8_192, Encoding: "cl100k_base"},
+	"gpt-4-0613":           {ContextWindow: 8_192, MaxOutputTokens: 8_192, Encoding: "cl100k_base"},
+	"gpt-3.5-turbo*":       {ContextWindow: 16_385, MaxOutputTokens: 4_096, Encoding: "cl100k_base"},
+	"o1*":                  {ContextWindow: 200_000, MaxOutputTokens: 100_000, Encoding: "o200k_base"},
+	"o3*":                  {ContextWindow: 200_000, MaxOutputTokens: 100_000, Encoding: "o200k_base"},
+	"o4-mini*":             {ContextWindow: 200_000, MaxOutputTokens: 100_000, Encoding: "o200k_base"},
+	"claude-*":             {ContextWindow: 200_000, MaxOutputTokens: 8_192, CharsPerToken: 3.5},
+	"gemini-*":             {ContextWindow: 1_048_576, MaxOutputTokens: 8_192, CharsPerToken: 4},
+}
+
+// LoadTable reads a JSON or YAML table of model metadata from a file.
+func LoadTable(file string) (Table, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model table %s: %w", file, err)
+	}
+
+	var table Table
+	if err := yaml.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse model table %s: %w", file, err)
+	}
+	return table, nil
+}
+
+// Lookup returns the metadata of the model by its name, or else by the longest prefix that matches it.
+func (t Table) Lookup(model string) (Info, bool) {
+	// Models from a provider are referenced as "model from provider", fall back to the bare model name.
+	name, _, _ := strings.Cut(model, " from ")
+	name = strings.TrimSpace(name)
+
+	if info, ok := t[name]; ok {
+		return info, true
+	}
+
+	var (
+		result  Info
+		longest = -1
+	)
+	for key, info := range t {
+		prefix, ok := strings.CutSuffix(key, "*")
+		if ok && strings.HasPrefix(name, prefix) && len(prefix) > longest {
+			result, longest = info, len(prefix)
+		}
+	}
+	return result, longest >= 0
+}
+
+// Tokenizer counts the tokens of text.
+type Tokenizer interface {
+	Count(text string) int
+}
+
+type encodingTokenizer struct {
+	encoding *tiktoken.Tiktoken
+}
+
+func (e encodingTokenizer) Count(text string) int {
+	return len(e.encoding.Encode(text, nil, nil))
+}
+
+type charsTokenizer struct {
+	charsPerToken float64
+}
+
+func (c charsTokenizer) Count(text string) int {
+	return int(math.Ceil(float64(utf8.RuneCountInString(text)) / c.charsPerToken))
+}
+
+// Registry returns the metadata and tokenizers of models.
+type Registry struct {
+	table         Table
+	charsPerToken float64
+
+	lock      sync.Mutex
+	encodings map[string]*tiktoken.Tiktoken
+}
+
+// NewRegistry returns a registry of the default models and the models of the tables, which override the default ones.
+// The tokens of the models without a tokenizer are estimated with charsPerToken, or DefaultCharsPerToken if it is 0.
+func NewRegistry(charsPerToken float64, tables ...Table) *Registry {
+	table := maps.Clone(Default)
+	for _, t := range tables {
+		maps.Copy(table, t)
+	}
+	if charsPerToken <= 0 {
+		charsPerToken = DefaultCharsPerToken
+	}
+	return &Registry{
+		table:         table,
+		charsPerToken: charsPerToken,
+		encodings:     map[string]*tiktoken.Tiktoken{},
+	}
+}
+
+// Load returns a registry with the models of the table in the file, if it is set.
+func Load(file string, charsPerToken float64) (*Registry, error) {
+	if file == "" {
+		return NewRegistry(charsPerToken), nil
+	}
+	table, err := LoadTable(file)
+	if err != nil {
+		return nil, err
+	}
+	return NewRegistry(charsPerToken, table), nil
+}
+
+// Info returns the metadata of the model.
+func (r *Registry) Info(model string) (Info, bool) {
+	return r.table.Lookup(model)
+}
+
+// TokenizerName describes the tokenizer of the model, which is either the name of its encoding or the characters per
+// token the tokens are estimated with.
+func (r *Registry) TokenizerName(model string) string {
+	info, _ := r.Info(model)
+	if info.Encoding != "" {
+		return info.Encoding
+	}
+	return fmt.Sprintf("~%g chars/token", cmp.Or(info.CharsPerToken, r.charsPerToken))
+}
+
+// Tokenizer returns the tokenizer of the model. If the encoding of the tokenizer is not known, the tokens are estimated
+// from the number of characters.
+func (r *Registry) Tokenizer(model string) (Tokenizer, error) {
+	info, _ := r.Info(model)
+	if info.Encoding == "" {
+		return charsTokenizer{
+			charsPerToken: cmp.Or(info.CharsPerToken, r.charsPerToken),
+		}, nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	encoding, ok := r.encodings[info.Encoding]
+	if !ok {
+		var err error
+		encoding, err = tiktoken.GetEncoding(info.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tokenizer %s of model %s: %w", info.Encoding, model, err)
+		}
+		r.encodings[info.Encoding] = encoding
+	}
+	return encodingTokenizer{
+		encoding: encoding,
+	}, nil
+}
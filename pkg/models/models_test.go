@@ -0,0 +1,95 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	r := NewRegistry(0)
+
+	info, ok := r.Info("gpt-4o-mini")
+	assert.True(t, ok)
+	assert.Equal(t, 128_000, info.ContextWindow)
+
+	// Models are matched by the prefixes of the table.
+	info, ok = r.Info("gpt-4-turbo-2024-04-09")
+	assert.True(t, ok)
+	assert.Equal(t, "cl100k_base", info.Encoding)
+	assert.Equal(t, 4_096, info.MaxOutputTokens)
+
+	info, ok = r.Info("gpt-4")
+	assert.True(t, ok)
+	assert.Equal(t, 8_192, info.ContextWindow)
+
+	info, ok = r.Info("gpt-4-0125-preview")
+	assert.True(t, ok)
+	assert.Equal(t, 128_000, info.ContextWindow)
+
+	// The gpt-4 models are listed by name, so an unknown one is not given the window of gpt-4.
+	_, ok = r.Info("gpt-4-custom")
+	assert.False(t, ok)
+
+	info, ok = r.Info("claude-sonnet-4 from github.com/gptscript-ai/claude3-anthropic-provider")
+	assert.True(t, ok)
+	assert.Equal(t, 200_000, info.ContextWindow)
+
+	_, ok = r.Info("llama3")
+	assert.False(t, ok)
+}
+
+func TestTokenizer(t *testing.T) {
+	r := NewRegistry(2)
+
+	tokenizer, err := r.Tokenizer("gpt-4o")
+	require.NoError(t, err)
+	assert.Equal(t, 2, tokenizer.Count("hello world"))
+
+	// Unknown models fall back to the characters per token of the registry.
+	tokenizer, err = r.Tokenizer("llama3")
+	require.NoError(t, err)
+	assert.Equal(t, 6, tokenizer.Count("hello world"))
+
+	// Known models without an encoding use their own characters per token.
+	tokenizer, err = r.Tokenizer("claude-sonnet-4")
+	require.NoError(t, err)
+	assert.Equal(t, 4, tokenizer.Count("hello world"))
+
+	assert.Equal(t, "o200k_base", r.TokenizerName("gpt-4o"))
+	assert.Equal(t, "~2 chars/token", r.TokenizerName("llama3"))
+	assert.Equal(t, "~3.5 chars/token", r.TokenizerName("claude-sonnet-4"))
+}
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "models.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+llama3*:
+  contextWindow: 8192
+  charsPerToken: 3
+gpt-4o:
+  contextWindow: 1000
+  encoding: bad
+`), 0644))
+
+	r, err := Load(file, 0)
+	require.NoError(t, err)
+
+	info, ok := r.Info("llama3.1")
+	assert.True(t, ok)
+	assert.Equal(t, 8192, info.ContextWindow)
+
+	tokenizer, err := r.Tokenizer("llama3.1")
+	require.NoError(t, err)
+	assert.Equal(t, 4, tokenizer.Count("hello world"))
+
+	// The table overrides the default models.
+	_, err = r.Tokenizer("gpt-4o")
+	assert.ErrorContains(t, err, "failed to load tokenizer bad of model gpt-4o")
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"), 0)
+	assert.ErrorContains(t, err, "failed to read model table")
+}
@@ -276,7 +276,41 @@ func (d *display) Event(event runner.Event) {
 			Request:      event.ChatRequest,
 			Response:     event.ChatResponse,
 			Cached:       event.ChatResponseCached,
+			Model:        event.Model,
 		})
+	case runner.EventTypeCompaction:
+		fields := []any{
+			"completionID", event.ChatCompletionID,
+			"strategy", event.Compaction.Strategy,
+			"messagesBefore", event.Compaction.MessagesBefore,
+			"messagesAfter", event.Compaction.MessagesAfter,
+		}
+		if event.Compaction.Fallback != "" {
+			fields = append(fields, "fallback", event.Compaction.Fallback, "error", event.Compaction.Error)
+		}
+		log.Fields(fields...).Infof("compact  [%s]", callName)
+	case runner.EventTypeQueue:
+		if event.Queue.Wait == 0 {
+			log.Fields(
+				"completionID", event.ChatCompletionID,
+				"provider", event.Queue.Provider,
+				"reason", event.Queue.Reason,
+			).Infof("queued   [%s]", callName)
+		} else {
+			log.Fields(
+				"completionID", event.ChatCompletionID,
+				"provider", event.Queue.Provider,
+				"reason", event.Queue.Reason,
+				"wait", event.Queue.Wait.String(),
+			).Infof("dequeued [%s]", callName)
+		}
+	case runner.EventTypeFallback:
+		log.Fields(
+			"from", event.Fallback.From,
+			"to", event.Fallback.To,
+			"reason", event.Fallback.Reason,
+			"error", event.Fallback.Error,
+		).Infof("fallback [%s]", callName)
 	case runner.EventTypeCallFinish:
 		d.livePrinter.progressEnd(currentCall)
 		d.livePrinter.end()
@@ -429,6 +463,7 @@ type message struct {
 	Request      any    `json:"request,omitempty"`
 	Response     any    `json:"response,omitempty"`
 	Cached       bool   `json:"cached,omitempty"`
+	Model        string `json:"model,omitempty"`
 }
 
 type call struct {
@@ -3,6 +3,7 @@ package monitor
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"strconv"
 	"strings"
@@ -151,6 +152,9 @@ func (f *fd) Stop(_ context.Context, output string, err error) {
 	if err != nil {
 		e.Err = err.Error()
 	}
+	if budgetErr := (*runner.ErrBudgetExceeded)(nil); errors.As(err, &budgetErr) {
+		e.BudgetExceeded = budgetErr
+	}
 
 	f.event(e)
 	f.factory.close()
@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"context"
+	"slices"
+
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+type multiFactory []runner.MonitorFactory
+
+// NewMultiFactory creates a monitor factory that sends the events of a run to all the given factories.
+func NewMultiFactory(factories ...runner.MonitorFactory) runner.MonitorFactory {
+	return multiFactory(factories)
+}
+
+func (m multiFactory) Start(ctx context.Context, prg *types.Program, env []string, input string) (runner.Monitor, error) {
+	var result multiMonitor
+	for _, factory := range m {
+		monitor, err := factory.Start(ctx, prg, env, input)
+		if err != nil {
+			result.Stop(ctx, "", err)
+			return nil, err
+		}
+		result = append(result, monitor)
+	}
+	return result, nil
+}
+
+func (m multiFactory) Pause() func() {
+	return pauseAll(m)
+}
+
+type multiMonitor []runner.Monitor
+
+func (m multiMonitor) Event(event runner.Event) {
+	for _, monitor := range m {
+		monitor.Event(event)
+	}
+}
+
+func (m multiMonitor) Pause() func() {
+	return pauseAll(m)
+}
+
+func (m multiMonitor) Stop(ctx context.Context, output string, err error) {
+	for _, monitor := range m {
+		monitor.Stop(ctx, output, err)
+	}
+}
+
+func pauseAll[T interface{ Pause() func() }](pausers []T) func() {
+	var unpause []func()
+	for _, p := range pausers {
+		unpause = append(unpause, p.Pause())
+	}
+	slices.Reverse(unpause)
+	return func() {
+		for _, f := range unpause {
+			f()
+		}
+	}
+}
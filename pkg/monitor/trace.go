@@ -0,0 +1,455 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/env"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/gptscript-ai/gptscript/pkg/version"
+)
+
+const (
+	defaultTraceServiceName = "gptscript"
+	defaultTraceTimeout     = 10 * time.Second
+
+	spanKindInternal = 1
+	spanKindClient   = 3
+
+	statusCodeOK    = 1
+	statusCodeError = 2
+)
+
+// TraceOptions configures the export of runs as OpenTelemetry traces using OTLP/HTTP with JSON encoding.
+type TraceOptions struct {
+	// Endpoint is the full URL that spans are posted to, for example http://localhost:4318/v1/traces.
+	Endpoint    string
+	Headers     map[string]string
+	ServiceName string
+	Timeout     time.Duration
+}
+
+// TraceOptionsFromEnv reads the trace options from the standard OTEL_* environment variables. The returned bool is
+// false if no OTLP endpoint is configured or the SDK is disabled.
+func TraceOptionsFromEnv(envs []string) (TraceOptions, bool) {
+	if strings.EqualFold(env.Getenv("OTEL_SDK_DISABLED", envs), "true") {
+		return TraceOptions{}, false
+	}
+
+	opts := TraceOptions{
+		Endpoint:    env.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", envs),
+		ServiceName: env.Getenv("OTEL_SERVICE_NAME", envs),
+		Headers:     parseHeaders(env.Getenv("OTEL_EXPORTER_OTLP_HEADERS", envs)),
+	}
+	if opts.Endpoint == "" {
+		if endpoint := env.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT", envs); endpoint != "" {
+			opts.Endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+		}
+	}
+	if opts.Endpoint == "" {
+		return TraceOptions{}, false
+	}
+
+	for k, v := range parseHeaders(env.Getenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS", envs)) {
+		opts.Headers[k] = v
+	}
+
+	timeout := env.Getenv("OTEL_EXPORTER_OTLP_TRACES_TIMEOUT", envs)
+	if timeout == "" {
+		timeout = env.Getenv("OTEL_EXPORTER_OTLP_TIMEOUT", envs)
+	}
+	if ms, err := strconv.Atoi(timeout); err == nil && ms > 0 {
+		opts.Timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	return opts, true
+}
+
+// parseHeaders parses headers in the "key1=value1,key2=value2" format of OTEL_EXPORTER_OTLP_HEADERS.
+func parseHeaders(s string) map[string]string {
+	result := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if unescaped, err := url.QueryUnescape(v); err == nil {
+			v = unescaped
+		}
+		if k != "" {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+type traceFactory struct {
+	opts   TraceOptions
+	client *http.Client
+}
+
+// NewTraceFactory creates a monitor factory that records each run as a trace. The run is the root span, every tool call
+// is a span nested under the call that invoked it, and every chat completion is a span under its call. The spans of a
+// run are exported when the run finishes.
+func NewTraceFactory(opts TraceOptions) runner.MonitorFactory {
+	if opts.ServiceName == "" {
+		opts.ServiceName = defaultTraceServiceName
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTraceTimeout
+	}
+	return &traceFactory{
+		opts: opts,
+		client: &http.Client{
+			Timeout: opts.Timeout,
+		},
+	}
+}
+
+func (t *traceFactory) Start(_ context.Context, prg *types.Program, _ []string, _ string) (runner.Monitor, error) {
+	m := &traceMonitor{
+		factory: t,
+		traceID: newID(16),
+		calls:   map[string]*span{},
+		chats:   map[string]*span{},
+	}
+
+	m.root = m.newSpan("run", "", time.Now(), spanKindInternal)
+	if prg != nil {
+		m.root.name = "run " + prg.Name
+		m.root.attr("gptscript.program.name", prg.Name)
+		if tool, ok := prg.ToolSet[prg.EntryToolID]; ok {
+			m.root.attr("gptscript.tool.name", tool.Name)
+			m.root.attr("gptscript.tool.id", tool.ID)
+		}
+	}
+
+	return m, nil
+}
+
+func (t *traceFactory) Pause() func() {
+	return func() {}
+}
+
+func (t *traceFactory) export(ctx context.Context, spans []*span) error {
+	data, err := json.Marshal(t.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.opts.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.opts.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d from %s: %s", resp.StatusCode, t.opts.Endpoint, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (t *traceFactory) request(spans []*span) otlpRequest {
+	result := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpKeyValue{
+						stringAttr("service.name", t.opts.ServiceName),
+						stringAttr("service.version", version.Get().String()),
+					},
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{
+							Name: "github.com/gptscript-ai/gptscript",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	scope := &result.ResourceSpans[0].ScopeSpans[0]
+	for _, s := range spans {
+		scope.Spans = append(scope.Spans, s.toOTLP())
+	}
+	return result
+}
+
+type traceMonitor struct {
+	factory *traceFactory
+	lock    sync.Mutex
+	traceID string
+	root    *span
+	calls   map[string]*span
+	chats   map[string]*span
+	spans   []*span
+}
+
+func (m *traceMonitor) newSpan(name, parentID string, start time.Time, kind int) *span {
+	s := &span{
+		traceID:  m.traceID,
+		spanID:   newID(8),
+		parentID: parentID,
+		name:     name,
+		kind:     kind,
+		start:    start,
+	}
+	m.spans = append(m.spans, s)
+	return s
+}
+
+func (m *traceMonitor) Event(event runner.Event) {
+	if event.CallContext == nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	callCtx := event.CallContext
+	switch event.Type {
+	case runner.EventTypeCallStart:
+		parent := m.root
+		if p, ok := m.calls[callCtx.ParentID]; ok {
+			parent = p
+		}
+
+		s := m.newSpan("call "+callCtx.ToolName, parent.spanID, event.Time, spanKindInternal)
+		s.attr("gptscript.call.id", callCtx.ID)
+		s.attr("gptscript.tool.name", callCtx.ToolName)
+		s.attr("gptscript.tool.id", callCtx.Tool.ID)
+		if callCtx.Tool.ModelName != "" {
+			s.attr("gen_ai.request.model", callCtx.Tool.ModelName)
+		}
+		if callCtx.ToolCategory != engine.NoCategory {
+			s.attr("gptscript.tool.category", string(callCtx.ToolCategory))
+		}
+		m.calls[callCtx.ID] = s
+	case runner.EventTypeChat:
+		parent, ok := m.calls[callCtx.ID]
+		if !ok {
+			parent = m.root
+		}
+
+		s, ok := m.chats[event.ChatCompletionID]
+		if !ok {
+			s = m.newSpan("chat "+callCtx.Tool.ModelName, parent.spanID, event.Time, spanKindClient)
+			s.attr("gptscript.chat.completion_id", event.ChatCompletionID)
+			s.attr("gen_ai.request.model", callCtx.Tool.ModelName)
+			m.chats[event.ChatCompletionID] = s
+		}
+		if event.ChatResponse == nil {
+			return
+		}
+
+		s.attr("gen_ai.usage.input_tokens", event.Usage.PromptTokens)
+		s.attr("gen_ai.usage.output_tokens", event.Usage.CompletionTokens)
+		s.attr("gptscript.cache.hit", event.ChatResponseCached)
+		if event.Model != "" {
+			s.attr("gen_ai.response.model", event.Model)
+		}
+		s.finish(event.Time, statusCodeOK, "")
+		delete(m.chats, event.ChatCompletionID)
+
+		for n := parent; n != nil; n = m.parentCall(n) {
+			n.usage.PromptTokens += event.Usage.PromptTokens
+			n.usage.CompletionTokens += event.Usage.CompletionTokens
+		}
+	case runner.EventTypeCallFinish:
+		if s, ok := m.calls[callCtx.ID]; ok {
+			s.finish(event.Time, statusCodeOK, "")
+		}
+	}
+}
+
+// parentCall returns the span of the call that made the call of the given span, or nil for the run.
+func (m *traceMonitor) parentCall(s *span) *span {
+	if s == m.root {
+		return nil
+	}
+	for _, call := range m.calls {
+		if call.spanID == s.parentID {
+			return call
+		}
+	}
+	return m.root
+}
+
+func (m *traceMonitor) Stop(ctx context.Context, _ string, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var (
+		now     = time.Now()
+		code    = statusCodeOK
+		message string
+	)
+	if err != nil {
+		code, message = statusCodeError, err.Error()
+	}
+
+	// Calls still open when the run stops were interrupted by the error that stopped it.
+	for _, s := range m.spans {
+		s.finish(now, code, message)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.factory.opts.Timeout)
+	defer cancel()
+
+	if err := m.factory.export(ctx, m.spans); err != nil {
+		log.Errorf("Failed to export trace: %v", err)
+	}
+}
+
+func (m *traceMonitor) Pause() func() {
+	return func() {}
+}
+
+type span struct {
+	traceID   string
+	spanID    string
+	parentID  string
+	name      string
+	kind      int
+	start     time.Time
+	end       time.Time
+	attrs     []otlpKeyValue
+	usage     types.Usage
+	status    int
+	statusMsg string
+}
+
+func (s *span) attr(key string, value any) {
+	switch v := value.(type) {
+	case string:
+		s.attrs = append(s.attrs, stringAttr(key, v))
+	case int:
+		s.attrs = append(s.attrs, otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: strconv.Itoa(v)}})
+	case bool:
+		s.attrs = append(s.attrs, otlpKeyValue{Key: key, Value: otlpAnyValue{BoolValue: &v}})
+	}
+}
+
+func (s *span) finish(end time.Time, code int, message string) {
+	if !s.end.IsZero() {
+		return
+	}
+	s.end = end
+	s.status = code
+	s.statusMsg = message
+	if s.kind == spanKindInternal && (s.usage.PromptTokens > 0 || s.usage.CompletionTokens > 0) {
+		s.attr("gen_ai.usage.input_tokens", s.usage.PromptTokens)
+		s.attr("gen_ai.usage.output_tokens", s.usage.CompletionTokens)
+	}
+}
+
+func (s *span) toOTLP() otlpSpan {
+	return otlpSpan{
+		TraceID:           s.traceID,
+		SpanID:            s.spanID,
+		ParentSpanID:      s.parentID,
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        s.attrs,
+		Status: otlpStatus{
+			Code:    s.status,
+			Message: s.statusMsg,
+		},
+	}
+}
+
+func newID(size int) string {
+	b := make([]byte, size)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func stringAttr(key, value string) otlpKeyValue {
+	return otlpKeyValue{
+		Key: key,
+		Value: otlpAnyValue{
+			StringValue: &value,
+		},
+	}
+}
+
+// The types below are the OTLP/HTTP JSON encoding of an ExportTraceServiceRequest. IDs are hex encoded and 64-bit
+// integers are strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    string  `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
@@ -0,0 +1,164 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceOptionsFromEnv(t *testing.T) {
+	_, ok := TraceOptionsFromEnv(nil)
+	require.False(t, ok)
+
+	opts, ok := TraceOptionsFromEnv([]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT=http://localhost:4318/",
+		"OTEL_EXPORTER_OTLP_HEADERS=authorization=Bearer%20token,x-a=b",
+		"OTEL_EXPORTER_OTLP_TRACES_HEADERS=x-a=c",
+		"OTEL_EXPORTER_OTLP_TIMEOUT=500",
+	})
+	require.True(t, ok)
+	require.Equal(t, TraceOptions{
+		Endpoint: "http://localhost:4318/v1/traces",
+		Headers: map[string]string{
+			"authorization": "Bearer token",
+			"x-a":           "c",
+		},
+		Timeout: 500 * time.Millisecond,
+	}, opts)
+
+	_, ok = TraceOptionsFromEnv([]string{
+		"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT=http://localhost:4318/v1/traces",
+		"OTEL_SDK_DISABLED=true",
+	})
+	require.False(t, ok)
+}
+
+func TestTrace(t *testing.T) {
+	var (
+		request otlpRequest
+		auth    string
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/traces", r.URL.Path)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		auth = r.Header.Get("Authorization")
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+	}))
+	defer collector.Close()
+
+	factory := NewTraceFactory(TraceOptions{
+		Endpoint: collector.URL + "/v1/traces",
+		Headers:  map[string]string{"Authorization": "token"},
+	})
+
+	prg := &types.Program{
+		Name:        "test.gpt",
+		EntryToolID: "main",
+		ToolSet: types.ToolSet{
+			"main": {ID: "main", ToolDef: types.ToolDef{Parameters: types.Parameters{Name: "main"}}},
+		},
+	}
+	m, err := factory.Start(context.Background(), prg, nil, "")
+	require.NoError(t, err)
+
+	callCtx := func(id, parentID, name string, category engine.ToolCategory) *engine.CallContext {
+		c := &engine.CallContext{
+			ToolName: name,
+			ParentID: parentID,
+		}
+		c.ID = id
+		c.Tool.ID = name + ".gpt:" + name
+		c.Tool.ModelName = "gpt-4o"
+		c.ToolCategory = category
+		return c
+	}
+
+	now := time.Now()
+	main := callCtx("1", "", "main", engine.NoCategory)
+	cred := callCtx("2", "1", "cred", engine.CredentialToolCategory)
+	for i, event := range []runner.Event{
+		{Type: runner.EventTypeCallStart, CallContext: main},
+		{Type: runner.EventTypeCallStart, CallContext: cred},
+		{Type: runner.EventTypeChat, CallContext: cred, ChatCompletionID: "c1", ChatRequest: "req"},
+		{Type: runner.EventTypeChat, CallContext: cred, ChatCompletionID: "c1", ChatResponse: "resp", ChatResponseCached: true,
+			Usage: types.Usage{PromptTokens: 10, CompletionTokens: 5}},
+		{Type: runner.EventTypeCallFinish, CallContext: cred},
+		{Type: runner.EventTypeChat, CallContext: main, ChatCompletionID: "c2", ChatRequest: "req"},
+	} {
+		event.Time = now.Add(time.Duration(i) * time.Second)
+		m.Event(event)
+	}
+	m.Stop(context.Background(), "", errors.New("boom"))
+
+	require.Equal(t, "token", auth)
+	require.Len(t, request.ResourceSpans, 1)
+	require.Equal(t, "gptscript", *request.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+
+	spans := map[string]otlpSpan{}
+	for _, s := range request.ResourceSpans[0].ScopeSpans[0].Spans {
+		spans[s.Name] = s
+	}
+	require.Len(t, spans, 4)
+
+	run, call, credCall, chat := spans["run test.gpt"], spans["call main"], spans["call cred"], spans["chat gpt-4o"]
+	require.Empty(t, run.ParentSpanID)
+	require.Equal(t, run.SpanID, call.ParentSpanID)
+	require.Equal(t, call.SpanID, credCall.ParentSpanID)
+	for _, s := range spans {
+		require.Equal(t, run.TraceID, s.TraceID)
+	}
+
+	attrs := func(s otlpSpan) map[string]any {
+		result := map[string]any{}
+		for _, kv := range s.Attributes {
+			switch {
+			case kv.Value.StringValue != nil:
+				result[kv.Key] = *kv.Value.StringValue
+			case kv.Value.BoolValue != nil:
+				result[kv.Key] = *kv.Value.BoolValue
+			default:
+				result[kv.Key] = kv.Value.IntValue
+			}
+		}
+		return result
+	}
+
+	require.Equal(t, map[string]any{
+		"gptscript.call.id":          "2",
+		"gptscript.tool.name":        "cred",
+		"gptscript.tool.id":          "cred.gpt:cred",
+		"gptscript.tool.category":    "credential",
+		"gen_ai.request.model":       "gpt-4o",
+		"gen_ai.usage.input_tokens":  "10",
+		"gen_ai.usage.output_tokens": "5",
+	}, attrs(credCall))
+	require.Equal(t, statusCodeOK, credCall.Status.Code)
+
+	// The interrupted call and the chat that never got a response end with the error of the run.
+	require.Equal(t, statusCodeError, call.Status.Code)
+	require.Equal(t, "boom", call.Status.Message)
+	require.Equal(t, "10", attrs(call)["gen_ai.usage.input_tokens"])
+	require.Equal(t, statusCodeError, run.Status.Code)
+	require.Equal(t, "10", attrs(run)["gen_ai.usage.input_tokens"])
+	require.Equal(t, "c2", attrs(chat)["gptscript.chat.completion_id"])
+	require.Equal(t, spanKindClient, chat.Kind)
+	require.Equal(t, statusCodeError, chat.Status.Code)
+
+	var cachedChat bool
+	for _, s := range request.ResourceSpans[0].ScopeSpans[0].Spans {
+		if attrs(s)["gptscript.chat.completion_id"] == "c1" {
+			cachedChat = attrs(s)["gptscript.cache.hit"].(bool)
+			require.Equal(t, credCall.SpanID, s.ParentSpanID)
+		}
+	}
+	require.True(t, cachedChat)
+}
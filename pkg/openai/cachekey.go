@@ -0,0 +1,142 @@
+package openai
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// NormalizedCacheKeyVersion is part of every normalized cache key. It changes whenever the normalization changes which
+// requests share a key, so that the responses that were cached with the old normalization are no longer hit.
+const NormalizedCacheKeyVersion = "n1"
+
+func (c *Client) cacheKey(opts types.CacheKeyOptions, request chatCompletionRequest) any {
+	if !opts.Normalize {
+		return map[string]any{
+			"base":    c.cacheKeyBase,
+			"request": request,
+		}
+	}
+	return map[string]any{
+		"base":    c.cacheKeyBase,
+		"version": NormalizedCacheKeyVersion,
+		"request": normalizeRequest(opts, request),
+	}
+}
+
+// normalizeRequest returns a copy of the request without the differences that don't change the response of the model:
+// the IDs of tool calls, the seed that is derived from the messages, the whitespace around the text of the messages, the
+// order of the tools and of the keys of JSON objects, and, if the options ignore them, the descriptions of the tools.
+func normalizeRequest(opts types.CacheKeyOptions, request chatCompletionRequest) chatCompletionRequest {
+	request.Seed = nil
+
+	request.Messages = slices.Clone(request.Messages)
+	for i, msg := range request.Messages {
+		msg.Content = normalizeText(opts, msg.Content)
+		msg.MultiContent = slices.Clone(msg.MultiContent)
+		for j, part := range msg.MultiContent {
+			msg.MultiContent[j].Text = normalizeText(opts, part.Text)
+		}
+		msg.ToolCallID = ""
+		msg.ToolCalls = slices.Clone(msg.ToolCalls)
+		for j, call := range msg.ToolCalls {
+			call.ID = ""
+			call.Function.Arguments = normalizeJSON(call.Function.Arguments)
+			msg.ToolCalls[j] = call
+		}
+		request.Messages[i] = msg
+	}
+
+	request.Tools = slices.Clone(request.Tools)
+	for i, tool := range request.Tools {
+		if tool.Function == nil {
+			continue
+		}
+		function := *tool.Function
+		function.Parameters = normalizeSchema(opts, function.Parameters)
+		if opts.IgnoreDescriptions {
+			function.Description = ""
+		}
+		request.Tools[i].Function = &function
+	}
+	if !opts.KeepToolOrder {
+		slices.SortStableFunc(request.Tools, func(a, b openai.Tool) int {
+			return strings.Compare(toolName(a), toolName(b))
+		})
+	}
+
+	return request
+}
+
+func toolName(tool openai.Tool) string {
+	if tool.Function == nil {
+		return ""
+	}
+	return tool.Function.Name
+}
+
+// normalizeText trims the whitespace around the text, and collapses the whitespace inside it only if the options ask for
+// it, since the whitespace inside a prompt can change the response.
+func normalizeText(opts types.CacheKeyOptions, text string) string {
+	switch {
+	case opts.KeepWhitespace:
+		return text
+	case opts.CollapseWhitespace:
+		return strings.Join(strings.Fields(text), " ")
+	default:
+		return strings.TrimSpace(text)
+	}
+}
+
+// normalizeJSON sorts the keys of the objects of a JSON document, and returns text that is not JSON as is.
+func normalizeJSON(text string) string {
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return text
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return text
+	}
+	return string(data)
+}
+
+// normalizeSchema converts the JSON schema of the parameters of a tool to plain JSON values, without the descriptions
+// if the options ignore them.
+func normalizeSchema(opts types.CacheKeyOptions, schema any) any {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return schema
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return schema
+	}
+	if opts.IgnoreDescriptions {
+		value = removeDescriptions(value)
+	}
+	return value
+}
+
+// removeDescriptions removes the "description" strings of a JSON schema. A property that is named description is an
+// object, so it is kept.
+func removeDescriptions(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if _, ok := child.(string); ok && key == "description" {
+				delete(v, key)
+				continue
+			}
+			v[key] = removeDescriptions(child)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = removeDescriptions(child)
+		}
+	}
+	return value
+}
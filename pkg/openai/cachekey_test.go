@@ -0,0 +1,134 @@
+package openai
+
+import (
+	"context"
+	"testing"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func keyRequest(description, content, callID string, tools ...string) chatCompletionRequest {
+	request := openai.ChatCompletionRequest{
+		Model: "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "You are a helpful assistant."},
+			{Role: openai.ChatMessageRoleUser, Content: content},
+			{
+				Role: openai.ChatMessageRoleAssistant,
+				ToolCalls: []openai.ToolCall{
+					{ID: callID, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "read", Arguments: `{"b": 2, "a": 1}`}},
+				},
+			},
+			{Role: openai.ChatMessageRoleTool, ToolCallID: callID, Content: "done"},
+		},
+		Seed: ptr(len(content)),
+	}
+	for _, tool := range tools {
+		request.Tools = append(request.Tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool,
+				Description: description,
+				Parameters: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"path": map[string]any{"type": "string", "description": description},
+						// A parameter that is named description is not a description.
+						"description": map[string]any{"type": "string"},
+					},
+				},
+			},
+		})
+	}
+	return chatCompletionRequest{ChatCompletionRequest: request}
+}
+
+func TestNormalizedCacheKey(t *testing.T) {
+	ctx := context.Background()
+
+	// same tells whether the response to request a is a cache hit for request b.
+	same := func(directive string, a, b chatCompletionRequest) bool {
+		c := newTestClient(t, Options{Cache: newTestCache(t)})
+		opts, err := types.ParseCacheKey(directive)
+		require.NoError(t, err)
+
+		require.NoError(t, c.cache.Store(ctx, cache.KindLLM, c.cacheKey(opts, a), "response"))
+		var response string
+		found, err := c.cache.Get(ctx, c.cacheKey(opts, b), &response)
+		require.NoError(t, err)
+		return found
+	}
+
+	base := keyRequest("Reads a file", "Summarize the file.", "call_1", "read", "write")
+	variant := keyRequest("Reads a file", "  Summarize the file.\n", "call_2", "write", "read")
+	variant.Messages[2].ToolCalls[0].Function.Arguments = `{"a":1,"b":2}`
+
+	assert.False(t, same("", base, variant))
+	assert.False(t, same("exact", base, variant))
+	assert.True(t, same("normalized", base, variant))
+	assert.False(t, same("normalized keep-whitespace", base, variant))
+	assert.True(t, same("normalized collapse-whitespace", base, variant))
+	assert.False(t, same("normalized keep-tool-order", base, variant))
+
+	// The whitespace inside the text of the messages is kept unless the options collapse it.
+	spaced := keyRequest("Reads a file", "Summarize\n\n    the file.", "call_1", "read", "write")
+	assert.False(t, same("normalized", base, spaced))
+	assert.True(t, same("normalized collapse-whitespace", base, spaced))
+
+	described := keyRequest("Reads a file from the workspace", "Summarize the file.", "call_1", "read", "write")
+	assert.False(t, same("normalized", base, described))
+	assert.True(t, same("normalized ignore-descriptions", base, described))
+
+	// The content of the messages is never ignored.
+	other := keyRequest("Reads a file", "Translate the file.", "call_1", "read", "write")
+	assert.False(t, same("normalized ignore-descriptions", base, other))
+
+	// The JSON schema of the response format is part of the key.
+	city := keyRequest("Reads a file", "Summarize the file.", "call_1", "read", "write")
+	city.ResponseFormat = &responseFormat{
+		Type:       responseFormatTypeJSONSchema,
+		JSONSchema: &jsonSchemaFormat{Name: "output", Schema: types.ObjectSchema("city", "The city"), Strict: true},
+	}
+	country := city
+	country.ResponseFormat = &responseFormat{
+		Type:       responseFormatTypeJSONSchema,
+		JSONSchema: &jsonSchemaFormat{Name: "output", Schema: types.ObjectSchema("country", "The country"), Strict: true},
+	}
+	assert.False(t, same("", city, country))
+	assert.False(t, same("normalized", city, country))
+	assert.True(t, same("normalized", city, city))
+
+	// Normalizing doesn't change the request that is sent.
+	assert.Equal(t, "  Summarize the file.\n", variant.Messages[1].Content)
+	assert.Equal(t, "call_2", variant.Messages[2].ToolCalls[0].ID)
+	assert.Equal(t, "write", variant.Tools[0].Function.Name)
+	assert.Equal(t, "Reads a file from the workspace", described.Tools[0].Function.Parameters.(map[string]any)["properties"].(map[string]any)["path"].(map[string]any)["description"])
+}
+
+// TestExactCacheKey checks that the exact keys did not change when the normalized keys were added, so that the responses
+// that are already cached are still hit.
+func TestExactCacheKey(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, Options{Cache: newTestCache(t)})
+	request := keyRequest("Reads a file", "Summarize the file.", "call_1", "read")
+
+	require.NoError(t, c.cache.Store(ctx, cache.KindLLM, map[string]any{
+		"base":    c.cacheKeyBase,
+		"request": request,
+	}, "response"))
+
+	var response string
+	found, err := c.cache.Get(ctx, c.cacheKey(types.CacheKeyOptions{}, request), &response)
+	require.NoError(t, err)
+	assert.True(t, found)
+}
+
+func newTestCache(t *testing.T) *cache.Client {
+	c, err := cache.New(cache.Options{CacheDir: t.TempDir()})
+	require.NoError(t, err)
+	return c
+}
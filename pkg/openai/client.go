@@ -5,6 +5,8 @@ import (
 	"errors"
 	"io"
 	"log/slog"
+	"maps"
+	"net/http"
 	"os"
 	"slices"
 	"sort"
@@ -17,8 +19,10 @@ import (
 	"github.com/gptscript-ai/gptscript/pkg/credentials"
 	"github.com/gptscript-ai/gptscript/pkg/engine"
 	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/models"
 	"github.com/gptscript-ai/gptscript/pkg/mvl"
 	"github.com/gptscript-ai/gptscript/pkg/prompt"
+	"github.com/gptscript-ai/gptscript/pkg/ratelimit"
 	"github.com/gptscript-ai/gptscript/pkg/system"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 )
@@ -49,6 +53,8 @@ type Client struct {
 	cacheKeyBase string
 	setSeed      bool
 	credStore    credentials.CredentialStore
+	compactors   map[string]Compactor
+	models       *models.Registry
 }
 
 type Options struct {
@@ -60,6 +66,13 @@ type Options struct {
 	SetSeed      bool   `usage:"-"`
 	CacheKey     string `usage:"-"`
 	Cache        *cache.Client
+	// Compactors are context compaction strategies by name, in addition to the built-in ones.
+	Compactors map[string]Compactor `usage:"-" json:"-"`
+
+	ModelTable    string  `usage:"Path to a JSON or YAML file of the context windows, max output tokens and tokenizers of models"`
+	CharsPerToken float64 `usage:"Characters per token used to estimate the tokens of models without a known tokenizer (default 4)"`
+	// Models are the metadata and tokenizers of the models. If not set, they are loaded from ModelTable.
+	Models *models.Registry `json:"-"`
 }
 
 func Complete(opts ...Options) (result Options) {
@@ -71,6 +84,15 @@ func Complete(opts ...Options) (result Options) {
 		result.DefaultModel = types.FirstSet(opt.DefaultModel, result.DefaultModel)
 		result.SetSeed = types.FirstSet(opt.SetSeed, result.SetSeed)
 		result.CacheKey = types.FirstSet(opt.CacheKey, result.CacheKey)
+		result.ModelTable = types.FirstSet(opt.ModelTable, result.ModelTable)
+		result.CharsPerToken = types.FirstSet(opt.CharsPerToken, result.CharsPerToken)
+		result.Models = types.FirstSet(opt.Models, result.Models)
+		if opt.Compactors != nil {
+			if result.Compactors == nil {
+				result.Compactors = map[string]Compactor{}
+			}
+			maps.Copy(result.Compactors, opt.Compactors)
+		}
 	}
 
 	return result
@@ -85,6 +107,10 @@ func complete(opts ...Options) (Options, error) {
 		})
 	}
 
+	if err == nil && result.Models == nil {
+		result.Models, err = models.Load(result.ModelTable, result.CharsPerToken)
+	}
+
 	if result.BaseURL == "" && url != "" {
 		result.BaseURL = url
 	}
@@ -116,13 +142,18 @@ func NewClient(ctx context.Context, credStore credentials.CredentialStore, opts
 	cfg := openai.DefaultConfig(opt.APIKey)
 	cfg.BaseURL = types.FirstSet(opt.BaseURL, cfg.BaseURL)
 	cfg.OrgID = types.FirstSet(opt.OrgID, cfg.OrgID)
+	cfg.HTTPClient = &http.Client{
+		Transport: &responseFormatTransport{
+			base: http.DefaultTransport,
+		},
+	}
 
 	cacheKeyBase := opt.CacheKey
 	if cacheKeyBase == "" {
 		cacheKeyBase = hash.ID(opt.APIKey, opt.BaseURL)
 	}
 
-	return &Client{
+	client := &Client{
 		c:            openai.NewClientWithConfig(cfg),
 		cache:        opt.Cache,
 		defaultModel: opt.DefaultModel,
@@ -130,7 +161,12 @@ func NewClient(ctx context.Context, credStore credentials.CredentialStore, opts
 		invalidAuth:  opt.APIKey == "" && opt.BaseURL == "",
 		setSeed:      opt.SetSeed,
 		credStore:    credStore,
-	}, nil
+		models:       opt.Models,
+	}
+	client.compactors = defaultCompactors(client)
+	maps.Copy(client.compactors, opt.Compactors)
+
+	return client, nil
 }
 
 func (c *Client) ProxyInfo([]string) (token, urlBase string) {
@@ -147,6 +183,11 @@ func (c *Client) ValidAuth() error {
 	return nil
 }
 
+// ProviderName returns the name of the provider of the models of the client, which is openai.
+func (c *Client) ProviderName(string) string {
+	return "openai"
+}
+
 func (c *Client) Supports(ctx context.Context, modelName string) (bool, error) {
 	models, err := c.ListModels(ctx)
 	if err != nil {
@@ -191,14 +232,7 @@ func (c *Client) ListModels(ctx context.Context, providers ...string) ([]openai.
 	return models.Models, nil
 }
 
-func (c *Client) cacheKey(request openai.ChatCompletionRequest) any {
-	return map[string]any{
-		"base":    c.cacheKeyBase,
-		"request": request,
-	}
-}
-
-func (c *Client) seed(request openai.ChatCompletionRequest) int {
+func (c *Client) seed(request chatCompletionRequest) int {
 	newRequest := request
 	newRequest.Messages = nil
 
@@ -217,11 +251,11 @@ func (c *Client) seed(request openai.ChatCompletionRequest) int {
 	return hash.Seed(newRequest)
 }
 
-func (c *Client) fromCache(ctx context.Context, messageRequest types.CompletionRequest, request openai.ChatCompletionRequest) (result types.CompletionMessage, _ bool, _ error) {
+func (c *Client) fromCache(ctx context.Context, messageRequest types.CompletionRequest, keyOpts types.CacheKeyOptions, request chatCompletionRequest) (result types.CompletionMessage, _ bool, _ error) {
 	if !messageRequest.GetCache() {
 		return types.CompletionMessage{}, false, nil
 	}
-	found, err := c.cache.Get(ctx, c.cacheKey(request), &result)
+	found, err := c.cache.Get(ctx, c.cacheKey(keyOpts, request), &result)
 	if err != nil {
 		return types.CompletionMessage{}, false, err
 	} else if !found {
@@ -349,29 +383,45 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 		return nil, err
 	}
 
-	toolTokenCount, err := countTools(messageRequest.Tools)
+	tokenizer, err := c.models.Tokenizer(messageRequest.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	toolTokenCount, err := countTools(tokenizer, messageRequest.Tools)
 	if err != nil {
 		return nil, err
 	}
 
+	id := counter.Next()
+	info, _ := c.models.Info(messageRequest.Model)
+	maxTokens := contextBudget(info, messageRequest.MaxTokens)
+
+	// The usage of compacting the messages is part of the usage of the completion.
+	var compactionUsage types.Usage
 	if messageRequest.Chat {
 		// Check the last message. If it is from a tool call, and if it takes up more than 80% of the budget on its own, reject it.
 		lastMessage := msgs[len(msgs)-1]
-		lastMessageCount, err := countMessage(lastMessage)
-		if err != nil {
-			return nil, err
-		}
+		lastMessageCount := countMessage(tokenizer, lastMessage)
 
-		if lastMessage.Role == string(types.CompletionMessageRoleTypeTool) && lastMessageCount+toolTokenCount > int(float64(getBudget(messageRequest.MaxTokens))*0.8) {
+		if lastMessage.Role == string(types.CompletionMessageRoleTypeTool) && lastMessageCount+toolTokenCount > int(float64(maxTokens)*0.8) {
 			// We need to update it in the msgs slice for right now and in the messageRequest for future calls.
 			msgs[len(msgs)-1].Content = TooLongMessage
 			messageRequest.Messages[len(messageRequest.Messages)-1].Content = types.Text(TooLongMessage)
 		}
 
-		msgs, err = dropMessagesOverCount(messageRequest.MaxTokens, toolTokenCount, msgs)
+		var compaction *types.Compaction
+		msgs, compaction, err = c.compact(ctx, messageRequest, env, tokenizer, maxTokens, toolTokenCount, msgs)
 		if err != nil {
 			return nil, err
 		}
+		if compaction != nil {
+			compactionUsage = compaction.Usage
+			status <- types.CompletionStatus{
+				CompletionID: id,
+				Compaction:   compaction,
+			}
+		}
 	}
 
 	if len(msgs) == 0 {
@@ -382,10 +432,12 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 		}, nil
 	}
 
-	request := openai.ChatCompletionRequest{
-		Model:     messageRequest.Model,
-		Messages:  msgs,
-		MaxTokens: messageRequest.MaxTokens,
+	request := chatCompletionRequest{
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model:     messageRequest.Model,
+			Messages:  msgs,
+			MaxTokens: messageRequest.MaxTokens,
+		},
 	}
 
 	if messageRequest.Temperature == nil {
@@ -394,8 +446,17 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 		request.Temperature = messageRequest.Temperature
 	}
 
-	if messageRequest.JSONResponse {
-		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+	if messageRequest.OutputSchema != nil {
+		request.ResponseFormat = &responseFormat{
+			Type: responseFormatTypeJSONSchema,
+			JSONSchema: &jsonSchemaFormat{
+				Name:   "output",
+				Schema: types.StrictSchema(messageRequest.OutputSchema),
+				Strict: true,
+			},
+		}
+	} else if messageRequest.JSONResponse {
+		request.ResponseFormat = &responseFormat{
 			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
 		}
 	}
@@ -424,7 +485,6 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 		})
 	}
 
-	id := counter.Next()
 	status <- types.CompletionStatus{
 		CompletionID: id,
 		Request: map[string]any{
@@ -440,19 +500,23 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 			IncludeUsage: true,
 		}
 	}
-	result, ok, err := c.fromCache(ctx, messageRequest, request)
+	keyOpts, err := types.ParseCacheKey(messageRequest.CacheKey)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok, err := c.fromCache(ctx, messageRequest, keyOpts, request)
 	if err != nil {
 		return nil, err
 	} else if !ok {
-		result, err = c.call(ctx, request, id, env, status)
+		result, err = c.call(ctx, request, keyOpts, id, env, status)
 
 		// If we got back a context length exceeded error, keep retrying and shrinking the message history until we pass.
 		var apiError *openai.APIError
 		if errors.As(err, &apiError) && apiError.Code == "context_length_exceeded" && messageRequest.Chat {
 			// Decrease maxTokens by 10% to make garbage collection more aggressive.
 			// The retry loop will further decrease maxTokens if needed.
-			maxTokens := decreaseTenPercent(messageRequest.MaxTokens)
-			result, err = c.contextLimitRetryLoop(ctx, request, id, env, maxTokens, toolTokenCount, status)
+			result, err = c.contextLimitRetryLoop(ctx, messageRequest, request, keyOpts, id, env, tokenizer, decreaseTenPercent(maxTokens), toolTokenCount, status)
 		}
 		if err != nil {
 			return nil, err
@@ -475,6 +539,7 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 	if cacheResponse {
 		result.Usage = types.Usage{}
 	}
+	result.Usage = addUsage(result.Usage, compactionUsage)
 
 	status <- types.CompletionStatus{
 		CompletionID: id,
@@ -486,21 +551,31 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 	return &result, nil
 }
 
-func (c *Client) contextLimitRetryLoop(ctx context.Context, request openai.ChatCompletionRequest, id string, env []string, maxTokens int, toolTokenCount int, status chan<- types.CompletionStatus) (types.CompletionMessage, error) {
+func (c *Client) contextLimitRetryLoop(ctx context.Context, messageRequest types.CompletionRequest, request chatCompletionRequest, keyOpts types.CacheKeyOptions, id string, env []string, tokenizer models.Tokenizer, maxTokens int, toolTokenCount int, status chan<- types.CompletionStatus) (types.CompletionMessage, error) {
 	var (
-		response types.CompletionMessage
-		err      error
+		response   types.CompletionMessage
+		compaction *types.Compaction
+		usage      types.Usage
+		err        error
 	)
 
 	for range 10 { // maximum 10 tries
-		// Try to drop older messages again, with a decreased max tokens.
-		request.Messages, err = dropMessagesOverCount(maxTokens, toolTokenCount, request.Messages)
+		// Try to compact the messages again, with a decreased max tokens.
+		request.Messages, compaction, err = c.compact(ctx, messageRequest, env, tokenizer, maxTokens, toolTokenCount, request.Messages)
 		if err != nil {
 			return types.CompletionMessage{}, err
 		}
+		if compaction != nil {
+			usage = addUsage(usage, compaction.Usage)
+			status <- types.CompletionStatus{
+				CompletionID: id,
+				Compaction:   compaction,
+			}
+		}
 
-		response, err = c.call(ctx, request, id, env, status)
+		response, err = c.call(ctx, request, keyOpts, id, env, status)
 		if err == nil {
+			response.Usage = addUsage(response.Usage, usage)
 			return response, nil
 		}
 
@@ -591,7 +666,7 @@ func override(left, right string) string {
 
 const WaitingMessage = "Waiting for model response..."
 
-func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest, transactionID string, env []string, partial chan<- types.CompletionStatus) (types.CompletionMessage, error) {
+func (c *Client) call(ctx context.Context, request chatCompletionRequest, keyOpts types.CacheKeyOptions, transactionID string, env []string, partial chan<- types.CompletionStatus) (result types.CompletionMessage, err error) {
 	streamResponse := os.Getenv("GPTSCRIPT_INTERNAL_OPENAI_STREAMING") != "false"
 
 	partial <- types.CompletionStatus{
@@ -602,6 +677,19 @@ func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest,
 		},
 	}
 
+	release, err := ratelimit.Acquire(ctx, c.countRequest(request.ChatCompletionRequest), func(queue types.Queue) {
+		partial <- types.CompletionStatus{
+			CompletionID: transactionID,
+			Queue:        &queue,
+		}
+	})
+	if err != nil {
+		return types.CompletionMessage{}, err
+	}
+	defer func() {
+		release(result.Usage)
+	}()
+
 	var (
 		headers          map[string]string
 		modelProviderEnv []string
@@ -637,9 +725,10 @@ func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest,
 		engineCtx.OnUserCancel(ctx, cancel)
 	}
 
+	ctx, clientRequest := request.clientRequest(ctx)
 	if !streamResponse {
-		request.StreamOptions = nil
-		resp, err := c.c.CreateChatCompletion(ctx, request, headers, retryOpts...)
+		clientRequest.StreamOptions = nil
+		resp, err := c.c.CreateChatCompletion(ctx, clientRequest, headers, retryOpts...)
 		if err != nil {
 			if errors.Is(err, context.Canceled) {
 				err = nil
@@ -666,7 +755,7 @@ func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest,
 			},
 		}), nil
 	}
-	stream, err := c.c.CreateChatCompletionStream(ctx, request, headers, retryOpts...)
+	stream, err := c.c.CreateChatCompletionStream(ctx, clientRequest, headers, retryOpts...)
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			return types.CompletionMessage{
@@ -696,7 +785,7 @@ func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest,
 			}
 			// If the stream is finished, either because we got an EOF or the context was canceled,
 			// then we're done. The cache won't save the response if the context was canceled.
-			return partialMessage, c.cache.Store(ctx, c.cacheKey(request), partialMessage)
+			return partialMessage, c.cache.Store(ctx, cache.KindLLM, c.cacheKey(keyOpts, request), partialMessage)
 		} else if err != nil {
 			return types.CompletionMessage{}, err
 		}
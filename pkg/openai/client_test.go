@@ -1,12 +1,18 @@
 package openai
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	openai "github.com/gptscript-ai/chat-completion-client"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"github.com/hexops/autogold/v2"
 	"github.com/hexops/valast"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTextToMultiContent(t *testing.T) {
@@ -86,3 +92,72 @@ func Test_appendMessage(t *testing.T) {
 		},
 	}))
 }
+
+func TestCallOutputSchema(t *testing.T) {
+	t.Setenv("GPTSCRIPT_INTERNAL_OPENAI_STREAMING", "false")
+
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{
+					Message: openai.ChatCompletionMessage{
+						Role:    openai.ChatMessageRoleAssistant,
+						Content: `{"city":"Paris","population":null}`,
+					},
+				},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	status := make(chan types.CompletionStatus)
+	go func() {
+		for range status {
+		}
+	}()
+	defer close(status)
+
+	schema := types.ObjectSchema("city", "The city", "population", "The population")
+	schema.Required = []string{"city"}
+
+	_, err := newTestClient(t, Options{BaseURL: srv.URL}).Call(context.Background(), types.CompletionRequest{
+		Model:        "gpt-4o",
+		JSONResponse: true,
+		OutputSchema: schema,
+		Messages: []types.CompletionMessage{
+			{
+				Role:    types.CompletionMessageRoleTypeUser,
+				Content: types.Text("What is the capital of France?"),
+			},
+		},
+	}, nil, status)
+	require.NoError(t, err)
+
+	autogold.Expect(map[string]any{
+		"json_schema": map[string]any{
+			"name": "output",
+			"schema": map[string]any{
+				"additionalProperties": false,
+				"properties": map[string]any{
+					"city": map[string]any{
+						"description": "The city",
+						"type":        "string",
+					},
+					"population": map[string]any{
+						"description": "The population",
+						"type":        []any{"string", "null"},
+					},
+				},
+				"required": []any{"city", "population"},
+				"type":     "object",
+			},
+			"strict": true,
+		},
+		"type": "json_schema",
+	}).Equal(t, body["response_format"])
+
+	// The schema of the request is not changed.
+	assert.Equal(t, []string{"city"}, schema.Required)
+}
@@ -0,0 +1,381 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/counter"
+	"github.com/gptscript-ai/gptscript/pkg/models"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// The built-in strategies of the Context Compaction directive.
+const (
+	CompactionDrop                = "drop"
+	CompactionSummarize           = "summarize"
+	CompactionKeepFirstLast       = "keep-first-last"
+	CompactionTruncateToolResults = "truncate-tool-results"
+)
+
+const (
+	// summaryTokens is the part of the budget that is reserved for the summary of the removed messages.
+	summaryTokens = 1_000
+	// DefaultToolResultLimit is the number of characters the older tool results are truncated to, unless the
+	// truncate-tool-results strategy is given another limit.
+	DefaultToolResultLimit = 1_000
+
+	summaryPrefix   = "Summary of the earlier conversation, which was removed to fit in the context window:\n"
+	truncatedSuffix = "\n... (truncated to fit in the context window)"
+	summarizePrompt = `You summarize conversations between a user, an assistant and the tools the assistant calls.
+Summarize the conversation given by the user in less than 500 words. Keep the facts, decisions, names, numbers and open
+tasks the assistant needs to continue the conversation. If the conversation starts with a summary of its earlier part,
+include that summary in yours. Respond with only the summary.`
+	previousSummaryPrefix = "Summary of the earlier part of the conversation:\n"
+)
+
+// Compactor shrinks the messages of a chat that no longer fit in the token budget.
+type Compactor interface {
+	Compact(ctx context.Context, req CompactRequest) (Compacted, error)
+}
+
+type CompactorFunc func(ctx context.Context, req CompactRequest) (Compacted, error)
+
+func (f CompactorFunc) Compact(ctx context.Context, req CompactRequest) (Compacted, error) {
+	return f(ctx, req)
+}
+
+type CompactRequest struct {
+	Model string
+	Env   []string
+	Cache bool
+	// Args are the words after the name of the strategy in the Context Compaction directive.
+	Args      []string
+	Tokenizer models.Tokenizer
+	// MaxTokens is the number of tokens the messages and the tools may use.
+	MaxTokens      int
+	ToolTokenCount int
+	Messages       []openai.ChatCompletionMessage
+	// System are the leading system messages of Messages, Over are the older messages that are over the budget, and
+	// Within are the newest messages that fit in it.
+	System, Over, Within []openai.ChatCompletionMessage
+}
+
+type Compacted struct {
+	Messages []openai.ChatCompletionMessage
+	// Summary is the summary of the removed messages, if the strategy summarizes them.
+	Summary string
+	// Fallback is the strategy the messages were compacted with instead if the strategy failed, and Error is why it did.
+	Fallback string
+	Error    error
+	// Usage is the usage of the requests to the model that compacted the messages.
+	Usage types.Usage
+}
+
+func defaultCompactors(c *Client) map[string]Compactor {
+	return map[string]Compactor{
+		CompactionDrop:                CompactorFunc(dropMessages),
+		CompactionSummarize:           CompactorFunc(c.summarizeMessages),
+		CompactionKeepFirstLast:       CompactorFunc(keepFirstLastMessages),
+		CompactionTruncateToolResults: CompactorFunc(truncateToolResults),
+	}
+}
+
+// compact fits the messages of a chat in the budget with the strategy of the Context Compaction directive, which drops
+// the older messages by default. The returned compaction is nil if all the messages fit.
+func (c *Client) compact(ctx context.Context, messageRequest types.CompletionRequest, env []string, tokenizer models.Tokenizer, maxTokens, toolTokenCount int, msgs []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, *types.Compaction, error) {
+	system, over, within := splitMessagesOverCount(tokenizer, maxTokens, toolTokenCount, msgs)
+	if len(over) == 0 {
+		return msgs, nil, nil
+	}
+
+	name, args := CompactionDrop, []string(nil)
+	if fields := strings.Fields(messageRequest.ContextCompaction); len(fields) > 0 {
+		name, args = fields[0], fields[1:]
+	}
+
+	compactor, ok := c.compactors[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown context compaction strategy %q", name)
+	}
+
+	result, err := compactor.Compact(ctx, CompactRequest{
+		Model:          messageRequest.Model,
+		Env:            env,
+		Cache:          messageRequest.GetCache(),
+		Args:           args,
+		Tokenizer:      tokenizer,
+		MaxTokens:      maxTokens,
+		ToolTokenCount: toolTokenCount,
+		Messages:       msgs,
+		System:         system,
+		Over:           over,
+		Within:         within,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to compact messages with strategy %q: %w", name, err)
+	}
+
+	compaction := &types.Compaction{
+		Strategy:       name,
+		MessagesBefore: len(msgs),
+		MessagesAfter:  len(result.Messages),
+		Summary:        result.Summary,
+		Fallback:       result.Fallback,
+		Usage:          result.Usage,
+	}
+	if result.Error != nil {
+		compaction.Error = result.Error.Error()
+	}
+	return result.Messages, compaction, nil
+}
+
+func dropMessages(_ context.Context, req CompactRequest) (Compacted, error) {
+	return Compacted{
+		Messages: slices.Concat(req.System, req.Within),
+	}, nil
+}
+
+// summarizeMessages replaces the messages that are over the budget with a summary written by the model. The messages
+// are summarized in parts that fit in the budget, each with the summary of the parts before it. If the model fails to
+// summarize them, they are dropped.
+func (c *Client) summarizeMessages(ctx context.Context, req CompactRequest) (Compacted, error) {
+	system, over, within := req.System, req.Over, req.Within
+	if budget := getBudget(req.MaxTokens) - summaryTokens; budget > 0 {
+		system, over, within = splitMessagesOverCount(req.Tokenizer, budget, req.ToolTokenCount, req.Messages)
+	}
+	if len(over) == 0 {
+		// Reserving the budget for the summary left nothing to summarize.
+		system, over, within = req.System, req.Over, req.Within
+	}
+
+	var (
+		summary string
+		usage   types.Usage
+	)
+	for _, chunk := range summaryChunks(req.Tokenizer, req.MaxTokens, over) {
+		if summary != "" {
+			chunk = previousSummaryPrefix + summary + "\n\n" + chunk
+		}
+
+		var (
+			chunkUsage types.Usage
+			err        error
+		)
+		summary, chunkUsage, err = c.summarize(ctx, req, chunk)
+		usage = addUsage(usage, chunkUsage)
+		if err != nil {
+			log.Errorf("failed to summarize %d messages, dropping them instead: %v", len(over), err)
+			return Compacted{
+				Messages: slices.Concat(system, within),
+				Fallback: CompactionDrop,
+				Error:    err,
+				Usage:    usage,
+			}, nil
+		}
+	}
+
+	return Compacted{
+		Messages: slices.Concat(system, []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: summaryPrefix + summary,
+			},
+		}, within),
+		Summary: summary,
+		Usage:   usage,
+	}, nil
+}
+
+// summaryChunks splits the transcript of the messages into parts that fit in a summary request along with the summary
+// of the parts before them. Messages that don't fit in a part on their own are truncated.
+func summaryChunks(tokenizer models.Tokenizer, maxTokens int, msgs []openai.ChatCompletionMessage) []string {
+	budget := getBudget(maxTokens)
+	budget = max(budget-tokenizer.Count(summarizePrompt)-summaryTokens, budget/2)
+
+	var (
+		chunks []string
+		chunk  strings.Builder
+		count  int
+	)
+	for _, line := range transcript(msgs) {
+		lineCount := tokenizer.Count(line)
+		if lineCount > budget {
+			// Cut the line in proportion to how far it is over the budget.
+			line = truncate(line, max(len(line)*budget/lineCount-len(truncatedSuffix), 0)) + truncatedSuffix + "\n"
+			lineCount = tokenizer.Count(line)
+		}
+		if count > 0 && count+lineCount > budget {
+			chunks = append(chunks, chunk.String())
+			chunk.Reset()
+			count = 0
+		}
+		chunk.WriteString(line)
+		count += lineCount
+	}
+	if count > 0 {
+		chunks = append(chunks, chunk.String())
+	}
+	return chunks
+}
+
+func (c *Client) summarize(ctx context.Context, req CompactRequest, conversation string) (string, types.Usage, error) {
+	request := chatCompletionRequest{
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model: req.Model,
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleSystem,
+					Content: summarizePrompt,
+				},
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: conversation,
+				},
+			},
+			Temperature: new(float32),
+		},
+	}
+
+	if req.Cache {
+		var result types.CompletionMessage
+		if found, err := c.cache.Get(ctx, c.cacheKey(types.CacheKeyOptions{}, request), &result); err != nil {
+			return "", types.Usage{}, err
+		} else if found {
+			return result.String(), types.Usage{}, nil
+		}
+	}
+
+	// The progress of the summary is not reported, so it is discarded. Its usage is part of the usage of the compaction.
+	progress := make(chan types.CompletionStatus)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range progress {
+		}
+	}()
+
+	result, err := c.call(ctx, request, types.CacheKeyOptions{}, counter.Next(), req.Env, progress)
+	close(progress)
+	<-done
+	if err != nil {
+		return "", result.Usage, err
+	}
+
+	summary := strings.TrimSpace(result.String())
+	if summary == "" {
+		return "", result.Usage, fmt.Errorf("the model returned an empty summary")
+	}
+	return summary, result.Usage, nil
+}
+
+// transcript renders messages as lines of text for the model to summarize.
+func transcript(msgs []openai.ChatCompletionMessage) (result []string) {
+	for _, msg := range msgs {
+		content := msg.Content
+		for _, part := range msg.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeText {
+				content += part.Text
+			}
+		}
+		if content != "" {
+			result = append(result, fmt.Sprintf("%s: %s\n", msg.Role, content))
+		}
+		for _, call := range msg.ToolCalls {
+			result = append(result, fmt.Sprintf("%s: call %s with %s\n", msg.Role, call.Function.Name, call.Function.Arguments))
+		}
+	}
+	return result
+}
+
+func addUsage(a, b types.Usage) types.Usage {
+	return types.Usage{
+		PromptTokens:     a.PromptTokens + b.PromptTokens,
+		CompletionTokens: a.CompletionTokens + b.CompletionTokens,
+		TotalTokens:      a.TotalTokens + b.TotalTokens,
+	}
+}
+
+// keepFirstLastMessages keeps the first message of the conversation, which is usually the request of the user, and the
+// newest messages that fit in the budget. If the strategy is given a number, at most that many of the newest messages
+// are kept.
+func keepFirstLastMessages(ctx context.Context, req CompactRequest) (Compacted, error) {
+	var last int
+	if len(req.Args) > 0 {
+		var err error
+		last, err = strconv.Atoi(req.Args[0])
+		if err != nil || last <= 0 {
+			return Compacted{}, fmt.Errorf("invalid number of last messages %q", req.Args[0])
+		}
+	}
+
+	first := req.Over[0]
+	if first.Role != openai.ChatMessageRoleUser {
+		return dropMessages(ctx, req)
+	}
+
+	budget := getBudget(req.MaxTokens) - countMessage(req.Tokenizer, first)
+	if budget <= 0 {
+		return dropMessages(ctx, req)
+	}
+
+	rest := slices.Concat(req.System, req.Over[1:], req.Within)
+	system, _, within := splitMessagesOverCount(req.Tokenizer, budget, req.ToolTokenCount, rest)
+
+	if last > 0 && len(within) > last {
+		capped := within[len(within)-last:]
+		for len(capped) > 0 && capped[0].Role == openai.ChatMessageRoleTool {
+			capped = capped[1:]
+		}
+		if len(capped) > 0 {
+			within = capped
+		}
+	}
+
+	return Compacted{
+		Messages: slices.Concat(system, []openai.ChatCompletionMessage{first}, within),
+	}, nil
+}
+
+// truncateToolResults truncates the older tool results, and then drops the messages that still do not fit. The tool
+// results at the end of the conversation are kept whole, because the model has not read them yet.
+func truncateToolResults(_ context.Context, req CompactRequest) (Compacted, error) {
+	limit := DefaultToolResultLimit
+	if len(req.Args) > 0 {
+		var err error
+		limit, err = strconv.Atoi(req.Args[0])
+		if err != nil || limit <= 0 {
+			return Compacted{}, fmt.Errorf("invalid tool result limit %q", req.Args[0])
+		}
+	}
+
+	msgs := slices.Clone(req.Messages)
+	end := len(msgs)
+	for end > 0 && msgs[end-1].Role == openai.ChatMessageRoleTool {
+		end--
+	}
+	for i, msg := range msgs[:end] {
+		if msg.Role == openai.ChatMessageRoleTool && len(msg.Content) > limit {
+			msgs[i].Content = truncate(msg.Content, limit) + truncatedSuffix
+		}
+	}
+
+	return Compacted{
+		Messages: dropMessagesOverCount(req.Tokenizer, req.MaxTokens, req.ToolTokenCount, msgs),
+	}, nil
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
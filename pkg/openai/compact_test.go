@@ -0,0 +1,264 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/models"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func message(role, name string, words int) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{
+		Role:    role,
+		Content: name + strings.Repeat(" word", words),
+	}
+}
+
+// chat is a conversation that is over a budget of 250 tokens, where only the first user message does not fit.
+func chat() []openai.ChatCompletionMessage {
+	return []openai.ChatCompletionMessage{
+		message(openai.ChatMessageRoleSystem, "system", 5),
+		message(openai.ChatMessageRoleUser, "u1", 100),
+		message(openai.ChatMessageRoleAssistant, "a1", 100),
+		message(openai.ChatMessageRoleUser, "u2", 100),
+		message(openai.ChatMessageRoleAssistant, "a2", 100),
+		message(openai.ChatMessageRoleUser, "u3", 5),
+	}
+}
+
+func names(msgs []openai.ChatCompletionMessage) (result []string) {
+	for _, msg := range msgs {
+		name, _, _ := strings.Cut(msg.Content, " ")
+		result = append(result, msg.Role+":"+name)
+	}
+	return
+}
+
+func newTestClient(t *testing.T, opts ...Options) *Client {
+	c, err := NewClient(context.Background(), credentials.NoopStore{}, append([]Options{{APIKey: "test"}}, opts...)...)
+	require.NoError(t, err)
+	return c
+}
+
+func testTokenizer(t *testing.T) models.Tokenizer {
+	tokenizer, err := models.NewRegistry(0).Tokenizer("gpt-4o")
+	require.NoError(t, err)
+	return tokenizer
+}
+
+func TestCompactFits(t *testing.T) {
+	msgs, compaction, err := newTestClient(t).compact(context.Background(), types.CompletionRequest{}, nil, testTokenizer(t), 1000, 0, chat())
+	require.NoError(t, err)
+	assert.Nil(t, compaction)
+	assert.Len(t, msgs, 6)
+}
+
+func TestCompactDrop(t *testing.T) {
+	msgs, compaction, err := newTestClient(t).compact(context.Background(), types.CompletionRequest{}, nil, testTokenizer(t), 250, 0, chat())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"system:system", "assistant:a1", "user:u2", "assistant:a2", "user:u3"}, names(msgs))
+	assert.Equal(t, &types.Compaction{
+		Strategy:       CompactionDrop,
+		MessagesBefore: 6,
+		MessagesAfter:  5,
+	}, compaction)
+}
+
+func TestCompactKeepFirstLast(t *testing.T) {
+	c := newTestClient(t)
+
+	msgs, _, err := c.compact(context.Background(), types.CompletionRequest{
+		ContextCompaction: "keep-first-last",
+	}, nil, testTokenizer(t), 250, 0, chat())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"system:system", "user:u1", "user:u2", "assistant:a2", "user:u3"}, names(msgs))
+
+	msgs, _, err = c.compact(context.Background(), types.CompletionRequest{
+		ContextCompaction: "keep-first-last 2",
+	}, nil, testTokenizer(t), 250, 0, chat())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"system:system", "user:u1", "assistant:a2", "user:u3"}, names(msgs))
+
+	_, _, err = c.compact(context.Background(), types.CompletionRequest{
+		ContextCompaction: "keep-first-last none",
+	}, nil, testTokenizer(t), 250, 0, chat())
+	assert.ErrorContains(t, err, `invalid number of last messages "none"`)
+}
+
+func TestCompactTruncateToolResults(t *testing.T) {
+	msgs := []openai.ChatCompletionMessage{
+		message(openai.ChatMessageRoleSystem, "system", 5),
+		message(openai.ChatMessageRoleUser, "u1", 5),
+		{
+			Role: openai.ChatMessageRoleAssistant,
+			ToolCalls: []openai.ToolCall{
+				{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "read"}},
+			},
+		},
+		message(openai.ChatMessageRoleTool, "t1", 300),
+		message(openai.ChatMessageRoleUser, "u2", 5),
+		{
+			Role: openai.ChatMessageRoleAssistant,
+			ToolCalls: []openai.ToolCall{
+				{ID: "call_2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "read"}},
+			},
+		},
+		message(openai.ChatMessageRoleTool, "t2", 100),
+	}
+
+	result, compaction, err := newTestClient(t).compact(context.Background(), types.CompletionRequest{
+		ContextCompaction: "truncate-tool-results 50",
+	}, nil, testTokenizer(t), 250, 0, msgs)
+	require.NoError(t, err)
+	assert.Equal(t, CompactionTruncateToolResults, compaction.Strategy)
+	require.Len(t, result, 7)
+	assert.Equal(t, truncate(msgs[3].Content, 50)+truncatedSuffix, result[3].Content)
+	// The last tool result has not been read by the model yet, so it is not truncated.
+	assert.Equal(t, msgs[6].Content, result[6].Content)
+	// The messages of the request are not changed.
+	assert.Len(t, msgs[3].Content, len("t1")+300*len(" word"))
+}
+
+func TestCompactSummarize(t *testing.T) {
+	t.Setenv("GPTSCRIPT_INTERNAL_OPENAI_STREAMING", "false")
+
+	var request openai.ChatCompletionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{
+					Message: openai.ChatCompletionMessage{
+						Role:    openai.ChatMessageRoleAssistant,
+						Content: "The user asked about u1.",
+					},
+				},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	msgs, compaction, err := newTestClient(t, Options{BaseURL: srv.URL}).compact(context.Background(), types.CompletionRequest{
+		Model:             "test-model",
+		ContextCompaction: "summarize",
+	}, nil, testTokenizer(t), 250, 0, chat())
+	require.NoError(t, err)
+
+	assert.Equal(t, "test-model", request.Model)
+	require.Len(t, request.Messages, 2)
+	assert.True(t, strings.HasPrefix(request.Messages[1].Content, "user: u1 word"))
+
+	assert.Equal(t, []string{"system:system", "system:Summary", "assistant:a1", "user:u2", "assistant:a2", "user:u3"}, names(msgs))
+	assert.Equal(t, summaryPrefix+"The user asked about u1.", msgs[1].Content)
+	assert.Equal(t, &types.Compaction{
+		Strategy:       CompactionSummarize,
+		MessagesBefore: 6,
+		MessagesAfter:  6,
+		Summary:        "The user asked about u1.",
+	}, compaction)
+}
+
+func TestCompactSummarizeChunks(t *testing.T) {
+	t.Setenv("GPTSCRIPT_INTERNAL_OPENAI_STREAMING", "false")
+
+	var requests []openai.ChatCompletionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request openai.ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests = append(requests, request)
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{
+					Message: openai.ChatCompletionMessage{
+						Role:    openai.ChatMessageRoleAssistant,
+						Content: fmt.Sprintf("summary %d", len(requests)),
+					},
+				},
+			},
+			Usage: openai.Usage{
+				PromptTokens:     100,
+				CompletionTokens: 10,
+				TotalTokens:      110,
+			},
+		})
+	}))
+	defer srv.Close()
+
+	msgs := slices.Concat(chat()[:5], []openai.ChatCompletionMessage{
+		message(openai.ChatMessageRoleUser, "u3", 100),
+		message(openai.ChatMessageRoleAssistant, "a3", 100),
+		message(openai.ChatMessageRoleUser, "u4", 5),
+	})
+	tokenizer := testTokenizer(t)
+
+	result, compaction, err := newTestClient(t, Options{BaseURL: srv.URL}).compact(context.Background(), types.CompletionRequest{
+		Model:             "test-model",
+		ContextCompaction: "summarize",
+	}, nil, tokenizer, 250, 0, msgs)
+	require.NoError(t, err)
+
+	// Each part of the messages that are removed fits in the budget on its own, and is summarized with the summary of
+	// the parts before it.
+	require.Len(t, requests, 3)
+	for i, request := range requests {
+		assert.LessOrEqual(t, countMessage(tokenizer, request.Messages[1]), 250)
+		if i > 0 {
+			assert.True(t, strings.HasPrefix(request.Messages[1].Content, previousSummaryPrefix+fmt.Sprintf("summary %d\n", i)))
+		}
+	}
+
+	assert.Equal(t, []string{"system:system", "system:Summary", "assistant:a2", "user:u3", "assistant:a3", "user:u4"}, names(result))
+	assert.Equal(t, "summary 3", compaction.Summary)
+	assert.Equal(t, types.Usage{PromptTokens: 300, CompletionTokens: 30, TotalTokens: 330}, compaction.Usage)
+}
+
+func TestCompactSummarizeFallback(t *testing.T) {
+	t.Setenv("GPTSCRIPT_INTERNAL_OPENAI_STREAMING", "false")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error": {"message": "bad request"}}`))
+	}))
+	defer srv.Close()
+
+	msgs, compaction, err := newTestClient(t, Options{BaseURL: srv.URL}).compact(context.Background(), types.CompletionRequest{
+		Model:             "test-model",
+		ContextCompaction: "summarize",
+	}, nil, testTokenizer(t), 250, 0, chat())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"system:system", "assistant:a1", "user:u2", "assistant:a2", "user:u3"}, names(msgs))
+	assert.Equal(t, CompactionSummarize, compaction.Strategy)
+	assert.Equal(t, CompactionDrop, compaction.Fallback)
+	assert.Contains(t, compaction.Error, "400 Bad Request")
+	assert.Empty(t, compaction.Summary)
+}
+
+func TestCompactCustomStrategy(t *testing.T) {
+	c := newTestClient(t, Options{
+		Compactors: map[string]Compactor{
+			"none": CompactorFunc(func(_ context.Context, req CompactRequest) (Compacted, error) {
+				return Compacted{Messages: req.Messages}, nil
+			}),
+		},
+	})
+
+	msgs, compaction, err := c.compact(context.Background(), types.CompletionRequest{ContextCompaction: "none"}, nil, testTokenizer(t), 250, 0, chat())
+	require.NoError(t, err)
+	assert.Len(t, msgs, 6)
+	assert.Equal(t, "none", compaction.Strategy)
+
+	_, _, err = c.compact(context.Background(), types.CompletionRequest{ContextCompaction: "unknown"}, nil, testTokenizer(t), 250, 0, chat())
+	assert.ErrorContains(t, err, `unknown context compaction strategy "unknown"`)
+}
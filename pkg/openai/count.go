@@ -1,19 +1,15 @@
 package openai
 
 import (
+	"cmp"
 	"encoding/json"
 
 	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/models"
 	"github.com/gptscript-ai/gptscript/pkg/types"
-	"github.com/pkoukk/tiktoken-go"
-	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
 )
 
-func init() {
-	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
-}
-
-const DefaultMaxTokens = 400_000 // This is the limit for GPT-5
+const DefaultMaxTokens = 400_000 // This is the limit for GPT-5, used for the models with an unknown context window
 
 func decreaseTenPercent(maxTokens int) int {
 	maxTokens = getBudget(maxTokens)
@@ -27,22 +23,38 @@ func getBudget(maxTokens int) int {
 	return maxTokens
 }
 
-func dropMessagesOverCount(maxTokens, toolTokenCount int, msgs []openai.ChatCompletionMessage) (result []openai.ChatCompletionMessage, err error) {
+// contextBudget is the number of tokens the messages and tools of a request to the model may use, which is the context window
+// of the model less the tokens reserved for the output.
+func contextBudget(info models.Info, maxTokens int) int {
+	contextWindow := cmp.Or(info.ContextWindow, DefaultMaxTokens)
+	if info.MaxOutputTokens > 0 {
+		maxTokens = min(maxTokens, info.MaxOutputTokens)
+	}
+	if maxTokens <= 0 || maxTokens >= contextWindow {
+		return contextWindow
+	}
+	return contextWindow - maxTokens
+}
+
+func dropMessagesOverCount(tokenizer models.Tokenizer, maxTokens, toolTokenCount int, msgs []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	system, _, within := splitMessagesOverCount(tokenizer, maxTokens, toolTokenCount, msgs)
+	return append(system, within...)
+}
+
+// splitMessagesOverCount splits the messages into the leading system messages, the older messages that are over the
+// budget, and the newest messages that are within it.
+func splitMessagesOverCount(tokenizer models.Tokenizer, maxTokens, toolTokenCount int, msgs []openai.ChatCompletionMessage) (system, over, within []openai.ChatCompletionMessage) {
 	var (
-		lastSystem   int
+		lastSystem   = -1
 		withinBudget int
 		budget       = getBudget(maxTokens) - toolTokenCount
 	)
 
 	for i, msg := range msgs {
 		if msg.Role == openai.ChatMessageRoleSystem {
-			count, err := countMessage(msg)
-			if err != nil {
-				return nil, err
-			}
-			budget -= count
+			budget -= countMessage(tokenizer, msg)
 			lastSystem = i
-			result = append(result, msg)
+			system = append(system, msg)
 		} else {
 			break
 		}
@@ -50,16 +62,17 @@ func dropMessagesOverCount(maxTokens, toolTokenCount int, msgs []openai.ChatComp
 
 	for i := len(msgs) - 1; i > lastSystem; i-- {
 		withinBudget = i
-		count, err := countMessage(msgs[i])
-		if err != nil {
-			return nil, err
-		}
-		budget -= count
+		budget -= countMessage(tokenizer, msgs[i])
 		if budget <= 0 {
 			break
 		}
 	}
 
+	if withinBudget < len(system) {
+		// All the messages are system messages.
+		withinBudget = len(system)
+	}
+
 	// OpenAI gets upset if there is a tool message without a tool call preceding it.
 	// Check the oldest message within budget, and if it is a tool message, just drop it.
 	// We do this in a loop because it is possible for multiple tool messages to be in a row,
@@ -71,42 +84,53 @@ func dropMessagesOverCount(maxTokens, toolTokenCount int, msgs []openai.ChatComp
 	if withinBudget == len(msgs)-1 {
 		// We are going to drop all non system messages, which seems useless, so just return them
 		// all and let it fail
-		return msgs, nil
+		return system, nil, msgs[len(system):]
 	}
 
-	return append(result, msgs[withinBudget:]...), nil
+	return system, msgs[len(system):withinBudget], msgs[withinBudget:]
 }
 
-func countMessage(msg openai.ChatCompletionMessage) (int, error) {
-	encoding, err := tiktoken.GetEncoding("o200k_base")
-	if err != nil {
-		return 0, err
-	}
-
-	count := len(encoding.Encode(msg.Role, nil, nil))
-	count += len(encoding.Encode(msg.Content, nil, nil))
+func countMessage(tokenizer models.Tokenizer, msg openai.ChatCompletionMessage) int {
+	count := tokenizer.Count(msg.Role)
+	count += tokenizer.Count(msg.Content)
 	for _, content := range msg.MultiContent {
-		count += len(encoding.Encode(content.Text, nil, nil))
+		count += tokenizer.Count(content.Text)
 	}
 	for _, tool := range msg.ToolCalls {
-		count += len(encoding.Encode(tool.Function.Name, nil, nil))
-		count += len(encoding.Encode(tool.Function.Arguments, nil, nil))
+		count += tokenizer.Count(tool.Function.Name)
+		count += tokenizer.Count(tool.Function.Arguments)
 	}
-	count += len(encoding.Encode(msg.ToolCallID, nil, nil))
+	count += tokenizer.Count(msg.ToolCallID)
 
-	return count, nil
+	return count
 }
 
-func countTools(tools []types.ChatCompletionTool) (int, error) {
-	encoding, err := tiktoken.GetEncoding("o200k_base")
+func countTools(tokenizer models.Tokenizer, tools []types.ChatCompletionTool) (int, error) {
+	toolJSON, err := json.Marshal(tools)
 	if err != nil {
 		return 0, err
 	}
 
-	toolJSON, err := json.Marshal(tools)
+	return tokenizer.Count(string(toolJSON)), nil
+}
+
+// countRequest estimates the prompt tokens of a request, which are counted against the tokens per minute of the rate
+// limits of its provider until the usage of the response is known.
+func (c *Client) countRequest(request openai.ChatCompletionRequest) int {
+	tokenizer, err := c.models.Tokenizer(request.Model)
 	if err != nil {
-		return 0, err
+		return 0
 	}
 
-	return len(encoding.Encode(string(toolJSON), nil, nil)), nil
+	var count int
+	for _, msg := range request.Messages {
+		count += countMessage(tokenizer, msg)
+	}
+	if len(request.Tools) > 0 {
+		toolJSON, err := json.Marshal(request.Tools)
+		if err == nil {
+			count += tokenizer.Count(string(toolJSON))
+		}
+	}
+	return count
 }
@@ -0,0 +1,20 @@
+package openai
+
+import (
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextBudget(t *testing.T) {
+	gpt4o := models.Info{ContextWindow: 128_000, MaxOutputTokens: 16_384}
+
+	assert.Equal(t, 128_000, contextBudget(gpt4o, 0))
+	assert.Equal(t, 127_000, contextBudget(gpt4o, 1_000))
+	// No more than the max output tokens of the model are reserved for the output.
+	assert.Equal(t, 128_000-16_384, contextBudget(gpt4o, 100_000))
+	// The budget of models with an unknown context window is the default.
+	assert.Equal(t, DefaultMaxTokens-1_000, contextBudget(models.Info{}, 1_000))
+	assert.Equal(t, DefaultMaxTokens, contextBudget(models.Info{}, DefaultMaxTokens))
+}
@@ -0,0 +1,103 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	openai "github.com/gptscript-ai/chat-completion-client"
+)
+
+// responseFormatTypeJSONSchema asks for a response that matches a JSON schema.
+const responseFormatTypeJSONSchema openai.ChatCompletionResponseFormatType = "json_schema"
+
+// chatCompletionRequest is a chat completion request with a response format that can have a JSON schema, which the
+// chat completion client has no field for. Its response format replaces the one of the client request, so the JSON
+// schema is part of the cache key of the request.
+type chatCompletionRequest struct {
+	openai.ChatCompletionRequest
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+}
+
+type responseFormat struct {
+	Type       openai.ChatCompletionResponseFormatType `json:"type"`
+	JSONSchema *jsonSchemaFormat                       `json:"json_schema,omitempty"`
+}
+
+type jsonSchemaFormat struct {
+	Name   string             `json:"name"`
+	Schema *jsonschema.Schema `json:"schema"`
+	Strict bool               `json:"strict"`
+}
+
+type responseFormatKey struct{}
+
+// clientRequest returns the request that is sent with the chat completion client. The client only sends the type of
+// the response format, so a response format with a JSON schema is passed in the returned context to
+// responseFormatTransport, which sends all of it.
+func (r chatCompletionRequest) clientRequest(ctx context.Context) (context.Context, openai.ChatCompletionRequest) {
+	request := r.ChatCompletionRequest
+	if r.ResponseFormat == nil {
+		return ctx, request
+	}
+
+	request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+		Type: r.ResponseFormat.Type,
+	}
+	if r.ResponseFormat.JSONSchema != nil {
+		ctx = context.WithValue(ctx, responseFormatKey{}, r.ResponseFormat)
+	}
+	return ctx, request
+}
+
+// responseFormatTransport sets the response format of chat completion requests to the one of their context.
+type responseFormatTransport struct {
+	base http.RoundTripper
+}
+
+func (t *responseFormatTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	format, _ := req.Context().Value(responseFormatKey{}).(*responseFormat)
+	if format == nil || req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	data, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = setResponseFormat(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.ContentLength = int64(len(data))
+	return t.base.RoundTrip(req)
+}
+
+func setResponseFormat(data []byte, format *responseFormat) ([]byte, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil {
+		// Not a chat completion request.
+		return data, nil
+	}
+	if _, ok := body["response_format"]; !ok {
+		return data, nil
+	}
+
+	responseFormat, err := json.Marshal(format)
+	if err != nil {
+		return nil, err
+	}
+	body["response_format"] = responseFormat
+	return json.Marshal(body)
+}
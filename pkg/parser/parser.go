@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"maps"
@@ -65,6 +66,23 @@ func addArg(line string, tool *types.Tool) error {
 		return fmt.Errorf("invalid arg format: %s", line)
 	}
 
+	// The type and constraints of the arg can be given in parentheses after its name, as in "count (integer, 1..10): The
+	// count". The description is never parsed, so args that were declared before arg types existed keep their meaning.
+	if name, spec, ok := strings.Cut(key, "("); ok && strings.HasSuffix(strings.TrimSpace(spec), ")") {
+		name = strings.TrimSpace(name)
+		spec = strings.TrimSuffix(strings.TrimSpace(spec), ")")
+		schema, required, ok := types.ParseArgSpec(spec)
+		if !ok {
+			return fmt.Errorf("invalid type of arg %s: %s", name, spec)
+		}
+		schema.Description = strings.TrimSpace(value)
+		tool.Arguments.Properties[name] = schema
+		if required && !slices.Contains(tool.Arguments.Required, name) {
+			tool.Arguments.Required = append(tool.Arguments.Required, name)
+		}
+		return nil
+	}
+
 	tool.Arguments.Properties[key] = &jsonschema.Schema{
 		Description: strings.TrimSpace(value),
 		Type:        "string",
@@ -128,6 +146,18 @@ func isParam(line string, tool *types.Tool, scan *simplescanner) (_ bool, err er
 			return false, err
 		}
 		tool.Stdin = b
+	case "sandbox":
+		b, err := toBool(value)
+		if err != nil {
+			return false, err
+		}
+		tool.Sandbox = b
+	case "network", "allownetwork":
+		b, err := toBool(value)
+		if err != nil {
+			return false, err
+		}
+		tool.Network = b
 	case "metadata":
 		mkey, mvalue, _ := strings.Cut(scan.AddMultiline(value), ":")
 		if tool.MetaData == nil {
@@ -143,17 +173,42 @@ func isParam(line string, tool *types.Tool, scan *simplescanner) (_ bool, err er
 		if err != nil {
 			return false, err
 		}
+	case "maxtokenstotal", "maxtotaltokens":
+		tool.MaxTokensTotal, err = strconv.Atoi(value)
+		if err != nil {
+			return false, err
+		}
+	case "maxcost":
+		tool.MaxCost, err = strconv.ParseFloat(strings.TrimPrefix(value, "$"), 64)
+		if err != nil {
+			return false, err
+		}
 	case "cache":
 		b, err := toBool(value)
 		if err != nil {
 			return false, err
 		}
 		tool.Cache = &b
+	case "cachekey":
+		if _, err := types.ParseCacheKey(value); err != nil {
+			return false, err
+		}
+		tool.CacheKey = value
 	case "jsonmode", "json", "jsonoutput", "jsonformat", "jsonresponse":
 		tool.JSONResponse, err = toBool(value)
 		if err != nil {
 			return false, err
 		}
+	case "outputschema":
+		tool.OutputSchema = &jsonschema.Schema{}
+		if err := json.Unmarshal([]byte(scan.AddMultiline(value)), tool.OutputSchema); err != nil {
+			return false, fmt.Errorf("invalid output schema: %w", err)
+		}
+		if _, err := tool.OutputSchema.Resolve(nil); err != nil {
+			return false, fmt.Errorf("invalid output schema: %w", err)
+		}
+	case "contextcompaction":
+		tool.ContextCompaction = value
 	case "temperature":
 		tool.Temperature, err = toFloatPtr(value)
 		if err != nil {
@@ -242,6 +242,149 @@ share output filters: shared
 	}}).Equal(t, out)
 }
 
+func TestParseBudget(t *testing.T) {
+	input := `
+name: sub
+max tokens total: 1000
+max cost: $0.25
+`
+	out, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	autogold.Expect(Document{Nodes: []Node{
+		{ToolNode: &ToolNode{
+			Tool: types.Tool{
+				ToolDef: types.ToolDef{
+					Parameters: types.Parameters{
+						Name:           "sub",
+						MaxTokensTotal: 1000,
+						MaxCost:        0.25,
+					},
+				},
+				Source: types.ToolSource{LineNo: 1},
+			},
+		}},
+	}}).Equal(t, out)
+}
+
+func TestParseOutputSchema(t *testing.T) {
+	input := `
+name: sub
+output schema: {"type": "object",
+  "properties": {"name": {"type": "string"}}}
+`
+	out, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, out.Nodes, 1)
+	schema := out.Nodes[0].ToolNode.Tool.OutputSchema
+	require.Equal(t, "object", schema.Type)
+	require.Equal(t, "string", schema.Properties["name"].Type)
+	require.Contains(t, out.Nodes[0].ToolNode.Tool.Print(), `Output Schema: {"type":"object","properties":{"name":{"type":"string"}}}`)
+
+	_, err = Parse(strings.NewReader("name: sub\noutput schema: {\"type\": 1}\n"))
+	require.ErrorContains(t, err, "invalid output schema")
+}
+
+func TestParseContextCompaction(t *testing.T) {
+	input := `
+name: sub
+chat: true
+context compaction: keep-first-last 10
+`
+	out, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, out.Nodes, 1)
+	require.Equal(t, "keep-first-last 10", out.Nodes[0].ToolNode.Tool.ContextCompaction)
+	require.Contains(t, out.Nodes[0].ToolNode.Tool.Print(), "Context Compaction: keep-first-last 10\n")
+}
+
+func TestParseCacheKey(t *testing.T) {
+	input := `
+name: sub
+cache key: normalized ignore-descriptions
+`
+	out, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, out.Nodes, 1)
+	require.Equal(t, "normalized ignore-descriptions", out.Nodes[0].ToolNode.Tool.CacheKey)
+	require.Contains(t, out.Nodes[0].ToolNode.Tool.Print(), "Cache Key: normalized ignore-descriptions\n")
+
+	_, err = Parse(strings.NewReader("name: sub\ncache key: normalized ignore-everything\n"))
+	require.ErrorContains(t, err, `invalid option of the normalized cache key "ignore-everything"`)
+}
+
+func TestParseTypedArgs(t *testing.T) {
+	input := `
+name: sub
+args: count (integer, required, 1..10): The number of items
+args: size (small|medium|large): The size
+args: tags (string[], ..3): The tags
+args: url: The URL: with a colon
+`
+	out, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, out.Nodes, 1)
+
+	args := out.Nodes[0].ToolNode.Tool.Arguments
+	require.Equal(t, []string{"count"}, args.Required)
+
+	count := args.Properties["count"]
+	require.Equal(t, "integer", count.Type)
+	require.Equal(t, 1.0, *count.Minimum)
+	require.Equal(t, 10.0, *count.Maximum)
+	require.Equal(t, "The number of items", count.Description)
+
+	require.Equal(t, "string", args.Properties["size"].Type)
+	require.Equal(t, []any{"small", "medium", "large"}, args.Properties["size"].Enum)
+
+	tags := args.Properties["tags"]
+	require.Equal(t, "array", tags.Type)
+	require.Equal(t, "string", tags.Items.Type)
+	require.Nil(t, tags.MinItems)
+	require.Equal(t, 3, *tags.MaxItems)
+
+	require.Equal(t, "string", args.Properties["url"].Type)
+	require.Equal(t, "The URL: with a colon", args.Properties["url"].Description)
+
+	printed := out.Nodes[0].ToolNode.Tool.Print()
+	require.Contains(t, printed, "Parameter: count (integer, required, 1..10): The number of items\n")
+	require.Contains(t, printed, "Parameter: size (small|medium|large): The size\n")
+	require.Contains(t, printed, "Parameter: tags (string[], ..3): The tags\n")
+	require.Contains(t, printed, "Parameter: url: The URL: with a colon\n")
+
+	reparsed, err := Parse(strings.NewReader(printed))
+	require.NoError(t, err)
+	require.Equal(t, args, reparsed.Nodes[0].ToolNode.Tool.Arguments)
+}
+
+func TestParseUntypedArgs(t *testing.T) {
+	// Descriptions that look like the type of an arg are kept as they were before args had types.
+	input := `
+name: sub
+args: x: Number: of items
+args: y: Required: the name
+args: z: integer, required: the count
+args: w (integer): The count
+`
+	out, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, out.Nodes, 1)
+
+	args := out.Nodes[0].ToolNode.Tool.Arguments
+	require.Empty(t, args.Required)
+	for key, description := range map[string]string{
+		"x": "Number: of items",
+		"y": "Required: the name",
+		"z": "integer, required: the count",
+	} {
+		require.Equal(t, "string", args.Properties[key].Type, key)
+		require.Equal(t, description, args.Properties[key].Description, key)
+	}
+	require.Equal(t, "integer", args.Properties["w"].Type)
+
+	_, err = Parse(strings.NewReader("name: sub\nargs: count (integr): The count\n"))
+	require.ErrorContains(t, err, "invalid type of arg count: integr")
+}
+
 func TestParseMetaDataSpace(t *testing.T) {
 	input := `
 name: a space
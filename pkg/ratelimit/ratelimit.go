@@ -0,0 +1,267 @@
+// Package ratelimit limits the requests and tokens per minute that are sent to each model provider, and the number of
+// completions that are requested at once across all of them. The model clients wait for the limits right before
+// sending a request, so the responses that are served from the cache are never limited.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// The reasons a request is queued.
+const (
+	ReasonInFlight          = "in-flight completions"
+	ReasonRequestsPerMinute = "requests per minute"
+	ReasonTokensPerMinute   = "tokens per minute"
+)
+
+// Limits are the requests and tokens per minute that can be sent to a model provider. Zero is unlimited.
+type Limits struct {
+	RequestsPerMinute int `json:"requestsPerMinute,omitempty"`
+	TokensPerMinute   int `json:"tokensPerMinute,omitempty"`
+}
+
+// Parse parses limits of the form provider:rpm=500 or provider:tpm=30000, where the provider is the name of a model
+// provider as in "Model: gpt-4o from provider", or openai, anthropic or mock for the built-in ones. The limits of the
+// same provider are merged.
+func Parse(specs ...string) (map[string]Limits, error) {
+	result := map[string]Limits{}
+	for _, spec := range specs {
+		// Providers can be URLs, so the limit is after the last colon.
+		i := strings.LastIndex(spec, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid rate limit %q, must be provider:rpm=N or provider:tpm=N", spec)
+		}
+		provider, limit := strings.TrimSpace(spec[:i]), spec[i+1:]
+
+		name, value, _ := strings.Cut(limit, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid rate limit %q, the limit must be a positive number", spec)
+		}
+
+		limits := result[provider]
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "rpm":
+			limits.RequestsPerMinute = n
+		case "tpm":
+			limits.TokensPerMinute = n
+		default:
+			return nil, fmt.Errorf("invalid rate limit %q, must be provider:rpm=N or provider:tpm=N", spec)
+		}
+		result[provider] = limits
+	}
+	return result, nil
+}
+
+// Limiter limits the requests of all the runs that share it.
+type Limiter struct {
+	inFlight  chan struct{}
+	providers map[string]*window
+}
+
+// New returns a limiter of the limits of the providers, and of the requests that are in flight at once if maxInFlight
+// is greater than zero.
+func New(maxInFlight int, limits map[string]Limits) *Limiter {
+	result := &Limiter{
+		providers: map[string]*window{},
+	}
+	if maxInFlight > 0 {
+		result.inFlight = make(chan struct{}, maxInFlight)
+	}
+	for provider, limit := range limits {
+		result.providers[provider] = &window{
+			limits: limit,
+		}
+	}
+	return result
+}
+
+// window holds the requests of a provider of the last minute.
+type window struct {
+	limits Limits
+
+	lock     sync.Mutex
+	requests []*request
+}
+
+type request struct {
+	at     time.Time
+	tokens int
+}
+
+// reserve adds a request with the tokens to the window if the limits allow it, or else returns how long until they
+// might and why.
+func (w *window) reserve(now time.Time, tokens int) (*request, time.Duration, string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for len(w.requests) > 0 && now.Sub(w.requests[0].at) >= time.Minute {
+		w.requests = w.requests[1:]
+	}
+
+	var (
+		wait   time.Duration
+		reason string
+	)
+	if rpm := w.limits.RequestsPerMinute; rpm > 0 && len(w.requests) >= rpm {
+		wait = w.requests[len(w.requests)-rpm].at.Add(time.Minute).Sub(now)
+		reason = ReasonRequestsPerMinute
+	}
+
+	if tpm := w.limits.TokensPerMinute; tpm > 0 && len(w.requests) > 0 {
+		var total int
+		for _, r := range w.requests {
+			total += r.tokens
+		}
+		// A request with more tokens than the limit is sent alone once the window is empty.
+		for i := 0; i < len(w.requests) && total+tokens > tpm; i++ {
+			total -= w.requests[i].tokens
+			if d := w.requests[i].at.Add(time.Minute).Sub(now); d > wait {
+				wait, reason = d, ReasonTokensPerMinute
+			}
+		}
+	}
+
+	if wait > 0 {
+		return nil, wait, reason
+	}
+
+	r := &request{
+		at:     now,
+		tokens: tokens,
+	}
+	w.requests = append(w.requests, r)
+	return r, 0, ""
+}
+
+func (w *window) settle(r *request, tokens int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	r.tokens = tokens
+}
+
+// cancel removes a request that was not sent from the window.
+func (w *window) cancel(r *request) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for i, req := range w.requests {
+		if req == r {
+			w.requests = append(w.requests[:i], w.requests[i+1:]...)
+			return
+		}
+	}
+}
+
+// wait waits until the limits of the provider allow a request with the tokens. It calls queued with the reason when
+// the request has to wait. The window of the provider is reserved before the in-flight slot is taken, so a request that
+// waits for its provider never holds a slot that the requests of other providers could use.
+func (l *Limiter) wait(ctx context.Context, provider string, tokens int, queued func(reason string)) (func(types.Usage), error) {
+	w := l.providers[provider]
+
+	var r *request
+	for w != nil {
+		var (
+			wait   time.Duration
+			reason string
+		)
+		r, wait, reason = w.reserve(time.Now(), tokens)
+		if r != nil {
+			break
+		}
+
+		queued(reason)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+		default:
+			queued(ReasonInFlight)
+			select {
+			case l.inFlight <- struct{}{}:
+			case <-ctx.Done():
+				if r != nil {
+					w.cancel(r)
+				}
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	return func(usage types.Usage) {
+		if r != nil && usage.TotalTokens > 0 {
+			w.settle(r, usage.TotalTokens)
+		}
+		if l.inFlight != nil {
+			<-l.inFlight
+		}
+	}, nil
+}
+
+type limiterKey struct{}
+
+type providerLimiter struct {
+	limiter  *Limiter
+	provider string
+}
+
+// WithProvider returns a context whose requests are limited by the limiter as requests of the provider.
+func WithProvider(ctx context.Context, limiter *Limiter, provider string) context.Context {
+	if limiter == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, limiterKey{}, providerLimiter{
+		limiter:  limiter,
+		provider: provider,
+	})
+}
+
+// Acquire waits until the limits of the context allow a request with the estimated tokens. If the request has to
+// wait, queued is called once when it starts waiting and once when it stops, with how long it waited. The returned
+// function must be called with the usage of the request when it is done, which replaces the estimated tokens.
+func Acquire(ctx context.Context, tokens int, queued func(types.Queue)) (func(types.Usage), error) {
+	l, ok := ctx.Value(limiterKey{}).(providerLimiter)
+	if !ok {
+		return func(types.Usage) {}, nil
+	}
+
+	var (
+		start  = time.Now()
+		reason string
+	)
+	release, err := l.limiter.wait(ctx, l.provider, tokens, func(r string) {
+		if reason == "" {
+			queued(types.Queue{
+				Provider: l.provider,
+				Reason:   r,
+			})
+		}
+		reason = r
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reason != "" {
+		queued(types.Queue{
+			Provider: l.provider,
+			Reason:   reason,
+			Wait:     time.Since(start),
+		})
+	}
+	return release, nil
+}
@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	limits, err := Parse("openai:rpm=500", "openai:tpm=30000", "https://api.mistral.ai/v1:TPM=1000")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Limits{
+		"openai":                    {RequestsPerMinute: 500, TokensPerMinute: 30000},
+		"https://api.mistral.ai/v1": {TokensPerMinute: 1000},
+	}, limits)
+
+	for _, spec := range []string{"openai", "openai:rpm", "openai:rpm=-1", "openai:rph=5", ":rpm=5"} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestRequestsPerMinute(t *testing.T) {
+	w := &window{limits: Limits{RequestsPerMinute: 2}}
+	now := time.Now()
+
+	r, _, _ := w.reserve(now, 0)
+	assert.NotNil(t, r)
+	r, _, _ = w.reserve(now.Add(10*time.Second), 0)
+	assert.NotNil(t, r)
+
+	r, wait, reason := w.reserve(now.Add(20*time.Second), 0)
+	assert.Nil(t, r)
+	assert.Equal(t, 40*time.Second, wait)
+	assert.Equal(t, ReasonRequestsPerMinute, reason)
+
+	// The first request leaves the window after a minute.
+	r, _, _ = w.reserve(now.Add(time.Minute), 0)
+	assert.NotNil(t, r)
+}
+
+func TestTokensPerMinute(t *testing.T) {
+	w := &window{limits: Limits{TokensPerMinute: 100}}
+	now := time.Now()
+
+	first, _, _ := w.reserve(now, 60)
+	require.NotNil(t, first)
+	second, _, _ := w.reserve(now.Add(10*time.Second), 30)
+	require.NotNil(t, second)
+
+	r, wait, reason := w.reserve(now.Add(20*time.Second), 20)
+	assert.Nil(t, r)
+	assert.Equal(t, 40*time.Second, wait)
+	assert.Equal(t, ReasonTokensPerMinute, reason)
+
+	// The usage of the first request was lower than estimated, which makes room for the next one.
+	w.settle(first, 40)
+	r, _, _ = w.reserve(now.Add(20*time.Second), 20)
+	assert.NotNil(t, r)
+
+	// A request over the limit is sent alone.
+	w = &window{limits: Limits{TokensPerMinute: 100}}
+	r, _, _ = w.reserve(now, 500)
+	assert.NotNil(t, r)
+	r, wait, _ = w.reserve(now.Add(30*time.Second), 500)
+	assert.Nil(t, r)
+	assert.Equal(t, 30*time.Second, wait)
+}
+
+func TestInFlight(t *testing.T) {
+	limiter := New(1, nil)
+	ctx := WithProvider(context.Background(), limiter, "openai")
+
+	var queued []types.Queue
+	release, err := Acquire(ctx, 0, func(q types.Queue) { queued = append(queued, q) })
+	require.NoError(t, err)
+	assert.Empty(t, queued)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		release, err := Acquire(ctx, 0, func(q types.Queue) { queued = append(queued, q) })
+		assert.NoError(t, err)
+		release(types.Usage{})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	release(types.Usage{})
+	<-done
+
+	require.Len(t, queued, 2)
+	assert.Equal(t, types.Queue{Provider: "openai", Reason: ReasonInFlight}, queued[0])
+	assert.Equal(t, ReasonInFlight, queued[1].Reason)
+	assert.Greater(t, queued[1].Wait, time.Duration(0))
+}
+
+func TestAcquireCanceled(t *testing.T) {
+	limiter := New(0, map[string]Limits{"openai": {RequestsPerMinute: 1}})
+	ctx, cancel := context.WithCancel(WithProvider(context.Background(), limiter, "openai"))
+
+	release, err := Acquire(ctx, 0, func(types.Queue) {})
+	require.NoError(t, err)
+	release(types.Usage{})
+
+	cancel()
+	_, err = Acquire(ctx, 0, func(types.Queue) {})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestAcquireWithoutLimiter(t *testing.T) {
+	release, err := Acquire(context.Background(), 1_000_000, func(types.Queue) {
+		t.Fatal("requests without a limiter are never queued")
+	})
+	require.NoError(t, err)
+	release(types.Usage{})
+}
+
+func TestInFlightNotHeldWhileWaitingForProvider(t *testing.T) {
+	limiter := New(1, map[string]Limits{"openai": {RequestsPerMinute: 1}})
+	openaiCtx, cancel := context.WithCancel(WithProvider(context.Background(), limiter, "openai"))
+	defer cancel()
+	anthropicCtx, cancelAnthropic := context.WithTimeout(WithProvider(context.Background(), limiter, "anthropic"), 5*time.Second)
+	defer cancelAnthropic()
+
+	release, err := Acquire(openaiCtx, 0, func(types.Queue) {})
+	require.NoError(t, err)
+	release(types.Usage{})
+
+	// The next request of openai waits for its window, without taking the only in-flight slot.
+	waiting := make(chan types.Queue, 2)
+	done := make(chan error)
+	go func() {
+		_, err := Acquire(openaiCtx, 0, func(q types.Queue) { waiting <- q })
+		done <- err
+	}()
+	assert.Equal(t, ReasonRequestsPerMinute, (<-waiting).Reason)
+
+	var queued []types.Queue
+	release, err = Acquire(anthropicCtx, 0, func(q types.Queue) { queued = append(queued, q) })
+	require.NoError(t, err)
+	assert.Empty(t, queued)
+	release(types.Usage{})
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
@@ -15,6 +15,8 @@ import (
 	"github.com/gptscript-ai/gptscript/pkg/engine"
 	env2 "github.com/gptscript-ai/gptscript/pkg/env"
 	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/mock"
+	"github.com/gptscript-ai/gptscript/pkg/models"
 	"github.com/gptscript-ai/gptscript/pkg/openai"
 	"github.com/gptscript-ai/gptscript/pkg/prompt"
 	"github.com/gptscript-ai/gptscript/pkg/runner"
@@ -24,6 +26,8 @@ import (
 type Client struct {
 	clientsLock     sync.Mutex
 	cache           *cache.Client
+	trust           *loader.Trust
+	models          *models.Registry
 	clients         map[string]clientInfo
 	runner          *runner.Runner
 	envs            []string
@@ -31,9 +35,11 @@ type Client struct {
 	defaultProvider string
 }
 
-func New(r *runner.Runner, envs []string, cache *cache.Client, credStore credentials.CredentialStore, defaultProvider string) *Client {
+func New(r *runner.Runner, envs []string, cache *cache.Client, trust *loader.Trust, models *models.Registry, credStore credentials.CredentialStore, defaultProvider string) *Client {
 	return &Client{
 		cache:           cache,
+		trust:           trust,
+		models:          models,
 		runner:          r,
 		envs:            envs,
 		credStore:       credStore,
@@ -65,6 +71,10 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 
 func (c *Client) ListModels(ctx context.Context, providers ...string) (result []openai2.Model, _ error) {
 	for _, provider := range providers {
+		if provider == mock.ProviderName {
+			// The models of the mock provider are listed by its own client.
+			continue
+		}
 		client, err := c.load(ctx, provider)
 		if err != nil {
 			return nil, err
@@ -96,6 +106,13 @@ func (c *Client) parseModel(modelString string) (modelName, providerName string)
 	return subTool, toolName
 }
 
+// ProviderName returns the name of the provider of the model, which is the default provider if the model doesn't name
+// one.
+func (c *Client) ProviderName(modelString string) string {
+	_, providerName := c.parseModel(modelString)
+	return providerName
+}
+
 func (c *Client) Supports(ctx context.Context, modelString string) (bool, error) {
 	_, providerName := c.parseModel(modelString)
 	if providerName == "" {
@@ -135,6 +152,7 @@ func (c *Client) clientFromURL(ctx context.Context, apiURL string, envs []string
 		BaseURL: apiURL,
 		Cache:   c.cache,
 		APIKey:  key,
+		Models:  c.models,
 	})
 }
 
@@ -161,6 +179,7 @@ func (c *Client) load(ctx context.Context, toolName string, env ...string) (*ope
 
 	prg, err := loader.Program(ctx, toolName, "", loader.Options{
 		Cache: c.cache,
+		Trust: c.trust,
 	})
 	if err != nil {
 		return nil, err
@@ -175,6 +194,7 @@ func (c *Client) load(ctx context.Context, toolName string, env ...string) (*ope
 		BaseURL:  strings.TrimSuffix(url, "/") + "/v1",
 		Cache:    c.cache,
 		CacheKey: prg.EntryToolID,
+		Models:   c.models,
 	})
 	if err != nil {
 		return nil, err
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -88,8 +89,9 @@ func (m *Manager) setup(ctx context.Context, runtime Runtime, tool types.Tool, e
 	target := filepath.Join(m.storageDir, tool.Source.Repo.Revision, tool.Source.Repo.Path, tool.Source.Repo.Name, runtime.ID())
 	targetFinal := filepath.Join(target, tool.Source.Repo.Path+runtimeHash)
 	doneFile := targetFinal + ".done"
+	manifestFile := doneFile + ".manifest"
 	envData, err := os.ReadFile(doneFile)
-	if err == nil {
+	if err == nil && verifiedWith(manifestFile, tool.Source.Repo.Manifest) {
 		var savedEnv []string
 		if err := json.Unmarshal(envData, &savedEnv); err == nil {
 			return targetFinal, append(env, savedEnv...), nil
@@ -101,6 +103,7 @@ func (m *Manager) setup(ctx context.Context, runtime Runtime, tool types.Tool, e
 	// Cleanup previous failed runs
 	_ = os.RemoveAll(doneFile + ".tmp")
 	_ = os.RemoveAll(doneFile)
+	_ = os.RemoveAll(manifestFile)
 	_ = os.RemoveAll(target)
 
 	var (
@@ -108,9 +111,14 @@ func (m *Manager) setup(ctx context.Context, runtime Runtime, tool types.Tool, e
 		isBinary bool
 	)
 
-	if isBinary, newEnv, err = runtime.Binary(ctx, tool, m.runtimeDir, targetFinal, env); err != nil {
-		return "", nil, err
-	} else if !isBinary {
+	// Released binaries are not covered by the manifest of a repo, so tools of signed repos are built from the checkout.
+	if tool.Source.Repo.Manifest == "" {
+		isBinary, newEnv, err = runtime.Binary(ctx, tool, m.runtimeDir, targetFinal, env)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	if !isBinary {
 		if tool.Source.Repo.VCS == "git" {
 			if err := git.Checkout(ctx, m.gitDir, tool.Source.Repo.Root, tool.Source.Repo.Revision, target); err != nil {
 				return "", nil, err
@@ -121,6 +129,16 @@ func (m *Manager) setup(ctx context.Context, runtime Runtime, tool types.Tool, e
 			}
 		}
 
+		if tool.Source.Repo.Manifest != "" {
+			if err := verifyCheckout(target, tool.Source.Repo.Manifest); err != nil {
+				return "", nil, fmt.Errorf("the checkout of %s at %s does not match its signed manifest: %w",
+					tool.Source.Repo.Root, tool.Source.Repo.Revision, err)
+			}
+			if err := os.WriteFile(manifestFile, []byte(tool.Source.Repo.Manifest), 0644); err != nil {
+				return "", nil, err
+			}
+		}
+
 		newEnv, err = runtime.Setup(ctx, tool, m.runtimeDir, targetFinal, env)
 		if err != nil {
 			return "", nil, err
@@ -144,6 +162,15 @@ func (m *Manager) setup(ctx context.Context, runtime Runtime, tool types.Tool, e
 	return targetFinal, append(env, newEnv...), os.Rename(doneFile+".tmp", doneFile)
 }
 
+// verifiedWith returns whether a setup was verified with the manifest of its repo, if its repo has one.
+func verifiedWith(manifestFile, manifest string) bool {
+	if manifest == "" {
+		return true
+	}
+	data, err := os.ReadFile(manifestFile)
+	return err == nil && string(data) == manifest
+}
+
 func (m *Manager) GetContext(ctx context.Context, tool types.Tool, cmd, env []string) (string, []string, error) {
 	for _, systemDir := range m.systemDirs {
 		if strings.HasPrefix(tool.WorkingDir, systemDir) {
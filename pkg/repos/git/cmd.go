@@ -25,15 +25,25 @@ func LsRemote(ctx context.Context, repo, ref string) (string, error) {
 	if err := cmd.Run(); err != nil {
 		return "", err
 	}
+	var commit string
 	for _, line := range strings.Split(cmd.Stdout(), "\n") {
 		fields := strings.Fields(line)
 		if len(fields) < 2 {
 			continue
 		}
-		if fields[1] == ref {
+		switch fields[1] {
+		case ref, "refs/heads/" + ref, "refs/tags/" + ref:
+			if commit == "" {
+				commit = fields[0]
+			}
+		case "refs/tags/" + ref + "^{}":
+			// The commit of an annotated tag
 			return fields[0], nil
 		}
 	}
+	if commit != "" {
+		return commit, nil
+	}
 	return "", fmt.Errorf("failed to find remote %q as %q", repo, ref)
 }
 
@@ -52,3 +62,13 @@ func fetchCommit(ctx context.Context, gitDir, commit string) error {
 	cmd := newGitCommand(ctx, "--git-dir", gitDir, "fetch", "origin", commit)
 	return cmd.Run()
 }
+
+func mirror(ctx context.Context, repo, commit, toDir string) error {
+	if err := newGitCommand(ctx, "init", "--bare", toDir).Run(); err != nil {
+		return err
+	}
+	if err := newGitCommand(ctx, "--git-dir", toDir, "fetch", "--depth", "1", repo, commit).Run(); err != nil {
+		return err
+	}
+	return newGitCommand(ctx, "--git-dir", toDir, "update-ref", "HEAD", commit).Run()
+}
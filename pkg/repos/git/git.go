@@ -41,6 +41,26 @@ func Checkout(ctx context.Context, base, repo, commit, toDir string) error {
 	return gitWorktreeAdd(ctx, gitDir(base, repo), toDir, commit)
 }
 
+// Mirror copies a commit of a repo to a new bare repo whose HEAD is the commit, so that it can be checked out from
+// there without access to the repo.
+func Mirror(ctx context.Context, repo, commit, toDir string) error {
+	if found, err := exists(toDir); err != nil {
+		return err
+	} else if found {
+		return fmt.Errorf("%s already exists, can not create repo", toDir)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(toDir), 0755); err != nil {
+		return err
+	}
+
+	log.InfofCtx(ctx, "Copying %s at %s to %s", repo, commit, toDir)
+	if usePureGo() {
+		return mirrorPureGo(ctx, repo, commit, toDir)
+	}
+	return mirror(ctx, repo, commit, toDir)
+}
+
 func gitDir(base, repo string) string {
 	return filepath.Join(base, "repos", hash.Digest(repo))
 }
@@ -95,3 +95,36 @@ func checkoutPureGo(ctx context.Context, _, repo, commit, toDir string) error {
 
 	return nil
 }
+
+func mirrorPureGo(ctx context.Context, repo, commit, toDir string) error {
+	r, err := git.PlainInit(toDir, true)
+	if err != nil {
+		return fmt.Errorf("failed to create the repo: %w", err)
+	}
+
+	remote, err := r.CreateRemote(&config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{repo},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add the remote: %w", err)
+	}
+
+	// Not every server can fetch a commit by its hash, so the branches and tags are fetched and the HEAD of the new repo,
+	// which is master, is set to the commit.
+	err = remote.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{
+			"+refs/heads/*:refs/remotes/origin/*",
+			"+refs/tags/*:refs/tags/*",
+		},
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to fetch the repo: %w", err)
+	}
+
+	hash := plumbing.NewHash(commit)
+	if _, err := r.CommitObject(hash); err != nil {
+		return fmt.Errorf("failed to find commit %s: %w", commit, err)
+	}
+	return r.Storer.SetReference(plumbing.NewHashReference(plumbing.Master, hash))
+}
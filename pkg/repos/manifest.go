@@ -0,0 +1,119 @@
+package repos
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+)
+
+// ManifestFile is the file at the root of a repo that lists the sha256 digest of every file of the repo in the format
+// of sha256sum, like git ls-files -z | xargs -0 sha256sum writes it. A signed manifest covers the tools of a repo and
+// all the code they run.
+const ManifestFile = "gptscript.manifest"
+
+// Manifest is the sha256 digest of every file of a repo by its path in the repo.
+type Manifest map[string]string
+
+// ParseManifest parses the content of a manifest file.
+func ParseManifest(data []byte) (Manifest, error) {
+	result := Manifest{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// sha256sum separates the digest from the path with a space and a space, or a * in binary mode.
+		digest, file, ok := strings.Cut(line, " ")
+		if !ok || len(digest) != 64 || len(file) < 2 {
+			return nil, fmt.Errorf("line %d of %s is not a digest and a path", i, ManifestFile)
+		}
+		result[cleanManifestPath(file[1:])] = strings.ToLower(digest)
+	}
+	return result, scanner.Err()
+}
+
+func cleanManifestPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// Digest returns the digest of a file of the repo, and false if the manifest doesn't list it.
+func (m Manifest) Digest(file string) (string, bool) {
+	digest, ok := m[cleanManifestPath(file)]
+	return digest, ok
+}
+
+// Verify fails unless the files of a checkout are the ones of the manifest with the same content. The .git of the
+// checkout is not part of the repo, and neither are the manifest and its signature.
+func (m Manifest) Verify(dir string) error {
+	seen := map[string]struct{}{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == ".git" || strings.HasPrefix(rel, ManifestFile) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		digest, ok := m[rel]
+		if !ok {
+			return fmt.Errorf("%s is not in %s", rel, ManifestFile)
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if hash.Digest(data) != digest {
+			return fmt.Errorf("%s does not match its digest in %s", rel, ManifestFile)
+		}
+		seen[rel] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for file := range m {
+		if _, ok := seen[file]; !ok && !strings.HasPrefix(file, ManifestFile) {
+			return fmt.Errorf("%s of %s is missing", file, ManifestFile)
+		}
+	}
+	return nil
+}
+
+// verifyCheckout verifies a checkout against its manifest, which must have the digest the loader verified the
+// signature of.
+func verifyCheckout(dir, manifestDigest string) error {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", ManifestFile, err)
+	}
+	if hash.Digest(data) != manifestDigest {
+		return fmt.Errorf("%s is not the signed manifest of the repo", ManifestFile)
+	}
+
+	manifest, err := ParseManifest(data)
+	if err != nil {
+		return err
+	}
+	return manifest.Verify(dir)
+}
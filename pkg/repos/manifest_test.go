@@ -0,0 +1,96 @@
+package repos
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "run.sh"), []byte("echo hi\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "tool.gpt"), []byte("#!sys.echo hi\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0644))
+
+	// Both the text and the binary mode of sha256sum are read.
+	manifest, err := ParseManifest([]byte(hash.Digest([]byte("echo hi\n")) + "  ./run.sh\n" +
+		hash.Digest([]byte("#!sys.echo hi\n")) + " *sub/tool.gpt\n"))
+	require.NoError(t, err)
+	digest, ok := manifest.Digest("sub/../run.sh")
+	assert.True(t, ok)
+	assert.Equal(t, hash.Digest([]byte("echo hi\n")), digest)
+	require.NoError(t, manifest.Verify(dir))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "extra.sh"), []byte("echo extra\n"), 0644))
+	assert.ErrorContains(t, manifest.Verify(dir), "extra.sh is not in "+ManifestFile)
+	require.NoError(t, os.Remove(filepath.Join(dir, "extra.sh")))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "run.sh"), []byte("echo changed\n"), 0644))
+	assert.ErrorContains(t, manifest.Verify(dir), "run.sh does not match its digest in "+ManifestFile)
+	require.NoError(t, os.Remove(filepath.Join(dir, "run.sh")))
+	assert.ErrorContains(t, manifest.Verify(dir), "run.sh of "+ManifestFile+" is missing")
+
+	_, err = ParseManifest([]byte("not a manifest\n"))
+	assert.ErrorContains(t, err, "line 1 of "+ManifestFile+" is not a digest and a path")
+}
+
+func TestManagerVerifiesManifest(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	repo := t.TempDir()
+	manifest := []byte(hash.Digest([]byte("echo hi\n")) + "  run.sh\n")
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "run.sh"), []byte("echo hi\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, ManifestFile), manifest, 0644))
+	git(repo, "init", "-b", "main")
+	git(repo, "add", ".")
+	git(repo, "commit", "-m", "tool")
+	signed := git(repo, "rev-parse", "HEAD")
+
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "extra.sh"), []byte("echo extra\n"), 0755))
+	git(repo, "add", ".")
+	git(repo, "commit", "-m", "extra")
+	unsigned := git(repo, "rev-parse", "HEAD")
+
+	m := New(t.TempDir(), "")
+	tool := func(revision string) types.Tool {
+		return types.Tool{
+			Source: types.ToolSource{
+				Repo: &types.Repo{
+					VCS:      "git",
+					Root:     repo,
+					Path:     ".",
+					Name:     "tool.gpt",
+					Revision: revision,
+					Manifest: hash.Digest(manifest),
+				},
+			},
+		}
+	}
+
+	dir, _, err := m.GetContext(context.Background(), tool(signed), []string{"/bin/sh"}, nil)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, "run.sh"))
+
+	_, _, err = m.GetContext(context.Background(), tool(unsigned), []string{"/bin/sh"}, nil)
+	assert.ErrorContains(t, err, "does not match its signed manifest: extra.sh is not in "+ManifestFile)
+}
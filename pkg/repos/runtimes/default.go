@@ -1,12 +1,16 @@
 package runtimes
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/gptscript-ai/gptscript/pkg/engine"
 	"github.com/gptscript-ai/gptscript/pkg/repos"
 	"github.com/gptscript-ai/gptscript/pkg/repos/runtimes/busybox"
 	"github.com/gptscript-ai/gptscript/pkg/repos/runtimes/golang"
 	"github.com/gptscript-ai/gptscript/pkg/repos/runtimes/node"
 	"github.com/gptscript-ai/gptscript/pkg/repos/runtimes/python"
+	"github.com/gptscript-ai/gptscript/pkg/types"
 )
 
 var Runtimes = []repos.Runtime{
@@ -33,3 +37,37 @@ var Runtimes = []repos.Runtime{
 func Default(cacheDir, systemDir string) engine.RuntimeManager {
 	return repos.New(cacheDir, systemDir, Runtimes...)
 }
+
+// Vendored returns the default runtime manager for programs that are loaded from a vendor directory. The runtimes are
+// not vendored, so a tool whose runtime is not set up in the cache yet fails with an error that says it needs network
+// access.
+func Vendored(cacheDir, systemDir string) engine.RuntimeManager {
+	return &vendoredManager{
+		manager: repos.New(cacheDir, systemDir, Runtimes...),
+	}
+}
+
+type vendoredManager struct {
+	manager *repos.Manager
+}
+
+func (v *vendoredManager) GetContext(ctx context.Context, tool types.Tool, cmd, env []string) (string, []string, error) {
+	wd, env, err := v.manager.GetContext(ctx, tool, cmd, env)
+	if err != nil {
+		if id := Supporting(tool, cmd); id != "" {
+			return "", nil, fmt.Errorf("failed to set up the %s runtime of %s, runtimes are not vendored and are downloaded the first time a tool needs them: %w",
+				id, tool.Name, err)
+		}
+	}
+	return wd, env, err
+}
+
+// Supporting returns the ID of the default runtime that sets up a command of a tool, or an empty string if none does.
+func Supporting(tool types.Tool, cmd []string) string {
+	for _, runtime := range Runtimes {
+		if runtime.Supports(tool, cmd) {
+			return runtime.ID()
+		}
+	}
+	return ""
+}
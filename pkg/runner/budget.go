@@ -0,0 +1,296 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// ModelPrice is the price of a model in USD per million tokens.
+type ModelPrice struct {
+	Input  float64 `json:"input,omitempty"`
+	Output float64 `json:"output,omitempty"`
+}
+
+// Prices is a price table keyed by model name.
+type Prices map[string]ModelPrice
+
+// LoadPrices reads a JSON or YAML price table from a file.
+func LoadPrices(file string) (Prices, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table %s: %w", file, err)
+	}
+
+	var prices Prices
+	if err := yaml.Unmarshal(data, &prices); err != nil {
+		return nil, fmt.Errorf("failed to parse price table %s: %w", file, err)
+	}
+	return prices, nil
+}
+
+func (p Prices) get(model string) (ModelPrice, bool) {
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+	// Models from a provider are referenced as "model from provider", fall back to the bare model name.
+	name, _, _ := strings.Cut(model, " from ")
+	price, ok := p[strings.TrimSpace(name)]
+	return price, ok
+}
+
+// UsageCost is the token usage and its cost in USD.
+type UsageCost struct {
+	Usage types.Usage `json:"usage"`
+	Cost  float64     `json:"cost,omitempty"`
+}
+
+func (u *UsageCost) add(usage types.Usage, cost float64) {
+	u.Usage.PromptTokens += usage.PromptTokens
+	u.Usage.CompletionTokens += usage.CompletionTokens
+	u.Usage.TotalTokens += usage.TotalTokens
+	u.Cost += cost
+}
+
+// BudgetUsage is the breakdown of the usage counted against a budget, by model and by tool.
+type BudgetUsage struct {
+	UsageCost `json:",inline"`
+	Models    map[string]UsageCost `json:"models,omitempty"`
+	Tools     map[string]UsageCost `json:"tools,omitempty"`
+}
+
+func (b *BudgetUsage) add(model, toolName string, usage types.Usage, cost float64) {
+	b.UsageCost.add(usage, cost)
+
+	if b.Models == nil {
+		b.Models = map[string]UsageCost{}
+	}
+	m := b.Models[model]
+	m.add(usage, cost)
+	b.Models[model] = m
+
+	if b.Tools == nil {
+		b.Tools = map[string]UsageCost{}
+	}
+	t := b.Tools[toolName]
+	t.add(usage, cost)
+	b.Tools[toolName] = t
+}
+
+func (b BudgetUsage) deepCopy() BudgetUsage {
+	result := b
+	result.Models = make(map[string]UsageCost, len(b.Models))
+	for k, v := range b.Models {
+		result.Models[k] = v
+	}
+	result.Tools = make(map[string]UsageCost, len(b.Tools))
+	for k, v := range b.Tools {
+		result.Tools[k] = v
+	}
+	return result
+}
+
+// ErrBudgetExceeded is returned when the tokens or cost used by a run, or by the calls of a tool with a
+// "Max Tokens Total" or "Max Cost" directive, exceed the limit.
+type ErrBudgetExceeded struct {
+	ToolName  string      `json:"toolName,omitempty"`
+	MaxTokens int         `json:"maxTokens,omitempty"`
+	MaxCost   float64     `json:"maxCost,omitempty"`
+	Usage     BudgetUsage `json:"usage"`
+}
+
+func (e *ErrBudgetExceeded) Error() string {
+	scope := "run"
+	if e.ToolName != "" {
+		scope = fmt.Sprintf("tool [%s]", e.ToolName)
+	}
+	if e.MaxTokens > 0 && e.Usage.Usage.TotalTokens > e.MaxTokens {
+		return fmt.Sprintf("token budget exceeded for %s: used %d of %d tokens", scope, e.Usage.Usage.TotalTokens, e.MaxTokens)
+	}
+	return fmt.Sprintf("cost budget exceeded for %s: used $%.4f of $%.4f", scope, e.Usage.Cost, e.MaxCost)
+}
+
+type budgetKey struct{}
+
+// budget tracks the usage of a run, or of the calls under a tool with its own limits. Usage is added to the
+// budget of the call and all of its parents.
+type budget struct {
+	shared    *budgetShared
+	parent    *budget
+	callID    string
+	toolName  string
+	maxTokens int
+	maxCost   float64
+	usage     BudgetUsage
+}
+
+type budgetShared struct {
+	lock   sync.Mutex
+	prices Prices
+	warned map[string]bool
+}
+
+// newBudget returns the budget of a run, which starts from the usage that the run already spent in previous turns of
+// a chat or before it was resumed from a checkpoint.
+func newBudget(prices Prices, maxTokens int, spent *BudgetUsage) *budget {
+	b := &budget{
+		shared: &budgetShared{
+			prices: prices,
+			warned: map[string]bool{},
+		},
+		maxTokens: maxTokens,
+	}
+	if spent != nil {
+		b.usage = spent.deepCopy()
+	}
+	return b
+}
+
+// checkPrices returns an error if a tool of the program sets a Max Cost that can't be enforced, because there are no
+// prices to count the cost of its calls with.
+func checkPrices(prg types.Program, prices Prices) error {
+	if len(prices) > 0 {
+		return nil
+	}
+	for _, tool := range prg.ToolSet {
+		if tool.MaxCost > 0 {
+			return fmt.Errorf("tool [%s] sets Max Cost, which needs a price table set with --price-table", tool.Name)
+		}
+	}
+	return nil
+}
+
+func budgetFromContext(ctx context.Context) *budget {
+	b, _ := ctx.Value(budgetKey{}).(*budget)
+	return b
+}
+
+// withBudget scopes a new budget to the call if its tool sets its own limits.
+func withBudget(callCtx *engine.Context) {
+	parent := budgetFromContext(callCtx.Ctx)
+	if parent == nil || parent.callID == callCtx.ID {
+		return
+	}
+	if callCtx.Tool.MaxTokensTotal == 0 && callCtx.Tool.MaxCost == 0 {
+		return
+	}
+
+	b := &budget{
+		shared:    parent.shared,
+		parent:    parent,
+		callID:    callCtx.ID,
+		toolName:  callCtx.Tool.Name,
+		maxTokens: callCtx.Tool.MaxTokensTotal,
+		maxCost:   callCtx.Tool.MaxCost,
+	}
+	if parent.parent == nil && callCtx.Parent == nil {
+		// Every call of the run is under its entry tool, so the entry tool already spent what the run did.
+		b.usage = parent.usage.deepCopy()
+	}
+	callCtx.Ctx = context.WithValue(callCtx.Ctx, budgetKey{}, b)
+}
+
+// spent returns the usage of the run that the budget is part of.
+func (b *budget) spent() *BudgetUsage {
+	b.shared.lock.Lock()
+	defer b.shared.lock.Unlock()
+
+	root := b
+	for root.parent != nil {
+		root = root.parent
+	}
+	if root.usage.Usage.TotalTokens == 0 && root.usage.Cost == 0 {
+		return nil
+	}
+	usage := root.usage.deepCopy()
+	return &usage
+}
+
+func (b *budget) add(model, toolName string, usage types.Usage) {
+	b.shared.lock.Lock()
+	defer b.shared.lock.Unlock()
+
+	var (
+		cost     float64
+		costUsed bool
+	)
+	for n := b; n != nil; n = n.parent {
+		costUsed = costUsed || n.maxCost > 0
+	}
+
+	price, ok := b.shared.prices.get(model)
+	if ok {
+		cost = (float64(usage.PromptTokens)*price.Input + float64(usage.CompletionTokens)*price.Output) / 1_000_000
+	} else if costUsed && !b.shared.warned[model] {
+		b.shared.warned[model] = true
+		log.Warnf("No price found for model [%s], its usage will not count towards the cost budget", model)
+	}
+
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+
+	for n := b; n != nil; n = n.parent {
+		n.usage.add(model, toolName, usage, cost)
+	}
+}
+
+func (b *budget) check() error {
+	b.shared.lock.Lock()
+	defer b.shared.lock.Unlock()
+
+	for n := b; n != nil; n = n.parent {
+		if (n.maxTokens > 0 && n.usage.Usage.TotalTokens > n.maxTokens) || (n.maxCost > 0 && n.usage.Cost > n.maxCost) {
+			return &ErrBudgetExceeded{
+				ToolName:  n.toolName,
+				MaxTokens: n.maxTokens,
+				MaxCost:   n.maxCost,
+				Usage:     n.usage.deepCopy(),
+			}
+		}
+	}
+	return nil
+}
+
+// budgetModel counts the usage of every completion against the budget of the call.
+type budgetModel struct {
+	engine.Model
+	budget   *budget
+	toolName string
+}
+
+func newBudgetModel(callCtx engine.Context, model engine.Model) engine.Model {
+	b := budgetFromContext(callCtx.Ctx)
+	if b == nil {
+		return model
+	}
+	return budgetModel{
+		Model:    model,
+		budget:   b,
+		toolName: callCtx.Tool.Name,
+	}
+}
+
+func (b budgetModel) Call(ctx context.Context, messageRequest types.CompletionRequest, env []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	if err := b.budget.check(); err != nil {
+		return nil, err
+	}
+
+	resp, err := b.Model.Call(ctx, messageRequest, env, status)
+	if err != nil {
+		return nil, err
+	}
+
+	// The price is the price of the model that served the call, which can be a fallback of the requested model.
+	b.budget.add(types.FirstSet(resp.Model, messageRequest.Model), b.toolName, resp.Usage)
+	if err := b.budget.check(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
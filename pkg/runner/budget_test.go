@@ -0,0 +1,159 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudgetExceeded(t *testing.T) {
+	ctx := context.Background()
+	load := func(sub string) types.Program {
+		prg, err := loader.ProgramFromSource(ctx, `
+model: test-model
+tools: sub
+
+Call sub
+
+---
+name: sub
+model: test-model
+`+sub+`
+
+Say hi
+`, "")
+		require.NoError(t, err)
+		return prg
+	}
+
+	index := 0
+	usage := types.Usage{PromptTokens: 80, CompletionTokens: 20, TotalTokens: 100}
+	newModel := func() *checkpointTestModel {
+		return &checkpointTestModel{
+			responses: []*types.CompletionMessage{
+				{
+					Role: types.CompletionMessageRoleTypeAssistant,
+					Content: []types.ContentPart{
+						{
+							ToolCall: &types.CompletionToolCall{
+								Index: &index,
+								ID:    "call_1",
+								Function: types.CompletionFunctionCall{
+									Name: "sub",
+								},
+							},
+						},
+					},
+					Usage: usage,
+				},
+				{
+					Role:    types.CompletionMessageRoleTypeAssistant,
+					Content: types.Text("hi"),
+					Usage:   usage,
+				},
+				{
+					Role:    types.CompletionMessageRoleTypeAssistant,
+					Content: types.Text("done"),
+					Usage:   usage,
+				},
+			},
+		}
+	}
+
+	r, err := New(newModel(), credentials.NoopStore{}, Options{
+		Sequential: true,
+		Prices: Prices{
+			"test-model": {Input: 1000, Output: 2000},
+		},
+	})
+	require.NoError(t, err)
+
+	out, err := r.Run(ctx, load("max tokens total: 150"), nil, "", RunOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "done", out)
+
+	// The run budget covers the calls of all tools.
+	r.c = newModel()
+	_, err = r.Run(ctx, load(""), nil, "", RunOptions{BudgetTokens: 250})
+
+	var budgetErr *ErrBudgetExceeded
+	require.True(t, errors.As(err, &budgetErr))
+	require.Equal(t, "", budgetErr.ToolName)
+	require.Equal(t, 250, budgetErr.MaxTokens)
+	require.Equal(t, 300, budgetErr.Usage.Usage.TotalTokens)
+	require.Equal(t, 100, budgetErr.Usage.Tools["sub"].Usage.TotalTokens)
+	require.Equal(t, 300, budgetErr.Usage.Models["test-model"].Usage.TotalTokens)
+
+	// Only the calls of the sub tool count towards its own limit.
+	r.c = newModel()
+	_, err = r.Run(ctx, load("max tokens total: 50"), nil, "", RunOptions{BudgetTokens: 1000})
+	require.True(t, errors.As(err, &budgetErr))
+	require.Equal(t, "sub", budgetErr.ToolName)
+	require.Equal(t, 100, budgetErr.Usage.Usage.TotalTokens)
+
+	// Each completion costs (80 * 1000 + 20 * 2000) / 1M = $0.12.
+	r.c = newModel()
+	_, err = r.Run(ctx, load("max cost: 0.1"), nil, "", RunOptions{})
+	require.True(t, errors.As(err, &budgetErr))
+	require.Equal(t, "sub", budgetErr.ToolName)
+	require.InDelta(t, 0.12, budgetErr.Usage.Cost, 0.0001)
+	require.EqualError(t, budgetErr, "cost budget exceeded for tool [sub]: used $0.1200 of $0.1000")
+}
+
+func TestBudgetAcrossChatTurns(t *testing.T) {
+	ctx := context.Background()
+	prg, err := loader.ProgramFromSource(ctx, `
+model: test-model
+chat: true
+
+Chat
+`, "")
+	require.NoError(t, err)
+
+	usage := types.Usage{PromptTokens: 80, CompletionTokens: 20, TotalTokens: 100}
+	r, err := New(&checkpointTestModel{
+		responses: []*types.CompletionMessage{
+			{Role: types.CompletionMessageRoleTypeAssistant, Content: types.Text("hi"), Usage: usage},
+			{Role: types.CompletionMessageRoleTypeAssistant, Content: types.Text("hi again"), Usage: usage},
+		},
+	}, credentials.NoopStore{}, Options{
+		Sequential: true,
+	})
+	require.NoError(t, err)
+
+	resp, err := r.Chat(ctx, nil, prg, nil, "hello", RunOptions{BudgetTokens: 150})
+	require.NoError(t, err)
+	require.Equal(t, "hi", resp.Content)
+
+	// The state of the chat carries what its turns spent, so the budget is not reset by the next turn.
+	data, err := json.Marshal(resp.State)
+	require.NoError(t, err)
+	_, err = r.Chat(ctx, string(data), prg, nil, "hello again", RunOptions{BudgetTokens: 150})
+
+	var budgetErr *ErrBudgetExceeded
+	require.True(t, errors.As(err, &budgetErr), "%v", err)
+	require.Equal(t, 200, budgetErr.Usage.Usage.TotalTokens)
+}
+
+func TestMaxCostWithoutPrices(t *testing.T) {
+	ctx := context.Background()
+	prg, err := loader.ProgramFromSource(ctx, `
+model: test-model
+max cost: 0.1
+
+Say hi
+`, "")
+	require.NoError(t, err)
+
+	r, err := New(&checkpointTestModel{}, credentials.NoopStore{}, Options{})
+	require.NoError(t, err)
+
+	_, err = r.Run(ctx, prg, nil, "", RunOptions{})
+	require.EqualError(t, err, "tool [] sets Max Cost, which needs a price table set with --price-table")
+}
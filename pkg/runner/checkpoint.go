@@ -0,0 +1,241 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// CheckpointStore persists the state of a run so that it can be resumed after a crash or interruption.
+type CheckpointStore interface {
+	Load(ctx context.Context, id string) (*Checkpoint, bool, error)
+	Save(ctx context.Context, checkpoint Checkpoint) error
+	Delete(ctx context.Context, id string) error
+}
+
+// Checkpoint is the persisted state of a run. Calls is keyed by the path of call IDs from the entry tool
+// ("/" being the entry tool itself) and holds the last known state of each call in the tree.
+type Checkpoint struct {
+	ID          string            `json:"id,omitempty"`
+	Program     string            `json:"program,omitempty"`
+	SubTool     string            `json:"subTool,omitempty"`
+	Input       string            `json:"input,omitempty"`
+	EntryToolID string            `json:"entryToolID,omitempty"`
+	Calls       map[string]*State `json:"calls,omitempty"`
+	UpdatedAt   time.Time         `json:"updatedAt,omitempty"`
+
+	// BudgetUsage is what the run spent so far, which counts towards its budget when it is resumed.
+	BudgetUsage *BudgetUsage `json:"budgetUsage,omitempty"`
+
+	// Dir is the working directory of a run of a program that was given as a relative path. The run is resumed from it,
+	// so that the program is loaded from the same relative path and its tools have the same IDs.
+	Dir string `json:"dir,omitempty"`
+}
+
+type checkpointerKey struct{}
+
+type checkpointer struct {
+	lock       sync.Mutex
+	store      CheckpointStore
+	checkpoint Checkpoint
+}
+
+func withCheckpointer(ctx context.Context, c *checkpointer) context.Context {
+	return context.WithValue(ctx, checkpointerKey{}, c)
+}
+
+func checkpointerFromContext(ctx context.Context) *checkpointer {
+	c, _ := ctx.Value(checkpointerKey{}).(*checkpointer)
+	return c
+}
+
+func (r *Runner) newCheckpointer(ctx context.Context, id string, prg types.Program, input string) (*checkpointer, error) {
+	checkpoint, ok, err := r.checkpoints.Load(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint %s: %w", id, err)
+	}
+	if !ok {
+		checkpoint = &Checkpoint{
+			ID: id,
+		}
+	}
+
+	if checkpoint.EntryToolID != "" && checkpoint.EntryToolID != prg.EntryToolID {
+		return nil, fmt.Errorf("checkpoint %s was created for a different program", id)
+	}
+	if len(checkpoint.Calls) > 0 && checkpoint.Input != input {
+		return nil, fmt.Errorf("checkpoint %s was created with different input", id)
+	}
+
+	checkpoint.EntryToolID = prg.EntryToolID
+	checkpoint.Input = input
+	if checkpoint.Calls == nil {
+		checkpoint.Calls = map[string]*State{}
+	}
+
+	return &checkpointer{
+		store:      r.checkpoints,
+		checkpoint: *checkpoint,
+	}, nil
+}
+
+// checkpointKey returns the path of call IDs from the entry tool to this call. Only regular tool calls are
+// checkpointed, context, credential, and filter tools will be run again on resume.
+func checkpointKey(callCtx engine.Context) (string, bool) {
+	var ids []string
+	for c := &callCtx; c.Parent != nil; c = c.Parent {
+		if c.ToolCategory != engine.NoCategory {
+			return "", false
+		}
+		ids = append([]string{c.ID}, ids...)
+	}
+	return "/" + strings.Join(ids, "/"), true
+}
+
+func (c *checkpointer) get(callCtx engine.Context) (*State, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	key, ok := checkpointKey(callCtx)
+	if !ok {
+		return nil, false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	state, ok := c.checkpoint.Calls[key]
+	return state, ok
+}
+
+func (c *checkpointer) save(callCtx engine.Context, state *State) error {
+	if c == nil || state == nil {
+		return nil
+	}
+
+	key, ok := checkpointKey(callCtx)
+	if !ok {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// A new state for this call makes anything saved for its sub calls obsolete.
+	prefix := strings.TrimSuffix(key, "/") + "/"
+	for k := range c.checkpoint.Calls {
+		if k != key && strings.HasPrefix(k, prefix) {
+			delete(c.checkpoint.Calls, k)
+		}
+	}
+
+	c.checkpoint.Calls[key] = state
+	c.checkpoint.UpdatedAt = time.Now()
+	if b := budgetFromContext(callCtx.Ctx); b != nil {
+		c.checkpoint.BudgetUsage = b.spent()
+	}
+
+	if err := c.store.Save(callCtx.Ctx, c.checkpoint); err != nil {
+		return fmt.Errorf("failed to save checkpoint %s: %w", c.checkpoint.ID, err)
+	}
+	return nil
+}
+
+func (c *checkpointer) delete(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	return c.store.Delete(ctx, c.checkpoint.ID)
+}
+
+type fileCheckpointStore struct {
+	dir string
+}
+
+// NewFileCheckpointStore returns a CheckpointStore that saves each checkpoint as a JSON file in dir.
+func NewFileCheckpointStore(dir string) CheckpointStore {
+	return &fileCheckpointStore{
+		dir: dir,
+	}
+}
+
+func (f *fileCheckpointStore) path(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid checkpoint id: %q", id)
+	}
+	return filepath.Join(f.dir, id+".json"), nil
+}
+
+func (f *fileCheckpointStore) Load(_ context.Context, id string) (*Checkpoint, bool, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal checkpoint %s: %w", id, err)
+	}
+	return &checkpoint, true, nil
+}
+
+func (f *fileCheckpointStore) Save(_ context.Context, checkpoint Checkpoint) error {
+	path, err := f.path(checkpoint.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(f.dir, 0700); err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename so a crash never leaves a partially written checkpoint behind.
+	tmp, err := os.CreateTemp(f.dir, checkpoint.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *fileCheckpointStore) Delete(_ context.Context, id string) error {
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
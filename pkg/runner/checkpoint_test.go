@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+type checkpointTestModel struct {
+	calls     int
+	responses []*types.CompletionMessage
+}
+
+func (c *checkpointTestModel) ProxyInfo([]string) (string, string, error) {
+	return "", "", nil
+}
+
+func (c *checkpointTestModel) Call(_ context.Context, _ types.CompletionRequest, _ []string, _ chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	c.calls++
+	if len(c.responses) == 0 {
+		return nil, errors.New("interrupted")
+	}
+	resp := c.responses[0]
+	c.responses = c.responses[1:]
+	return resp, nil
+}
+
+func TestRunResumeFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	prg, err := loader.ProgramFromSource(ctx, `
+tools: echo
+
+Call echo
+
+---
+name: echo
+
+#!sys.echo
+
+hello
+`, "")
+	require.NoError(t, err)
+
+	index := 0
+	model := &checkpointTestModel{
+		responses: []*types.CompletionMessage{
+			{
+				Role: types.CompletionMessageRoleTypeAssistant,
+				Content: []types.ContentPart{
+					{
+						ToolCall: &types.CompletionToolCall{
+							Index: &index,
+							ID:    "call_1",
+							Function: types.CompletionFunctionCall{
+								Name: "echo",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	store := NewFileCheckpointStore(t.TempDir())
+	r, err := New(model, credentials.NoopStore{}, Options{
+		Sequential:      true,
+		CheckpointStore: store,
+	})
+	require.NoError(t, err)
+
+	_, err = r.Run(ctx, prg, nil, "input", RunOptions{CheckpointID: "test"})
+	require.ErrorContains(t, err, "interrupted")
+	require.Equal(t, 2, model.calls)
+
+	checkpoint, ok, err := store.Load(ctx, "test")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "input", checkpoint.Input)
+	require.Contains(t, checkpoint.Calls, "/")
+	require.Contains(t, checkpoint.Calls, "/call_1")
+	require.Equal(t, "\nhello", *checkpoint.Calls["/call_1"].Result)
+
+	_, err = r.Run(ctx, prg, nil, "other input", RunOptions{CheckpointID: "test"})
+	require.ErrorContains(t, err, "different input")
+
+	// The resumed run should only need the final completion, the first completion and the echo call are restored.
+	model.calls = 0
+	model.responses = []*types.CompletionMessage{
+		{
+			Role:    types.CompletionMessageRoleTypeAssistant,
+			Content: types.Text("done"),
+		},
+	}
+
+	out, err := r.Run(ctx, prg, nil, "input", RunOptions{CheckpointID: "test"})
+	require.NoError(t, err)
+	require.Equal(t, "done", out)
+	require.Equal(t, 1, model.calls)
+
+	_, ok, err = store.Load(ctx, "test")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
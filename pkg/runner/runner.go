@@ -31,23 +31,34 @@ type Monitor interface {
 }
 
 type Options struct {
-	MonitorFactory      MonitorFactory        `usage:"-"`
-	RuntimeManager      engine.RuntimeManager `usage:"-"`
-	StartPort           int64                 `usage:"-"`
-	EndPort             int64                 `usage:"-"`
-	CredentialOverrides []string              `usage:"-"`
-	Sequential          bool                  `usage:"-"`
-	Authorizer          AuthorizerFunc        `usage:"-"`
-	MCPRunner           engine.MCPRunner      `usage:"-"`
+	MonitorFactory      MonitorFactory            `usage:"-"`
+	RuntimeManager      engine.RuntimeManager     `usage:"-"`
+	StartPort           int64                     `usage:"-"`
+	EndPort             int64                     `usage:"-"`
+	CredentialOverrides []string                  `usage:"-"`
+	Sequential          bool                      `usage:"-"`
+	Authorizer          AuthorizerFunc            `usage:"-"`
+	MCPRunner           engine.MCPRunner          `usage:"-"`
+	CheckpointStore     CheckpointStore           `usage:"-"`
+	Prices              Prices                    `usage:"-"`
+	Sandbox             bool                      `usage:"-"`
+	CommandInterceptor  engine.CommandInterceptor `usage:"-"`
 }
 
 type RunOptions struct {
 	UserCancel <-chan struct{}
+	// CheckpointID enables checkpointing of the run to the CheckpointStore. If a checkpoint with this ID
+	// already exists the run is resumed from it.
+	CheckpointID string
+	// BudgetTokens is the maximum number of tokens the whole run may use, zero meaning no limit.
+	BudgetTokens int
 }
 
 type AuthorizerResponse struct {
 	Accept  bool
 	Message string
+	// Remember asks for the decision to apply to later calls of the same tool, if the authorizer supports it.
+	Remember bool
 }
 
 type AuthorizerFunc func(ctx engine.Context, input string) (AuthorizerResponse, error)
@@ -65,6 +76,10 @@ func Complete(opts ...Options) (result Options) {
 		result.StartPort = types.FirstSet(opt.StartPort, result.StartPort)
 		result.EndPort = types.FirstSet(opt.EndPort, result.EndPort)
 		result.Sequential = types.FirstSet(opt.Sequential, result.Sequential)
+		result.Sandbox = types.FirstSet(opt.Sandbox, result.Sandbox)
+		if opt.CommandInterceptor != nil {
+			result.CommandInterceptor = opt.CommandInterceptor
+		}
 		if opt.Authorizer != nil {
 			result.Authorizer = opt.Authorizer
 		}
@@ -74,6 +89,12 @@ func Complete(opts ...Options) (result Options) {
 		if opt.MCPRunner != nil {
 			result.MCPRunner = opt.MCPRunner
 		}
+		if opt.CheckpointStore != nil {
+			result.CheckpointStore = opt.CheckpointStore
+		}
+		if opt.Prices != nil {
+			result.Prices = opt.Prices
+		}
 	}
 	return
 }
@@ -108,6 +129,10 @@ type Runner struct {
 	credStore      credentials.CredentialStore
 	sequential     bool
 	mcpRunner      engine.MCPRunner
+	checkpoints    CheckpointStore
+	prices         Prices
+	sandbox        bool
+	interceptor    engine.CommandInterceptor
 }
 
 func New(client engine.Model, credStore credentials.CredentialStore, opts ...Options) (*Runner, error) {
@@ -123,6 +148,10 @@ func New(client engine.Model, credStore credentials.CredentialStore, opts ...Opt
 		sequential:     opt.Sequential,
 		auth:           opt.Authorizer,
 		mcpRunner:      opt.MCPRunner,
+		checkpoints:    opt.CheckpointStore,
+		prices:         opt.Prices,
+		sandbox:        opt.Sandbox,
+		interceptor:    opt.CommandInterceptor,
 	}
 
 	if opt.StartPort != 0 {
@@ -145,6 +174,11 @@ type ChatResponse struct {
 type ChatState interface{}
 
 func (r *Runner) Chat(ctx context.Context, prevState ChatState, prg types.Program, env []string, input string, opts RunOptions) (resp ChatResponse, err error) {
+	// Chat is never checkpointed, the caller is responsible for the returned state.
+	return r.chat(withCheckpointer(ctx, nil), prevState, prg, env, input, opts)
+}
+
+func (r *Runner) chat(ctx context.Context, prevState ChatState, prg types.Program, env []string, input string, opts RunOptions) (resp ChatResponse, err error) {
 	var state *State
 
 	defer func() {
@@ -181,13 +215,26 @@ func (r *Runner) Chat(ctx context.Context, prevState ChatState, prg types.Progra
 		monitor.Stop(ctx, resp.Content, err)
 	}()
 
-	callCtx, err := engine.NewContext(ctx, &prg, input, opts.UserCancel)
+	if err := checkPrices(prg, r.prices); err != nil {
+		return resp, err
+	}
+
+	// The budget of the run counts what the previous turns of a chat, or the run before it was checkpointed, spent.
+	var spent *BudgetUsage
+	if state != nil {
+		spent = state.BudgetUsage
+	} else if checkpoints := checkpointerFromContext(ctx); checkpoints != nil && len(checkpoints.checkpoint.Calls) > 0 {
+		spent = checkpoints.checkpoint.BudgetUsage
+	}
+
+	callCtx, err := engine.NewContext(context.WithValue(ctx, budgetKey{}, newBudget(r.prices, opts.BudgetTokens, spent)), &prg, input, opts.UserCancel)
 	if err != nil {
 		return resp, err
 	}
+	withBudget(&callCtx)
 
 	if state == nil {
-		state, err = r.start(callCtx, state, monitor, env, input)
+		state, err = r.startOrRestore(callCtx, monitor, env, input)
 		if err != nil {
 			return resp, err
 		}
@@ -195,9 +242,11 @@ func (r *Runner) Chat(ctx context.Context, prevState ChatState, prg types.Progra
 		state = state.WithResumeInput(&input)
 	}
 
-	state, err = r.resume(callCtx, monitor, env, state)
-	if err != nil {
-		return resp, err
+	if state.Result == nil {
+		state, err = r.resume(callCtx, monitor, env, state)
+		if err != nil {
+			return resp, err
+		}
 	}
 
 	if state.Result != nil {
@@ -217,6 +266,7 @@ func (r *Runner) Chat(ctx context.Context, prevState ChatState, prg types.Progra
 		return resp, err
 	}
 
+	state.BudgetUsage = budgetFromContext(callCtx.Ctx).spent()
 	return ChatResponse{
 		Content: content,
 		State:   state,
@@ -225,10 +275,22 @@ func (r *Runner) Chat(ctx context.Context, prevState ChatState, prg types.Progra
 }
 
 func (r *Runner) Run(ctx context.Context, prg types.Program, env []string, input string, opts RunOptions) (output string, err error) {
-	resp, err := r.Chat(ctx, nil, prg, env, input, opts)
+	var checkpoints *checkpointer
+	if opts.CheckpointID != "" && r.checkpoints != nil {
+		checkpoints, err = r.newCheckpointer(ctx, opts.CheckpointID, prg, input)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	resp, err := r.chat(withCheckpointer(ctx, checkpoints), nil, prg, env, input, opts)
 	if err != nil {
 		return "", err
 	}
+
+	if err := checkpoints.delete(ctx); err != nil {
+		log.Warnf("failed to delete checkpoint %s: %v", opts.CheckpointID, err)
+	}
 	return resp.Content, nil
 }
 
@@ -244,6 +306,12 @@ type Event struct {
 	Usage              types.Usage            `json:"usage,omitempty"`
 	ChatResponseCached bool                   `json:"chatResponseCached,omitempty"`
 	Content            string                 `json:"content,omitempty"`
+	BudgetExceeded     *ErrBudgetExceeded     `json:"budgetExceeded,omitempty"`
+	Compaction         *types.Compaction      `json:"compaction,omitempty"`
+	// Model is the model that the chat request was sent to.
+	Model    string          `json:"model,omitempty"`
+	Fallback *types.Fallback `json:"fallback,omitempty"`
+	Queue    *types.Queue    `json:"queue,omitempty"`
 }
 
 type EventType string
@@ -255,6 +323,9 @@ var (
 	EventTypeCallSubCalls EventType = "callSubCalls"
 	EventTypeCallProgress EventType = "callProgress"
 	EventTypeChat         EventType = "callChat"
+	EventTypeCompaction   EventType = "callCompaction"
+	EventTypeFallback     EventType = "callFallback"
+	EventTypeQueue        EventType = "callQueue"
 	EventTypeCallFinish   EventType = "callFinish"
 	EventTypeRunFinish    EventType = "runFinish"
 )
@@ -294,11 +365,41 @@ func (r *Runner) getContext(callCtx engine.Context, state *State, monitor Monito
 }
 
 func (r *Runner) call(callCtx engine.Context, monitor Monitor, env []string, input string) (*State, error) {
-	result, err := r.start(callCtx, nil, monitor, env, input)
+	withBudget(&callCtx)
+
+	result, err := r.startOrRestore(callCtx, monitor, env, input)
 	if err != nil {
 		return nil, err
 	}
-	return r.resume(callCtx, monitor, env, result)
+	if result.Result != nil {
+		return result, nil
+	}
+
+	result, err = r.resume(callCtx, monitor, env, result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Result != nil {
+		if err := checkpointerFromContext(callCtx.Ctx).save(callCtx, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// startOrRestore starts the call unless the run is being resumed and a checkpoint of this call exists, in which
+// case the saved state is returned instead.
+func (r *Runner) startOrRestore(callCtx engine.Context, monitor Monitor, env []string, input string) (*State, error) {
+	checkpoints := checkpointerFromContext(callCtx.Ctx)
+	if state, ok := checkpoints.get(callCtx); ok {
+		return state, nil
+	}
+
+	state, err := r.start(callCtx, nil, monitor, env, input)
+	if err != nil {
+		return nil, err
+	}
+	return state, checkpoints.save(callCtx, state)
 }
 
 func (r *Runner) start(callCtx engine.Context, state *State, monitor Monitor, env []string, input string) (*State, error) {
@@ -335,11 +436,13 @@ func (r *Runner) start(callCtx engine.Context, state *State, monitor Monitor, en
 	}
 
 	e := engine.Engine{
-		Model:          r.c,
-		MCPRunner:      r.mcpRunner,
-		RuntimeManager: runtimeWithLogger(callCtx, monitor, r.runtimeManager),
-		Progress:       progress,
-		Env:            env,
+		Model:              newBudgetModel(callCtx, r.c),
+		MCPRunner:          r.mcpRunner,
+		RuntimeManager:     runtimeWithLogger(callCtx, monitor, r.runtimeManager),
+		Progress:           progress,
+		Env:                env,
+		Sandbox:            r.sandbox,
+		CommandInterceptor: r.interceptor,
 	}
 
 	callCtx.Ctx = context2.AddPauseFuncToCtx(callCtx.Ctx, monitor.Pause)
@@ -388,6 +491,9 @@ type State struct {
 	SubCallID   string          `json:"subCallID,omitempty"`
 
 	InputContexts []engine.InputContext `json:"inputContexts,omitempty"`
+
+	// BudgetUsage is what the chat spent so far, which counts towards the budget of its next turns.
+	BudgetUsage *BudgetUsage `json:"budgetUsage,omitempty"`
 }
 
 func (s State) WithResumeInput(input *string) *State {
@@ -534,11 +640,13 @@ func (r *Runner) resume(callCtx engine.Context, monitor Monitor, env []string, s
 		})
 
 		e := engine.Engine{
-			Model:          r.c,
-			MCPRunner:      r.mcpRunner,
-			RuntimeManager: runtimeWithLogger(callCtx, monitor, r.runtimeManager),
-			Progress:       progress,
-			Env:            env,
+			Model:              newBudgetModel(callCtx, r.c),
+			MCPRunner:          r.mcpRunner,
+			RuntimeManager:     runtimeWithLogger(callCtx, monitor, r.runtimeManager),
+			Progress:           progress,
+			Env:                env,
+			Sandbox:            r.sandbox,
+			CommandInterceptor: r.interceptor,
 		}
 
 		var contentInput string
@@ -571,6 +679,12 @@ func (r *Runner) resume(callCtx engine.Context, monitor Monitor, env []string, s
 			return nil, err
 		}
 
+		if err := checkpointerFromContext(callCtx.Ctx).save(callCtx, &State{
+			Continuation: nextContinuation,
+		}); err != nil {
+			return nil, err
+		}
+
 		state = &State{
 			Continuation: nextContinuation,
 			SubCalls:     callResults,
@@ -593,6 +707,34 @@ func streamProgress(callCtx *engine.Context, monitor Monitor) (chan<- types.Comp
 					Type:             EventTypeCallProgress,
 					ChatCompletionID: status.CompletionID,
 					Content:          getEventContent(message.String(), *callCtx),
+					Model:            status.Model,
+				})
+			} else if status.Compaction != nil {
+				monitor.Event(Event{
+					Time:             time.Now(),
+					CallContext:      callCtx.GetCallContext(),
+					Type:             EventTypeCompaction,
+					ChatCompletionID: status.CompletionID,
+					Compaction:       status.Compaction,
+					Model:            status.Model,
+				})
+			} else if status.Queue != nil {
+				monitor.Event(Event{
+					Time:             time.Now(),
+					CallContext:      callCtx.GetCallContext(),
+					Type:             EventTypeQueue,
+					ChatCompletionID: status.CompletionID,
+					Model:            status.Model,
+					Queue:            status.Queue,
+				})
+			} else if status.Fallback != nil {
+				monitor.Event(Event{
+					Time:             time.Now(),
+					CallContext:      callCtx.GetCallContext(),
+					Type:             EventTypeFallback,
+					ChatCompletionID: status.CompletionID,
+					Model:            status.Model,
+					Fallback:         status.Fallback,
 				})
 			} else {
 				monitor.Event(Event{
@@ -604,6 +746,7 @@ func streamProgress(callCtx *engine.Context, monitor Monitor) (chan<- types.Comp
 					ChatResponse:       status.Response,
 					Usage:              status.Usage,
 					ChatResponseCached: status.Cached,
+					Model:              status.Model,
 				})
 			}
 		}
@@ -644,6 +787,7 @@ func (r *Runner) subCallResume(ctx context.Context, parentContext engine.Context
 	if err != nil {
 		return nil, err
 	}
+	withBudget(&callCtx)
 
 	state, err = r.resume(callCtx, monitor, env, state)
 	if finishErr := (*engine.ErrChatFinish)(nil); errors.As(err, &finishErr) && callCtx.Tool.Chat {
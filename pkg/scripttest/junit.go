@@ -0,0 +1,115 @@
+package scripttest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteJUnit writes the results as JUnit XML, with a test suite for every spec.
+func WriteJUnit(w io.Writer, results []SpecResult) error {
+	var (
+		suites junitTestSuites
+		total  time.Duration
+	)
+
+	for _, specResult := range results {
+		suite := junitTestSuite{
+			Name: specResult.File,
+		}
+
+		if specResult.Err != nil {
+			suite.Tests, suite.Errors = 1, 1
+			suite.TestCases = append(suite.TestCases, junitTestCase{
+				Name:      "load",
+				ClassName: specResult.File,
+				Time:      seconds(0),
+				Error: &junitMessage{
+					Message: specResult.Err.Error(),
+				},
+			})
+		}
+
+		var suiteTime time.Duration
+		for _, result := range specResult.Results {
+			testCase := junitTestCase{
+				Name:      result.Name,
+				ClassName: specResult.File,
+				Time:      seconds(result.Duration),
+				SystemOut: result.Output,
+			}
+			if result.Err != nil {
+				suite.Errors++
+				testCase.Error = &junitMessage{
+					Message: result.Err.Error(),
+				}
+			} else if len(result.Failures) > 0 {
+				suite.Failures++
+				testCase.Failure = &junitMessage{
+					Message: result.Failures[0],
+					Text:    strings.Join(result.Failures, "\n"),
+				}
+			}
+			suite.Tests++
+			suiteTime += result.Duration
+			suite.TestCases = append(suite.TestCases, testCase)
+		}
+
+		suite.Time = seconds(suiteTime)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		total += suiteTime
+		suites.Suites = append(suites.Suites, suite)
+	}
+	suites.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,71 @@
+package scripttest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// mockModel returns scripted responses in order instead of calling a model.
+type mockModel struct {
+	lock      sync.Mutex
+	calls     int
+	responses []MockResponse
+}
+
+func (m *mockModel) ProxyInfo([]string) (string, string, error) {
+	return "", "", nil
+}
+
+func (m *mockModel) Call(_ context.Context, messageRequest types.CompletionRequest, _ []string, _ chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.calls++
+	if len(m.responses) == 0 {
+		return nil, fmt.Errorf("mock model has no response for call %d", m.calls)
+	}
+
+	resp := m.responses[0]
+	m.responses = m.responses[1:]
+
+	if resp.ToolCall == nil {
+		return &types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeAssistant,
+			Content: types.Text(resp.Text),
+		}, nil
+	}
+
+	args, err := jsonString(resp.ToolCall.Arguments)
+	if err != nil {
+		return nil, fmt.Errorf("invalid arguments of mock model call %d: %w", m.calls, err)
+	}
+
+	var names []string
+	for i, tool := range messageRequest.Tools {
+		if tool.Function.Name != resp.ToolCall.Name {
+			names = append(names, tool.Function.Name)
+			continue
+		}
+		return &types.CompletionMessage{
+			Role: types.CompletionMessageRoleTypeAssistant,
+			Content: []types.ContentPart{
+				{
+					ToolCall: &types.CompletionToolCall{
+						Index: &i,
+						ID:    fmt.Sprintf("call_%d", m.calls),
+						Function: types.CompletionFunctionCall{
+							Name:      tool.Function.Name,
+							Arguments: args,
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("mock model call %d calls tool %q, but the available tools are [%s]", m.calls, resp.ToolCall.Name, strings.Join(names, ", "))
+}
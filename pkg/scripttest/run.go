@@ -0,0 +1,226 @@
+package scripttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+type Runner interface {
+	Run(ctx context.Context, prg types.Program, env []string, input string, opts runner.RunOptions) (string, error)
+}
+
+// Judge decides whether the actual output is equivalent to the expected output, as judge.Judge does.
+type Judge interface {
+	Equal(ctx context.Context, expected, actual, criteria string) (bool, string, error)
+}
+
+type Options struct {
+	// Runner runs the test cases that do not mock the model.
+	Runner Runner
+	// NewMockRunner returns a runner that calls the mocked model of a test case.
+	NewMockRunner func(model engine.Model) (Runner, error)
+	// Judge is used by the test cases that expect a judge to agree with the output.
+	Judge  Judge
+	Loader loader.Options
+	Env    []string
+}
+
+// SpecResult is the result of the test cases of one spec.
+type SpecResult struct {
+	File    string
+	Results []Result
+	// Err is set if the spec could not be loaded.
+	Err error
+}
+
+type Result struct {
+	Name     string
+	Output   string
+	Duration time.Duration
+	// Failures are the assertions that failed.
+	Failures []string
+	// Err is set if the test case could not be run.
+	Err error
+}
+
+func (r Result) Passed() bool {
+	return r.Err == nil && len(r.Failures) == 0
+}
+
+// Run runs the test cases of the specs in order.
+func Run(ctx context.Context, opts Options, files ...string) []SpecResult {
+	var results []SpecResult
+	for _, file := range files {
+		result := SpecResult{
+			File: file,
+		}
+		spec, err := Load(file)
+		if err != nil {
+			result.Err = err
+		} else {
+			for _, c := range spec.Tests {
+				start := time.Now()
+				caseResult := runCase(ctx, opts, spec, c)
+				caseResult.Duration = time.Since(start)
+				result.Results = append(result.Results, caseResult)
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func runCase(ctx context.Context, opts Options, spec *Spec, c Case) (result Result) {
+	result.Name = c.Name
+
+	prg, err := loader.Program(ctx, spec.ScriptPath(), c.Tool, opts.Loader)
+	if err != nil {
+		result.Err = err
+		return
+	}
+
+	if err := mockTools(prg, c.MockTools); err != nil {
+		result.Err = err
+		return
+	}
+
+	r := opts.Runner
+	model := &mockModel{
+		responses: c.MockModel,
+	}
+	if len(c.MockModel) > 0 {
+		if opts.NewMockRunner == nil {
+			result.Err = errors.New("mocking the model is not supported")
+			return
+		}
+		r, err = opts.NewMockRunner(model)
+		if err != nil {
+			result.Err = err
+			return
+		}
+	} else if r == nil {
+		result.Err = errors.New("no runner for test cases that do not mock the model")
+		return
+	}
+
+	input, err := jsonString(c.Input)
+	if err != nil {
+		result.Err = fmt.Errorf("invalid input: %w", err)
+		return
+	}
+
+	result.Output, err = r.Run(ctx, prg, opts.Env, input, runner.RunOptions{})
+	if err != nil && c.Expect.Error == "" {
+		result.Err = err
+		return
+	}
+
+	if len(model.responses) > 0 {
+		result.Failures = append(result.Failures, fmt.Sprintf("the mock model has %d unused responses", len(model.responses)))
+	}
+
+	if c.Expect.Error != "" {
+		if err == nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("expected an error matching %q, but the run succeeded", c.Expect.Error))
+		} else if failure, checkErr := matchRegex("error", c.Expect.Error, err.Error()); checkErr != nil {
+			result.Err = checkErr
+		} else if failure != "" {
+			result.Failures = append(result.Failures, failure)
+		}
+		return
+	}
+
+	failures, err := check(ctx, opts.Judge, c.Expect, result.Output)
+	result.Failures = append(result.Failures, failures...)
+	result.Err = err
+	return
+}
+
+// mockTools replaces the tools with the names of the mocks by tools that echo the output of the mock.
+func mockTools(prg types.Program, mocks map[string]string) error {
+	found := map[string]bool{}
+	for id, tool := range prg.ToolSet {
+		output, ok := mocks[tool.Name]
+		if !ok {
+			continue
+		}
+		found[tool.Name] = true
+		tool.Instructions = types.EchoPrefix + "\n" + output
+		prg.ToolSet[id] = tool
+	}
+
+	for name := range mocks {
+		if !found[name] {
+			return fmt.Errorf("mocked tool %q is not in the program", name)
+		}
+	}
+	return nil
+}
+
+func check(ctx context.Context, judge Judge, expect Expect, output string) (failures []string, _ error) {
+	if expect.Exact != nil && strings.TrimSpace(*expect.Exact) != strings.TrimSpace(output) {
+		failures = append(failures, fmt.Sprintf("expected output %q, got %q", strings.TrimSpace(*expect.Exact), strings.TrimSpace(output)))
+	}
+
+	if expect.Regex != "" {
+		failure, err := matchRegex("output", expect.Regex, output)
+		if err != nil {
+			return nil, err
+		}
+		if failure != "" {
+			failures = append(failures, failure)
+		}
+	}
+
+	if expect.Schema != nil {
+		var data any
+		if err := json.Unmarshal([]byte(output), &data); err != nil {
+			failures = append(failures, fmt.Sprintf("expected output to be JSON: %v", err))
+		} else {
+			result, err := gojsonschema.Validate(gojsonschema.NewGoLoader(expect.Schema), gojsonschema.NewGoLoader(data))
+			if err != nil {
+				return nil, fmt.Errorf("invalid schema: %w", err)
+			}
+			for _, resultErr := range result.Errors() {
+				failures = append(failures, "output does not match the schema: "+resultErr.String())
+			}
+		}
+	}
+
+	if expect.Judge != nil {
+		if judge == nil {
+			return nil, errors.New("no judge is configured")
+		}
+		equal, reasoning, err := judge.Equal(ctx, expect.Judge.Expected, output, expect.Judge.Criteria)
+		if err != nil {
+			return nil, fmt.Errorf("failed to judge output: %w", err)
+		}
+		if !equal {
+			failures = append(failures, "judge ruled the output is not equivalent to the expected output: "+reasoning)
+		}
+	}
+
+	return failures, nil
+}
+
+func matchRegex(name, pattern, value string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s regex %q: %w", name, pattern, err)
+	}
+	if !re.MatchString(value) {
+		return fmt.Sprintf("expected %s to match %q, got %q", name, pattern, value), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,77 @@
+package scripttest
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"os"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscover(t *testing.T) {
+	files, err := Discover("testdata")
+	require.NoError(t, err)
+	require.Equal(t, []string{"testdata/greet.test.yaml", "testdata/shout.test.gpt"}, files)
+
+	spec, err := Load("testdata/shout.test.gpt")
+	require.NoError(t, err)
+	require.Equal(t, "testdata/shout.test.gpt", spec.ScriptPath())
+	require.Len(t, spec.Tests, 1)
+	require.Equal(t, "shout", spec.Tests[0].Name)
+	require.Equal(t, "shout", spec.Tests[0].Tool)
+}
+
+func TestRun(t *testing.T) {
+	files, err := Discover("testdata")
+	require.NoError(t, err)
+
+	newRunner := func(model engine.Model) (Runner, error) {
+		return runner.New(model, credentials.NoopStore{}, runner.Options{
+			Sequential: true,
+		})
+	}
+	// The test cases that do not mock the model only run commands, so this model fails if it is called.
+	r, err := newRunner(&mockModel{})
+	require.NoError(t, err)
+
+	results := Run(context.Background(), Options{
+		Runner:        r,
+		Env:           os.Environ(),
+		NewMockRunner: newRunner,
+	}, files...)
+	require.Len(t, results, 2)
+
+	greet := results[0]
+	require.NoError(t, greet.Err)
+	require.Len(t, greet.Results, 5)
+	for _, result := range greet.Results[:3] {
+		require.True(t, result.Passed(), "%s: %v %v", result.Name, result.Err, result.Failures)
+	}
+	require.Equal(t, "BOB\n", greet.Results[1].Output)
+	require.NoError(t, greet.Results[3].Err)
+	require.Equal(t, []string{`expected output "Hello, BOB!", got "Hi, bob!"`}, greet.Results[3].Failures)
+	// Unused responses of the mock model fail a test case that expects an error too.
+	require.NoError(t, greet.Results[4].Err)
+	require.Equal(t, []string{"the mock model has 1 unused responses"}, greet.Results[4].Failures)
+
+	shout := results[1]
+	require.NoError(t, shout.Err)
+	require.Len(t, shout.Results, 1)
+	require.True(t, shout.Results[0].Passed(), "%v %v", shout.Results[0].Err, shout.Results[0].Failures)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteJUnit(buf, results))
+
+	var suites junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &suites))
+	require.Equal(t, 6, suites.Tests)
+	require.Equal(t, 2, suites.Failures)
+	require.Equal(t, 0, suites.Errors)
+	require.Equal(t, "wrong greeting", suites.Suites[0].TestCases[3].Name)
+	require.NotNil(t, suites.Suites[0].TestCases[3].Failure)
+}
@@ -0,0 +1,193 @@
+// Package scripttest runs declarative test cases against GPTScript tools and reports the results as JUnit XML.
+package scripttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/parser"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// MetaDataKey is the metadata of a tool in a .test.gpt file that makes the tool a test case. It holds the test case in
+// YAML, without the name.
+const MetaDataKey = "test.yaml"
+
+var specSuffixes = []string{".test.gpt", ".test.yaml", ".test.yml"}
+
+// Spec is a file of test cases for a script.
+type Spec struct {
+	// File is the path of the spec.
+	File string `json:"-"`
+	// Script is the script the test cases run, relative to the spec. It defaults to the name of the spec without
+	// ".test", for example greet.gpt for greet.test.yaml.
+	Script string `json:"script,omitempty"`
+	Tests  []Case `json:"tests,omitempty"`
+}
+
+// Case runs a tool of the script with an input and checks its output.
+type Case struct {
+	Name string `json:"name,omitempty"`
+	// Tool is the tool of the script to run instead of the first one.
+	Tool string `json:"tool,omitempty"`
+	// Input is the input of the tool, either a string or an object of arguments.
+	Input any `json:"input,omitempty"`
+	// MockModel are the responses of the model, in order. If set, the model is not called.
+	MockModel []MockResponse `json:"mockModel,omitempty"`
+	// MockTools are the outputs of tools by name, which are returned instead of running the tools.
+	MockTools map[string]string `json:"mockTools,omitempty"`
+	Expect    Expect            `json:"expect,omitempty"`
+}
+
+// MockResponse is a response of the mocked model, either text or a call to a tool.
+type MockResponse struct {
+	Text     string    `json:"text,omitempty"`
+	ToolCall *ToolCall `json:"toolCall,omitempty"`
+}
+
+type ToolCall struct {
+	Name string `json:"name"`
+	// Arguments are either a JSON string or an object.
+	Arguments any `json:"arguments,omitempty"`
+}
+
+// Expect are the assertions on the output. All the ones that are set must pass.
+type Expect struct {
+	// Exact is the expected output, ignoring leading and trailing whitespace.
+	Exact *string `json:"exact,omitempty"`
+	// Regex is a regular expression that must match the output.
+	Regex string `json:"regex,omitempty"`
+	// Schema is a JSON schema the output must be valid JSON for.
+	Schema any `json:"schema,omitempty"`
+	// Judge asks a model whether the output is equivalent to the expected output.
+	Judge *JudgeExpect `json:"judge,omitempty"`
+	// Error is a regular expression that must match the error of the run. If not set, the run must not fail.
+	Error string `json:"error,omitempty"`
+}
+
+type JudgeExpect struct {
+	Expected string `json:"expected"`
+	// Criteria are the rules the judge uses to decide whether the output is equivalent.
+	Criteria string `json:"criteria,omitempty"`
+}
+
+// IsSpec returns whether the file is a test spec by its name.
+func IsSpec(file string) bool {
+	for _, suffix := range specSuffixes {
+		if strings.HasSuffix(file, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Discover returns the test specs in the paths, looking in directories recursively. Files are returned as given.
+func Discover(paths ...string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && path != "." && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && IsSpec(d.Name()) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
+
+// Load reads a test spec. A YAML spec lists its test cases, and in a .test.gpt file every tool with "test.yaml"
+// metadata is a test case that runs that tool.
+func Load(file string) (*Spec, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &Spec{
+		File: file,
+	}
+
+	if strings.HasSuffix(file, ".test.gpt") {
+		doc, err := parser.Parse(strings.NewReader(string(data)), parser.Options{
+			Location: file,
+		})
+		if err != nil {
+			return nil, err
+		}
+		spec.Script = filepath.Base(file)
+		for _, node := range doc.Nodes {
+			if node.ToolNode == nil || node.ToolNode.Tool.MetaData[MetaDataKey] == "" {
+				continue
+			}
+			var c Case
+			if err := yaml.Unmarshal([]byte(node.ToolNode.Tool.MetaData[MetaDataKey]), &c); err != nil {
+				return nil, fmt.Errorf("failed to parse test of tool %s in %s: %w", node.ToolNode.Tool.Name, file, err)
+			}
+			c.Name = types.FirstSet(c.Name, node.ToolNode.Tool.Name)
+			c.Tool = node.ToolNode.Tool.Name
+			spec.Tests = append(spec.Tests, c)
+		}
+	} else if err := yaml.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	if spec.Script == "" {
+		base := filepath.Base(file)
+		for _, suffix := range specSuffixes {
+			base = strings.TrimSuffix(base, suffix)
+		}
+		spec.Script = base + ".gpt"
+	}
+
+	for i := range spec.Tests {
+		if spec.Tests[i].Name == "" {
+			spec.Tests[i].Name = fmt.Sprintf("test %d", i+1)
+		}
+	}
+
+	return spec, nil
+}
+
+// ScriptPath is the path of the script relative to the current directory, unless it is a URL.
+func (s *Spec) ScriptPath() string {
+	if strings.Contains(s.Script, "://") || filepath.IsAbs(s.Script) {
+		return s.Script
+	}
+	return filepath.Join(filepath.Dir(s.File), s.Script)
+}
+
+// jsonString returns v if it is a string, and otherwise v as JSON.
+func jsonString(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
@@ -0,0 +1,284 @@
+package sdkserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	gcontext "github.com/gptscript-ai/gptscript/pkg/context"
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"sigs.k8s.io/yaml"
+)
+
+// The scopes of API keys. ScopeAll grants every scope and access to the runs, workspaces and credentials of all
+// tenants.
+const (
+	ScopeRun               = "run"
+	ScopeCredentialsRead   = "credentials:read"
+	ScopeCredentialsWrite  = "credentials:write"
+	ScopeCredentialsReveal = "credentials:reveal"
+	ScopeWorkspaces        = "workspaces"
+	ScopeDatasets          = "datasets"
+	ScopeCache             = "cache"
+	ScopeAll               = "*"
+)
+
+var (
+	scopes = []string{
+		ScopeRun,
+		ScopeCredentialsRead,
+		ScopeCredentialsWrite,
+		ScopeCredentialsReveal,
+		ScopeWorkspaces,
+		ScopeDatasets,
+		ScopeCache,
+		ScopeAll,
+	}
+	credentialContextRegexp = regexp.MustCompile("^[-a-zA-Z0-9.]+$")
+)
+
+// APIKey is a key that clients authenticate to the server with as a bearer token.
+type APIKey struct {
+	// Name identifies the key in the logs and the audit log.
+	Name string `json:"name"`
+	// Key is the key itself. KeyEnv is the environment variable the key is read from if Key is empty.
+	Key    string `json:"key,omitempty"`
+	KeyEnv string `json:"keyEnv,omitempty"`
+	// Tenant is who the key belongs to, the name of the key if empty. The runs and workspaces that are created with a key
+	// can only be used with the keys of the same tenant.
+	Tenant string `json:"tenant,omitempty"`
+	// Scopes are what the key can be used for.
+	Scopes []string `json:"scopes"`
+	// CredentialContexts are the credential contexts the key can use. "*" allows all contexts. If empty, keys with all
+	// scopes can use all contexts and other keys only the context named after their tenant.
+	CredentialContexts []string `json:"credentialContexts,omitempty"`
+}
+
+type apiKeysFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// LoadAPIKeys reads JSON or YAML API keys from a file.
+func LoadAPIKeys(file string) ([]APIKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys %s: %w", file, err)
+	}
+
+	keys, err := ParseAPIKeys(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API keys %s: %w", file, err)
+	}
+	return keys, nil
+}
+
+// ParseAPIKeys parses JSON or YAML API keys and reads the keys that are set in the environment.
+func ParseAPIKeys(data []byte) ([]APIKey, error) {
+	var file apiKeysFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+
+	for i := range file.Keys {
+		key := &file.Keys[i]
+		if key.Key == "" && key.KeyEnv != "" {
+			key.Key = os.Getenv(key.KeyEnv)
+			if key.Key == "" {
+				return nil, fmt.Errorf("environment variable %s of API key %q is not set", key.KeyEnv, key.Name)
+			}
+		}
+		if err := key.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return file.Keys, nil
+}
+
+func (k APIKey) validate() error {
+	if k.Name == "" {
+		return fmt.Errorf("API keys must have a name")
+	}
+	if k.Key == "" {
+		return fmt.Errorf("API key %q has no key", k.Name)
+	}
+	for _, scope := range k.Scopes {
+		if !slices.Contains(scopes, scope) {
+			return fmt.Errorf("API key %q has unknown scope %q, must be one of %s", k.Name, scope, strings.Join(scopes, ", "))
+		}
+	}
+	for _, c := range k.credentialContexts() {
+		if c != credentials.AllCredentialContexts && !credentialContextRegexp.MatchString(c) {
+			return fmt.Errorf("API key %q has invalid credential context %q, credential contexts must be alphanumeric", k.Name, c)
+		}
+	}
+	return nil
+}
+
+func (k APIKey) tenant() string {
+	if k.Tenant == "" {
+		return k.Name
+	}
+	return k.Tenant
+}
+
+func (k APIKey) credentialContexts() []string {
+	if len(k.CredentialContexts) == 0 && slices.Contains(k.Scopes, ScopeAll) {
+		return []string{credentials.AllCredentialContexts}
+	} else if len(k.CredentialContexts) == 0 {
+		return []string{k.tenant()}
+	}
+	return k.CredentialContexts
+}
+
+func hashAPIKey(key string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(key))
+}
+
+// indexAPIKeys indexes the keys by their hash, so that looking a key up doesn't take longer the more of it matches.
+func indexAPIKeys(keys []APIKey) (map[[sha256.Size]byte]*APIKey, error) {
+	result := make(map[[sha256.Size]byte]*APIKey, len(keys))
+	for i := range keys {
+		if err := keys[i].validate(); err != nil {
+			return nil, err
+		}
+		hash := hashAPIKey(keys[i].Key)
+		if existing, ok := result[hash]; ok {
+			return nil, fmt.Errorf("API keys %q and %q are the same", existing.Name, keys[i].Name)
+		}
+		result[hash] = &keys[i]
+	}
+	return result, nil
+}
+
+type apiKeyKey struct{}
+
+// apiKeyFromContext returns the API key of a request, which is nil if the server has no API keys.
+func apiKeyFromContext(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyKey{}).(*APIKey)
+	return key
+}
+
+// authenticate requires a valid API key if the server has any. The health check is always allowed, and the prompts of
+// the runs are authenticated with the prompt tokens of the runs instead.
+func (s *server) authenticate(next http.Handler) http.Handler {
+	if len(s.apiKeys) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || strings.HasPrefix(r.URL.Path, "/prompt/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		key := s.apiKeys[hashAPIKey(token)]
+		if !ok || key == nil {
+			writeError(gcontext.GetLogger(r.Context()), w, http.StatusUnauthorized, fmt.Errorf("invalid API key"))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, key)))
+	})
+}
+
+// hasScope returns whether the key can be used for the scope, which is always true without a key.
+func (k *APIKey) hasScope(scope string) bool {
+	return k == nil || slices.Contains(k.Scopes, ScopeAll) || slices.Contains(k.Scopes, scope)
+}
+
+// canAccess returns whether the key can use what belongs to the tenant, which is always true without a key or with
+// all scopes.
+func (k *APIKey) canAccess(tenant string) bool {
+	return k == nil || slices.Contains(k.Scopes, ScopeAll) || k.tenant() == tenant
+}
+
+// requireScope only passes the requests whose API key has the scope to the handler.
+func requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if key := apiKeyFromContext(r.Context()); !key.hasScope(scope) {
+			writeError(gcontext.GetLogger(r.Context()), w, http.StatusForbidden, fmt.Errorf("API key %q does not have the %s scope", key.Name, scope))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// allowCredentialContexts returns the credential contexts a request can use out of the ones it asks for. Without a key,
+// or with a key that allows all contexts, that's the ones it asks for. Otherwise, asking for none or for all contexts
+// is asking for the contexts of the key, and asking for any other context is an error.
+func (k *APIKey) allowCredentialContexts(requested []string) ([]string, error) {
+	if k == nil {
+		return requested, nil
+	}
+
+	allowed := k.credentialContexts()
+	if slices.Contains(allowed, credentials.AllCredentialContexts) {
+		return requested, nil
+	}
+	if len(requested) == 0 || slices.Contains(requested, credentials.AllCredentialContexts) {
+		return allowed, nil
+	}
+	for _, c := range requested {
+		if !slices.Contains(allowed, c) {
+			return nil, fmt.Errorf("API key %q cannot use credential context %q", k.Name, c)
+		}
+	}
+	return requested, nil
+}
+
+// owners records the tenants that the running runs and the confirmations were created by, so that other tenants can't
+// use them, and caches the owners of workspaces, which are recorded in the workspaces themselves.
+type owners struct {
+	lock    sync.RWMutex
+	tenants map[string]string
+}
+
+func (o *owners) set(id string, key *APIKey) {
+	if key == nil {
+		return
+	}
+	o.setTenant(id, key.tenant())
+}
+
+func (o *owners) setTenant(id, tenant string) {
+	if id == "" || tenant == "" {
+		return
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.tenants == nil {
+		o.tenants = map[string]string{}
+	}
+	o.tenants[id] = tenant
+}
+
+// tenant returns the tenant that what has the ID was created by.
+func (o *owners) tenant(id string) (string, bool) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	tenant, ok := o.tenants[id]
+	return tenant, ok
+}
+
+func (o *owners) delete(id string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	delete(o.tenants, id)
+}
+
+// owns returns whether the key can use what has the ID, which is always true without a key or with all scopes.
+func (o *owners) owns(key *APIKey, id string) bool {
+	if key == nil || slices.Contains(key.Scopes, ScopeAll) {
+		return true
+	}
+
+	tenant, ok := o.tenant(id)
+	return ok && key.canAccess(tenant)
+}
@@ -0,0 +1,216 @@
+package sdkserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gcontext "github.com/gptscript-ai/gptscript/pkg/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAPIKeys = `
+keys:
+- name: admin
+  key: admin-key
+  scopes: ["*"]
+- name: ci
+  keyEnv: TEST_CI_KEY
+  tenant: team-a
+  scopes: [run, credentials:read]
+- name: dev
+  key: dev-key
+  tenant: team-b
+  scopes: [run, workspaces]
+  credentialContexts: [team-b, shared]
+`
+
+func testServer(t *testing.T) (*server, http.Handler) {
+	t.Helper()
+	t.Setenv("TEST_CI_KEY", "ci-key")
+
+	keys, err := ParseAPIKeys([]byte(testAPIKeys))
+	require.NoError(t, err)
+	apiKeys, err := indexAPIKeys(keys)
+	require.NoError(t, err)
+
+	s := &server{
+		apiKeys: apiKeys,
+		audit: auditor{
+			file: filepath.Join(t.TempDir(), "audit.log"),
+		},
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(gcontext.GetLogger(r.Context()), w, map[string]string{"stdout": "ok"})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", ok)
+	mux.HandleFunc("GET /version", ok)
+	mux.HandleFunc("POST /credentials", requireScope(ScopeCredentialsRead, ok))
+	mux.HandleFunc("POST /credentials/reveal", s.audit.audited(requireScope(ScopeCredentialsReveal, func(w http.ResponseWriter, r *http.Request) {
+		auditEntry(r.Context()).Target = "github"
+		ok(w, r)
+	})))
+	return s, apply(mux, s.authenticate)
+}
+
+func do(t *testing.T, h http.Handler, method, path, key string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	t.Setenv("TEST_CI_KEY", "ci-key")
+	keys, err := ParseAPIKeys([]byte(testAPIKeys))
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+	assert.Equal(t, "ci-key", keys[1].Key)
+	assert.Equal(t, "admin", keys[0].tenant())
+	assert.Equal(t, []string{"team-a"}, keys[1].credentialContexts())
+	assert.Equal(t, []string{"*"}, keys[0].credentialContexts())
+
+	for _, tt := range []struct{ name, keys, err string }{
+		{name: "missing env", keys: "keys:\n- name: a\n  keyEnv: TEST_MISSING_KEY\n", err: "TEST_MISSING_KEY of API key \"a\" is not set"},
+		{name: "unknown scope", keys: "keys:\n- name: a\n  key: a\n  scopes: [admin]\n", err: `unknown scope "admin"`},
+		{name: "no name", keys: "keys:\n- key: a\n", err: "must have a name"},
+		{name: "invalid tenant context", keys: "keys:\n- name: a b\n  key: a\n", err: `invalid credential context "a b"`},
+		{name: "unknown field", keys: "keys:\n- name: a\n  key: a\n  scope: [run]\n", err: "unknown field"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseAPIKeys([]byte(tt.keys))
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+
+	_, err = indexAPIKeys([]APIKey{{Name: "a", Key: "same"}, {Name: "b", Key: "same"}})
+	assert.ErrorContains(t, err, `API keys "a" and "b" are the same`)
+}
+
+func TestAuthenticate(t *testing.T) {
+	_, h := testServer(t)
+
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/healthz", ""))
+	assert.Equal(t, http.StatusUnauthorized, do(t, h, http.MethodGet, "/version", ""))
+	assert.Equal(t, http.StatusUnauthorized, do(t, h, http.MethodGet, "/version", "wrong-key"))
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/version", "dev-key"))
+
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodPost, "/credentials", "ci-key"))
+	assert.Equal(t, http.StatusForbidden, do(t, h, http.MethodPost, "/credentials", "dev-key"))
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodPost, "/credentials", "admin-key"))
+}
+
+func TestNoAPIKeys(t *testing.T) {
+	s := &server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /credentials/reveal", requireScope(ScopeCredentialsReveal, func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, apiKeyFromContext(r.Context()))
+	}))
+	assert.Equal(t, http.StatusOK, do(t, apply(mux, s.authenticate), http.MethodPost, "/credentials/reveal", ""))
+}
+
+func TestAudit(t *testing.T) {
+	s, h := testServer(t)
+
+	assert.Equal(t, http.StatusForbidden, do(t, h, http.MethodPost, "/credentials/reveal", "ci-key"))
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodPost, "/credentials/reveal", "admin-key"))
+
+	data, err := os.ReadFile(s.audit.file)
+	require.NoError(t, err)
+
+	var entries []AuditEntry
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var entry AuditEntry
+		require.NoError(t, json.Unmarshal(line, &entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 2)
+	assert.Equal(t, "ci", entries[0].Key)
+	assert.Equal(t, "team-a", entries[0].Tenant)
+	assert.Equal(t, "POST /credentials/reveal", entries[0].Route)
+	assert.Equal(t, http.StatusForbidden, entries[0].Status)
+	assert.Equal(t, "admin", entries[1].Key)
+	assert.Equal(t, "github", entries[1].Target)
+	assert.Equal(t, http.StatusOK, entries[1].Status)
+}
+
+func TestAllowCredentialContexts(t *testing.T) {
+	key := &APIKey{Name: "dev", Tenant: "team-b", CredentialContexts: []string{"team-b", "shared"}}
+
+	contexts, err := key.allowCredentialContexts(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team-b", "shared"}, contexts)
+
+	contexts, err = key.allowCredentialContexts([]string{"*"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team-b", "shared"}, contexts)
+
+	contexts, err = key.allowCredentialContexts([]string{"shared"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shared"}, contexts)
+
+	_, err = key.allowCredentialContexts([]string{"default"})
+	assert.ErrorContains(t, err, `API key "dev" cannot use credential context "default"`)
+
+	contexts, err = (&APIKey{Name: "admin", CredentialContexts: []string{"*"}}).allowCredentialContexts([]string{"default"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default"}, contexts)
+
+	contexts, err = (*APIKey)(nil).allowCredentialContexts(nil)
+	require.NoError(t, err)
+	assert.Empty(t, contexts)
+}
+
+func TestOwners(t *testing.T) {
+	var (
+		o     owners
+		teamA = &APIKey{Name: "ci", Tenant: "team-a"}
+		alsoA = &APIKey{Name: "other", Tenant: "team-a"}
+		teamB = &APIKey{Name: "dev", Tenant: "team-b"}
+		admin = &APIKey{Name: "admin", Scopes: []string{ScopeAll}}
+	)
+
+	o.set("run-1", teamA)
+	assert.True(t, o.owns(teamA, "run-1"))
+	assert.True(t, o.owns(alsoA, "run-1"))
+	assert.False(t, o.owns(teamB, "run-1"))
+	assert.True(t, o.owns(admin, "run-1"))
+	assert.True(t, o.owns(nil, "run-1"))
+
+	// Nothing that wasn't created by a tenant belongs to it.
+	assert.False(t, o.owns(teamA, "directory:///tmp"))
+
+	o.delete("run-1")
+	assert.False(t, o.owns(teamA, "run-1"))
+}
+
+func TestPromptToken(t *testing.T) {
+	s, _ := testServer(t)
+	s.promptTokens = map[string]string{
+		"run-a": "token-a",
+		"run-b": "token-b",
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /prompt/{id}", s.prompt)
+	h := apply(mux, s.authenticate)
+
+	// A run can't prompt in another run with its own token, nor in a run that is not running.
+	assert.Equal(t, http.StatusUnauthorized, do(t, h, http.MethodPost, "/prompt/run-b", "token-a"))
+	assert.Equal(t, http.StatusUnauthorized, do(t, h, http.MethodPost, "/prompt/run-c", "token-a"))
+	assert.Equal(t, http.StatusUnauthorized, do(t, h, http.MethodPost, "/prompt/run-a", ""))
+
+	// The token of the run gets past authentication, up to decoding the prompt.
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodPost, "/prompt/run-a", "token-a"))
+}
@@ -0,0 +1,110 @@
+package sdkserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	gcontext "github.com/gptscript-ai/gptscript/pkg/context"
+)
+
+// AuditEntry is the record of one request to a sensitive route in the audit log.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestID,omitempty"`
+	// Key and Tenant are the name and tenant of the API key of the request, if the server has API keys.
+	Key    string `json:"key,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	Route  string `json:"route"`
+	// Target is what the request is about, such as the name of a credential or the ID of a confirmation.
+	Target             string   `json:"target,omitempty"`
+	CredentialContexts []string `json:"credentialContexts,omitempty"`
+	// Accept is the answer to a confirmation.
+	Accept *bool `json:"accept,omitempty"`
+	Status int   `json:"status"`
+}
+
+type auditor struct {
+	file string
+	lock sync.Mutex
+}
+
+type auditEntryKey struct{}
+
+// auditEntry returns the entry of an audited request for the handler to fill in, or an entry that isn't written if the
+// request isn't audited.
+func auditEntry(ctx context.Context) *AuditEntry {
+	if entry, ok := ctx.Value(auditEntryKey{}).(*AuditEntry); ok {
+		return entry
+	}
+	return new(AuditEntry)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// audited logs every request to the handler with its outcome, and appends it as a JSON line to the audit log if there
+// is one. Requests that are denied for their API key are logged too.
+func (a *auditor) audited(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entry := &AuditEntry{
+			Time:      time.Now(),
+			RequestID: gcontext.GetRequestID(r.Context()),
+			Route:     r.Pattern,
+		}
+		if key := apiKeyFromContext(r.Context()); key != nil {
+			entry.Key = key.Name
+			entry.Tenant = key.tenant()
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next(recorder, r.WithContext(context.WithValue(r.Context(), auditEntryKey{}, entry)))
+
+		entry.Status = recorder.status
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		a.write(r.Context(), *entry)
+	}
+}
+
+func (a *auditor) write(ctx context.Context, entry AuditEntry) {
+	logger := gcontext.GetLogger(ctx)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.Errorf("Failed to marshal audit entry: %v", err)
+		return
+	}
+
+	logger.Infof("Audit: %s", data)
+	if a.file == "" {
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	f, err := os.OpenFile(a.file, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		logger.Errorf("Failed to open audit log %s: %v", a.file, err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		logger.Errorf("Failed to write audit log %s: %v", a.file, err)
+	}
+}
@@ -0,0 +1,98 @@
+package sdkserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	gcontext "github.com/gptscript-ai/gptscript/pkg/context"
+)
+
+type cacheRequest struct {
+	// Kinds limits listing and clearing to the entries of these kinds.
+	Kinds []string `json:"kinds"`
+}
+
+// decodeCacheRequest decodes the optional body of the cache routes.
+func decodeCacheRequest(r *http.Request) ([]cache.Kind, error) {
+	req := new(cacheRequest)
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			return nil, fmt.Errorf("invalid request body: %w", err)
+		}
+	}
+
+	kinds := make([]cache.Kind, 0, len(req.Kinds))
+	for _, k := range req.Kinds {
+		kind, err := cache.ParseKind(k)
+		if err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// listCache will return the output of `gptscript cache ls`
+func (s *server) listCache(w http.ResponseWriter, r *http.Request) {
+	logger := gcontext.GetLogger(r.Context())
+	kinds, err := decodeCacheRequest(r)
+	if err != nil {
+		writeError(logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	entries, err := s.client.Cache.List(kinds...)
+	if err != nil {
+		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to list cache entries: %w", err))
+		return
+	}
+	if entries == nil {
+		entries = []cache.Entry{}
+	}
+
+	writeResponse(logger, w, map[string]any{"stdout": entries})
+}
+
+// cacheStats will return the output of `gptscript cache stats`
+func (s *server) cacheStats(w http.ResponseWriter, r *http.Request) {
+	logger := gcontext.GetLogger(r.Context())
+	stats, err := s.client.Cache.Stats()
+	if err != nil {
+		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to read cache stats: %w", err))
+		return
+	}
+
+	writeResponse(logger, w, map[string]any{"stdout": stats})
+}
+
+// pruneCache will return the output of `gptscript cache prune`
+func (s *server) pruneCache(w http.ResponseWriter, r *http.Request) {
+	logger := gcontext.GetLogger(r.Context())
+	result, err := s.client.Cache.Prune()
+	if err != nil {
+		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to prune cache: %w", err))
+		return
+	}
+
+	writeResponse(logger, w, map[string]any{"stdout": result})
+}
+
+// clearCache will return the output of `gptscript cache clear`
+func (s *server) clearCache(w http.ResponseWriter, r *http.Request) {
+	logger := gcontext.GetLogger(r.Context())
+	kinds, err := decodeCacheRequest(r)
+	if err != nil {
+		writeError(logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := s.client.Cache.Clear(kinds...)
+	if err != nil {
+		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to clear cache: %w", err))
+		return
+	}
+
+	writeResponse(logger, w, map[string]any{"stdout": result})
+}
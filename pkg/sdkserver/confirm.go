@@ -35,10 +35,12 @@ func (s *server) authorize(ctx engine.Context, input string) (runner.AuthorizerR
 	authChan = make(chan runner.AuthorizerResponse)
 	s.waitingToConfirm[ctx.ID] = authChan
 	s.lock.Unlock()
+	s.owners.set(ctx.ID, apiKeyFromContext(ctx.Ctx))
 	defer func(id string) {
 		s.lock.Lock()
 		delete(s.waitingToConfirm, id)
 		s.lock.Unlock()
+		s.owners.delete(id)
 	}(ctx.ID)
 
 	s.events.C <- event{
@@ -65,12 +67,14 @@ func (s *server) authorize(ctx engine.Context, input string) (runner.AuthorizerR
 func (s *server) confirm(w http.ResponseWriter, r *http.Request) {
 	logger := gcontext.GetLogger(r.Context())
 	id := r.PathValue("id")
+	entry := auditEntry(r.Context())
+	entry.Target = id
 
 	s.lock.RLock()
 	authChan := s.waitingToConfirm[id]
 	s.lock.RUnlock()
 
-	if authChan == nil {
+	if authChan == nil || !s.owners.owns(apiKeyFromContext(r.Context()), id) {
 		writeError(logger, w, http.StatusNotFound, fmt.Errorf("no confirmation found with id %q", id))
 		return
 	}
@@ -80,6 +84,7 @@ func (s *server) confirm(w http.ResponseWriter, r *http.Request) {
 		writeError(logger, w, http.StatusBadRequest, fmt.Errorf("failed to decode request body: %w", err))
 		return
 	}
+	entry.Accept = &authResponse.Accept
 
 	// Don't block here because, if the authorizer is no longer waiting on this then it will never unblock.
 	select {
@@ -20,9 +20,28 @@ func (s *server) initializeCredentialStore(_ context.Context, credCtxs []string)
 	return store, nil
 }
 
+// allowCredentialContexts returns the credential contexts of a request that its API key allows, or the default context
+// if there are none.
+func allowCredentialContexts(r *http.Request, requested []string) ([]string, error) {
+	result, err := apiKeyFromContext(r.Context()).allowCredentialContexts(requested)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return []string{credentials.DefaultCredentialContext}, nil
+	}
+	return result, nil
+}
+
 func (s *server) recreateAllCredentials(w http.ResponseWriter, r *http.Request) {
 	logger := gcontext.GetLogger(r.Context())
 
+	// Credentials are recreated in all contexts, so only keys that can use all contexts can recreate them.
+	if key := apiKeyFromContext(r.Context()); key != nil && !slices.Contains(key.credentialContexts(), credentials.AllCredentialContexts) {
+		writeError(logger, w, http.StatusForbidden, fmt.Errorf("API key %q cannot use all credential contexts", key.Name))
+		return
+	}
+
 	store, err := s.initializeCredentialStore(r.Context(), []string{credentials.AllCredentialContexts})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, err)
@@ -47,11 +66,15 @@ func (s *server) listCredentials(w http.ResponseWriter, r *http.Request) {
 
 	if req.AllContexts {
 		req.Context = []string{credentials.AllCredentialContexts}
-	} else if len(req.Context) == 0 {
-		req.Context = []string{credentials.DefaultCredentialContext}
 	}
 
-	store, err := s.initializeCredentialStore(r.Context(), req.Context)
+	contexts, err := allowCredentialContexts(r, req.Context)
+	if err != nil {
+		writeError(logger, w, http.StatusForbidden, err)
+		return
+	}
+
+	store, err := s.initializeCredentialStore(r.Context(), contexts)
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, err)
 		return
@@ -88,9 +111,20 @@ func (s *server) createCredential(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if cred.Context == "" {
-		cred.Context = credentials.DefaultCredentialContext
+	var requested []string
+	if cred.Context != "" {
+		requested = []string{cred.Context}
 	}
+	contexts, err := allowCredentialContexts(r, requested)
+	if err != nil {
+		writeError(logger, w, http.StatusForbidden, err)
+		return
+	}
+	cred.Context = contexts[0]
+
+	entry := auditEntry(r.Context())
+	entry.Target = cred.ToolName
+	entry.CredentialContexts = []string{cred.Context}
 
 	store, err := s.initializeCredentialStore(r.Context(), []string{cred.Context})
 	if err != nil {
@@ -114,6 +148,9 @@ func (s *server) revealCredential(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entry := auditEntry(r.Context())
+	entry.Target = req.Name
+
 	if req.Name == "" {
 		writeError(logger, w, http.StatusBadRequest, fmt.Errorf("missing credential name"))
 		return
@@ -122,11 +159,16 @@ func (s *server) revealCredential(w http.ResponseWriter, r *http.Request) {
 	if req.AllContexts || slices.Contains(req.Context, credentials.AllCredentialContexts) {
 		writeError(logger, w, http.StatusBadRequest, fmt.Errorf("allContexts is not supported for credential retrieval; please specify the specific context that the credential is in"))
 		return
-	} else if len(req.Context) == 0 {
-		req.Context = []string{credentials.DefaultCredentialContext}
 	}
 
-	store, err := s.initializeCredentialStore(r.Context(), req.Context)
+	contexts, err := allowCredentialContexts(r, req.Context)
+	if err != nil {
+		writeError(logger, w, http.StatusForbidden, err)
+		return
+	}
+	entry.CredentialContexts = contexts
+
+	store, err := s.initializeCredentialStore(r.Context(), contexts)
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, err)
 		return
@@ -149,8 +191,12 @@ func (s *server) deleteCredential(w http.ResponseWriter, r *http.Request) {
 	req := new(credentialsRequest)
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
 		writeError(logger, w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
 	}
 
+	entry := auditEntry(r.Context())
+	entry.Target = req.Name
+
 	if req.Name == "" {
 		writeError(logger, w, http.StatusBadRequest, fmt.Errorf("missing credential name"))
 		return
@@ -159,11 +205,16 @@ func (s *server) deleteCredential(w http.ResponseWriter, r *http.Request) {
 	if req.AllContexts || slices.Contains(req.Context, credentials.AllCredentialContexts) {
 		writeError(logger, w, http.StatusBadRequest, fmt.Errorf("allContexts is not supported for credential deletion; please specify the specific context that the credential is in"))
 		return
-	} else if len(req.Context) == 0 {
-		req.Context = []string{credentials.DefaultCredentialContext}
 	}
 
-	store, err := s.initializeCredentialStore(r.Context(), req.Context)
+	contexts, err := allowCredentialContexts(r, req.Context)
+	if err != nil {
+		writeError(logger, w, http.StatusForbidden, err)
+		return
+	}
+	entry.CredentialContexts = contexts
+
+	store, err := s.initializeCredentialStore(r.Context(), contexts)
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, err)
 		return
@@ -41,13 +41,19 @@ func (r datasetRequest) opts(o gptscript.Options) gptscript.Options {
 		Monitor: o.Monitor,
 		Runner:  o.Runner,
 	}
+	opts.Workspace = r.workspaceID()
+	return opts
+}
+
+func (r datasetRequest) workspaceID() string {
+	var result string
 	for _, e := range r.Env {
 		v, ok := strings.CutPrefix(e, "GPTSCRIPT_WORKSPACE_ID=")
 		if ok {
-			opts.Workspace = v
+			result = v
 		}
 	}
-	return opts
+	return result
 }
 
 func (s *server) listDatasets(w http.ResponseWriter, r *http.Request) {
@@ -64,6 +70,10 @@ func (s *server) listDatasets(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if id := req.workspaceID(); id != "" && !s.ownsWorkspace(logger, w, r, workspaceCommonRequest{Env: req.Env}, id) {
+		return
+	}
+
 	g, err := gptscript.New(r.Context(), req.opts(s.gptscriptOpts))
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to initialize gptscript: %w", err))
@@ -73,6 +83,7 @@ func (s *server) listDatasets(w http.ResponseWriter, r *http.Request) {
 
 	prg, err := loader.Program(r.Context(), s.getDatasetTool(req), "List Datasets", loader.Options{
 		Cache: g.Cache,
+		Trust: s.gptscriptOpts.Trust,
 	})
 
 	if err != nil {
@@ -122,6 +133,10 @@ func (s *server) addDatasetElements(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if id := req.workspaceID(); id != "" && !s.ownsWorkspace(logger, w, r, workspaceCommonRequest{Env: req.Env}, id) {
+		return
+	}
+
 	g, err := gptscript.New(r.Context(), req.opts(s.gptscriptOpts))
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to initialize gptscript: %w", err))
@@ -142,6 +157,7 @@ func (s *server) addDatasetElements(w http.ResponseWriter, r *http.Request) {
 
 	prg, err := loader.Program(r.Context(), s.getDatasetTool(req), "Add Elements", loader.Options{
 		Cache: g.Cache,
+		Trust: s.gptscriptOpts.Trust,
 	})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
@@ -182,6 +198,10 @@ func (s *server) listDatasetElements(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if id := req.workspaceID(); id != "" && !s.ownsWorkspace(logger, w, r, workspaceCommonRequest{Env: req.Env}, id) {
+		return
+	}
+
 	g, err := gptscript.New(r.Context(), req.opts(s.gptscriptOpts))
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to initialize gptscript: %w", err))
@@ -202,6 +222,7 @@ func (s *server) listDatasetElements(w http.ResponseWriter, r *http.Request) {
 
 	prg, err := loader.Program(r.Context(), s.getDatasetTool(req), "List Elements", loader.Options{
 		Cache: g.Cache,
+		Trust: s.gptscriptOpts.Trust,
 	})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
@@ -245,6 +266,10 @@ func (s *server) getDatasetElement(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if id := req.workspaceID(); id != "" && !s.ownsWorkspace(logger, w, r, workspaceCommonRequest{Env: req.Env}, id) {
+		return
+	}
+
 	g, err := gptscript.New(r.Context(), req.opts(s.gptscriptOpts))
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to initialize gptscript: %w", err))
@@ -265,6 +290,7 @@ func (s *server) getDatasetElement(w http.ResponseWriter, r *http.Request) {
 
 	prg, err := loader.Program(r.Context(), s.getDatasetTool(req), "Get Element", loader.Options{
 		Cache: g.Cache,
+		Trust: s.gptscriptOpts.Trust,
 	})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
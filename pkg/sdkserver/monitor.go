@@ -2,6 +2,7 @@ package sdkserver
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
@@ -91,6 +92,9 @@ func (s *Session) Stop(ctx context.Context, output string, err error) {
 	if err != nil {
 		e.Err = err.Error()
 	}
+	if budgetErr := (*runner.ErrBudgetExceeded)(nil); errors.As(err, &budgetErr) {
+		e.BudgetExceeded = budgetErr
+	}
 
 	s.runLock.Lock()
 	defer s.runLock.Unlock()
@@ -1,6 +1,7 @@
 package sdkserver
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -21,7 +22,8 @@ func (s *server) promptResponse(w http.ResponseWriter, r *http.Request) {
 	promptChan := s.waitingToPrompt[id]
 	s.lock.RUnlock()
 
-	if promptChan == nil {
+	// The ID of a prompt is the ID of its run.
+	if promptChan == nil || !s.owners.owns(apiKeyFromContext(r.Context()), id) {
 		writeError(logger, w, http.StatusNotFound, fmt.Errorf("no prompt found with id %q", id))
 		return
 	}
@@ -43,13 +45,12 @@ func (s *server) promptResponse(w http.ResponseWriter, r *http.Request) {
 
 func (s *server) prompt(w http.ResponseWriter, r *http.Request) {
 	logger := gcontext.GetLogger(r.Context())
-	if r.Header.Get("Authorization") != "Bearer "+s.token {
+	id := r.PathValue("id")
+	if !s.validPromptToken(id, r.Header.Get("Authorization")) {
 		writeError(logger, w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
 		return
 	}
 
-	id := r.PathValue("id")
-
 	s.lock.RLock()
 	promptChan := s.waitingToPrompt[id]
 	s.lock.RUnlock()
@@ -96,6 +97,15 @@ func (s *server) prompt(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// validPromptToken returns whether the authorization header has the prompt token of the run with the ID, which is
+// only given to the run, so that the prompts reach the owner of the run.
+func (s *server) validPromptToken(id, authorization string) bool {
+	s.runningLock.Lock()
+	token, ok := s.promptTokens[id]
+	s.runningLock.Unlock()
+	return ok && subtle.ConstantTimeCompare([]byte(authorization), []byte("Bearer "+token)) == 1
+}
+
 func writePromptResponse(logger mvl.Logger, w http.ResponseWriter, code int, resp any) {
 	b, err := json.Marshal(resp)
 	if err != nil {
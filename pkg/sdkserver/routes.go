@@ -1,19 +1,24 @@
 package sdkserver
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 
+	"github.com/google/uuid"
 	"github.com/gptscript-ai/broadcaster"
+	"github.com/gptscript-ai/gptscript/pkg/auth"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
 	gcontext "github.com/gptscript-ai/gptscript/pkg/context"
 	"github.com/gptscript-ai/gptscript/pkg/engine"
 	"github.com/gptscript-ai/gptscript/pkg/gptscript"
 	"github.com/gptscript-ai/gptscript/pkg/input"
+	"github.com/gptscript-ai/gptscript/pkg/lint"
 	"github.com/gptscript-ai/gptscript/pkg/loader"
 	"github.com/gptscript-ai/gptscript/pkg/openai"
 	"github.com/gptscript-ai/gptscript/pkg/parser"
@@ -30,7 +35,13 @@ type server struct {
 	serverToolsEnv             []string
 	client                     *gptscript.GPTScript
 	mcpLoader                  loader.MCPLoader
+	policy                     *auth.PolicyAuthorizer
 	events                     *broadcaster.Broadcaster[event]
+	apiKeys                    map[[sha256.Size]byte]*APIKey
+	owners                     owners
+	workspaceOwners            owners
+	audit                      auditor
+	runs                       *runStore
 
 	runtimeManager engine.RuntimeManager
 
@@ -38,8 +49,10 @@ type server struct {
 	waitingToConfirm map[string]chan runner.AuthorizerResponse
 	waitingToPrompt  map[string]chan map[string]string
 
-	runningLock sync.Mutex
-	running     map[string]chan struct{}
+	// runningLock guards the cancel channels and the prompt tokens of the running runs.
+	runningLock  sync.Mutex
+	running      map[string]chan struct{}
+	promptTokens map[string]string
 }
 
 func (s *server) addRoutes(mux *http.ServeMux) {
@@ -51,45 +64,57 @@ func (s *server) addRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /list-tools", s.listTools)
 	mux.HandleFunc("GET /list-tools", s.listTools)
 	// Listing models supports listing OpenAI models (GET) or listing models from providers (POST).
-	mux.HandleFunc("POST /list-models", s.listModels)
-	mux.HandleFunc("GET /list-models", s.listModels)
+	mux.HandleFunc("POST /list-models", requireScope(ScopeRun, s.listModels))
+	mux.HandleFunc("GET /list-models", requireScope(ScopeRun, s.listModels))
 
-	mux.HandleFunc("POST /run", s.execHandler)
-	mux.HandleFunc("POST /evaluate", s.execHandler)
-	mux.HandleFunc("POST /abort/{run_id}", s.abort)
+	mux.HandleFunc("POST /run", requireScope(ScopeRun, s.execHandler))
+	mux.HandleFunc("POST /evaluate", requireScope(ScopeRun, s.execHandler))
+	mux.HandleFunc("POST /abort/{run_id}", requireScope(ScopeRun, s.abort))
 
-	mux.HandleFunc("POST /load", s.load)
+	mux.HandleFunc("GET /runs", requireScope(ScopeRun, s.listRuns))
+	mux.HandleFunc("GET /runs/{run_id}", requireScope(ScopeRun, s.getRun))
+	mux.HandleFunc("GET /runs/{run_id}/events", requireScope(ScopeRun, s.runEvents))
 
-	mux.HandleFunc("POST /parse", s.parse)
-	mux.HandleFunc("POST /fmt", s.fmtDocument)
+	// Loading, parsing and linting read the files of the server, like running does.
+	mux.HandleFunc("POST /load", requireScope(ScopeRun, s.load))
 
-	mux.HandleFunc("POST /confirm/{id}", s.confirm)
+	mux.HandleFunc("POST /parse", requireScope(ScopeRun, s.parse))
+	mux.HandleFunc("POST /lint", requireScope(ScopeRun, s.lint))
+	mux.HandleFunc("POST /fmt", requireScope(ScopeRun, s.fmtDocument))
+
+	mux.HandleFunc("POST /confirm/{id}", s.audit.audited(requireScope(ScopeRun, s.confirm)))
 	mux.HandleFunc("POST /prompt/{id}", s.prompt)
-	mux.HandleFunc("POST /prompt-response/{id}", s.promptResponse)
-
-	mux.HandleFunc("POST /credentials", s.listCredentials)
-	mux.HandleFunc("POST /credentials/create", s.createCredential)
-	mux.HandleFunc("POST /credentials/reveal", s.revealCredential)
-	mux.HandleFunc("POST /credentials/delete", s.deleteCredential)
-	mux.HandleFunc("POST /credentials/recreate-all", s.recreateAllCredentials)
-
-	mux.HandleFunc("POST /datasets", s.listDatasets)
-	mux.HandleFunc("POST /datasets/list-elements", s.listDatasetElements)
-	mux.HandleFunc("POST /datasets/get-element", s.getDatasetElement)
-	mux.HandleFunc("POST /datasets/add-elements", s.addDatasetElements)
-
-	mux.HandleFunc("POST /workspaces/create", s.createWorkspace)
-	mux.HandleFunc("POST /workspaces/delete", s.deleteWorkspace)
-	mux.HandleFunc("POST /workspaces/list", s.listWorkspaceContents)
-	mux.HandleFunc("POST /workspaces/remove-all-with-prefix", s.removeAllWithPrefixInWorkspace)
-	mux.HandleFunc("POST /workspaces/write-file", s.writeFileInWorkspace)
-	mux.HandleFunc("POST /workspaces/delete-file", s.removeFileInWorkspace)
-	mux.HandleFunc("POST /workspaces/read-file", s.readFileInWorkspace)
-	mux.HandleFunc("POST /workspaces/read-file-with-revision", s.readFileWithRevisionInWorkspace)
-	mux.HandleFunc("POST /workspaces/stat-file", s.statFileInWorkspace)
-	mux.HandleFunc("POST /workspaces/list-revisions", s.listRevisions)
-	mux.HandleFunc("POST /workspaces/get-revision", s.getRevisionForFileInWorkspace)
-	mux.HandleFunc("POST /workspaces/delete-revision", s.deleteRevisionForFileInWorkspace)
+	mux.HandleFunc("POST /prompt-response/{id}", requireScope(ScopeRun, s.promptResponse))
+
+	mux.HandleFunc("POST /credentials", requireScope(ScopeCredentialsRead, s.listCredentials))
+	mux.HandleFunc("POST /credentials/create", s.audit.audited(requireScope(ScopeCredentialsWrite, s.createCredential)))
+	mux.HandleFunc("POST /credentials/reveal", s.audit.audited(requireScope(ScopeCredentialsReveal, s.revealCredential)))
+	mux.HandleFunc("POST /credentials/delete", s.audit.audited(requireScope(ScopeCredentialsWrite, s.deleteCredential)))
+	mux.HandleFunc("POST /credentials/recreate-all", s.audit.audited(requireScope(ScopeCredentialsWrite, s.recreateAllCredentials)))
+
+	mux.HandleFunc("POST /cache", requireScope(ScopeCache, s.listCache))
+	mux.HandleFunc("POST /cache/stats", requireScope(ScopeCache, s.cacheStats))
+	// The cache is shared by all tenants, so only keys with all scopes can remove its entries.
+	mux.HandleFunc("POST /cache/prune", requireScope(ScopeAll, s.pruneCache))
+	mux.HandleFunc("POST /cache/clear", requireScope(ScopeAll, s.clearCache))
+
+	mux.HandleFunc("POST /datasets", requireScope(ScopeDatasets, s.listDatasets))
+	mux.HandleFunc("POST /datasets/list-elements", requireScope(ScopeDatasets, s.listDatasetElements))
+	mux.HandleFunc("POST /datasets/get-element", requireScope(ScopeDatasets, s.getDatasetElement))
+	mux.HandleFunc("POST /datasets/add-elements", requireScope(ScopeDatasets, s.addDatasetElements))
+
+	mux.HandleFunc("POST /workspaces/create", requireScope(ScopeWorkspaces, s.createWorkspace))
+	mux.HandleFunc("POST /workspaces/delete", requireScope(ScopeWorkspaces, s.deleteWorkspace))
+	mux.HandleFunc("POST /workspaces/list", requireScope(ScopeWorkspaces, s.listWorkspaceContents))
+	mux.HandleFunc("POST /workspaces/remove-all-with-prefix", requireScope(ScopeWorkspaces, s.removeAllWithPrefixInWorkspace))
+	mux.HandleFunc("POST /workspaces/write-file", requireScope(ScopeWorkspaces, s.writeFileInWorkspace))
+	mux.HandleFunc("POST /workspaces/delete-file", requireScope(ScopeWorkspaces, s.removeFileInWorkspace))
+	mux.HandleFunc("POST /workspaces/read-file", requireScope(ScopeWorkspaces, s.readFileInWorkspace))
+	mux.HandleFunc("POST /workspaces/read-file-with-revision", requireScope(ScopeWorkspaces, s.readFileWithRevisionInWorkspace))
+	mux.HandleFunc("POST /workspaces/stat-file", requireScope(ScopeWorkspaces, s.statFileInWorkspace))
+	mux.HandleFunc("POST /workspaces/list-revisions", requireScope(ScopeWorkspaces, s.listRevisions))
+	mux.HandleFunc("POST /workspaces/get-revision", requireScope(ScopeWorkspaces, s.getRevisionForFileInWorkspace))
+	mux.HandleFunc("POST /workspaces/delete-revision", requireScope(ScopeWorkspaces, s.deleteRevisionForFileInWorkspace))
 }
 
 // health just provides an endpoint for checking whether the server is running and accessible.
@@ -168,12 +193,27 @@ func (s *server) execHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := gserver.ContextWithNewRunID(r.Context())
+	key := apiKeyFromContext(r.Context())
+	credentialContexts, err := key.allowCredentialContexts(reqObject.CredentialContexts)
+	if err != nil {
+		writeError(logger, w, http.StatusForbidden, err)
+		return
+	}
+	if reqObject.Workspace != "" && !s.ownsWorkspace(logger, w, r, workspaceCommonRequest{Env: reqObject.Env}, reqObject.Workspace) {
+		return
+	}
+
+	// The runs are stored across restarts of the server, so their IDs are unique instead of counted from the start.
+	ctx := gserver.ContextWithRunID(r.Context(), uuid.NewString())
 	runID := gserver.RunIDFromContext(ctx)
 	cancel := make(chan struct{})
+	promptToken := uuid.NewString()
 	s.runningLock.Lock()
 	s.running[runID] = cancel
+	s.promptTokens[runID] = promptToken
 	s.runningLock.Unlock()
+	s.owners.set(runID, key)
+	defer s.owners.delete(runID)
 
 	defer func() {
 		s.runningLock.Lock()
@@ -183,6 +223,7 @@ func (s *server) execHandler(w http.ResponseWriter, r *http.Request) {
 			close(cancel)
 		}
 		delete(s.running, runID)
+		delete(s.promptTokens, runID)
 		s.runningLock.Unlock()
 	}()
 
@@ -191,18 +232,12 @@ func (s *server) execHandler(w http.ResponseWriter, r *http.Request) {
 		reqObject.ChatState = "null"
 	}
 
-	// Don't overwrite the PromptURLEnvVar if it is already set in the environment.
-	var promptTokenAlreadySet bool
-	for _, env := range reqObject.Env {
-		if v, ok := strings.CutPrefix(env, types.PromptTokenEnvVar+"="); ok && v != "" {
-			promptTokenAlreadySet = true
-			break
-		}
-	}
-	if !promptTokenAlreadySet {
-		// Append a prompt URL for this run.
-		reqObject.Env = append(reqObject.Env, fmt.Sprintf("%s=http://%s/prompt/%s", types.PromptURLEnvVar, s.address, runID), fmt.Sprintf("%s=%s", types.PromptTokenEnvVar, s.token))
-	}
+	// The prompts of the run are sent to the prompt URL of the run with its own token, which the request can't override,
+	// so that a run can't prompt in the runs of others.
+	reqObject.Env = slices.DeleteFunc(reqObject.Env, func(env string) bool {
+		return strings.HasPrefix(env, types.PromptURLEnvVar+"=") || strings.HasPrefix(env, types.PromptTokenEnvVar+"=")
+	})
+	reqObject.Env = append(reqObject.Env, fmt.Sprintf("%s=http://%s/prompt/%s", types.PromptURLEnvVar, s.address, runID), fmt.Sprintf("%s=%s", types.PromptTokenEnvVar, promptToken))
 
 	logger.Debugf("executing tool: %+v", reqObject)
 	var (
@@ -221,21 +256,31 @@ func (s *server) execHandler(w http.ResponseWriter, r *http.Request) {
 		OpenAI:             openai.Options(reqObject.openAIOptions),
 		Env:                reqObject.Env,
 		Workspace:          reqObject.Workspace,
-		CredentialContexts: reqObject.CredentialContexts,
+		CredentialContexts: credentialContexts,
 		Runner: runner.Options{
 			// Set the monitor factory so that we can get events from the server.
 			MonitorFactory:      NewSessionFactory(s.events),
 			CredentialOverrides: reqObject.CredentialOverrides,
 			Sequential:          reqObject.ForceSequential,
+			Sandbox:             reqObject.Sandbox,
 		},
 		DefaultModelProvider: reqObject.DefaultModelProvider,
 	}
 
-	if reqObject.Confirm {
+	if s.policy != nil {
+		var ask runner.AuthorizerFunc
+		if reqObject.Confirm {
+			ask = s.authorize
+		}
+		opts.Runner.Authorizer = s.policy.Authorizer(ask)
+	} else if reqObject.Confirm {
 		opts.Runner.Authorizer = s.authorize
 	}
 
-	s.execAndStream(ctx, programLoader, logger, w, opts, reqObject.ChatState, reqObject.Input, reqObject.SubTool, def, cancel)
+	s.execAndStream(ctx, programLoader, logger, w, opts, reqObject.ChatState, reqObject.Input, reqObject.SubTool, def, runner.RunOptions{
+		UserCancel:   cancel,
+		BudgetTokens: reqObject.BudgetTokens,
+	})
 }
 
 // abort will abort the run in a way such that the chat state will be returned.
@@ -247,6 +292,11 @@ func (s *server) abort(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.owners.owns(apiKeyFromContext(r.Context()), runID) {
+		writeResponse(logger, w, "run not found")
+		return
+	}
+
 	s.runningLock.Lock()
 	cancel := s.running[runID]
 	delete(s.running, runID)
@@ -287,16 +337,19 @@ func (s *server) load(w http.ResponseWriter, r *http.Request) {
 		prg, err = loader.ProgramFromSource(ctx, reqObject.Content, reqObject.SubTool, loader.Options{
 			Cache:     s.client.Cache,
 			MCPLoader: s.mcpLoader,
+			Trust:     s.gptscriptOpts.Trust,
 		})
 	} else if reqObject.File != "" {
 		prg, err = loader.Program(ctx, reqObject.File, reqObject.SubTool, loader.Options{
 			Cache:     s.client.Cache,
 			MCPLoader: s.mcpLoader,
+			Trust:     s.gptscriptOpts.Trust,
 		})
 	} else {
 		prg, err = loader.ProgramFromSource(ctx, reqObject.ToolDefs.String(), reqObject.SubTool, loader.Options{
 			Cache:     s.client.Cache,
 			MCPLoader: s.mcpLoader,
+			Trust:     s.gptscriptOpts.Trust,
 		})
 	}
 	if err != nil {
@@ -307,6 +360,49 @@ func (s *server) load(w http.ResponseWriter, r *http.Request) {
 	writeResponse(logger, w, map[string]any{"stdout": map[string]any{"program": prg}})
 }
 
+// lint will check the program for problems like broken tool references and return the diagnostics.
+func (s *server) lint(w http.ResponseWriter, r *http.Request) {
+	logger := gcontext.GetLogger(r.Context())
+	reqObject := new(lintRequest)
+	if err := json.NewDecoder(r.Body).Decode(reqObject); err != nil {
+		writeError(logger, w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	logger.Debugf("linting file: file=%s, content=%s", reqObject.File, reqObject.Content)
+
+	ctx := r.Context()
+	if reqObject.DisableCache {
+		ctx = cache.WithNoCache(ctx)
+	}
+
+	content := reqObject.Content
+	if content == "" && reqObject.File == "" {
+		content = reqObject.ToolDefs.String()
+	}
+
+	diagnostics, err := lint.Lint(ctx, reqObject.File, content, lint.Options{
+		Loader: loader.Options{
+			Cache:     s.client.Cache,
+			MCPLoader: s.mcpLoader,
+			Trust:     s.gptscriptOpts.Trust,
+		},
+	})
+	if err != nil {
+		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
+		return
+	}
+
+	if reqObject.Format == "sarif" {
+		writeResponse(logger, w, map[string]any{"stdout": lint.ToSARIF(diagnostics, lint.DefaultRules()...)})
+		return
+	}
+	if diagnostics == nil {
+		diagnostics = []lint.Diagnostic{}
+	}
+	writeResponse(logger, w, map[string]any{"stdout": map[string]any{"diagnostics": diagnostics}})
+}
+
 // parse will parse the file and return the corresponding Document.
 func (s *server) parse(w http.ResponseWriter, r *http.Request) {
 	logger := gcontext.GetLogger(r.Context())
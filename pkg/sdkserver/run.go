@@ -24,7 +24,7 @@ func loaderWithLocation(f loaderFunc, loc string) loaderFunc {
 	}
 }
 
-func (s *server) execAndStream(ctx context.Context, programLoader loaderFunc, logger mvl.Logger, w http.ResponseWriter, opts gptscript.Options, chatState, input, subTool string, toolDef fmt.Stringer, cancel <-chan struct{}) {
+func (s *server) execAndStream(ctx context.Context, programLoader loaderFunc, logger mvl.Logger, w http.ResponseWriter, opts gptscript.Options, chatState, input, subTool string, toolDef fmt.Stringer, runOpts runner.RunOptions) {
 	g, err := gptscript.New(ctx, s.gptscriptOpts, opts)
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to initialize gptscript: %w", err))
@@ -40,6 +40,7 @@ func (s *server) execAndStream(ctx context.Context, programLoader loaderFunc, lo
 		Cache:        g.Cache,
 		DefaultModel: defaultModel,
 		MCPLoader:    s.mcpLoader,
+		Trust:        s.gptscriptOpts.Trust,
 	})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
@@ -52,9 +53,7 @@ func (s *server) execAndStream(ctx context.Context, programLoader loaderFunc, lo
 	defer events.Close()
 
 	go func() {
-		run, err := g.Chat(ctx, chatState, prg, opts.Env, input, runner.RunOptions{
-			UserCancel: cancel,
-		})
+		run, err := g.Chat(ctx, chatState, prg, opts.Env, input, runOpts)
 		if err != nil {
 			errChan <- err
 		} else {
@@ -64,29 +63,39 @@ func (s *server) execAndStream(ctx context.Context, programLoader loaderFunc, lo
 		close(programOutput)
 	}()
 
-	processEventStreamOutput(logger, w, gserver.RunIDFromContext(ctx), events.C, programOutput, errChan)
+	var (
+		id     = gserver.RunIDFromContext(ctx)
+		tenant string
+	)
+	if key := apiKeyFromContext(ctx); key != nil {
+		tenant = key.tenant()
+	}
+	processEventStreamOutput(logger, w, id, s.runs.start(logger, id, tenant), events.C, programOutput, errChan)
 }
 
-// processEventStreamOutput will stream the events of the tool to the response as server sent events.
-// If an error occurs, then an event with the error will also be sent.
-func processEventStreamOutput(logger mvl.Logger, w http.ResponseWriter, id string, events <-chan event, output <-chan runner.ChatResponse, errChan chan error) {
+// processEventStreamOutput will stream the events of the tool to the response as server sent events, and record them
+// in the run store. If an error occurs, then an event with the error will also be sent.
+func processEventStreamOutput(logger mvl.Logger, w http.ResponseWriter, id string, recorder *runRecorder, events <-chan event, output <-chan runner.ChatResponse, errChan chan error) {
 	run := newRun(id)
 	setStreamingHeaders(w)
 
-	streamEvents(logger, w, run, events)
+	streamEvents(logger, w, run, recorder, events)
 
+	var runErr string
 	select {
 	case out := <-output:
 		run.processStdout(out)
 
-		writeServerSentEvent(logger, w, map[string]any{
+		recorder.write(logger, w, run, map[string]any{
 			"stdout": out,
 		})
 	case err := <-errChan:
-		writeServerSentEvent(logger, w, map[string]any{
-			"stderr": err.Error(),
+		runErr = err.Error()
+		recorder.write(logger, w, run, map[string]any{
+			"stderr": runErr,
 		})
 	}
+	recorder.finish(logger, run, runErr)
 
 	// Now that we have received all events, send the DONE event.
 	writeServerSentEvent(logger, w, "[DONE]")
@@ -95,14 +104,14 @@ func processEventStreamOutput(logger mvl.Logger, w http.ResponseWriter, id strin
 }
 
 // streamEvents will stream the events of the tool to the response as server sent events.
-func streamEvents(logger mvl.Logger, w http.ResponseWriter, run *runInfo, events <-chan event) {
+func streamEvents(logger mvl.Logger, w http.ResponseWriter, run *runInfo, recorder *runRecorder, events <-chan event) {
 	logger.Debugf("receiving events")
 	for e := range events {
 		if e.RunID != run.ID {
 			continue
 		}
 
-		writeServerSentEvent(logger, w, run.process(e))
+		recorder.write(logger, w, run, run.process(e))
 
 		if e.Type == runner.EventTypeRunFinish {
 			break
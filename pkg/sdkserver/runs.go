@@ -0,0 +1,554 @@
+package sdkserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gcontext "github.com/gptscript-ai/gptscript/pkg/context"
+	"github.com/gptscript-ai/gptscript/pkg/mvl"
+)
+
+var errRunNotFound = errors.New("run not found")
+
+// runSummary is what is listed of a run.
+type runSummary struct {
+	ID     string `json:"id"`
+	Tenant string `json:"tenant,omitempty"`
+	// Tool is the name of the entry tool of the program of the run.
+	Tool   string    `json:"tool,omitempty"`
+	Input  string    `json:"input,omitempty"`
+	State  runState  `json:"state"`
+	Error  string    `json:"error,omitempty"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Events int       `json:"events"`
+}
+
+// runDetail is a run as it is rebuilt from its events: the last state of the run and of each of its calls.
+type runDetail struct {
+	runSummary `json:",inline"`
+	Run        json.RawMessage            `json:"run,omitempty"`
+	Calls      map[string]json.RawMessage `json:"calls"`
+	Stdout     json.RawMessage            `json:"stdout,omitempty"`
+	Stderr     string                     `json:"stderr,omitempty"`
+}
+
+type storedRun struct {
+	summary runSummary
+	// events are kept in memory while the run is in flight, or for as long as the run is kept if it isn't persisted.
+	// Otherwise, they are read from the events file of the run.
+	events    [][]byte
+	persisted bool
+	done      bool
+	// changed is closed and replaced whenever an event is added or the run is done.
+	changed chan struct{}
+	file    *os.File
+}
+
+// runStore keeps the events the server streams for each run, so that clients can list past runs and replay their
+// events after disconnecting. If it has a directory, runs are persisted as a directory per run with the summary of
+// the run in run.json and its events in events.jsonl, and are loaded again when the server restarts.
+type runStore struct {
+	dir       string
+	retention time.Duration
+	maxRuns   int
+
+	lock sync.Mutex
+	runs map[string]*storedRun
+}
+
+func newRunStore(dir string, retention time.Duration, maxRuns int) (*runStore, error) {
+	s := &runStore{
+		dir:       dir,
+		retention: retention,
+		maxRuns:   maxRuns,
+		runs:      map[string]*storedRun{},
+	}
+	if dir == "" {
+		return s, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create run store %s: %w", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run store %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name(), "run.json"))
+		if err != nil {
+			continue
+		}
+		var summary runSummary
+		if err := json.Unmarshal(data, &summary); err != nil || summary.ID != entry.Name() {
+			continue
+		}
+		if summary.State == Creating || summary.State == Running {
+			summary.State = Error
+			summary.Error = "the server stopped before the run finished"
+		}
+		if summary.End.IsZero() {
+			summary.End = summary.Start
+		}
+		s.runs[summary.ID] = &storedRun{
+			summary:   summary,
+			persisted: true,
+			done:      true,
+			changed:   make(chan struct{}),
+		}
+	}
+
+	s.prune()
+	return s, nil
+}
+
+func (s *runStore) runDir(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid run id: %q", id)
+	}
+	return filepath.Join(s.dir, id), nil
+}
+
+func (s *runStore) saveSummary(summary runSummary) error {
+	dir, err := s.runDir(summary.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename so a crash never leaves a partially written summary behind.
+	tmp, err := os.CreateTemp(dir, "run.*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, "run.json"))
+}
+
+// runRecorder records the events of a run as they are streamed to the client that started it.
+type runRecorder struct {
+	store *runStore
+	run   *storedRun
+}
+
+// start starts recording a run. Failing to persist the run doesn't fail it, it is only kept in memory.
+func (s *runStore) start(logger mvl.Logger, id, tenant string) *runRecorder {
+	run := &storedRun{
+		summary: runSummary{
+			ID:     id,
+			Tenant: tenant,
+			State:  Creating,
+			Start:  time.Now(),
+		},
+		changed: make(chan struct{}),
+	}
+
+	if s.dir != "" {
+		if err := s.create(run); err != nil {
+			logger.Errorf("failed to persist run %s: %v", id, err)
+			if run.file != nil {
+				_ = run.file.Close()
+				run.file = nil
+			}
+		}
+	}
+
+	s.lock.Lock()
+	s.runs[id] = run
+	s.lock.Unlock()
+
+	return &runRecorder{
+		store: s,
+		run:   run,
+	}
+}
+
+// create persists a new run. It fails if a run with the same ID was already persisted, so that a run never takes
+// over the events of another.
+func (s *runStore) create(run *storedRun) error {
+	dir, err := s.runDir(run.summary.ID)
+	if err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return err
+	}
+	if err := s.saveSummary(run.summary); err != nil {
+		return err
+	}
+	run.file, err = os.OpenFile(filepath.Join(dir, "events.jsonl"), os.O_APPEND|os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	run.persisted = true
+	return nil
+}
+
+// updateSummary copies the state of the run into the summary. The lock of the store must be held.
+func (r *runRecorder) updateSummary(run *runInfo) {
+	summary := &r.run.summary
+	summary.State = run.State
+	summary.Input = run.Input
+	summary.Error = run.Error
+	summary.End = run.End
+	if !run.Start.IsZero() {
+		summary.Start = run.Start
+	}
+	if tool, ok := run.Program.ToolSet[run.Program.EntryToolID]; ok {
+		summary.Tool = tool.Name
+	}
+}
+
+// write records an event of the run and writes it to the client as a server sent event.
+func (r *runRecorder) write(logger mvl.Logger, w http.ResponseWriter, run *runInfo, event any) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		logger.Warnf("failed to marshal event: %v", err)
+		return
+	}
+
+	r.store.lock.Lock()
+	r.updateSummary(run)
+	r.run.summary.Events++
+	if r.run.file != nil {
+		if _, err := r.run.file.Write(append(data, '\n')); err != nil {
+			// The events are still kept in memory, so the run stays complete until the server restarts.
+			logger.Errorf("failed to persist event of run %s: %v", r.run.summary.ID, err)
+			_ = r.run.file.Close()
+			r.run.file = nil
+			r.run.persisted = false
+		}
+	}
+	r.run.events = append(r.run.events, data)
+	close(r.run.changed)
+	r.run.changed = make(chan struct{})
+	r.store.lock.Unlock()
+
+	writeServerSentEvent(logger, w, json.RawMessage(data))
+}
+
+// finish marks the run as done and removes the runs that are past the retention of the store.
+func (r *runRecorder) finish(logger mvl.Logger, run *runInfo, err string) {
+	r.store.lock.Lock()
+	r.updateSummary(run)
+	if err != "" {
+		r.run.summary.State = Error
+		r.run.summary.Error = err
+	}
+	if r.run.summary.End.IsZero() {
+		r.run.summary.End = time.Now()
+	}
+	summary := r.run.summary
+	if r.run.file != nil {
+		if err := r.run.file.Close(); err != nil {
+			logger.Errorf("failed to persist events of run %s: %v", summary.ID, err)
+			r.run.persisted = false
+		}
+		r.run.file = nil
+	}
+	persisted := r.run.persisted
+	if persisted {
+		// The events are read from the events file from now on.
+		r.run.events = nil
+	}
+	r.run.done = true
+	close(r.run.changed)
+	r.run.changed = make(chan struct{})
+	r.store.lock.Unlock()
+
+	if persisted {
+		if err := r.store.saveSummary(summary); err != nil {
+			logger.Errorf("failed to persist run %s: %v", summary.ID, err)
+		}
+	}
+	r.store.prune()
+}
+
+// prune removes the runs that finished longer ago than the retention, and the oldest finished runs past the maximum
+// number of runs. Runs in flight are always kept.
+func (s *runStore) prune() {
+	s.lock.Lock()
+	var done []runSummary
+	for _, run := range s.runs {
+		if run.done {
+			done = append(done, run.summary)
+		}
+	}
+	sortRuns(done)
+
+	var remove []string
+	for i, summary := range done {
+		if (s.maxRuns > 0 && i >= s.maxRuns) || (s.retention > 0 && time.Since(summary.End) > s.retention) {
+			if s.runs[summary.ID].persisted {
+				remove = append(remove, summary.ID)
+			}
+			delete(s.runs, summary.ID)
+		}
+	}
+	s.lock.Unlock()
+
+	for _, id := range remove {
+		if dir, err := s.runDir(id); err == nil {
+			_ = os.RemoveAll(dir)
+		}
+	}
+}
+
+// sortRuns sorts runs from the newest to the oldest.
+func sortRuns(runs []runSummary) {
+	slices.SortFunc(runs, func(a, b runSummary) int {
+		if c := b.Start.Compare(a.Start); c != 0 {
+			return c
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+}
+
+func (s *runStore) list(key *APIKey) []runSummary {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result := make([]runSummary, 0, len(s.runs))
+	for _, run := range s.runs {
+		if key.canAccess(run.summary.Tenant) {
+			result = append(result, run.summary)
+		}
+	}
+	sortRuns(result)
+	return result
+}
+
+func (s *runStore) get(key *APIKey, id string) (runSummary, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	run, ok := s.runs[id]
+	if !ok || !key.canAccess(run.summary.Tenant) {
+		return runSummary{}, false
+	}
+	return run.summary, true
+}
+
+// events returns the events of a run from the offset, whether the run is done, and a channel that is closed when
+// there are more events or the run is done.
+func (s *runStore) events(id string, offset int) ([][]byte, bool, <-chan struct{}, error) {
+	s.lock.Lock()
+	run, ok := s.runs[id]
+	if !ok {
+		s.lock.Unlock()
+		return nil, false, nil, errRunNotFound
+	}
+	events, done, changed := run.events, run.done, run.changed
+	inFile := run.persisted && done
+	s.lock.Unlock()
+
+	if inFile {
+		dir, err := s.runDir(id)
+		if err != nil {
+			return nil, false, nil, err
+		}
+		events, err = readEvents(filepath.Join(dir, "events.jsonl"))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil, errRunNotFound
+		} else if err != nil {
+			return nil, false, nil, fmt.Errorf("failed to read events of run %s: %w", id, err)
+		}
+	}
+
+	if offset >= len(events) {
+		return nil, done, changed, nil
+	}
+	return events[offset:], done, changed, nil
+}
+
+func readEvents(file string) ([][]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		result [][]byte
+		reader = bufio.NewReader(f)
+	)
+	for {
+		line, err := reader.ReadBytes('\n')
+		// A line without a newline is an event that was only partially written when the server stopped.
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			result = append(result, line)
+		}
+	}
+}
+
+// detail rebuilds the run from its events.
+func (s *runStore) detail(summary runSummary) (runDetail, error) {
+	result := runDetail{
+		runSummary: summary,
+		Calls:      map[string]json.RawMessage{},
+	}
+
+	events, _, _, err := s.events(summary.ID, 0)
+	if err != nil {
+		return result, err
+	}
+
+	for _, data := range events {
+		var e struct {
+			Run    json.RawMessage `json:"run"`
+			Call   json.RawMessage `json:"call"`
+			Stdout json.RawMessage `json:"stdout"`
+			Stderr string          `json:"stderr"`
+		}
+		if err := json.Unmarshal(data, &e); err != nil {
+			return result, fmt.Errorf("failed to parse event of run %s: %w", summary.ID, err)
+		}
+
+		switch {
+		case e.Run != nil:
+			result.Run = e.Run
+		case e.Call != nil:
+			var call struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(e.Call, &call); err != nil {
+				return result, fmt.Errorf("failed to parse event of run %s: %w", summary.ID, err)
+			}
+			result.Calls[call.ID] = e.Call
+		case e.Stdout != nil:
+			result.Stdout = e.Stdout
+		case e.Stderr != "":
+			result.Stderr = e.Stderr
+		}
+	}
+	return result, nil
+}
+
+// listRuns lists the runs that are kept by the server, from the newest to the oldest.
+func (s *server) listRuns(w http.ResponseWriter, r *http.Request) {
+	writeResponse(gcontext.GetLogger(r.Context()), w, map[string]any{"stdout": s.runs.list(apiKeyFromContext(r.Context()))})
+}
+
+// getRun returns the last state of a run and of each of its calls.
+func (s *server) getRun(w http.ResponseWriter, r *http.Request) {
+	logger := gcontext.GetLogger(r.Context())
+	id := r.PathValue("run_id")
+
+	summary, ok := s.runs.get(apiKeyFromContext(r.Context()), id)
+	if !ok {
+		writeError(logger, w, http.StatusNotFound, fmt.Errorf("run %q not found", id))
+		return
+	}
+
+	run, err := s.runs.detail(summary)
+	if errors.Is(err, errRunNotFound) {
+		writeError(logger, w, http.StatusNotFound, fmt.Errorf("run %q not found", id))
+		return
+	} else if err != nil {
+		writeError(logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeResponse(logger, w, map[string]any{"stdout": run})
+}
+
+// runEvents replays the events of a run as server sent events, starting at the offset query parameter or after the
+// Last-Event-ID header. The ID of each event is its offset. If the run is still in flight, its events are streamed as
+// they happen until it is done.
+func (s *server) runEvents(w http.ResponseWriter, r *http.Request) {
+	logger := gcontext.GetLogger(r.Context())
+	id := r.PathValue("run_id")
+
+	if _, ok := s.runs.get(apiKeyFromContext(r.Context()), id); !ok {
+		writeError(logger, w, http.StatusNotFound, fmt.Errorf("run %q not found", id))
+		return
+	}
+
+	var offset int
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(logger, w, http.StatusBadRequest, fmt.Errorf("invalid offset %q", v))
+			return
+		}
+		offset = n
+	} else if v := r.Header.Get("Last-Event-ID"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(logger, w, http.StatusBadRequest, fmt.Errorf("invalid Last-Event-ID %q", v))
+			return
+		}
+		offset = n + 1
+	}
+
+	events, done, changed, err := s.runs.events(id, offset)
+	if errors.Is(err, errRunNotFound) {
+		writeError(logger, w, http.StatusNotFound, fmt.Errorf("run %q not found", id))
+		return
+	} else if err != nil {
+		writeError(logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	setStreamingHeaders(w)
+	for {
+		for _, data := range events {
+			if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", offset, data); err != nil {
+				return
+			}
+			offset++
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		if done {
+			writeServerSentEvent(logger, w, "[DONE]")
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+
+		events, done, changed, err = s.runs.events(id, offset)
+		if err != nil {
+			logger.Errorf("failed to read events of run %s: %v", id, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package sdkserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/mvl"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	gserver "github.com/gptscript-ai/gptscript/pkg/server"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testLogger = mvl.New("test")
+
+// recordRun records a run with a call and finishes it, as if it was streamed to a client.
+func recordRun(t *testing.T, store *runStore, id, tenant string) {
+	t.Helper()
+	recorder := store.start(testLogger, id, tenant)
+	run := newRun(id)
+	w := httptest.NewRecorder()
+
+	prg := types.Program{
+		EntryToolID: "main",
+		ToolSet: types.ToolSet{
+			"main": types.Tool{ToolDef: types.ToolDef{Parameters: types.Parameters{Name: "hello"}}},
+		},
+	}
+	callCtx := &engine.CallContext{}
+	callCtx.ID = "1"
+	for _, e := range []event{
+		{Event: gserver.Event{RunID: id, Program: &prg, Input: "hi", Event: runner.Event{Time: time.Now(), Type: runner.EventTypeRunStart}}},
+		{Event: gserver.Event{RunID: id, Event: runner.Event{Time: time.Now(), Type: runner.EventTypeCallStart, CallContext: callCtx}}},
+		{Event: gserver.Event{RunID: id, Event: runner.Event{Time: time.Now(), Type: runner.EventTypeCallFinish, CallContext: callCtx, Content: "hello"}}},
+		{Event: gserver.Event{RunID: id, Output: "hello", Event: runner.Event{Time: time.Now(), Type: runner.EventTypeRunFinish}}},
+	} {
+		recorder.write(testLogger, w, run, run.process(e))
+	}
+	out := runner.ChatResponse{Done: true, Content: "hello"}
+	run.processStdout(out)
+	recorder.write(testLogger, w, run, map[string]any{"stdout": out})
+	recorder.finish(testLogger, run, "")
+
+	assert.Equal(t, 5, strings.Count(w.Body.String(), "data: "))
+}
+
+func TestRunStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newRunStore(dir, 0, 100)
+	require.NoError(t, err)
+
+	recordRun(t, store, "1", "team-a")
+	recordRun(t, store, "2", "team-b")
+
+	runs := store.list(nil)
+	require.Len(t, runs, 2)
+	assert.Equal(t, "2", runs[0].ID)
+	assert.Equal(t, "hello", runs[1].Tool)
+	assert.Equal(t, "hi", runs[1].Input)
+	assert.Equal(t, Finished, runs[1].State)
+	assert.Equal(t, 5, runs[1].Events)
+
+	teamA := &APIKey{Name: "ci", Tenant: "team-a"}
+	runs = store.list(teamA)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "1", runs[0].ID)
+	_, ok := store.get(teamA, "2")
+	assert.False(t, ok)
+
+	// The runs are loaded again from the directory.
+	store, err = newRunStore(dir, 0, 100)
+	require.NoError(t, err)
+	summary, ok := store.get(teamA, "1")
+	require.True(t, ok)
+	assert.Equal(t, Finished, summary.State)
+
+	detail, err := store.detail(summary)
+	require.NoError(t, err)
+	require.Contains(t, detail.Calls, "1")
+	assert.Contains(t, string(detail.Calls["1"]), `"content":"hello"`)
+	assert.Contains(t, string(detail.Run), `"state":"finished"`)
+	assert.JSONEq(t, `{"done": true, "content": "hello", "toolID": "", "state": null}`, string(detail.Stdout))
+
+	events, done, _, err := store.events("1", 3)
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Len(t, events, 2)
+}
+
+func TestRunStoreRetention(t *testing.T) {
+	store, err := newRunStore("", 0, 2)
+	require.NoError(t, err)
+
+	for _, id := range []string{"1", "2", "3"} {
+		recordRun(t, store, id, "")
+	}
+	runs := store.list(nil)
+	require.Len(t, runs, 2)
+	assert.Equal(t, "3", runs[0].ID)
+	assert.Equal(t, "2", runs[1].ID)
+
+	store, err = newRunStore(t.TempDir(), time.Nanosecond, 0)
+	require.NoError(t, err)
+	recordRun(t, store, "1", "")
+	assert.Empty(t, store.list(nil))
+}
+
+func TestRunStoreInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newRunStore(dir, 0, 100)
+	require.NoError(t, err)
+	store.start(testLogger, "1", "")
+
+	store, err = newRunStore(dir, 0, 100)
+	require.NoError(t, err)
+	summary, ok := store.get(nil, "1")
+	require.True(t, ok)
+	assert.Equal(t, Error, summary.State)
+	assert.Equal(t, "the server stopped before the run finished", summary.Error)
+}
+
+func TestRunStoreReusedID(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newRunStore(dir, 0, 100)
+	require.NoError(t, err)
+	recordRun(t, store, "1", "team-a")
+
+	// A run with the ID of a run from before the restart is not persisted over it, and doesn't see its events.
+	store, err = newRunStore(dir, 0, 100)
+	require.NoError(t, err)
+	recordRun(t, store, "1", "team-b")
+
+	_, ok := store.get(&APIKey{Name: "ci", Tenant: "team-a"}, "1")
+	assert.False(t, ok)
+	events, _, _, err := store.events("1", 0)
+	require.NoError(t, err)
+	assert.Len(t, events, 5)
+
+	store, err = newRunStore(dir, 0, 100)
+	require.NoError(t, err)
+	summary, ok := store.get(nil, "1")
+	require.True(t, ok)
+	assert.Equal(t, "team-a", summary.Tenant)
+	assert.Equal(t, 5, summary.Events)
+}
+
+func TestRunEvents(t *testing.T) {
+	store, err := newRunStore("", 0, 100)
+	require.NoError(t, err)
+	s := &server{runs: store}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /runs/{run_id}/events", s.runEvents)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	recorder := store.start(testLogger, "1", "")
+	run := newRun("1")
+	recorder.write(testLogger, httptest.NewRecorder(), run, map[string]any{"n": 0})
+	recorder.write(testLogger, httptest.NewRecorder(), run, map[string]any{"n": 1})
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/runs/1/events", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	read := func(n int) {
+		for len(lines) < n && scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	// The events after the last one the client saw are replayed, then new ones are streamed until the run is done.
+	read(2)
+	assert.Equal(t, []string{"id: 1", `data: {"n":1}`}, lines)
+
+	recorder.write(testLogger, httptest.NewRecorder(), run, map[string]any{"n": 2})
+	recorder.finish(testLogger, run, "")
+	read(5)
+	assert.Equal(t, []string{"id: 1", `data: {"n":1}`, "id: 2", `data: {"n":2}`, `data: "[DONE]"`}, lines)
+
+	resp, err = http.Get(srv.URL + "/runs/missing/events")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	var body map[string]any
+	resp, err = http.Get(srv.URL + "/runs/1/events?offset=x")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, `invalid offset "x"`, body["stderr"])
+}
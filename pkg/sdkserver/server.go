@@ -15,6 +15,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/gptscript-ai/broadcaster"
+	"github.com/gptscript-ai/gptscript/pkg/auth"
 	"github.com/gptscript-ai/gptscript/pkg/gptscript"
 	"github.com/gptscript-ai/gptscript/pkg/loader"
 	"github.com/gptscript-ai/gptscript/pkg/mcp"
@@ -29,11 +30,23 @@ type Options struct {
 	gptscript.Options
 
 	MCPLoader                  loader.MCPLoader
+	Policy                     *auth.PolicyAuthorizer
 	ListenAddress              string
 	DatasetTool, WorkspaceTool string
 	ServerToolsEnv             []string
 	Debug                      bool
 	DisableServerErrorLogging  bool
+	// APIKeys are the keys clients must authenticate with. If there are none, the server is open to all clients.
+	APIKeys []APIKey
+	// AuditLog is a file every request to a sensitive route is appended to as a JSON line. The requests are logged
+	// either way.
+	AuditLog string
+	// RunStore is the directory the runs of the server are persisted in. If empty, runs are only kept in memory.
+	RunStore string
+	// RunRetention is how long finished runs are kept, forever if zero. MaxRuns is how many finished runs are kept, 100
+	// if zero.
+	RunRetention time.Duration
+	MaxRuns      int
 }
 
 // Run will start the server and block until the server is shut down.
@@ -98,6 +111,16 @@ func run(ctx context.Context, listener net.Listener, opts Options) error {
 	opts.Runner.MonitorFactory = NewSessionFactory(events)
 	go events.Start(ctx)
 
+	apiKeys, err := indexAPIKeys(opts.APIKeys)
+	if err != nil {
+		return err
+	}
+
+	runs, err := newRunStore(opts.RunStore, opts.RunRetention, opts.MaxRuns)
+	if err != nil {
+		return err
+	}
+
 	token := uuid.NewString()
 	// Add the prompt token env var so that gptscript doesn't start its own server. We never want this client to start the
 	// prompt server because it is only used for fmt, parse, etc.
@@ -118,11 +141,18 @@ func run(ctx context.Context, listener net.Listener, opts Options) error {
 
 		client:           g,
 		mcpLoader:        opts.MCPLoader,
+		policy:           opts.Policy,
 		events:           events,
 		runtimeManager:   runtimes.Default(opts.Cache.CacheDir, opts.SystemToolsDir),
 		waitingToConfirm: make(map[string]chan runner.AuthorizerResponse),
 		waitingToPrompt:  make(map[string]chan map[string]string),
 		running:          make(map[string]chan struct{}),
+		promptTokens:     make(map[string]string),
+		apiKeys:          apiKeys,
+		runs:             runs,
+		audit: auditor{
+			file: opts.AuditLog,
+		},
 	}
 	defer s.close()
 
@@ -136,6 +166,7 @@ func run(ctx context.Context, listener net.Listener, opts Options) error {
 			addLogger,
 			logRequest,
 			cors.Default().Handler,
+			s.authenticate,
 		),
 	}
 
@@ -174,6 +205,12 @@ func complete(opts ...Options) Options {
 		result.Debug = types.FirstSet(opt.Debug, result.Debug)
 		result.DisableServerErrorLogging = types.FirstSet(opt.DisableServerErrorLogging, result.DisableServerErrorLogging)
 		result.MCPLoader = types.FirstSet(opt.MCPLoader, result.MCPLoader)
+		result.Policy = types.FirstSet(opt.Policy, result.Policy)
+		result.APIKeys = append(result.APIKeys, opt.APIKeys...)
+		result.AuditLog = types.FirstSet(opt.AuditLog, result.AuditLog)
+		result.RunStore = types.FirstSet(opt.RunStore, result.RunStore)
+		result.RunRetention = types.FirstSet(opt.RunRetention, result.RunRetention)
+		result.MaxRuns = types.FirstSet(opt.MaxRuns, result.MaxRuns)
 	}
 
 	if result.ListenAddress == "" {
@@ -192,6 +229,9 @@ func complete(opts ...Options) Options {
 	if result.MCPLoader == nil {
 		result.MCPLoader = mcp.DefaultLoader
 	}
+	if result.MaxRuns == 0 {
+		result.MaxRuns = 100
+	}
 
 	return result
 }
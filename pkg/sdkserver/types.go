@@ -60,7 +60,9 @@ type toolOrFileRequest struct {
 	Confirm              bool     `json:"confirm"`
 	Location             string   `json:"location,omitempty"`
 	ForceSequential      bool     `json:"forceSequential"`
+	Sandbox              bool     `json:"sandbox,omitempty"`
 	DefaultModelProvider string   `json:"DefaultModelProvider,omitempty"`
+	BudgetTokens         int      `json:"budgetTokens,omitempty"`
 }
 
 type content struct {
@@ -88,6 +90,16 @@ type loadRequest struct {
 	File         string   `json:"file"`
 }
 
+type lintRequest struct {
+	content `json:",inline"`
+
+	ToolDefs     toolDefs `json:"toolDefs,inline"`
+	DisableCache bool     `json:"disableCache"`
+	File         string   `json:"file"`
+	// Format is the format of the diagnostics, sarif for a SARIF log. They are a list otherwise.
+	Format string `json:"format,omitempty"`
+}
+
 type parseRequest struct {
 	parser.Options `json:",inline"`
 	content        `json:",inline"`
@@ -113,6 +125,8 @@ type runInfo struct {
 	End       time.Time       `json:"end"`
 	State     runState        `json:"state"`
 	ChatState any             `json:"chatState"`
+
+	BudgetExceeded *runner.ErrBudgetExceeded `json:"budgetExceeded,omitempty"`
 }
 
 func newRun(id string) *runInfo {
@@ -146,6 +160,7 @@ func (r *runInfo) process(e event) map[string]any {
 		r.End = e.Time
 		r.Output = e.Output
 		r.Error = e.Err
+		r.BudgetExceeded = e.BudgetExceeded
 		if r.Error != "" {
 			r.State = Error
 		} else {
@@ -186,6 +201,7 @@ func (r *runInfo) process(e event) map[string]any {
 
 	case runner.EventTypeChat:
 		call.Usage = e.Usage
+		call.Model = types.FirstSet(e.Model, call.Model)
 		call.ChatResponseCached = e.ChatResponseCached
 		if e.ChatRequest != nil {
 			call.LLMRequest = e.ChatRequest
@@ -193,6 +209,21 @@ func (r *runInfo) process(e event) map[string]any {
 		if e.ChatResponse != nil {
 			call.LLMResponse = e.ChatResponse
 		}
+
+	case runner.EventTypeCompaction:
+		if e.Compaction != nil {
+			call.Compactions = append(call.Compactions, *e.Compaction)
+		}
+
+	case runner.EventTypeQueue:
+		if e.Queue != nil {
+			call.QueueTime += e.Queue.Wait
+		}
+
+	case runner.EventTypeFallback:
+		if e.Fallback != nil {
+			call.Fallbacks = append(call.Fallbacks, *e.Fallback)
+		}
 	}
 
 	r.Calls[e.CallContext.ID] = call
@@ -212,16 +243,22 @@ func (r *runInfo) processStdout(cs runner.ChatResponse) {
 type call struct {
 	engine.CallContext `json:",inline"`
 
-	Type               runner.EventType `json:"type"`
-	Start              time.Time        `json:"start"`
-	End                time.Time        `json:"end"`
-	Input              string           `json:"input"`
-	Output             []output         `json:"output"`
-	Usage              types.Usage      `json:"usage"`
-	ChatResponseCached bool             `json:"chatResponseCached"`
-	ToolResults        int              `json:"toolResults"`
-	LLMRequest         any              `json:"llmRequest"`
-	LLMResponse        any              `json:"llmResponse"`
+	Type               runner.EventType   `json:"type"`
+	Start              time.Time          `json:"start"`
+	End                time.Time          `json:"end"`
+	Input              string             `json:"input"`
+	Output             []output           `json:"output"`
+	Usage              types.Usage        `json:"usage"`
+	ChatResponseCached bool               `json:"chatResponseCached"`
+	ToolResults        int                `json:"toolResults"`
+	LLMRequest         any                `json:"llmRequest"`
+	LLMResponse        any                `json:"llmResponse"`
+	Compactions        []types.Compaction `json:"compactions,omitempty"`
+	// Model is the model that served the last chat request of the call.
+	Model     string           `json:"model,omitempty"`
+	Fallbacks []types.Fallback `json:"fallbacks,omitempty"`
+	// QueueTime is how long the chat requests of the call waited for the rate limits of their providers.
+	QueueTime time.Duration `json:"queueTime,omitempty"`
 }
 
 func (c *call) setSubCalls(subCalls map[string]engine.Call) {
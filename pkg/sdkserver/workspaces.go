@@ -1,12 +1,18 @@
 package sdkserver
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path"
+	"slices"
+	"strings"
 
 	gcontext "github.com/gptscript-ai/gptscript/pkg/context"
 	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/mvl"
 	"github.com/gptscript-ai/gptscript/pkg/runner"
 )
 
@@ -34,6 +40,101 @@ func (s *server) getServerToolsEnv(env []string) []string {
 	return append(s.serverToolsEnv, env...)
 }
 
+// workspaceOwnerFile is the file in a workspace that records the tenant that created it, so that the workspace stays
+// theirs after the server restarts. Clients can't write or delete it.
+const workspaceOwnerFile = ".gptscript-owner"
+
+// runWorkspaceTool runs a tool of the workspace tool with the input marshaled as JSON.
+func (s *server) runWorkspaceTool(ctx context.Context, req workspaceCommonRequest, subTool string, input map[string]any) (string, error) {
+	prg, err := loader.Program(ctx, s.getWorkspaceTool(req), subTool, loader.Options{Cache: s.client.Cache, Trust: s.gptscriptOpts.Trust})
+	if err != nil {
+		return "", fmt.Errorf("failed to load program: %w", err)
+	}
+
+	b, err := json.Marshal(input)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	out, err := s.client.Run(ctx, prg, s.getServerToolsEnv(req.Env), string(b), runner.RunOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to run program: %w", err)
+	}
+	return out, nil
+}
+
+// setWorkspaceOwner records the tenant of the key as the owner of the workspace.
+func (s *server) setWorkspaceOwner(ctx context.Context, req workspaceCommonRequest, id string, key *APIKey) error {
+	if key == nil {
+		return nil
+	}
+
+	// The contents of files are base64 encoded, the same as the SDKs write them.
+	_, err := s.runWorkspaceTool(ctx, req, "Write File In Workspace", map[string]any{
+		"workspace_id":    id,
+		"file_path":       workspaceOwnerFile,
+		"body":            base64.StdEncoding.EncodeToString([]byte(key.tenant())),
+		"create_revision": false,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record the owner of workspace %q: %w", id, err)
+	}
+
+	s.workspaceOwners.setTenant(id, key.tenant())
+	return nil
+}
+
+// workspaceOwner returns the tenant that created the workspace, or "" if it wasn't created by a tenant.
+func (s *server) workspaceOwner(ctx context.Context, req workspaceCommonRequest, id string) string {
+	if tenant, ok := s.workspaceOwners.tenant(id); ok {
+		return tenant
+	}
+
+	logger := gcontext.GetLogger(ctx)
+	out, err := s.runWorkspaceTool(ctx, req, "Read File In Workspace", map[string]any{
+		"workspace_id": id,
+		"file_path":    workspaceOwnerFile,
+	})
+	if err != nil {
+		logger.Debugf("failed to read the owner of workspace %q: %v", id, err)
+		return ""
+	}
+
+	tenant, err := base64.StdEncoding.DecodeString(strings.TrimSpace(out))
+	if err != nil {
+		logger.Debugf("invalid owner of workspace %q: %v", id, err)
+		return ""
+	}
+
+	s.workspaceOwners.setTenant(id, string(tenant))
+	return string(tenant)
+}
+
+// ownsWorkspace writes a not found error and returns false if the workspace wasn't created by the tenant of the API key
+// of the request. Workspaces that weren't created through a server with API keys are only available to keys with all
+// scopes.
+func (s *server) ownsWorkspace(logger mvl.Logger, w http.ResponseWriter, r *http.Request, req workspaceCommonRequest, id string) bool {
+	key := apiKeyFromContext(r.Context())
+	if key == nil || slices.Contains(key.Scopes, ScopeAll) {
+		return true
+	}
+
+	if tenant := s.workspaceOwner(r.Context(), req, id); tenant == "" || !key.canAccess(tenant) {
+		writeError(logger, w, http.StatusNotFound, fmt.Errorf("workspace %q not found", id))
+		return false
+	}
+	return true
+}
+
+// allowWorkspaceFile writes a bad request error and returns false if the file is the owner file of the workspace.
+func allowWorkspaceFile(logger mvl.Logger, w http.ResponseWriter, file string) bool {
+	if path.Clean("/"+file) == "/"+workspaceOwnerFile {
+		writeError(logger, w, http.StatusBadRequest, fmt.Errorf("%s is reserved for the server", workspaceOwnerFile))
+		return false
+	}
+	return true
+}
+
 func (s *server) createWorkspace(w http.ResponseWriter, r *http.Request) {
 	logger := gcontext.GetLogger(r.Context())
 	var reqObject createWorkspaceRequest
@@ -42,7 +143,13 @@ func (s *server) createWorkspace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Create Workspace", loader.Options{Cache: s.client.Cache})
+	for _, id := range reqObject.FromWorkspaceIDs {
+		if !s.ownsWorkspace(logger, w, r, reqObject.workspaceCommonRequest, id) {
+			return
+		}
+	}
+
+	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Create Workspace", loader.Options{Cache: s.client.Cache, Trust: s.gptscriptOpts.Trust})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
 		return
@@ -73,6 +180,10 @@ func (s *server) createWorkspace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := s.setWorkspaceOwner(r.Context(), reqObject.workspaceCommonRequest, strings.TrimSpace(out), apiKeyFromContext(r.Context())); err != nil {
+		writeError(logger, w, http.StatusInternalServerError, err)
+		return
+	}
 	writeResponse(logger, w, map[string]any{"stdout": out})
 }
 
@@ -88,7 +199,11 @@ func (s *server) deleteWorkspace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Delete Workspace", loader.Options{Cache: s.client.Cache})
+	if !s.ownsWorkspace(logger, w, r, reqObject.workspaceCommonRequest, reqObject.ID) {
+		return
+	}
+
+	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Delete Workspace", loader.Options{Cache: s.client.Cache, Trust: s.gptscriptOpts.Trust})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
 		return
@@ -109,6 +224,7 @@ func (s *server) deleteWorkspace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.workspaceOwners.delete(reqObject.ID)
 	writeResponse(logger, w, map[string]any{"stdout": out})
 }
 
@@ -126,7 +242,11 @@ func (s *server) listWorkspaceContents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "List Workspace Contents", loader.Options{Cache: s.client.Cache})
+	if !s.ownsWorkspace(logger, w, r, reqObject.workspaceCommonRequest, reqObject.ID) {
+		return
+	}
+
+	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "List Workspace Contents", loader.Options{Cache: s.client.Cache, Trust: s.gptscriptOpts.Trust})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
 		return
@@ -163,7 +283,17 @@ func (s *server) removeAllWithPrefixInWorkspace(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Remove All With Prefix In Workspace", loader.Options{Cache: s.client.Cache})
+	if !s.ownsWorkspace(logger, w, r, reqObject.workspaceCommonRequest, reqObject.ID) {
+		return
+	}
+
+	// Removing the files with a prefix of the owner file removes it too, so it is recorded again afterwards.
+	var owner string
+	if strings.HasPrefix(workspaceOwnerFile, reqObject.Prefix) {
+		owner = s.workspaceOwner(r.Context(), reqObject.workspaceCommonRequest, reqObject.ID)
+	}
+
+	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Remove All With Prefix In Workspace", loader.Options{Cache: s.client.Cache, Trust: s.gptscriptOpts.Trust})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
 		return
@@ -184,6 +314,13 @@ func (s *server) removeAllWithPrefixInWorkspace(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if owner != "" {
+		if err := s.setWorkspaceOwner(r.Context(), reqObject.workspaceCommonRequest, reqObject.ID, &APIKey{Tenant: owner}); err != nil {
+			writeError(logger, w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
 	writeResponse(logger, w, map[string]any{"stdout": out})
 }
 
@@ -203,7 +340,14 @@ func (s *server) writeFileInWorkspace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Write File In Workspace", loader.Options{Cache: s.client.Cache})
+	if !s.ownsWorkspace(logger, w, r, reqObject.workspaceCommonRequest, reqObject.ID) {
+		return
+	}
+	if !allowWorkspaceFile(logger, w, reqObject.FilePath) {
+		return
+	}
+
+	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Write File In Workspace", loader.Options{Cache: s.client.Cache, Trust: s.gptscriptOpts.Trust})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
 		return
@@ -240,7 +384,14 @@ func (s *server) removeFileInWorkspace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Remove File In Workspace", loader.Options{Cache: s.client.Cache})
+	if !s.ownsWorkspace(logger, w, r, reqObject.workspaceCommonRequest, reqObject.ID) {
+		return
+	}
+	if !allowWorkspaceFile(logger, w, reqObject.FilePath) {
+		return
+	}
+
+	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Remove File In Workspace", loader.Options{Cache: s.client.Cache, Trust: s.gptscriptOpts.Trust})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
 		return
@@ -277,7 +428,11 @@ func (s *server) readFileInWorkspace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Read File In Workspace", loader.Options{Cache: s.client.Cache})
+	if !s.ownsWorkspace(logger, w, r, reqObject.workspaceCommonRequest, reqObject.ID) {
+		return
+	}
+
+	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Read File In Workspace", loader.Options{Cache: s.client.Cache, Trust: s.gptscriptOpts.Trust})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
 		return
@@ -309,7 +464,11 @@ func (s *server) readFileWithRevisionInWorkspace(w http.ResponseWriter, r *http.
 		return
 	}
 
-	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Read File With Revision In Workspace", loader.Options{Cache: s.client.Cache})
+	if !s.ownsWorkspace(logger, w, r, reqObject.workspaceCommonRequest, reqObject.ID) {
+		return
+	}
+
+	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Read File With Revision In Workspace", loader.Options{Cache: s.client.Cache, Trust: s.gptscriptOpts.Trust})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
 		return
@@ -347,7 +506,11 @@ func (s *server) statFileInWorkspace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Stat File In Workspace", loader.Options{Cache: s.client.Cache})
+	if !s.ownsWorkspace(logger, w, r, reqObject.workspaceCommonRequest, reqObject.ID) {
+		return
+	}
+
+	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Stat File In Workspace", loader.Options{Cache: s.client.Cache, Trust: s.gptscriptOpts.Trust})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
 		return
@@ -381,9 +544,14 @@ func (s *server) listRevisions(w http.ResponseWriter, r *http.Request) {
 	var reqObject listRevisionsRequest
 	if err := json.NewDecoder(r.Body).Decode(&reqObject); err != nil {
 		writeError(logger, w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
 	}
 
-	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "List Revisions for File in Workspace", loader.Options{Cache: s.client.Cache})
+	if !s.ownsWorkspace(logger, w, r, reqObject.workspaceCommonRequest, reqObject.ID) {
+		return
+	}
+
+	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "List Revisions for File in Workspace", loader.Options{Cache: s.client.Cache, Trust: s.gptscriptOpts.Trust})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
 		return
@@ -421,7 +589,11 @@ func (s *server) getRevisionForFileInWorkspace(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Get a Revision for File in Workspace", loader.Options{Cache: s.client.Cache})
+	if !s.ownsWorkspace(logger, w, r, reqObject.workspaceCommonRequest, reqObject.ID) {
+		return
+	}
+
+	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Get a Revision for File in Workspace", loader.Options{Cache: s.client.Cache, Trust: s.gptscriptOpts.Trust})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
 		return
@@ -459,7 +631,14 @@ func (s *server) deleteRevisionForFileInWorkspace(w http.ResponseWriter, r *http
 		return
 	}
 
-	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Delete a Revision for File in Workspace", loader.Options{Cache: s.client.Cache})
+	if !s.ownsWorkspace(logger, w, r, reqObject.workspaceCommonRequest, reqObject.ID) {
+		return
+	}
+	if !allowWorkspaceFile(logger, w, reqObject.FilePath) {
+		return
+	}
+
+	prg, err := loader.Program(r.Context(), s.getWorkspaceTool(reqObject.workspaceCommonRequest), "Delete a Revision for File in Workspace", loader.Options{Cache: s.client.Cache, Trust: s.gptscriptOpts.Trust})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
 		return
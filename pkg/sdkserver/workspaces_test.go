@@ -0,0 +1,114 @@
+package sdkserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	gcontext "github.com/gptscript-ai/gptscript/pkg/context"
+	"github.com/gptscript-ai/gptscript/pkg/gptscript"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testWorkspaceTool is a workspace tool with the tools the server uses to record the owners of workspaces, which keeps
+// the workspaces in the directory of the tool.
+const testWorkspaceTool = `Name: Create Workspace
+Param: provider: The provider
+Param: fromWorkspaceIDs: The workspaces to copy
+
+#!/bin/sh
+mktemp -d "${GPTSCRIPT_TOOL_DIR}/workspace.XXXXXX"
+
+---
+Name: Write File In Workspace
+Param: workspace_id: The workspace
+Param: file_path: The file
+Param: body: The base64 encoded contents
+Param: create_revision: Whether to create a revision
+
+#!/bin/sh
+printf %s "${BODY}" > "${WORKSPACE_ID}/${FILE_PATH}"
+
+---
+Name: Read File In Workspace
+Param: workspace_id: The workspace
+Param: file_path: The file
+
+#!/bin/sh
+cat "${WORKSPACE_ID}/${FILE_PATH}"
+`
+
+func testWorkspaceServer(t *testing.T, workspaceTool string) (*server, http.Handler) {
+	t.Helper()
+
+	s, _ := testServer(t)
+	g, err := gptscript.New(context.Background(), gptscript.Options{
+		Cache: cache.Options{
+			CacheDir: t.TempDir(),
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		g.Close(true)
+	})
+
+	s.client = g
+	s.workspaceTool = workspaceTool
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /workspaces/create", requireScope(ScopeWorkspaces, s.createWorkspace))
+	mux.HandleFunc("POST /workspaces/write-file", requireScope(ScopeWorkspaces, s.writeFileInWorkspace))
+	mux.HandleFunc("POST /workspaces/owns", func(w http.ResponseWriter, r *http.Request) {
+		if s.ownsWorkspace(gcontext.GetLogger(r.Context()), w, r, workspaceCommonRequest{}, r.URL.Query().Get("id")) {
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+	return s, apply(mux, s.authenticate)
+}
+
+func TestWorkspaceOwner(t *testing.T) {
+	workspaceTool := filepath.Join(t.TempDir(), "workspace.gpt")
+	require.NoError(t, os.WriteFile(workspaceTool, []byte(testWorkspaceTool), 0644))
+
+	post := func(h http.Handler, key, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	_, h := testWorkspaceServer(t, workspaceTool)
+	resp := post(h, "dev-key", "/workspaces/create", `{}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	var created map[string]string
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+	id := strings.TrimSpace(created["stdout"])
+
+	owner, err := os.ReadFile(filepath.Join(id, workspaceOwnerFile))
+	require.NoError(t, err)
+	assert.Equal(t, "dGVhbS1i", string(owner))
+
+	// The owner is read from the workspace by a server that didn't create it, like after a restart.
+	_, h = testWorkspaceServer(t, workspaceTool)
+	assert.Equal(t, http.StatusOK, post(h, "dev-key", "/workspaces/owns?id="+id, "").Code)
+	assert.Equal(t, http.StatusNotFound, post(h, "ci-key", "/workspaces/owns?id="+id, "").Code)
+	assert.Equal(t, http.StatusOK, post(h, "admin-key", "/workspaces/owns?id="+id, "").Code)
+	assert.Equal(t, http.StatusNotFound, post(h, "dev-key", "/workspaces/owns?id="+t.TempDir(), "").Code)
+
+	// Clients can't change the owner.
+	resp = post(h, "dev-key", "/workspaces/write-file", `{"id": "`+id+`", "filePath": "./`+workspaceOwnerFile+`", "contents": "dGVhbS1h"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	owner, err = os.ReadFile(filepath.Join(id, workspaceOwnerFile))
+	require.NoError(t, err)
+	assert.Equal(t, "dGVhbS1i", string(owner))
+}
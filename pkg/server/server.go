@@ -23,6 +23,11 @@ func ContextWithNewRunID(ctx context.Context) context.Context {
 	return context.WithValue(ctx, execKey{}, counter.Next())
 }
 
+// ContextWithRunID sets the ID of the run, for runs whose IDs must be unique across restarts.
+func ContextWithRunID(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, execKey{}, runID)
+}
+
 func RunIDFromContext(ctx context.Context) string {
 	runID, _ := ctx.Value(execKey{}).(string)
 	return runID
@@ -0,0 +1,57 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The modes of the Cache Key directive.
+const (
+	CacheKeyExact      = "exact"
+	CacheKeyNormalized = "normalized"
+)
+
+// CacheKeyOptions are the parsed Cache Key directive of a tool.
+type CacheKeyOptions struct {
+	Normalize          bool
+	IgnoreDescriptions bool
+	KeepWhitespace     bool
+	CollapseWhitespace bool
+	KeepToolOrder      bool
+}
+
+// ParseCacheKey parses a Cache Key directive, which is a mode optionally followed by the options of the normalized mode.
+func ParseCacheKey(directive string) (CacheKeyOptions, error) {
+	fields := strings.Fields(directive)
+	if len(fields) == 0 || fields[0] == CacheKeyExact {
+		if len(fields) > 1 {
+			return CacheKeyOptions{}, fmt.Errorf("the %s cache key has no options, got %q", CacheKeyExact, strings.Join(fields[1:], " "))
+		}
+		return CacheKeyOptions{}, nil
+	}
+	if fields[0] != CacheKeyNormalized {
+		return CacheKeyOptions{}, fmt.Errorf("invalid cache key mode %q, must be %s or %s", fields[0], CacheKeyExact, CacheKeyNormalized)
+	}
+
+	result := CacheKeyOptions{
+		Normalize: true,
+	}
+	for _, option := range fields[1:] {
+		switch option {
+		case "ignore-descriptions":
+			result.IgnoreDescriptions = true
+		case "keep-whitespace":
+			result.KeepWhitespace = true
+		case "collapse-whitespace":
+			result.CollapseWhitespace = true
+		case "keep-tool-order":
+			result.KeepToolOrder = true
+		default:
+			return CacheKeyOptions{}, fmt.Errorf("invalid option of the %s cache key %q", CacheKeyNormalized, option)
+		}
+	}
+	if result.KeepWhitespace && result.CollapseWhitespace {
+		return CacheKeyOptions{}, fmt.Errorf("the options keep-whitespace and collapse-whitespace of the %s cache key can't be combined", CacheKeyNormalized)
+	}
+	return result, nil
+}
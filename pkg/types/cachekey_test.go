@@ -0,0 +1,33 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCacheKey(t *testing.T) {
+	for directive, expected := range map[string]CacheKeyOptions{
+		"":                                  {},
+		"exact":                             {},
+		"normalized":                        {Normalize: true},
+		"normalized ignore-descriptions":    {Normalize: true, IgnoreDescriptions: true},
+		"normalized keep-whitespace":        {Normalize: true, KeepWhitespace: true},
+		"normalized collapse-whitespace":    {Normalize: true, CollapseWhitespace: true},
+		" normalized   keep-tool-order    ": {Normalize: true, KeepToolOrder: true},
+	} {
+		opts, err := ParseCacheKey(directive)
+		require.NoError(t, err, directive)
+		assert.Equal(t, expected, opts, directive)
+	}
+
+	_, err := ParseCacheKey("fuzzy")
+	assert.ErrorContains(t, err, `invalid cache key mode "fuzzy"`)
+	_, err = ParseCacheKey("normalized ignore-everything")
+	assert.ErrorContains(t, err, `invalid option of the normalized cache key "ignore-everything"`)
+	_, err = ParseCacheKey("normalized keep-whitespace collapse-whitespace")
+	assert.Error(t, err)
+	_, err = ParseCacheKey("exact keep-whitespace")
+	assert.Error(t, err)
+}
@@ -4,6 +4,7 @@ package types
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/jsonschema-go/jsonschema"
 )
@@ -17,7 +18,10 @@ type CompletionRequest struct {
 	Chat                 bool                 `json:"chat,omitempty"`
 	Temperature          *float32             `json:"temperature,omitempty"`
 	JSONResponse         bool                 `json:"jsonResponse,omitempty"`
+	OutputSchema         *jsonschema.Schema   `json:"outputSchema,omitempty"`
+	ContextCompaction    string               `json:"contextCompaction,omitempty"`
 	Cache                *bool                `json:"cache,omitempty"`
+	CacheKey             string               `json:"cacheKey,omitempty"`
 }
 
 func (r *CompletionRequest) GetCache() bool {
@@ -55,6 +59,9 @@ type CompletionMessage struct {
 	// result of the call describe by this field
 	ToolCall *CompletionToolCall `json:"toolCall,omitempty"`
 	Usage    Usage               `json:"usage,omitempty"`
+	// Model is the model that generated the message, which differs from the requested model if the call was routed to
+	// another model or fell back to one.
+	Model string `json:"model,omitempty"`
 }
 
 func (c CompletionMessage) ChatText() string {
@@ -84,6 +91,44 @@ type CompletionStatus struct {
 	Usage           Usage
 	Cached          bool
 	PartialResponse *CompletionMessage
+	Compaction      *Compaction
+	// Model is the model the request was sent to.
+	Model    string
+	Fallback *Fallback
+	Queue    *Queue
+}
+
+// Queue describes a request that waits for the rate limits of its model provider.
+type Queue struct {
+	Provider string `json:"provider,omitempty"`
+	// Reason is the limit the request waits for.
+	Reason string `json:"reason,omitempty"`
+	// Wait is how long the request waited, which is zero while it is still waiting.
+	Wait time.Duration `json:"wait,omitempty"`
+}
+
+// Fallback describes a failed call to a model that is retried with the next model of its fallbacks.
+type Fallback struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// Reason is why the call failed, which is one of "rate limit", "server error" or "context length".
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Compaction describes how the messages of a chat were compacted to fit in the context window.
+type Compaction struct {
+	Strategy       string `json:"strategy,omitempty"`
+	MessagesBefore int    `json:"messagesBefore,omitempty"`
+	MessagesAfter  int    `json:"messagesAfter,omitempty"`
+	// Summary is the summary of the removed messages, if the strategy summarizes them.
+	Summary string `json:"summary,omitempty"`
+	// Fallback is the strategy the messages were compacted with instead if the strategy failed, and Error is why it did.
+	Fallback string `json:"fallback,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Usage is the usage of the requests to the model that compacted the messages, which is also part of the usage of
+	// the completion.
+	Usage Usage `json:"usage,omitempty"`
 }
 
 func (c CompletionMessage) IsToolCall() bool {
@@ -1,7 +1,15 @@
 //nolint:revive
 package types
 
-import "github.com/google/jsonschema-go/jsonschema"
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
 
 func ObjectSchema(kv ...string) *jsonschema.Schema {
 	s := &jsonschema.Schema{
@@ -18,3 +26,223 @@ func ObjectSchema(kv ...string) *jsonschema.Schema {
 	}
 	return s
 }
+
+var argTypes = map[string]string{
+	"string":  "string",
+	"integer": "integer",
+	"int":     "integer",
+	"number":  "number",
+	"float":   "number",
+	"boolean": "boolean",
+	"bool":    "boolean",
+	"array":   "array",
+	"object":  "object",
+}
+
+// ParseArgSpec parses the type, constraints, and required-ness of an argument, such as "integer, required, 1..10" or
+// "string[]" or "small|medium|large". It returns false if spec isn't an argument spec, such as when it's part of the
+// description of the argument.
+func ParseArgSpec(spec string) (_ *jsonschema.Schema, required bool, _ bool) {
+	var (
+		schema               jsonschema.Schema
+		minimum, maximum     *float64
+		enum                 []string
+		hasRange, hasAnyPart bool
+	)
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		lower := strings.ToLower(part)
+		hasAnyPart = true
+
+		if typ, ok := argTypes[lower]; ok && schema.Type == "" {
+			schema.Type = typ
+		} else if typ, ok := argTypes[strings.TrimSuffix(lower, "[]")]; ok && strings.HasSuffix(lower, "[]") && schema.Type == "" {
+			schema.Type = "array"
+			schema.Items = &jsonschema.Schema{Type: typ}
+		} else if lower == "required" && !required {
+			required = true
+		} else if low, high, ok := strings.Cut(part, ".."); ok && !hasRange && (low != "" || high != "") {
+			hasRange = true
+			for _, bound := range []struct {
+				text  string
+				value **float64
+			}{{low, &minimum}, {high, &maximum}} {
+				if bound.text == "" {
+					continue
+				}
+				f, err := strconv.ParseFloat(bound.text, 64)
+				if err != nil {
+					return nil, false, false
+				}
+				*bound.value = &f
+			}
+		} else if strings.Contains(part, "|") && !strings.ContainsAny(part, " \t") && enum == nil {
+			enum = strings.Split(part, "|")
+		} else {
+			return nil, false, false
+		}
+	}
+
+	if !hasAnyPart {
+		return nil, false, false
+	}
+	if schema.Type == "" {
+		schema.Type = "string"
+	}
+
+	if hasRange {
+		switch schema.Type {
+		case "integer", "number":
+			schema.Minimum, schema.Maximum = minimum, maximum
+		case "string":
+			schema.MinLength, schema.MaxLength = toInt(minimum), toInt(maximum)
+		case "array":
+			schema.MinItems, schema.MaxItems = toInt(minimum), toInt(maximum)
+		default:
+			return nil, false, false
+		}
+	}
+
+	for _, value := range enum {
+		switch schema.Type {
+		case "string":
+			schema.Enum = append(schema.Enum, value)
+		case "integer":
+			i, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, false, false
+			}
+			schema.Enum = append(schema.Enum, i)
+		case "number":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, false, false
+			}
+			schema.Enum = append(schema.Enum, f)
+		default:
+			return nil, false, false
+		}
+	}
+
+	return &schema, required, true
+}
+
+func toInt(f *float64) *int {
+	if f == nil {
+		return nil
+	}
+	i := int(*f)
+	return &i
+}
+
+func formatFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func formatInt(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
+
+// ArgSpec formats the type and constraints of an argument as ParseArgSpec parses them. It returns "" for an optional
+// string argument without constraints.
+func ArgSpec(schema *jsonschema.Schema, required bool) string {
+	var parts []string
+
+	switch {
+	case schema.Type == "array" && schema.Items != nil && schema.Items.Type != "":
+		parts = append(parts, schema.Items.Type+"[]")
+	case schema.Type != "" && schema.Type != "string":
+		parts = append(parts, schema.Type)
+	}
+	if required {
+		parts = append(parts, "required")
+	}
+
+	var low, high string
+	switch schema.Type {
+	case "integer", "number":
+		low, high = formatFloat(schema.Minimum), formatFloat(schema.Maximum)
+	case "string":
+		low, high = formatInt(schema.MinLength), formatInt(schema.MaxLength)
+	case "array":
+		low, high = formatInt(schema.MinItems), formatInt(schema.MaxItems)
+	}
+	if low != "" || high != "" {
+		parts = append(parts, low+".."+high)
+	}
+
+	if len(schema.Enum) > 0 {
+		var values []string
+		for _, value := range schema.Enum {
+			values = append(values, fmt.Sprint(value))
+		}
+		parts = append(parts, strings.Join(values, "|"))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// StrictSchema returns a copy of schema that providers can enforce in strict mode, which only accepts objects that
+// don't allow additional properties and that require all their properties. Properties that were optional can be null
+// instead.
+func StrictSchema(schema *jsonschema.Schema) *jsonschema.Schema {
+	result := schema.CloneSchemas()
+	strictSchema(result)
+	return result
+}
+
+func strictSchema(schema *jsonschema.Schema) {
+	if schema == nil {
+		return
+	}
+
+	if schema.Type == "object" || slices.Contains(schema.Types, "object") {
+		if schema.Properties == nil {
+			schema.Properties = map[string]*jsonschema.Schema{}
+		}
+		// A schema with not set to the empty schema is the false schema, which allows no additional properties.
+		schema.AdditionalProperties = &jsonschema.Schema{Not: &jsonschema.Schema{}}
+		for _, name := range slices.Sorted(maps.Keys(schema.Properties)) {
+			if slices.Contains(schema.Required, name) {
+				continue
+			}
+			schema.Required = append(schema.Required, name)
+			nullable(schema.Properties[name])
+		}
+	}
+
+	for _, property := range schema.Properties {
+		strictSchema(property)
+	}
+	for _, def := range schema.Defs {
+		strictSchema(def)
+	}
+	for _, def := range schema.Definitions {
+		strictSchema(def)
+	}
+	for _, sub := range slices.Concat(schema.PrefixItems, schema.AnyOf, schema.AllOf, schema.OneOf) {
+		strictSchema(sub)
+	}
+	strictSchema(schema.Items)
+}
+
+func nullable(schema *jsonschema.Schema) {
+	switch {
+	case schema == nil:
+	case schema.Type != "" && schema.Type != "null":
+		schema.Types = []string{schema.Type, "null"}
+		schema.Type = ""
+	case len(schema.Types) > 0 && !slices.Contains(schema.Types, "null"):
+		schema.Types = append(schema.Types, "null")
+	}
+	if schema != nil && len(schema.Enum) > 0 && !slices.Contains(schema.Enum, nil) {
+		schema.Enum = append(schema.Enum, nil)
+	}
+}
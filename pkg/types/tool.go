@@ -124,14 +124,19 @@ type Parameters struct {
 	Name                string             `json:"name,omitempty"`
 	Description         string             `json:"description,omitempty"`
 	MaxTokens           int                `json:"maxTokens,omitempty"`
+	MaxTokensTotal      int                `json:"maxTokensTotal,omitempty"`
+	MaxCost             float64            `json:"maxCost,omitempty"`
 	ModelName           string             `json:"modelName,omitempty"`
 	ModelProvider       bool               `json:"modelProvider,omitempty"`
 	JSONResponse        bool               `json:"jsonResponse,omitempty"`
 	Chat                bool               `json:"chat,omitempty"`
 	Temperature         *float32           `json:"temperature,omitempty"`
 	Cache               *bool              `json:"cache,omitempty"`
+	CacheKey            string             `json:"cacheKey,omitempty"`
 	InternalPrompt      *bool              `json:"internalPrompt"`
 	Arguments           *jsonschema.Schema `json:"arguments,omitempty"`
+	OutputSchema        *jsonschema.Schema `json:"outputSchema,omitempty"`
+	ContextCompaction   string             `json:"contextCompaction,omitempty"`
 	Tools               []string           `json:"tools,omitempty"`
 	GlobalTools         []string           `json:"globalTools,omitempty"`
 	GlobalModelName     string             `json:"globalModelName,omitempty"`
@@ -147,6 +152,8 @@ type Parameters struct {
 	ExportOutputFilters []string           `json:"exportOutputFilters,omitempty"`
 	Blocking            bool               `json:"-"`
 	Stdin               bool               `json:"stdin,omitempty"`
+	Sandbox             bool               `json:"sandbox,omitempty"`
+	Network             bool               `json:"network,omitempty"`
 	Type                ToolType           `json:"type,omitempty"`
 }
 
@@ -461,6 +468,12 @@ func (t ToolDef) Print() string {
 	if t.MaxTokens != 0 {
 		_, _ = fmt.Fprintf(buf, "Max Tokens: %d\n", t.MaxTokens)
 	}
+	if t.MaxTokensTotal != 0 {
+		_, _ = fmt.Fprintf(buf, "Max Tokens Total: %d\n", t.MaxTokensTotal)
+	}
+	if t.MaxCost != 0 {
+		_, _ = fmt.Fprintf(buf, "Max Cost: %v\n", t.MaxCost)
+	}
 	if t.ModelName != "" {
 		_, _ = fmt.Fprintf(buf, "Model: %s\n", t.ModelName)
 	}
@@ -470,12 +483,28 @@ func (t ToolDef) Print() string {
 	if t.JSONResponse {
 		_, _ = fmt.Fprintln(buf, "JSON Response: true")
 	}
+	if t.OutputSchema != nil {
+		schema, _ := json.Marshal(t.OutputSchema)
+		_, _ = fmt.Fprintf(buf, "Output Schema: %s\n", schema)
+	}
+	if t.ContextCompaction != "" {
+		_, _ = fmt.Fprintf(buf, "Context Compaction: %s\n", t.ContextCompaction)
+	}
 	if t.Cache != nil && !*t.Cache {
 		_, _ = fmt.Fprintln(buf, "Cache: false")
 	}
+	if t.CacheKey != "" {
+		_, _ = fmt.Fprintf(buf, "Cache Key: %s\n", t.CacheKey)
+	}
 	if t.Stdin {
 		_, _ = fmt.Fprintln(buf, "Stdin: true")
 	}
+	if t.Sandbox {
+		_, _ = fmt.Fprintln(buf, "Sandbox: true")
+	}
+	if t.Network {
+		_, _ = fmt.Fprintln(buf, "Network: true")
+	}
 	if t.Temperature != nil {
 		_, _ = fmt.Fprintf(buf, "Temperature: %f\n", *t.Temperature)
 	}
@@ -487,7 +516,11 @@ func (t ToolDef) Print() string {
 		sort.Strings(keys)
 		for _, key := range keys {
 			prop := t.Arguments.Properties[key]
-			_, _ = fmt.Fprintf(buf, "Parameter: %s: %s\n", key, prop.Description)
+			if spec := ArgSpec(prop, slices.Contains(t.Arguments.Required, key)); spec != "" {
+				_, _ = fmt.Fprintf(buf, "Parameter: %s (%s): %s\n", key, spec, prop.Description)
+			} else {
+				_, _ = fmt.Fprintf(buf, "Parameter: %s: %s\n", key, prop.Description)
+			}
 		}
 	}
 	if t.InternalPrompt != nil {
@@ -838,6 +871,9 @@ type Repo struct {
 	Name string
 	// The revision of this source
 	Revision string
+	// Manifest is the digest of the signed manifest of the repo if its signature was verified with a trusted key, in
+	// which case the checkout must match the manifest before anything in it runs.
+	Manifest string `json:",omitempty"`
 }
 
 type ToolSource struct {